@@ -0,0 +1,316 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core/domain/accesslog"
+)
+
+// accessLogKey is the gin context key holding the access log entry of a request.
+const accessLogKey = "access_log_entry"
+
+// accessLogBuffer is how many entries may wait for the sink before new
+// entries are dropped, so a slow sink never delays proxied requests.
+const accessLogBuffer = 1024
+
+// accessLogPruneEvery is how many entries the repository sink writes between
+// prunes of old rows.
+const accessLogPruneEvery = 1000
+
+// AccessLogSink receives access log entries. Writes are serialized by the
+// AccessLogger, so sinks need not be safe for concurrent use.
+type AccessLogSink interface {
+	Write(entry *accesslog.Entry) error
+	Close() error
+}
+
+// AccessLogConfig contains sampling settings for the access log.
+type AccessLogConfig struct {
+	SampleRate      float64 // Fraction of requests logged (0-1)
+	AlwaysLogErrors bool    // Log failed requests (5xx or routing error) regardless of sampling
+}
+
+// AccessLogger writes one entry per routed request to a sink. Entries are
+// written in the background; when the sink falls behind, entries are dropped.
+// A nil *AccessLogger is valid and logs nothing.
+type AccessLogger struct {
+	sink     AccessLogSink
+	cfg      AccessLogConfig
+	entries  chan *accesslog.Entry
+	dropped  atomic.Int64
+	mu       sync.Mutex // Serializes sink writes and guards running and stopped
+	running  bool
+	stopped  bool
+	stopChan chan struct{}
+	doneChan chan struct{} // Closed once Start has returned
+}
+
+// NewAccessLogger creates an access logger writing to the given sink.
+func NewAccessLogger(sink AccessLogSink, cfg AccessLogConfig) *AccessLogger {
+	return &AccessLogger{
+		sink:     sink,
+		cfg:      cfg,
+		entries:  make(chan *accesslog.Entry, accessLogBuffer),
+		stopChan: make(chan struct{}),
+		doneChan: make(chan struct{}),
+	}
+}
+
+// Start writes queued entries to the sink until Stop is called.
+// This method blocks, so it should be run in a separate goroutine.
+func (l *AccessLogger) Start() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	if l.stopped {
+		l.mu.Unlock()
+		return
+	}
+	l.running = true
+	l.mu.Unlock()
+	defer close(l.doneChan)
+
+	for {
+		select {
+		case entry := <-l.entries:
+			l.write(entry)
+		case <-l.stopChan:
+			return
+		}
+	}
+}
+
+// Stop stops the background writer and waits for it to return, then writes
+// the entries still queued and closes the sink.
+func (l *AccessLogger) Stop() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.stopped = true
+	running := l.running
+	l.mu.Unlock()
+
+	close(l.stopChan)
+	if running {
+		<-l.doneChan
+	}
+	for {
+		select {
+		case entry := <-l.entries:
+			l.write(entry)
+		default:
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if err := l.sink.Close(); err != nil {
+				log.Printf("Failed to close access log sink: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// Log queues an entry if it is sampled.
+func (l *AccessLogger) Log(entry *accesslog.Entry) {
+	if l == nil || !l.sampled(entry) {
+		return
+	}
+	select {
+	case l.entries <- entry:
+	default:
+		if l.dropped.Add(1)%accessLogBuffer == 1 {
+			log.Printf("Access log sink falling behind, %d entries dropped so far", l.dropped.Load())
+		}
+	}
+}
+
+// sampled decides whether an entry is logged.
+func (l *AccessLogger) sampled(entry *accesslog.Entry) bool {
+	if l.cfg.AlwaysLogErrors && (entry.Status >= 500 || entry.Error != "") {
+		return true
+	}
+	return l.cfg.SampleRate >= 1 || rand.Float64() < l.cfg.SampleRate
+}
+
+func (l *AccessLogger) write(entry *accesslog.Entry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.sink.Write(entry); err != nil {
+		log.Printf("Failed to write access log entry: %v", err)
+	}
+}
+
+// StartAccessLogEntry attaches a new access log entry to the request. The
+// routing service fills in the service, instance and upstream details.
+func StartAccessLogEntry(c *gin.Context) *accesslog.Entry {
+	entry := &accesslog.Entry{}
+	c.Set(accessLogKey, entry)
+	return entry
+}
+
+// accessLogEntry returns the access log entry of the request, or nil if the
+// request is not access logged.
+func accessLogEntry(c *gin.Context) *accesslog.Entry {
+	value, exists := c.Get(accessLogKey)
+	if !exists {
+		return nil
+	}
+	entry, _ := value.(*accesslog.Entry)
+	return entry
+}
+
+// NewWriterSink creates a sink writing one JSON line per entry, e.g. to stdout.
+func NewWriterSink(w io.Writer) AccessLogSink {
+	return &writerSink{encoder: json.NewEncoder(w)}
+}
+
+type writerSink struct {
+	encoder *json.Encoder
+}
+
+func (s *writerSink) Write(entry *accesslog.Entry) error {
+	return s.encoder.Encode(entry)
+}
+
+func (s *writerSink) Close() error {
+	return nil
+}
+
+// NewFileSink creates a sink appending JSON lines to a file. Once the file
+// reaches maxBytes it is rotated to path.1 (path.1 to path.2, and so on),
+// keeping at most maxBackups old files.
+func NewFileSink(path string, maxBytes int64, maxBackups int) (AccessLogSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Printf("Failed to create access log directory: %v", err)
+		return nil, errors.New("failed to create access log directory")
+	}
+	sink := &fileSink{path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := sink.open(); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+type fileSink struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func (s *fileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		log.Printf("Failed to open access log file %s: %v", s.path, err)
+		return errors.New("failed to open access log file")
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		log.Printf("Failed to stat access log file %s: %v", s.path, err)
+		return errors.New("failed to open access log file")
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+func (s *fileSink) Write(entry *accesslog.Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	// A failed rotation left no file open; try again
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	if s.size > 0 && s.size+int64(len(line)) > s.maxBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// rotate shifts the backups up by one, moves the current file to path.1 and
+// starts a new file. If the new file cannot be opened, the next write
+// retries.
+func (s *fileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		log.Printf("Failed to close access log file: %v", err)
+	}
+	s.file = nil
+
+	if s.maxBackups < 1 {
+		os.Remove(s.path)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", s.path, s.maxBackups))
+		for i := s.maxBackups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+		}
+		if err := os.Rename(s.path, s.path+".1"); err != nil {
+			log.Printf("Failed to rotate access log file: %v", err)
+		}
+	}
+
+	return s.open()
+}
+
+func (s *fileSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// NewRepositorySink creates a sink storing entries in the access_logs table.
+// Older rows are pruned so that about maxRows are kept (0: no limit).
+func NewRepositorySink(repo *accesslog.Repository, maxRows int) AccessLogSink {
+	return &repositorySink{repo: repo, maxRows: maxRows, pruneEvery: accessLogPruneEvery}
+}
+
+type repositorySink struct {
+	repo       *accesslog.Repository
+	maxRows    int
+	pruneEvery int
+	writes     int
+}
+
+func (s *repositorySink) Write(entry *accesslog.Entry) error {
+	if err := s.repo.Create(entry); err != nil {
+		return err
+	}
+
+	// Pruning on every write would cost a delete per request
+	if s.maxRows > 0 && s.writes%s.pruneEvery == 0 {
+		if err := s.repo.Prune(s.maxRows); err != nil {
+			log.Printf("Failed to prune access logs: %v", err)
+		}
+	}
+	s.writes++
+	return nil
+}
+
+func (s *repositorySink) Close() error {
+	return nil
+}
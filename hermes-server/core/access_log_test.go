@@ -0,0 +1,237 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core/domain/accesslog"
+)
+
+// memorySink collects access log entries for tests
+type memorySink struct {
+	entries []*accesslog.Entry
+}
+
+func (s *memorySink) Write(entry *accesslog.Entry) error {
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	return nil
+}
+
+func TestAccessLogger_Sampling(t *testing.T) {
+	sink := &memorySink{}
+	logger := NewAccessLogger(sink, AccessLogConfig{SampleRate: 0, AlwaysLogErrors: true})
+
+	logger.Log(&accesslog.Entry{Path: "/ok", Status: http.StatusOK})
+	logger.Log(&accesslog.Entry{Path: "/down", Status: http.StatusServiceUnavailable})
+	logger.Log(&accesslog.Entry{Path: "/refused", Status: http.StatusServiceUnavailable, Error: "no healthy instances available"})
+	logger.Stop()
+
+	if len(sink.entries) != 2 || sink.entries[0].Path != "/down" || sink.entries[1].Path != "/refused" {
+		t.Errorf("Expected only failed requests to be logged at sample rate 0, got %+v", sink.entries)
+	}
+}
+
+// blockingSink holds its first write until released and counts writes made
+// after it was closed
+type blockingSink struct {
+	memorySink
+	writing    chan struct{}
+	release    chan struct{}
+	closed     bool
+	lateWrites int
+}
+
+func (s *blockingSink) Write(entry *accesslog.Entry) error {
+	if len(s.entries) == 0 {
+		close(s.writing)
+		<-s.release
+	}
+	if s.closed {
+		s.lateWrites++
+	}
+	return s.memorySink.Write(entry)
+}
+
+func (s *blockingSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestAccessLogger_StopWaitsForWriter(t *testing.T) {
+	sink := &blockingSink{writing: make(chan struct{}), release: make(chan struct{})}
+	logger := NewAccessLogger(sink, AccessLogConfig{SampleRate: 1})
+	go logger.Start()
+
+	logger.Log(&accesslog.Entry{Path: "/first", Status: http.StatusOK})
+	<-sink.writing
+
+	// An entry logged while stopping is written before the sink is closed
+	stopped := make(chan struct{})
+	go func() {
+		logger.Stop()
+		close(stopped)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	logger.Log(&accesslog.Entry{Path: "/second", Status: http.StatusOK})
+	close(sink.release)
+	<-stopped
+
+	if len(sink.entries) != 2 || sink.lateWrites != 0 {
+		t.Errorf("Expected 2 entries written before the sink was closed, got %d (%d after closing)", len(sink.entries), sink.lateWrites)
+	}
+}
+
+func TestWriterSink_JSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewWriterSink(&buf)
+	sink.Write(&accesslog.Entry{Method: "GET", Path: "/a", Service: "api", Status: 200})
+	sink.Write(&accesslog.Entry{Method: "POST", Path: "/b", Service: "api", Status: 201})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d: %q", len(lines), buf.String())
+	}
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatalf("Expected JSON line, got %q: %v", lines[1], err)
+	}
+	if entry["method"] != "POST" || entry["service"] != "api" || entry["status"] != float64(201) {
+		t.Errorf("Unexpected entry: %v", entry)
+	}
+}
+
+func TestFileSink_Rotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "access.log")
+	sink, err := NewFileSink(path, 200, 2)
+	if err != nil {
+		t.Fatalf("Failed to create file sink: %v", err)
+	}
+
+	// Each entry is over 100 bytes, so every second write rotates
+	for i := 0; i < 8; i++ {
+		if err := sink.Write(&accesslog.Entry{Method: "GET", Path: "/orders", Service: "orders", Status: 200}); err != nil {
+			t.Fatalf("Failed to write entry: %v", err)
+		}
+	}
+	sink.Close()
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("Expected %s to exist: %v", name, err)
+		}
+		if info.Size() > 200 {
+			t.Errorf("Expected %s to stay under the size limit, got %d bytes", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("Expected at most 2 backups to be kept")
+	}
+}
+
+func TestFileSink_ReopensAfterFailedRotation(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	path := filepath.Join(dir, "access.log")
+	sink, err := NewFileSink(path, 200, 2)
+	if err != nil {
+		t.Fatalf("Failed to create file sink: %v", err)
+	}
+	defer sink.Close()
+	entry := &accesslog.Entry{Method: "GET", Path: "/orders", Service: "orders", Status: 200}
+	sink.Write(entry)
+
+	// With the directory gone, the rotated file cannot be created
+	os.RemoveAll(dir)
+	if err := sink.Write(entry); err == nil {
+		t.Fatal("Expected the rotation to fail")
+	}
+
+	os.MkdirAll(dir, 0755)
+	if err := sink.Write(entry); err != nil {
+		t.Fatalf("Expected the file to be reopened, got %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+		t.Errorf("Expected the entry to be written to a new file, got %v", err)
+	}
+}
+
+func TestRepositorySink_Prunes(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	repo := accesslog.NewRepository(db)
+
+	sink := NewRepositorySink(repo, 3)
+	sink.(*repositorySink).pruneEvery = 1
+	for i := 0; i < 6; i++ {
+		if err := sink.Write(&accesslog.Entry{Method: "GET", Path: "/" + strconv.Itoa(i), Service: "api", Status: 200}); err != nil {
+			t.Fatalf("Failed to write entry: %v", err)
+		}
+	}
+
+	entries, err := repo.GetRecent(10)
+	if err != nil {
+		t.Fatalf("Failed to read access logs: %v", err)
+	}
+	if len(entries) != 3 || entries[0].Path != "/5" || entries[2].Path != "/3" {
+		t.Errorf("Expected the 3 latest entries to be kept, got %+v", entries)
+	}
+}
+
+func TestRepositorySink(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	repo := accesslog.NewRepository(db)
+
+	sink := NewRepositorySink(repo, 0)
+	if err := sink.Write(&accesslog.Entry{Method: "GET", Path: "/a", Service: "api", Status: 502, UpstreamStatus: 502, Error: "backend failed"}); err != nil {
+		t.Fatalf("Failed to write entry: %v", err)
+	}
+
+	entries, err := repo.GetRecent(10)
+	if err != nil {
+		t.Fatalf("Failed to read access logs: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Service != "api" || entries[0].UpstreamStatus != 502 || entries[0].Error != "backend failed" {
+		t.Errorf("Unexpected access log entries: %+v", entries)
+	}
+}
+
+func TestRoutingService_FillsAccessLogEntry(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+
+	var hits int32
+	backend := newCountingBackend(http.StatusCreated, &hits)
+	defer backend.Close()
+	svc := registerTestBackend(t, reg, "api", backend)
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/hermes/route/api/", nil)
+	entry := StartAccessLogEntry(c)
+
+	if err := newTestRoutingService(reg).RouteToService(c, "api", "/"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if entry.Service != "api" || entry.InstanceID != svc.ID || entry.UpstreamStatus != http.StatusCreated {
+		t.Errorf("Expected service, instance and upstream status in entry, got %+v", entry)
+	}
+	if entry.UpstreamLatencyMs <= 0 {
+		t.Errorf("Expected upstream latency to be recorded, got %v", entry.UpstreamLatencyMs)
+	}
+}
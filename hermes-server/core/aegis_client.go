@@ -16,6 +16,11 @@ import (
 type AegisClient struct {
 	baseURL    string
 	httpClient *http.Client
+	metrics    *Metrics
+	jwks       *JWKS       // Keys for local JWT validation, nil to always ask Aegis
+	issuer     string      // Required iss claim of local JWTs, empty to skip
+	audience   string      // Required aud claim of local JWTs, empty to skip
+	cache      *TokenCache // Cache of Aegis results, nil to disable
 }
 
 // ValidateTokenRequest represents a token validation request sent to Aegis.
@@ -52,10 +57,70 @@ func NewAegisClient(baseURL string, timeout time.Duration) *AegisClient {
 	}
 }
 
-// ValidateToken calls Aegis to validate a JWT token.
-// Returns the validation response containing user information if valid,
-// or an error if the request fails or the token is invalid.
+// SetMetrics makes the client record the latency and outcome of token validations.
+func (c *AegisClient) SetMetrics(m *Metrics) {
+	c.metrics = m
+}
+
+// SetJWKS makes the client verify JWTs signed with a key from the JWKS
+// locally. Tokens that cannot be verified locally are still sent to Aegis.
+// A non-empty issuer or audience must match the token's iss or aud claim.
+func (c *AegisClient) SetJWKS(jwks *JWKS, issuer, audience string) {
+	c.jwks = jwks
+	c.issuer = issuer
+	c.audience = audience
+}
+
+// SetTokenCache makes the client reuse Aegis validation results.
+func (c *AegisClient) SetTokenCache(cache *TokenCache) {
+	c.cache = cache
+}
+
+// ValidateToken validates a token. JWTs signed with a JWKS key are verified
+// locally; other tokens are looked up in the result cache and, on a miss,
+// sent to Aegis. Returns the validation response containing user information
+// if valid, or an error if Aegis could not be reached.
 func (c *AegisClient) ValidateToken(token string) (*ValidateTokenResponse, error) {
+	if c.jwks != nil {
+		if result, ok := verifyJWT(token, c.jwks, c.issuer, c.audience); ok {
+			c.metrics.ObserveTokenValidation("jwks", validationOutcome(result, nil))
+			return result, nil
+		}
+	}
+	if c.cache != nil {
+		if result, ok := c.cache.Get(token); ok {
+			c.metrics.ObserveTokenValidation("cache", validationOutcome(result, nil))
+			return result, nil
+		}
+	}
+
+	start := time.Now()
+	result, err := c.validateToken(token)
+	outcome := validationOutcome(result, err)
+	c.metrics.ObserveAegisValidation(outcome, time.Since(start))
+	c.metrics.ObserveTokenValidation("aegis", outcome)
+
+	// Errors are not cached so that an Aegis outage is not remembered
+	if err == nil && c.cache != nil {
+		c.cache.Put(token, result)
+	}
+	return result, err
+}
+
+// validationOutcome names the outcome of a validation for metrics.
+func validationOutcome(result *ValidateTokenResponse, err error) string {
+
+	if err != nil {
+		return "error"
+	}
+	if !result.Valid {
+		return "invalid"
+	}
+	return "valid"
+}
+
+// validateToken performs the validation call to Aegis.
+func (c *AegisClient) validateToken(token string) (*ValidateTokenResponse, error) {
 	reqBody := ValidateTokenRequest{Token: token}
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
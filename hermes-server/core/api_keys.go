@@ -0,0 +1,127 @@
+package core
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"nfcunha/hermes/hermes-server/core/domain/apikey"
+)
+
+// apiKeyPrefix marks API key secrets.
+const apiKeyPrefix = "hak_"
+
+// apiKeyTouchInterval limits how often the last use of a key is written, so
+// that busy keys do not cause a database write per request.
+const apiKeyTouchInterval = time.Minute
+
+// APIKeys issues and checks gateway-managed API keys for machine clients.
+// A key carries fixed roles and permissions, which are applied like those of
+// an Aegis user. Keys are sent in a configurable header (e.g. X-API-Key).
+// A nil *APIKeys disables API key authentication.
+type APIKeys struct {
+	repo   *apikey.Repository
+	header string
+}
+
+// NewAPIKeys creates the API key service reading keys from the given header.
+func NewAPIKeys(repo *apikey.Repository, header string) *APIKeys {
+	return &APIKeys{repo: repo, header: header}
+}
+
+// Header returns the request header carrying API keys, or "" if API keys
+// are disabled.
+func (ak *APIKeys) Header() string {
+	if ak == nil {
+		return ""
+	}
+	return ak.header
+}
+
+// Issue creates a key with the given roles and permissions. A nil expiresAt
+// creates a key that does not expire. Returns the secret, which is only
+// available at this point.
+func (ak *APIKeys) Issue(name string, roles, permissions []string, expiresAt *time.Time) (string, *apikey.Key, error) {
+	if name == "" {
+		return "", nil, errors.New("name is required")
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", nil, errors.New("expiry must be in the future")
+	}
+	if roles == nil {
+		roles = []string{}
+	}
+	if permissions == nil {
+		permissions = []string{}
+	}
+
+	secret, err := newSecret(apiKeyPrefix)
+	if err != nil {
+		return "", nil, errors.New("failed to generate key")
+	}
+
+	key := &apikey.Key{
+		ID:          uuid.NewString(),
+		Name:        name,
+		Roles:       roles,
+		Permissions: permissions,
+		CreatedAt:   time.Now().UTC(),
+		ExpiresAt:   expiresAt,
+	}
+	if err := ak.repo.Create(key, hashSecret(secret)); err != nil {
+		log.Printf("Failed to store API key: %v", err)
+		return "", nil, errors.New("failed to store key")
+	}
+
+	log.Printf("API key issued: %s (%s) with roles %v", key.Name, key.ID, roles)
+	return secret, key, nil
+}
+
+// List returns all API keys, without their secrets.
+func (ak *APIKeys) List() ([]apikey.Key, error) {
+	keys, err := ak.repo.List()
+	if err != nil {
+		log.Printf("Failed to list API keys: %v", err)
+		return nil, errors.New("failed to list keys")
+	}
+	return keys, nil
+}
+
+// Revoke deletes an API key.
+func (ak *APIKeys) Revoke(id string) error {
+	if err := ak.repo.Delete(id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("key not found")
+		}
+		log.Printf("Failed to revoke API key %s: %v", id, err)
+		return errors.New("failed to revoke key")
+	}
+
+	log.Printf("API key revoked: %s", id)
+	return nil
+}
+
+// Authenticate returns the key matching the secret. Unknown, revoked and
+// expired keys are rejected with "invalid API key".
+func (ak *APIKeys) Authenticate(secret string) (*apikey.Key, error) {
+	key, err := ak.repo.GetByHash(hashSecret(secret))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to look up API key: %v", err)
+		}
+		return nil, errors.New("invalid API key")
+	}
+
+	now := time.Now()
+	if key.Expired(now) {
+		return nil, errors.New("invalid API key")
+	}
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		if err := ak.repo.TouchLastUsed(key.ID, now.UTC()); err != nil {
+			log.Printf("Warning: failed to record use of API key %s: %v", key.ID, err)
+		}
+	}
+	return key, nil
+}
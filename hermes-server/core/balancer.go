@@ -0,0 +1,252 @@
+package core
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core/domain/service"
+)
+
+// Metadata keys read from service registrations to configure load balancing.
+const (
+	// MetadataBalancer selects the load-balancing strategy for a service name.
+	MetadataBalancer = "lb_strategy"
+	// MetadataWeight sets the relative weight of an instance (weighted round-robin).
+	MetadataWeight = "lb_weight"
+	// MetadataHashKey selects what the consistent-hash strategy hashes on.
+	// Accepted values: "ip" (default), "header:<name>", "cookie:<name>".
+	MetadataHashKey = "lb_hash_key"
+)
+
+// Supported load-balancing strategies.
+const (
+	StrategyRoundRobin         = "round_robin"
+	StrategyWeightedRoundRobin = "weighted_round_robin"
+	StrategyLeastRequests      = "least_requests"
+	StrategyRandomTwoChoices   = "random_two_choices"
+	StrategyConsistentHash     = "consistent_hash"
+)
+
+// Balancer selects one instance out of a set of candidate instances.
+// Implementations must be safe for concurrent use.
+type Balancer interface {
+	// Pick returns the instance that should receive the request.
+	// The instances slice is never empty.
+	Pick(c *gin.Context, instances []*service.Service) *service.Service
+}
+
+// NewBalancer creates a balancer for the given strategy name.
+// Unknown or empty strategies fall back to round-robin.
+// The in-flight tracker is used by strategies that balance on outstanding requests.
+func NewBalancer(strategy string, hashKey string, inflight *InFlightTracker) Balancer {
+	switch strategy {
+	case StrategyWeightedRoundRobin:
+		return &weightedRoundRobinBalancer{current: make(map[string]int)}
+	case StrategyLeastRequests:
+		return &leastRequestsBalancer{inflight: inflight}
+	case StrategyRandomTwoChoices:
+		return &randomTwoChoicesBalancer{inflight: inflight}
+	case StrategyConsistentHash:
+		return &consistentHashBalancer{key: hashKey}
+	default:
+		return &roundRobinBalancer{}
+	}
+}
+
+// IsValidStrategy reports whether the strategy name is a known balancer.
+// An empty strategy is valid and means the default (round-robin).
+func IsValidStrategy(strategy string) bool {
+	switch strategy {
+	case "", StrategyRoundRobin, StrategyWeightedRoundRobin, StrategyLeastRequests,
+		StrategyRandomTwoChoices, StrategyConsistentHash:
+		return true
+	}
+	return false
+}
+
+// InFlightTracker counts outstanding requests per service instance.
+type InFlightTracker struct {
+	counts sync.Map // Key: instance ID, value: *int64
+}
+
+// NewInFlightTracker creates an empty in-flight tracker.
+func NewInFlightTracker() *InFlightTracker {
+	return &InFlightTracker{}
+}
+
+// Acquire increments the in-flight count for an instance.
+func (t *InFlightTracker) Acquire(id string) {
+	atomic.AddInt64(t.counter(id), 1)
+}
+
+// Release decrements the in-flight count for an instance. Requests released
+// after their instance was forgotten leave no count behind.
+func (t *InFlightTracker) Release(id string) {
+	if v, ok := t.counts.Load(id); ok {
+		atomic.AddInt64(v.(*int64), -1)
+	}
+}
+
+// Count returns the current in-flight count for an instance.
+func (t *InFlightTracker) Count(id string) int64 {
+	if v, ok := t.counts.Load(id); ok {
+		return atomic.LoadInt64(v.(*int64))
+	}
+	return 0
+}
+
+// Forget drops the in-flight count of an instance, e.g. once it is
+// deregistered.
+func (t *InFlightTracker) Forget(svc *service.Service) {
+	t.counts.Delete(svc.ID)
+}
+
+func (t *InFlightTracker) counter(id string) *int64 {
+	v, _ := t.counts.LoadOrStore(id, new(int64))
+	return v.(*int64)
+}
+
+// roundRobinBalancer cycles through instances in order.
+type roundRobinBalancer struct {
+	next uint64
+}
+
+func (b *roundRobinBalancer) Pick(c *gin.Context, instances []*service.Service) *service.Service {
+	n := atomic.AddUint64(&b.next, 1) - 1
+	return instances[n%uint64(len(instances))]
+}
+
+// weightedRoundRobinBalancer implements smooth weighted round-robin.
+// Each instance's weight is read from its MetadataWeight entry (default 1).
+type weightedRoundRobinBalancer struct {
+	mu      sync.Mutex
+	current map[string]int // Key: instance ID
+}
+
+func (b *weightedRoundRobinBalancer) Pick(c *gin.Context, instances []*service.Service) *service.Service {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	total := 0
+	var best *service.Service
+	for _, svc := range instances {
+		weight := instanceWeight(svc)
+		total += weight
+		b.current[svc.ID] += weight
+		if best == nil || b.current[svc.ID] > b.current[best.ID] {
+			best = svc
+		}
+	}
+	b.current[best.ID] -= total
+
+	// Forget instances that are no longer candidates
+	if len(b.current) > len(instances) {
+		present := make(map[string]bool, len(instances))
+		for _, svc := range instances {
+			present[svc.ID] = true
+		}
+		for id := range b.current {
+			if !present[id] {
+				delete(b.current, id)
+			}
+		}
+	}
+
+	return best
+}
+
+// instanceWeight returns the configured weight of an instance, defaulting to 1.
+func instanceWeight(svc *service.Service) int {
+	if val, ok := svc.Metadata[MetadataWeight]; ok {
+		if weight, err := strconv.Atoi(val); err == nil && weight > 0 {
+			return weight
+		}
+	}
+	return 1
+}
+
+// leastRequestsBalancer picks the instance with the fewest outstanding requests.
+// Ties are broken by position so that idle instances are used in order.
+type leastRequestsBalancer struct {
+	inflight *InFlightTracker
+}
+
+func (b *leastRequestsBalancer) Pick(c *gin.Context, instances []*service.Service) *service.Service {
+	best := instances[0]
+	bestCount := b.inflight.Count(best.ID)
+	for _, svc := range instances[1:] {
+		if count := b.inflight.Count(svc.ID); count < bestCount {
+			best, bestCount = svc, count
+		}
+	}
+	return best
+}
+
+// randomTwoChoicesBalancer samples two random instances and picks the one
+// with fewer outstanding requests ("power of two choices").
+type randomTwoChoicesBalancer struct {
+	inflight *InFlightTracker
+}
+
+func (b *randomTwoChoicesBalancer) Pick(c *gin.Context, instances []*service.Service) *service.Service {
+	if len(instances) == 1 {
+		return instances[0]
+	}
+
+	i := rand.Intn(len(instances))
+	j := rand.Intn(len(instances) - 1)
+	if j >= i {
+		j++
+	}
+
+	first, second := instances[i], instances[j]
+	if b.inflight.Count(second.ID) < b.inflight.Count(first.ID) {
+		return second
+	}
+	return first
+}
+
+// consistentHashBalancer maps a request key onto an instance using
+// rendezvous (highest random weight) hashing, so that only the keys owned
+// by an instance move when that instance joins or leaves.
+type consistentHashBalancer struct {
+	key string // "ip", "header:<name>" or "cookie:<name>"
+}
+
+func (b *consistentHashBalancer) Pick(c *gin.Context, instances []*service.Service) *service.Service {
+	key := b.requestKey(c)
+
+	var best *service.Service
+	var bestScore uint64
+	for _, svc := range instances {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write([]byte(svc.ID))
+		if score := h.Sum64(); best == nil || score > bestScore {
+			best, bestScore = svc, score
+		}
+	}
+	return best
+}
+
+// requestKey extracts the hash key from the request.
+// Falls back to the client IP when the configured header or cookie is absent.
+func (b *consistentHashBalancer) requestKey(c *gin.Context) string {
+	switch {
+	case strings.HasPrefix(b.key, "header:"):
+		if val := c.GetHeader(strings.TrimPrefix(b.key, "header:")); val != "" {
+			return val
+		}
+	case strings.HasPrefix(b.key, "cookie:"):
+		if val, err := c.Cookie(strings.TrimPrefix(b.key, "cookie:")); err == nil && val != "" {
+			return val
+		}
+	}
+	return c.ClientIP()
+}
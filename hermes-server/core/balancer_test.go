@@ -0,0 +1,209 @@
+package core
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core/domain/service"
+)
+
+// newTestContext creates a gin context wrapping a GET request
+func newTestContext(t *testing.T) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	return c
+}
+
+// newTestInstances creates n instances of the same service
+func newTestInstances(n int) []*service.Service {
+	instances := make([]*service.Service, n)
+	for i := range instances {
+		instances[i] = service.NewService("api", "localhost", 8080+i, "/health")
+	}
+	return instances
+}
+
+func TestNewBalancer_DefaultsToRoundRobin(t *testing.T) {
+	if _, ok := NewBalancer("", "", NewInFlightTracker()).(*roundRobinBalancer); !ok {
+		t.Error("Expected empty strategy to create a round-robin balancer")
+	}
+	if _, ok := NewBalancer("unknown", "", NewInFlightTracker()).(*roundRobinBalancer); !ok {
+		t.Error("Expected unknown strategy to create a round-robin balancer")
+	}
+}
+
+func TestRoundRobinBalancer_Cycles(t *testing.T) {
+	c := newTestContext(t)
+	instances := newTestInstances(3)
+	b := NewBalancer(StrategyRoundRobin, "", NewInFlightTracker())
+
+	for round := 0; round < 2; round++ {
+		for i, expected := range instances {
+			if got := b.Pick(c, instances); got.ID != expected.ID {
+				t.Errorf("Round %d pick %d: expected %s, got %s", round, i, expected.ID, got.ID)
+			}
+		}
+	}
+}
+
+func TestWeightedRoundRobinBalancer_RespectsWeights(t *testing.T) {
+	c := newTestContext(t)
+	instances := newTestInstances(2)
+	instances[0].Metadata[MetadataWeight] = "3"
+	instances[1].Metadata[MetadataWeight] = "1"
+	b := NewBalancer(StrategyWeightedRoundRobin, "", NewInFlightTracker())
+
+	counts := make(map[string]int)
+	for i := 0; i < 40; i++ {
+		counts[b.Pick(c, instances).ID]++
+	}
+
+	if counts[instances[0].ID] != 30 || counts[instances[1].ID] != 10 {
+		t.Errorf("Expected 30/10 split, got %d/%d", counts[instances[0].ID], counts[instances[1].ID])
+	}
+}
+
+func TestLeastRequestsBalancer_PicksIdlest(t *testing.T) {
+	c := newTestContext(t)
+	instances := newTestInstances(3)
+	inflight := NewInFlightTracker()
+	inflight.Acquire(instances[0].ID)
+	inflight.Acquire(instances[0].ID)
+	inflight.Acquire(instances[2].ID)
+
+	b := NewBalancer(StrategyLeastRequests, "", inflight)
+	if got := b.Pick(c, instances); got.ID != instances[1].ID {
+		t.Errorf("Expected idle instance %s, got %s", instances[1].ID, got.ID)
+	}
+
+	inflight.Acquire(instances[1].ID)
+	inflight.Acquire(instances[1].ID)
+	inflight.Release(instances[2].ID)
+	if got := b.Pick(c, instances); got.ID != instances[2].ID {
+		t.Errorf("Expected idle instance %s, got %s", instances[2].ID, got.ID)
+	}
+}
+
+func TestInFlightTracker_ForgetsDeregisteredInstances(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+	inflight := NewInFlightTracker()
+	reg.OnDeregister(inflight.Forget)
+
+	svc := service.NewService("api", "localhost", 8080, "/health")
+	reg.Register(svc)
+	inflight.Acquire(svc.ID)
+
+	reg.Deregister(svc.ID)
+	inflight.Release(svc.ID)
+	if _, exists := inflight.counts.Load(svc.ID); exists {
+		t.Error("Expected the count of a deregistered instance to be dropped")
+	}
+}
+
+func TestRandomTwoChoicesBalancer_AvoidsBusyInstance(t *testing.T) {
+	c := newTestContext(t)
+	instances := newTestInstances(2)
+	inflight := NewInFlightTracker()
+	inflight.Acquire(instances[0].ID)
+
+	b := NewBalancer(StrategyRandomTwoChoices, "", inflight)
+	for i := 0; i < 20; i++ {
+		if got := b.Pick(c, instances); got.ID != instances[1].ID {
+			t.Fatalf("Expected less loaded instance %s, got %s", instances[1].ID, got.ID)
+		}
+	}
+}
+
+func TestConsistentHashBalancer_StickyByHeader(t *testing.T) {
+	instances := newTestInstances(5)
+	b := NewBalancer(StrategyConsistentHash, "header:X-User-ID", NewInFlightTracker())
+
+	c := newTestContext(t)
+	c.Request.Header.Set("X-User-ID", "user-42")
+	first := b.Pick(c, instances)
+	for i := 0; i < 10; i++ {
+		if got := b.Pick(c, instances); got.ID != first.ID {
+			t.Fatalf("Expected sticky instance %s, got %s", first.ID, got.ID)
+		}
+	}
+
+	// Removing a different instance must not move the key
+	remaining := make([]*service.Service, 0, len(instances)-1)
+	removed := false
+	for _, svc := range instances {
+		if !removed && svc.ID != first.ID {
+			removed = true
+			continue
+		}
+		remaining = append(remaining, svc)
+	}
+	if got := b.Pick(c, remaining); got.ID != first.ID {
+		t.Errorf("Expected key to stay on %s after unrelated removal, got %s", first.ID, got.ID)
+	}
+}
+
+func TestConsistentHashBalancer_StickyByCookie(t *testing.T) {
+	instances := newTestInstances(5)
+	b := NewBalancer(StrategyConsistentHash, "cookie:session", NewInFlightTracker())
+
+	c := newTestContext(t)
+	c.Request.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+	first := b.Pick(c, instances)
+	for i := 0; i < 10; i++ {
+		if got := b.Pick(c, instances); got.ID != first.ID {
+			t.Fatalf("Expected sticky instance %s, got %s", first.ID, got.ID)
+		}
+	}
+}
+
+func TestRoutingService_BalancerFromMetadata(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	reg := NewServiceRegistry(db)
+	routing := newTestRoutingService(reg)
+	c := newTestContext(t)
+
+	instances := newTestInstances(2)
+	if _, ok := routing.balancerFor(c, "api", instances).(*roundRobinBalancer); !ok {
+		t.Error("Expected round-robin balancer by default")
+	}
+
+	instances[1].Metadata[MetadataBalancer] = StrategyLeastRequests
+	if _, ok := routing.balancerFor(c, "api", instances).(*leastRequestsBalancer); !ok {
+		t.Error("Expected least-requests balancer from metadata")
+	}
+}
+
+func TestRoutingService_UnknownStrategyLoggedOnRebuild(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	routing := newTestRoutingService(nil)
+	c := newTestContext(t)
+	instances := newTestInstances(1)
+	instances[0].Metadata[MetadataBalancer] = "fastest"
+
+	first := routing.balancerFor(c, "api", instances)
+	if _, ok := first.(*roundRobinBalancer); !ok {
+		t.Fatalf("Expected an unknown strategy to fall back to round-robin, got %T", first)
+	}
+	for i := 0; i < 3; i++ {
+		if routing.balancerFor(c, "api", instances) != first {
+			t.Fatal("Expected the balancer to be reused")
+		}
+	}
+	if n := strings.Count(logs.String(), "Unknown balancer strategy"); n != 1 {
+		t.Errorf("Expected the unknown strategy to be logged once, got %d times", n)
+	}
+}
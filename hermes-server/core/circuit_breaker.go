@@ -0,0 +1,219 @@
+package core
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"nfcunha/hermes/hermes-server/core/domain/service"
+)
+
+// Metadata keys read from service registrations to override circuit breaker settings.
+const (
+	// MetadataBreakerFailureThreshold sets consecutive failures that open the breaker.
+	MetadataBreakerFailureThreshold = "cb_failure_threshold"
+	// MetadataBreakerOpenDuration sets how long the breaker stays open (e.g. "30s").
+	MetadataBreakerOpenDuration = "cb_open_duration"
+	// MetadataBreakerHalfOpenRequests sets how many trial requests a half-open breaker admits.
+	MetadataBreakerHalfOpenRequests = "cb_half_open_requests"
+)
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState string
+
+const (
+	// BreakerClosed lets all traffic through.
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen rejects all traffic until the open duration has passed.
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen lets a limited number of trial requests through.
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+// BreakerConfig holds circuit breaker thresholds.
+type BreakerConfig struct {
+	FailureThreshold int           // Consecutive failures that open the breaker
+	OpenDuration     time.Duration // Time spent open before trial requests are allowed
+	HalfOpenRequests int           // Concurrent trial requests allowed while half-open
+}
+
+// BreakerSnapshot is a point-in-time view of an instance's circuit breaker.
+type BreakerSnapshot struct {
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	OpenedAt            *time.Time   `json:"opened_at,omitempty"`
+}
+
+// CircuitBreaker tracks live proxy outcomes per service instance and stops
+// routing to instances that keep failing (5xx responses, connection errors
+// or timeouts), without waiting for the next active health check.
+type CircuitBreaker struct {
+	defaults BreakerConfig
+	breakers map[string]*instanceBreaker // Key: instance ID
+	mu       sync.Mutex
+}
+
+// instanceBreaker holds the breaker state of a single instance.
+type instanceBreaker struct {
+	state               BreakerState
+	consecutiveFailures int
+	openedAt            time.Time
+	trials              int // Trial requests in flight while half-open
+}
+
+// NewCircuitBreaker creates a circuit breaker registry with default thresholds.
+// Individual services may override them through registration metadata.
+func NewCircuitBreaker(defaults BreakerConfig) *CircuitBreaker {
+	return &CircuitBreaker{
+		defaults: defaults,
+		breakers: make(map[string]*instanceBreaker),
+	}
+}
+
+// Available reports whether an instance may currently be selected for a request.
+// It does not change the breaker state: Admit makes the final decision.
+func (b *CircuitBreaker) Available(svc *service.Service) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	br, exists := b.breakers[svc.ID]
+	if !exists {
+		return true
+	}
+
+	cfg := b.configFor(svc)
+	switch br.state {
+	case BreakerOpen:
+		return time.Since(br.openedAt) >= cfg.OpenDuration
+	case BreakerHalfOpen:
+		return br.trials < cfg.HalfOpenRequests
+	default:
+		return true
+	}
+}
+
+// Admit decides whether a request may be sent to an instance and, if so,
+// records that it is being sent. An open breaker whose open duration has
+// passed becomes half-open, and a half-open breaker admits requests as trial
+// requests up to its limit. Every admitted request must be reported with Record.
+func (b *CircuitBreaker) Admit(svc *service.Service) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	br, exists := b.breakers[svc.ID]
+	if !exists {
+		return true
+	}
+
+	cfg := b.configFor(svc)
+	if br.state == BreakerOpen {
+		if time.Since(br.openedAt) < cfg.OpenDuration {
+			return false
+		}
+		br.state = BreakerHalfOpen
+		br.trials = 0
+	}
+	if br.state == BreakerHalfOpen {
+		if br.trials >= cfg.HalfOpenRequests {
+			return false
+		}
+		br.trials++
+	}
+	return true
+}
+
+// Release ends a request admitted by Admit without reporting an outcome, for
+// requests that were canceled before the backend could answer.
+func (b *CircuitBreaker) Release(svc *service.Service) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if br, exists := b.breakers[svc.ID]; exists && br.state == BreakerHalfOpen && br.trials > 0 {
+		br.trials--
+	}
+}
+
+// Forget drops the breaker state of an instance, e.g. once it is deregistered.
+func (b *CircuitBreaker) Forget(svc *service.Service) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.breakers, svc.ID)
+}
+
+// Record reports the outcome of a request sent to an instance.
+// Failures are 5xx responses, connection errors and timeouts.
+func (b *CircuitBreaker) Record(svc *service.Service, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	br, exists := b.breakers[svc.ID]
+	if !exists {
+		if success {
+			return
+		}
+		br = &instanceBreaker{state: BreakerClosed}
+		b.breakers[svc.ID] = br
+	}
+
+	if br.state == BreakerHalfOpen && br.trials > 0 {
+		br.trials--
+	}
+
+	if success {
+		if br.state == BreakerHalfOpen || br.state == BreakerClosed {
+			delete(b.breakers, svc.ID)
+		}
+		return
+	}
+
+	br.consecutiveFailures++
+	switch br.state {
+	case BreakerHalfOpen:
+		// A failed trial reopens the breaker immediately
+		br.state = BreakerOpen
+		br.openedAt = time.Now()
+	case BreakerClosed:
+		if br.consecutiveFailures >= b.configFor(svc).FailureThreshold {
+			br.state = BreakerOpen
+			br.openedAt = time.Now()
+		}
+	}
+}
+
+// Snapshot returns the current breaker state of an instance.
+func (b *CircuitBreaker) Snapshot(id string) BreakerSnapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	br, exists := b.breakers[id]
+	if !exists {
+		return BreakerSnapshot{State: BreakerClosed}
+	}
+
+	snapshot := BreakerSnapshot{
+		State:               br.state,
+		ConsecutiveFailures: br.consecutiveFailures,
+	}
+	if br.state != BreakerClosed {
+		openedAt := br.openedAt
+		snapshot.OpenedAt = &openedAt
+	}
+	return snapshot
+}
+
+// configFor returns the breaker configuration for an instance, applying
+// metadata overrides on top of the defaults.
+func (b *CircuitBreaker) configFor(svc *service.Service) BreakerConfig {
+	cfg := b.defaults
+	if val, err := strconv.Atoi(svc.Metadata[MetadataBreakerFailureThreshold]); err == nil && val > 0 {
+		cfg.FailureThreshold = val
+	}
+	if val, err := time.ParseDuration(svc.Metadata[MetadataBreakerOpenDuration]); err == nil && val > 0 {
+		cfg.OpenDuration = val
+	}
+	if val, err := strconv.Atoi(svc.Metadata[MetadataBreakerHalfOpenRequests]); err == nil && val > 0 {
+		cfg.HalfOpenRequests = val
+	}
+	return cfg
+}
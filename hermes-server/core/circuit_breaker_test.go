@@ -0,0 +1,143 @@
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"nfcunha/hermes/hermes-server/core/domain/service"
+)
+
+func newTestBreaker() *CircuitBreaker {
+	return NewCircuitBreaker(BreakerConfig{
+		FailureThreshold: 3,
+		OpenDuration:     50 * time.Millisecond,
+		HalfOpenRequests: 1,
+	})
+}
+
+func TestCircuitBreaker_OpensAfterConsecutiveFailures(t *testing.T) {
+	b := newTestBreaker()
+	svc := service.NewService("api", "localhost", 8080, "/health")
+
+	b.Record(svc, false)
+	b.Record(svc, false)
+	if !b.Available(svc) {
+		t.Fatal("Expected breaker to stay closed below the threshold")
+	}
+
+	// A success resets the consecutive failure count
+	b.Record(svc, true)
+	b.Record(svc, false)
+	b.Record(svc, false)
+	if state := b.Snapshot(svc.ID).State; state != BreakerClosed {
+		t.Fatalf("Expected breaker to be closed after reset, got %s", state)
+	}
+
+	b.Record(svc, false)
+	snapshot := b.Snapshot(svc.ID)
+	if snapshot.State != BreakerOpen {
+		t.Fatalf("Expected breaker to be open, got %s", snapshot.State)
+	}
+	if snapshot.OpenedAt == nil {
+		t.Error("Expected open breaker to report when it opened")
+	}
+	if b.Available(svc) {
+		t.Error("Expected open breaker to reject traffic")
+	}
+}
+
+func TestCircuitBreaker_HalfOpenTrial(t *testing.T) {
+	b := newTestBreaker()
+	svc := service.NewService("api", "localhost", 8080, "/health")
+	for i := 0; i < 3; i++ {
+		b.Record(svc, false)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if !b.Available(svc) || !b.Admit(svc) {
+		t.Fatal("Expected breaker to admit a trial request after the open duration")
+	}
+
+	if state := b.Snapshot(svc.ID).State; state != BreakerHalfOpen {
+		t.Fatalf("Expected half-open breaker, got %s", state)
+	}
+	if b.Available(svc) || b.Admit(svc) {
+		t.Error("Expected half-open breaker to admit only one trial request")
+	}
+
+	// Failed trial reopens the breaker
+	b.Record(svc, false)
+	if state := b.Snapshot(svc.ID).State; state != BreakerOpen {
+		t.Fatalf("Expected breaker to reopen after failed trial, got %s", state)
+	}
+
+	// Successful trial closes it
+	time.Sleep(60 * time.Millisecond)
+	b.Admit(svc)
+	b.Record(svc, true)
+	if state := b.Snapshot(svc.ID).State; state != BreakerClosed {
+		t.Errorf("Expected breaker to close after successful trial, got %s", state)
+	}
+}
+
+func TestCircuitBreaker_MetadataOverrides(t *testing.T) {
+	b := newTestBreaker()
+	svc := service.NewService("api", "localhost", 8080, "/health")
+	svc.Metadata[MetadataBreakerFailureThreshold] = "1"
+
+	b.Record(svc, false)
+	if state := b.Snapshot(svc.ID).State; state != BreakerOpen {
+		t.Errorf("Expected metadata threshold of 1 to open the breaker, got %s", state)
+	}
+}
+
+func TestCircuitBreaker_ConcurrentHalfOpenAdmission(t *testing.T) {
+	b := newTestBreaker()
+	svc := service.NewService("api", "localhost", 8080, "/health")
+	svc.Metadata[MetadataBreakerHalfOpenRequests] = "2"
+	for i := 0; i < 3; i++ {
+		b.Record(svc, false)
+	}
+	time.Sleep(60 * time.Millisecond)
+
+	var admitted atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if b.Admit(svc) {
+				admitted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := admitted.Load(); got != 2 {
+		t.Errorf("Expected exactly 2 trial requests to be admitted, got %d", got)
+	}
+}
+
+func TestCircuitBreaker_ForgetsDeregisteredInstances(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+	b := newTestBreaker()
+	reg.OnDeregister(b.Forget)
+
+	svc := service.NewService("api", "localhost", 8080, "/health")
+	reg.Register(svc)
+	for i := 0; i < 3; i++ {
+		b.Record(svc, false)
+	}
+
+	reg.Deregister(svc.ID)
+	b.mu.Lock()
+	_, exists := b.breakers[svc.ID]
+	b.mu.Unlock()
+	if exists {
+		t.Error("Expected the breaker of a deregistered instance to be dropped")
+	}
+}
@@ -0,0 +1,373 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"nfcunha/hermes/hermes-server/core/domain/service"
+)
+
+// Metadata keys read from service registrations to override concurrency limits.
+const (
+	// MetadataMaxRequests caps the requests in flight to all instances of a service.
+	MetadataMaxRequests = "concurrency_max_requests"
+	// MetadataMaxInstanceRequests caps the requests in flight to the registering instance.
+	MetadataMaxInstanceRequests = "concurrency_max_instance_requests"
+	// MetadataQueueSize sets how many requests may wait for a free slot.
+	MetadataQueueSize = "concurrency_queue_size"
+	// MetadataQueueTimeout bounds how long a request waits for a free slot (e.g. "1s").
+	MetadataQueueTimeout = "concurrency_queue_timeout"
+)
+
+// Errors returned when a request is shed by the concurrency limiter.
+var (
+	// ErrQueueFull means the service was at its limit and its queue was full.
+	ErrQueueFull = errors.New("service overloaded (queue full)")
+	// ErrQueueTimeout means no slot became free while the request was queued.
+	ErrQueueTimeout = errors.New("service overloaded (queue timeout)")
+)
+
+// ConcurrencyConfig holds concurrency limits and queueing settings.
+type ConcurrencyConfig struct {
+	MaxRequests         int           // Requests in flight to a service (0: unlimited)
+	MaxInstanceRequests int           // Requests in flight to one instance (0: unlimited)
+	QueueSize           int           // Requests that may wait for a free slot (0: shed at once)
+	QueueTimeout        time.Duration // Time a request may wait for a free slot
+}
+
+// ConcurrencySnapshot is a point-in-time view of the concurrency limits of
+// an instance and its service.
+type ConcurrencySnapshot struct {
+	InFlight            int   `json:"in_flight"`
+	MaxInstanceRequests int   `json:"max_instance_requests"`
+	ServiceInFlight     int   `json:"service_in_flight"`
+	MaxRequests         int   `json:"max_requests"`
+	Queued              int   `json:"queued"`
+	QueueSize           int   `json:"queue_size"`
+	Rejected            int64 `json:"rejected"` // Requests of the service shed so far
+}
+
+// ConcurrencyLimiter caps the requests in flight to each service and each
+// instance. Requests beyond the limits wait in a bounded FIFO queue per
+// service until a slot is released or the queue timeout passes, after which
+// they are shed. An admitted request reserves a slot of one of its instances
+// until it takes an instance slot, so that no more requests are admitted than
+// there are free instance slots. A nil *ConcurrencyLimiter applies no limits.
+type ConcurrencyLimiter struct {
+	defaults  ConcurrencyConfig
+	services  map[string]*serviceSlots // Key: service name
+	instances map[string]int           // Key: instance ID, value: requests in flight
+	reserved  map[string]int           // Key: instance ID, value: slots reserved at admission
+	metrics   *Metrics
+	mu        sync.Mutex
+}
+
+// ConcurrencySlot is a service slot taken with Acquire. A nil
+// *ConcurrencySlot holds nothing.
+type ConcurrencySlot struct {
+	limiter     *ConcurrencyLimiter
+	serviceName string
+	reserved    *service.Service // Instance reserved at admission, nil once an instance slot is taken
+}
+
+// serviceSlots holds the admission state of a service.
+type serviceSlots struct {
+	inFlight int
+	queue    []*slotWaiter
+	rejected int64
+}
+
+// slotWaiter is a queued request. Its channel is closed once it has been
+// given a service slot and an instance reservation.
+type slotWaiter struct {
+	cfg       ConcurrencyConfig
+	instances []*service.Service
+	reserved  *service.Service
+	ready     chan struct{}
+}
+
+// NewConcurrencyLimiter creates a concurrency limiter with default limits.
+// Individual services may override them through registration metadata.
+// Metrics may be nil.
+func NewConcurrencyLimiter(defaults ConcurrencyConfig, metrics *Metrics) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		defaults:  defaults,
+		services:  make(map[string]*serviceSlots),
+		instances: make(map[string]int),
+		reserved:  make(map[string]int),
+		metrics:   metrics,
+	}
+}
+
+// Acquire takes a slot of a service for a request to one of the given
+// instances, waiting in the service's queue if the service is at its limit
+// or every instance is at its own limit. The slot is released with
+// ConcurrencySlot.Release. Returns ErrQueueFull or ErrQueueTimeout if the
+// request is shed, or the context error if the request is canceled while
+// queued.
+func (l *ConcurrencyLimiter) Acquire(ctx context.Context, serviceName string, instances []*service.Service) (*ConcurrencySlot, error) {
+	if l == nil {
+		return nil, nil
+	}
+	cfg := concurrencyConfigFor(l.defaults, instances[0])
+
+	l.mu.Lock()
+	slots := l.slotsFor(serviceName)
+	if len(slots.queue) == 0 {
+		if reserved := l.admits(slots, cfg, instances); reserved != nil {
+			l.admit(slots, reserved)
+			l.mu.Unlock()
+			return &ConcurrencySlot{limiter: l, serviceName: serviceName, reserved: reserved}, nil
+		}
+	}
+	if len(slots.queue) >= cfg.QueueSize {
+		l.reject(serviceName, slots, "queue_full")
+		l.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+	w := &slotWaiter{cfg: cfg, instances: instances, ready: make(chan struct{})}
+	slots.queue = append(slots.queue, w)
+	l.metrics.SetConcurrencyQueueDepth(serviceName, len(slots.queue))
+	l.mu.Unlock()
+
+	timer := time.NewTimer(cfg.QueueTimeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-w.ready:
+		return &ConcurrencySlot{limiter: l, serviceName: serviceName, reserved: w.reserved}, nil
+	case <-timer.C:
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		// A slot was handed over while giving up
+		return &ConcurrencySlot{limiter: l, serviceName: serviceName, reserved: w.reserved}, nil
+	default:
+	}
+	l.removeWaiter(serviceName, slots, w)
+	if err == ErrQueueTimeout {
+		l.reject(serviceName, slots, "queue_timeout")
+	}
+	return nil, err
+}
+
+// AcquireInstance takes a slot of one of the candidates, chosen by pick among
+// those below their instance limit, in place of the reservation the request's
+// service slot may still hold. Returns nil if every candidate is at its limit
+// or pick returns nil. The slot is released with ReleaseInstance.
+func (l *ConcurrencyLimiter) AcquireInstance(slot *ConcurrencySlot, candidates []*service.Service, pick func([]*service.Service) *service.Service) *service.Service {
+	if l == nil {
+		return pick(candidates)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	unreserved := slot != nil && slot.reserved != nil
+	if unreserved {
+		l.unreserve(slot.reserved)
+		slot.reserved = nil
+	}
+
+	available := make([]*service.Service, 0, len(candidates))
+	for _, svc := range candidates {
+		if l.instanceAvailable(svc) {
+			available = append(available, svc)
+		}
+	}
+	var target *service.Service
+	if len(available) > 0 {
+		target = pick(available)
+	}
+	if target != nil {
+		l.instances[target.ID]++
+	} else if unreserved {
+		// The reservation was not used, so queued requests may fit now
+		if slots, exists := l.services[slot.serviceName]; exists {
+			l.dispatch(slot.serviceName, slots)
+		}
+	}
+	return target
+}
+
+// ReleaseInstance releases a slot taken with AcquireInstance and lets queued
+// requests of the service in if they now fit.
+func (l *ConcurrencyLimiter) ReleaseInstance(svc *service.Service) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.instances[svc.ID] <= 1 {
+		delete(l.instances, svc.ID)
+	} else {
+		l.instances[svc.ID]--
+	}
+	if slots, exists := l.services[svc.Name]; exists {
+		l.dispatch(svc.Name, slots)
+	}
+}
+
+// Snapshot returns the concurrency state of an instance and its service.
+func (l *ConcurrencyLimiter) Snapshot(svc *service.Service) ConcurrencySnapshot {
+	if l == nil {
+		return ConcurrencySnapshot{}
+	}
+	cfg := concurrencyConfigFor(l.defaults, svc)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	snapshot := ConcurrencySnapshot{
+		InFlight:            l.instances[svc.ID],
+		MaxInstanceRequests: cfg.MaxInstanceRequests,
+		MaxRequests:         cfg.MaxRequests,
+		QueueSize:           cfg.QueueSize,
+	}
+	if slots, exists := l.services[svc.Name]; exists {
+		snapshot.ServiceInFlight = slots.inFlight
+		snapshot.Queued = len(slots.queue)
+		snapshot.Rejected = slots.rejected
+	}
+	return snapshot
+}
+
+// Release returns the service slot, along with its reservation if no instance
+// slot was taken, and lets queued requests in if they now fit.
+func (s *ConcurrencySlot) Release() {
+	if s == nil {
+		return
+	}
+	l := s.limiter
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if s.reserved != nil {
+		l.unreserve(s.reserved)
+		s.reserved = nil
+	}
+	slots := l.slotsFor(s.serviceName)
+	slots.inFlight--
+	l.dispatch(s.serviceName, slots)
+}
+
+// dispatch hands service slots to queued requests, in order, for as long as
+// the next one fits. Must be called with the lock held.
+func (l *ConcurrencyLimiter) dispatch(serviceName string, slots *serviceSlots) {
+	if len(slots.queue) == 0 {
+		return
+	}
+	for len(slots.queue) > 0 {
+		next := slots.queue[0]
+		reserved := l.admits(slots, next.cfg, next.instances)
+		if reserved == nil {
+			break
+		}
+		slots.queue = slots.queue[1:]
+		l.admit(slots, reserved)
+		next.reserved = reserved
+		close(next.ready)
+	}
+	l.metrics.SetConcurrencyQueueDepth(serviceName, len(slots.queue))
+}
+
+// admits returns the instance a request to one of the instances would
+// reserve, or nil if the request does not fit within the limits. Must be
+// called with the lock held.
+func (l *ConcurrencyLimiter) admits(slots *serviceSlots, cfg ConcurrencyConfig, instances []*service.Service) *service.Service {
+	if cfg.MaxRequests > 0 && slots.inFlight >= cfg.MaxRequests {
+		return nil
+	}
+	for _, svc := range instances {
+		if l.instanceAvailable(svc) {
+			return svc
+		}
+	}
+	return nil
+}
+
+// admit gives a request a service slot and reserves a slot of the instance.
+// Must be called with the lock held.
+func (l *ConcurrencyLimiter) admit(slots *serviceSlots, reserved *service.Service) {
+	slots.inFlight++
+	l.reserved[reserved.ID]++
+}
+
+// unreserve drops a reservation taken at admission. Must be called with the
+// lock held.
+func (l *ConcurrencyLimiter) unreserve(svc *service.Service) {
+	if l.reserved[svc.ID] <= 1 {
+		delete(l.reserved, svc.ID)
+	} else {
+		l.reserved[svc.ID]--
+	}
+}
+
+// instanceAvailable reports whether an instance is below its limit, counting
+// the slots reserved by admitted requests. Must be called with the lock held.
+func (l *ConcurrencyLimiter) instanceAvailable(svc *service.Service) bool {
+	limit := concurrencyConfigFor(l.defaults, svc).MaxInstanceRequests
+	return limit <= 0 || l.instances[svc.ID]+l.reserved[svc.ID] < limit
+}
+
+// removeWaiter removes a request that gave up from the queue. Must be called
+// with the lock held.
+func (l *ConcurrencyLimiter) removeWaiter(serviceName string, slots *serviceSlots, w *slotWaiter) {
+	for i, queued := range slots.queue {
+		if queued == w {
+			slots.queue = append(slots.queue[:i], slots.queue[i+1:]...)
+			break
+		}
+	}
+	l.metrics.SetConcurrencyQueueDepth(serviceName, len(slots.queue))
+}
+
+// reject counts a shed request. Must be called with the lock held.
+func (l *ConcurrencyLimiter) reject(serviceName string, slots *serviceSlots, reason string) {
+	slots.rejected++
+	l.metrics.ObserveConcurrencyRejection(serviceName, reason)
+}
+
+// slotsFor returns the admission state of a service, creating it if needed.
+// Must be called with the lock held.
+func (l *ConcurrencyLimiter) slotsFor(serviceName string) *serviceSlots {
+	slots, exists := l.services[serviceName]
+	if !exists {
+		slots = &serviceSlots{}
+		l.services[serviceName] = slots
+	}
+	return slots
+}
+
+// concurrencyConfigFor returns the concurrency settings for an instance,
+// applying metadata overrides on top of the defaults.
+func concurrencyConfigFor(defaults ConcurrencyConfig, svc *service.Service) ConcurrencyConfig {
+	cfg := defaults
+	if val, err := strconv.Atoi(svc.Metadata[MetadataMaxRequests]); err == nil && val >= 0 {
+		cfg.MaxRequests = val
+	}
+	if val, err := strconv.Atoi(svc.Metadata[MetadataMaxInstanceRequests]); err == nil && val >= 0 {
+		cfg.MaxInstanceRequests = val
+	}
+	if val, err := strconv.Atoi(svc.Metadata[MetadataQueueSize]); err == nil && val >= 0 {
+		cfg.QueueSize = val
+	}
+	if val, err := time.ParseDuration(svc.Metadata[MetadataQueueTimeout]); err == nil && val >= 0 {
+		cfg.QueueTimeout = val
+	}
+	return cfg
+}
@@ -0,0 +1,178 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"nfcunha/hermes/hermes-server/core/domain/service"
+)
+
+func TestConcurrencyLimiter_QueuesAndSheds(t *testing.T) {
+	metrics := NewMetrics()
+	l := NewConcurrencyLimiter(ConcurrencyConfig{MaxRequests: 1, QueueSize: 1, QueueTimeout: time.Second}, metrics)
+	instances := []*service.Service{service.NewService("api", "localhost", 8080, "/health")}
+
+	slot, err := l.Acquire(context.Background(), "api", instances)
+	if err != nil {
+		t.Fatalf("Expected first request to be admitted, got %v", err)
+	}
+
+	// The second request waits for the first one
+	admitted := make(chan error, 1)
+	go func() {
+		slot, err := l.Acquire(context.Background(), "api", instances)
+		if err == nil {
+			slot.Release()
+		}
+		admitted <- err
+	}()
+	waitFor(t, func() bool { return l.Snapshot(instances[0]).Queued == 1 })
+
+	// The queue is full, so the third request is shed at once
+	if _, err := l.Acquire(context.Background(), "api", instances); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+
+	slot.Release()
+	select {
+	case err := <-admitted:
+		if err != nil {
+			t.Errorf("Expected queued request to be admitted, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Queued request was not admitted after a release")
+	}
+
+	snapshot := l.Snapshot(instances[0])
+	if snapshot.ServiceInFlight != 0 || snapshot.Queued != 0 || snapshot.Rejected != 1 {
+		t.Errorf("Expected no requests in flight and one rejection, got %+v", snapshot)
+	}
+
+	var out strings.Builder
+	metrics.Write(&out, nil)
+	for _, line := range []string{
+		`hermes_concurrency_queue_depth{service="api"} 0`,
+		`hermes_concurrency_rejections_total{service="api",reason="queue_full"} 1`,
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Expected metrics to contain %q", line)
+		}
+	}
+}
+
+func TestConcurrencyLimiter_QueueTimeout(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyConfig{MaxRequests: 1, QueueSize: 5, QueueTimeout: 20 * time.Millisecond}, nil)
+	instances := []*service.Service{service.NewService("api", "localhost", 8080, "/health")}
+
+	slot, _ := l.Acquire(context.Background(), "api", instances)
+	defer slot.Release()
+
+	start := time.Now()
+	if _, err := l.Acquire(context.Background(), "api", instances); !errors.Is(err, ErrQueueTimeout) {
+		t.Fatalf("Expected ErrQueueTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Expected request to wait for the queue timeout, waited %v", elapsed)
+	}
+	if queued := l.Snapshot(instances[0]).Queued; queued != 0 {
+		t.Errorf("Expected timed out request to leave the queue, %d queued", queued)
+	}
+}
+
+func TestConcurrencyLimiter_InstanceLimit(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyConfig{QueueSize: 1, QueueTimeout: 20 * time.Millisecond}, nil)
+	first := service.NewService("api", "host1", 8080, "/health")
+	second := service.NewService("api", "host2", 8080, "/health")
+	first.Metadata = map[string]string{MetadataMaxInstanceRequests: "1"}
+	second.Metadata = map[string]string{MetadataMaxInstanceRequests: "1"}
+	instances := []*service.Service{first, second}
+	pickFirst := func(available []*service.Service) *service.Service { return available[0] }
+
+	if target := l.AcquireInstance(nil, instances, pickFirst); target != first {
+		t.Fatalf("Expected first instance, got %v", target)
+	}
+	if target := l.AcquireInstance(nil, instances, pickFirst); target != second {
+		t.Fatalf("Expected instance at its limit to be skipped, got %v", target)
+	}
+	if target := l.AcquireInstance(nil, instances, pickFirst); target != nil {
+		t.Fatalf("Expected no instance below its limit, got %v", target)
+	}
+
+	// With every instance at its limit, new requests wait in the service queue
+	if _, err := l.Acquire(context.Background(), "api", instances); !errors.Is(err, ErrQueueTimeout) {
+		t.Errorf("Expected ErrQueueTimeout, got %v", err)
+	}
+
+	l.ReleaseInstance(first)
+	slot, err := l.Acquire(context.Background(), "api", instances)
+	if err != nil {
+		t.Fatalf("Expected request to be admitted once an instance is free, got %v", err)
+	}
+	slot.Release()
+	if snapshot := l.Snapshot(second); snapshot.InFlight != 1 || snapshot.MaxInstanceRequests != 1 {
+		t.Errorf("Expected one request in flight to the second instance, got %+v", snapshot)
+	}
+}
+
+func TestConcurrencyLimiter_AdmitsOnlyFreeInstanceSlots(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyConfig{MaxInstanceRequests: 1, QueueSize: 3, QueueTimeout: time.Second}, nil)
+	instances := []*service.Service{service.NewService("api", "localhost", 8080, "/health")}
+	pickFirst := func(available []*service.Service) *service.Service { return available[0] }
+
+	slot, err := l.Acquire(context.Background(), "api", instances)
+	if err != nil {
+		t.Fatalf("Expected first request to be admitted, got %v", err)
+	}
+	target := l.AcquireInstance(slot, instances, pickFirst)
+	if target == nil {
+		t.Fatal("Expected first request to get the instance")
+	}
+
+	// Both queued requests wait for the single instance slot
+	admitted := make(chan *ConcurrencySlot, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			if slot, err := l.Acquire(context.Background(), "api", instances); err == nil {
+				admitted <- slot
+			}
+		}()
+	}
+	waitFor(t, func() bool { return l.Snapshot(instances[0]).Queued == 2 })
+
+	// Freeing it admits a single one, which is then sure to get it
+	l.ReleaseInstance(target)
+	slot.Release()
+	next := <-admitted
+	select {
+	case <-admitted:
+		t.Fatal("Expected only one queued request to be admitted for one free instance slot")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if target := l.AcquireInstance(next, instances, pickFirst); target == nil {
+		t.Fatal("Expected the admitted request to get the instance")
+	}
+
+	// Its release lets the last one in
+	l.ReleaseInstance(instances[0])
+	next.Release()
+	last := <-admitted
+	last.Release()
+	if snapshot := l.Snapshot(instances[0]); snapshot.InFlight != 0 || snapshot.ServiceInFlight != 0 || snapshot.Queued != 0 {
+		t.Errorf("Expected nothing left in flight, got %+v", snapshot)
+	}
+}
+
+// waitFor polls until cond holds or a second has passed.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,109 @@
+// Package accesslog defines the domain model for the access log of routed traffic.
+// It provides persistence for access log entries when the SQLite sink is used.
+package accesslog
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Entry represents a single routed request.
+// It is written as one JSON line to the stdout and file sinks.
+type Entry struct {
+	Time              time.Time `json:"time"`
+	RequestID         string    `json:"request_id,omitempty"`
+	Method            string    `json:"method"`
+	Path              string    `json:"path"`
+	Service           string    `json:"service"`
+	InstanceID        string    `json:"instance_id,omitempty"`
+	Status            int       `json:"status"`
+	UpstreamStatus    int       `json:"upstream_status,omitempty"`
+	UpstreamLatencyMs float64   `json:"upstream_latency_ms,omitempty"`
+	LatencyMs         float64   `json:"latency_ms"`
+	BytesIn           int64     `json:"bytes_in"`
+	BytesOut          int64     `json:"bytes_out"`
+	Subject           string    `json:"subject,omitempty"`
+	Error             string    `json:"error,omitempty"`
+}
+
+// Repository handles persistence of access log entries to the database.
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository creates a new access log repository with the given database connection.
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// Create stores an access log entry in the database.
+// Returns an error if the database operation fails.
+func (r *Repository) Create(entry *Entry) error {
+	if r.db == nil {
+		return nil
+	}
+
+	query := `
+		INSERT INTO access_logs (logged_at, request_id, method, path, service, instance_id, status,
+			upstream_status, upstream_latency_ms, latency_ms, bytes_in, bytes_out, subject, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := r.db.Exec(query, entry.Time, entry.RequestID, entry.Method, entry.Path, entry.Service, entry.InstanceID,
+		entry.Status, entry.UpstreamStatus, entry.UpstreamLatencyMs, entry.LatencyMs, entry.BytesIn, entry.BytesOut,
+		entry.Subject, entry.Error)
+	return err
+}
+
+// Prune deletes all but the most recent keep entries.
+// Returns an error if the database operation fails.
+func (r *Repository) Prune(keep int) error {
+	if r.db == nil {
+		return nil
+	}
+
+	query := `
+		DELETE FROM access_logs
+		WHERE id <= (SELECT id FROM access_logs ORDER BY id DESC LIMIT 1 OFFSET ?)
+	`
+
+	_, err := r.db.Exec(query, keep)
+	return err
+}
+
+// GetRecent retrieves the most recent access log entries.
+// Entries are returned in descending order (most recent first).
+// The limit parameter controls the maximum number of entries to return.
+func (r *Repository) GetRecent(limit int) ([]Entry, error) {
+	if r.db == nil {
+		return nil, nil
+	}
+
+	query := `
+		SELECT logged_at, request_id, method, path, service, instance_id, status,
+			upstream_status, upstream_latency_ms, latency_ms, bytes_in, bytes_out, subject, error
+		FROM access_logs
+		ORDER BY id DESC
+		LIMIT ?
+	`
+
+	rows, err := r.db.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var entry Entry
+		err := rows.Scan(&entry.Time, &entry.RequestID, &entry.Method, &entry.Path, &entry.Service, &entry.InstanceID,
+			&entry.Status, &entry.UpstreamStatus, &entry.UpstreamLatencyMs, &entry.LatencyMs, &entry.BytesIn,
+			&entry.BytesOut, &entry.Subject, &entry.Error)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
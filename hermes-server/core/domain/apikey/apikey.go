@@ -0,0 +1,135 @@
+// Package apikey defines the domain model for gateway-managed API keys.
+// API keys authenticate machine clients (CI jobs, scripts) with fixed roles
+// and permissions. Only the SHA-256 hash of a key is stored.
+package apikey
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Key is an admin-issued API key.
+type Key struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Roles       []string   `json:"roles"`
+	Permissions []string   `json:"permissions"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"` // nil means the key does not expire
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Expired reports whether the key has expired at the given time.
+func (k *Key) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && now.After(*k.ExpiresAt)
+}
+
+// Repository handles persistence of API keys to the database.
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository creates a new API key repository with the given database connection.
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// Create stores a key under the hash of its secret.
+func (r *Repository) Create(key *Key, hash string) error {
+	roles, err := json.Marshal(key.Roles)
+	if err != nil {
+		return err
+	}
+	permissions, err := json.Marshal(key.Permissions)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO api_keys (id, key_hash, name, roles, permissions, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = r.db.Exec(query, key.ID, hash, key.Name, string(roles), string(permissions), key.CreatedAt, key.ExpiresAt)
+	return err
+}
+
+// GetByHash retrieves the key whose secret has the given hash.
+// Returns sql.ErrNoRows if there is none.
+func (r *Repository) GetByHash(hash string) (*Key, error) {
+	row := r.db.QueryRow(`
+		SELECT id, name, roles, permissions, created_at, expires_at, last_used_at
+		FROM api_keys
+		WHERE key_hash = ?
+	`, hash)
+	return scanKey(row)
+}
+
+// List retrieves all keys, most recently created first.
+func (r *Repository) List() ([]Key, error) {
+	rows, err := r.db.Query(`
+		SELECT id, name, roles, permissions, created_at, expires_at, last_used_at
+		FROM api_keys
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []Key{}
+	for rows.Next() {
+		key, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// Delete revokes a key. Returns sql.ErrNoRows if it does not exist.
+func (r *Repository) Delete(id string) error {
+	result, err := r.db.Exec("DELETE FROM api_keys WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// TouchLastUsed records that a key was used at the given time.
+func (r *Repository) TouchLastUsed(id string, at time.Time) error {
+	_, err := r.db.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", at, id)
+	return err
+}
+
+// scanner is implemented by *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanKey reads a key from a row.
+func scanKey(row scanner) (*Key, error) {
+	var key Key
+	var roles, permissions string
+	var expiresAt, lastUsedAt sql.NullTime
+	if err := row.Scan(&key.ID, &key.Name, &roles, &permissions, &key.CreatedAt, &expiresAt, &lastUsedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(roles), &key.Roles); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(permissions), &key.Permissions); err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	return &key, nil
+}
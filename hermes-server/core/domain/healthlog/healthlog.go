@@ -32,7 +32,7 @@ func NewRepository(db *sql.DB) *Repository {
 // Create stores a health check result in the database.
 // Parameters:
 //   - serviceID: unique ID of the service being checked
-//   - status: "healthy", "unhealthy", or "error"
+//   - status: "healthy", "unhealthy", "error", or "ejected" (passive outlier detection)
 //   - errorMsg: error message if check failed (empty string if successful)
 //   - responseBody: HTTP response body from the health endpoint
 //   - responseTimeMs: response time in milliseconds
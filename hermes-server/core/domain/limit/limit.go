@@ -0,0 +1,70 @@
+// Package limit defines the traffic limits applied to routed services.
+package limit
+
+import (
+	"errors"
+	"time"
+)
+
+// KeyType selects what a rate limit counts requests by. Each distinct key
+// gets its own token bucket.
+type KeyType string
+
+const (
+	// KeyIP counts requests per client IP.
+	KeyIP KeyType = "ip"
+	// KeyUser counts requests per authenticated user (or API key).
+	KeyUser KeyType = "user"
+	// KeyAPIKey counts requests per API key.
+	KeyAPIKey KeyType = "api_key"
+	// KeyService counts all requests to the service together.
+	KeyService KeyType = "service"
+)
+
+// SourceConfigFile marks limits declared in the route config file.
+const SourceConfigFile = "config_file"
+
+// IsValidKeyType reports whether k is a known key type.
+func IsValidKeyType(k KeyType) bool {
+	switch k {
+	case KeyIP, KeyUser, KeyAPIKey, KeyService:
+		return true
+	default:
+		return false
+	}
+}
+
+// RateLimit is the token bucket rate limit of a service name. A bucket holds up
+// to Burst tokens and is refilled at RequestsPerSecond; each request takes
+// one token. A RequestsPerSecond of 0 means the service is not limited.
+type RateLimit struct {
+	ServiceName       string    `json:"service_name"`
+	RequestsPerSecond float64   `json:"requests_per_second"`
+	Burst             int       `json:"burst"`
+	Key               KeyType   `json:"key"`
+	Source            string    `json:"source,omitempty"` // SourceConfigFile, or empty if set through the API
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// Unlimited reports whether the limit lets all requests through.
+func (l *RateLimit) Unlimited() bool {
+	return l.RequestsPerSecond == 0
+}
+
+// Validate checks that the limit names a service, has a known key type and
+// a non-negative rate and burst.
+func (l *RateLimit) Validate() error {
+	if l.ServiceName == "" {
+		return errors.New("service name is required")
+	}
+	if !IsValidKeyType(l.Key) {
+		return errors.New("key must be ip, user, api_key or service")
+	}
+	if l.RequestsPerSecond < 0 {
+		return errors.New("requests_per_second must not be negative")
+	}
+	if l.Burst < 0 {
+		return errors.New("burst must not be negative")
+	}
+	return nil
+}
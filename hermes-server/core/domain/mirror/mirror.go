@@ -0,0 +1,36 @@
+// Package mirror defines the traffic mirrors copying requests of routed
+// services to another service.
+package mirror
+
+import (
+	"errors"
+	"time"
+)
+
+// Mirror sends a copy of a share of the requests routed to a service to
+// another registered service. Copies are sent in the background and their
+// responses are discarded, so they never affect the routed request.
+type Mirror struct {
+	ServiceName string    `json:"service_name"`
+	Target      string    `json:"target"`  // Name of the registered service receiving the copies
+	Percent     float64   `json:"percent"` // Share of requests copied, 0-100
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Validate checks that the mirror names two different services and a
+// percentage between 0 and 100.
+func (m *Mirror) Validate() error {
+	if m.ServiceName == "" {
+		return errors.New("service name is required")
+	}
+	if m.Target == "" {
+		return errors.New("target is required")
+	}
+	if m.Target == m.ServiceName {
+		return errors.New("a service cannot be mirrored to itself")
+	}
+	if m.Percent < 0 || m.Percent > 100 {
+		return errors.New("percent must be between 0 and 100")
+	}
+	return nil
+}
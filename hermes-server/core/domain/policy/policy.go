@@ -0,0 +1,62 @@
+// Package policy defines the access policies applied to routed services.
+package policy
+
+import (
+	"errors"
+	"time"
+)
+
+// Access selects who may call a service through the route endpoint.
+type Access string
+
+const (
+	// AccessPublic lets anyone call the service.
+	AccessPublic Access = "public"
+	// AccessAuthenticated requires a valid token.
+	AccessAuthenticated Access = "authenticated"
+	// AccessRoles requires a valid token and at least one of the policy's roles.
+	AccessRoles Access = "roles"
+	// AccessPermissions requires a valid token and all of the policy's permissions.
+	AccessPermissions Access = "permissions"
+)
+
+// SourceConfigFile marks policies declared in the route config file.
+const SourceConfigFile = "config_file"
+
+// IsValidAccess reports whether a is a known access level.
+func IsValidAccess(a Access) bool {
+	switch a {
+	case AccessPublic, AccessAuthenticated, AccessRoles, AccessPermissions:
+		return true
+	default:
+		return false
+	}
+}
+
+// RoutePolicy is the access policy of a service name.
+type RoutePolicy struct {
+	ServiceName string    `json:"service_name"`
+	Access      Access    `json:"access"`
+	Roles       []string  `json:"roles,omitempty"`       // AccessRoles only
+	Permissions []string  `json:"permissions,omitempty"` // AccessPermissions only
+	Source      string    `json:"source,omitempty"`      // SourceConfigFile, or empty if set through the API
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Validate checks that the policy names a service, has a known access level
+// and lists the roles or permissions its access level requires.
+func (p *RoutePolicy) Validate() error {
+	if p.ServiceName == "" {
+		return errors.New("service name is required")
+	}
+	if !IsValidAccess(p.Access) {
+		return errors.New("access must be public, authenticated, roles or permissions")
+	}
+	if p.Access == AccessRoles && len(p.Roles) == 0 {
+		return errors.New("roles access requires at least one role")
+	}
+	if p.Access == AccessPermissions && len(p.Permissions) == 0 {
+		return errors.New("permissions access requires at least one permission")
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+// Package regtoken defines the domain model for registration tokens.
+// Registration tokens authorize services to self-register under specific
+// service names. Only the SHA-256 hash of a token is stored.
+package regtoken
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Token is an admin-issued registration token.
+type Token struct {
+	ID           string     `json:"id"`
+	Description  string     `json:"description,omitempty"`
+	ServiceNames []string   `json:"service_names"`          // Names the token may register
+	SourceCIDRs  []string   `json:"source_cidrs,omitempty"` // Allowed client networks, empty for any
+	CreatedAt    time.Time  `json:"created_at"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"` // nil means the token does not expire
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Expired reports whether the token has expired at the given time.
+func (t *Token) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && now.After(*t.ExpiresAt)
+}
+
+// AllowsService reports whether the token may register the service name.
+func (t *Token) AllowsService(name string) bool {
+	for _, allowed := range t.ServiceNames {
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Repository handles persistence of registration tokens to the database.
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository creates a new registration token repository with the given database connection.
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// Create stores a token under the hash of its secret.
+func (r *Repository) Create(token *Token, hash string) error {
+	serviceNames, err := json.Marshal(token.ServiceNames)
+	if err != nil {
+		return err
+	}
+	sourceCIDRs, err := json.Marshal(token.SourceCIDRs)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO registration_tokens (id, token_hash, description, service_names, source_cidrs, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = r.db.Exec(query, token.ID, hash, token.Description, string(serviceNames), string(sourceCIDRs),
+		token.CreatedAt, token.ExpiresAt)
+	return err
+}
+
+// GetByHash retrieves the token whose secret has the given hash.
+// Returns sql.ErrNoRows if there is none.
+func (r *Repository) GetByHash(hash string) (*Token, error) {
+	row := r.db.QueryRow(`
+		SELECT id, description, service_names, source_cidrs, created_at, expires_at, last_used_at
+		FROM registration_tokens
+		WHERE token_hash = ?
+	`, hash)
+	return scanToken(row)
+}
+
+// List retrieves all tokens, most recently created first.
+func (r *Repository) List() ([]Token, error) {
+	rows, err := r.db.Query(`
+		SELECT id, description, service_names, source_cidrs, created_at, expires_at, last_used_at
+		FROM registration_tokens
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []Token{}
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+	return tokens, rows.Err()
+}
+
+// Delete revokes a token. Returns sql.ErrNoRows if it does not exist.
+func (r *Repository) Delete(id string) error {
+	result, err := r.db.Exec("DELETE FROM registration_tokens WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// TouchLastUsed records that a token was used at the given time.
+func (r *Repository) TouchLastUsed(id string, at time.Time) error {
+	_, err := r.db.Exec("UPDATE registration_tokens SET last_used_at = ? WHERE id = ?", at, id)
+	return err
+}
+
+// scanner is implemented by *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanToken reads a token from a row.
+func scanToken(row scanner) (*Token, error) {
+	var token Token
+	var serviceNames, sourceCIDRs string
+	var expiresAt, lastUsedAt sql.NullTime
+	if err := row.Scan(&token.ID, &token.Description, &serviceNames, &sourceCIDRs,
+		&token.CreatedAt, &expiresAt, &lastUsedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(serviceNames), &token.ServiceNames); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(sourceCIDRs), &token.SourceCIDRs); err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	return &token, nil
+}
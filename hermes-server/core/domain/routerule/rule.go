@@ -0,0 +1,186 @@
+// Package routerule defines the rules mapping requests at the gateway root to
+// routed services.
+package routerule
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SourceConfigFile marks rules declared in the route config file.
+const SourceConfigFile = "config_file"
+
+// Rule maps the requests it matches to a service. A request matches when its
+// host, path, method and headers all satisfy the rule's conditions; empty
+// conditions match anything. Rules with a higher Priority are tried first.
+type Rule struct {
+	Name          string            `json:"name"`
+	Priority      int               `json:"priority"`
+	Hosts         []string          `json:"hosts,omitempty"`       // Exact hosts or "*.example.com" wildcards
+	PathPrefix    string            `json:"path_prefix,omitempty"` // Matches whole path segments
+	PathRegex     string            `json:"path_regex,omitempty"`
+	Methods       []string          `json:"methods,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"` // Exact values; an empty value only requires the header
+	ServiceName   string            `json:"service_name"`
+	StripPrefix   bool              `json:"strip_prefix,omitempty"`   // Remove PathPrefix before forwarding
+	Rewrite       string            `json:"rewrite,omitempty"`        // Replaces PathPrefix, or the PathRegex match ($1 expands groups)
+	SubsetHeaders map[string]string `json:"subset_headers,omitempty"` // Header name -> metadata key the header's value must match
+	Source        string            `json:"source,omitempty"`         // SourceConfigFile, or empty if set through the API
+	UpdatedAt     time.Time         `json:"updated_at"`
+
+	pathRegex *regexp.Regexp
+}
+
+// Validate checks that the rule is named, targets a service, matches on a
+// host or path and has consistent path options. It also normalizes hosts and
+// methods and compiles the path regex, so it must be called before Matches.
+func (r *Rule) Validate() error {
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	if r.ServiceName == "" {
+		return errors.New("service_name is required")
+	}
+	if len(r.Hosts) == 0 && r.PathPrefix == "" && r.PathRegex == "" {
+		return errors.New("a rule needs hosts, path_prefix or path_regex")
+	}
+	if r.PathPrefix != "" && r.PathRegex != "" {
+		return errors.New("path_prefix and path_regex are mutually exclusive")
+	}
+	if r.PathPrefix != "" && !strings.HasPrefix(r.PathPrefix, "/") {
+		return errors.New("path_prefix must start with /")
+	}
+	if r.StripPrefix && r.PathPrefix == "" {
+		return errors.New("strip_prefix requires path_prefix")
+	}
+	if r.StripPrefix && r.Rewrite != "" {
+		return errors.New("strip_prefix and rewrite are mutually exclusive")
+	}
+	if r.Rewrite != "" && r.PathPrefix == "" && r.PathRegex == "" {
+		return errors.New("rewrite requires path_prefix or path_regex")
+	}
+	for header, key := range r.SubsetHeaders {
+		if header == "" || key == "" {
+			return errors.New("subset_headers must map header names to metadata keys")
+		}
+	}
+
+	r.pathRegex = nil
+	if r.PathRegex != "" {
+		re, err := regexp.Compile(r.PathRegex)
+		if err != nil {
+			return errors.New("invalid path_regex")
+		}
+		r.pathRegex = re
+	}
+
+	for i, host := range r.Hosts {
+		if host == "" || strings.Contains(strings.TrimPrefix(host, "*."), "*") {
+			return errors.New("hosts must be names or *.domain wildcards")
+		}
+		r.Hosts[i] = strings.ToLower(host)
+	}
+	for i, method := range r.Methods {
+		r.Methods[i] = strings.ToUpper(method)
+	}
+	return nil
+}
+
+// Matches reports whether the request satisfies all conditions of the rule.
+func (r *Rule) Matches(req *http.Request) bool {
+	if len(r.Hosts) > 0 && !r.matchesHost(req.Host) {
+		return false
+	}
+	if r.PathPrefix != "" && !hasPathPrefix(req.URL.Path, r.PathPrefix) {
+		return false
+	}
+	if r.pathRegex != nil && !r.pathRegex.MatchString(req.URL.Path) {
+		return false
+	}
+	if len(r.Methods) > 0 && !contains(r.Methods, req.Method) {
+		return false
+	}
+	for name, value := range r.Headers {
+		values := req.Header.Values(name)
+		if len(values) == 0 || (value != "" && !contains(values, value)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Subset returns the instance metadata selector derived from the request's
+// subset headers, or nil if the rule has none or the request carries none.
+func (r *Rule) Subset(req *http.Request) map[string]string {
+	var selector map[string]string
+	for header, key := range r.SubsetHeaders {
+		value := req.Header.Get(header)
+		if value == "" {
+			continue
+		}
+		if selector == nil {
+			selector = make(map[string]string)
+		}
+		selector[key] = value
+	}
+	return selector
+}
+
+// TargetPath returns the path to forward a matched request path to, with
+// the rule's prefix stripping or rewrite applied.
+func (r *Rule) TargetPath(path string) string {
+	switch {
+	case r.PathPrefix != "" && (r.StripPrefix || r.Rewrite != ""):
+		rest := strings.TrimPrefix(path, strings.TrimSuffix(r.PathPrefix, "/"))
+		path = strings.TrimSuffix(r.Rewrite, "/") + rest
+	case r.pathRegex != nil && r.Rewrite != "":
+		path = r.pathRegex.ReplaceAllString(path, r.Rewrite)
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// matchesHost reports whether a Host header value, with or without port,
+// matches one of the rule's hosts.
+func (r *Rule) matchesHost(hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	for _, pattern := range r.Hosts {
+		if suffix, wildcard := strings.CutPrefix(pattern, "*"); wildcard {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPathPrefix reports whether path starts with prefix on a segment
+// boundary: "/api" matches "/api" and "/api/users" but not "/apis".
+func hasPathPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -13,13 +13,39 @@ type Status string
 
 const (
 	// StatusHealthy indicates the service is responding to health checks.
-	StatusHealthy   Status = "healthy"
+	StatusHealthy Status = "healthy"
 	// StatusUnhealthy indicates the service has failed health checks.
 	StatusUnhealthy Status = "unhealthy"
 	// StatusDraining indicates the service is being gracefully shut down.
-	StatusDraining  Status = "draining"
+	StatusDraining Status = "draining"
 )
 
+// HealthCheckType selects how a service instance is health checked.
+type HealthCheckType string
+
+const (
+	// HealthCheckHTTP sends a GET to the health check path and expects a 2xx status.
+	HealthCheckHTTP HealthCheckType = "http"
+	// HealthCheckTCP only checks that a TCP connection can be opened.
+	HealthCheckTCP HealthCheckType = "tcp"
+	// HealthCheckGRPC uses the standard grpc.health.v1 protocol. The health
+	// check path holds the gRPC service name to check (empty: the whole server).
+	HealthCheckGRPC HealthCheckType = "grpc"
+	// HealthCheckHTTPExpect sends a GET to the health check path and matches
+	// the response against an expected status and/or body regular expression.
+	HealthCheckHTTPExpect HealthCheckType = "http-expect"
+)
+
+// IsValidHealthCheckType reports whether t is a known health check type.
+func IsValidHealthCheckType(t HealthCheckType) bool {
+	switch t {
+	case HealthCheckHTTP, HealthCheckTCP, HealthCheckGRPC, HealthCheckHTTPExpect:
+		return true
+	default:
+		return false
+	}
+}
+
 // Service represents a registered backend service instance.
 // It contains connection details, health status, and metadata.
 type Service struct {
@@ -29,16 +55,27 @@ type Service struct {
 	Port            int               `json:"port"`
 	Protocol        string            `json:"protocol"` // http, https
 	HealthCheckPath string            `json:"health_check_path"`
+	HealthCheckType HealthCheckType   `json:"health_check_type"`
+	ExpectStatus    int               `json:"health_check_expect_status,omitempty"`    // http-expect only; 0 means any 2xx
+	ExpectBody      string            `json:"health_check_expect_body,omitempty"`      // http-expect only; regular expression
+	HealthInterval  int               `json:"health_check_interval_seconds,omitempty"` // 0 means the global default
+	HealthTimeout   int               `json:"health_check_timeout_seconds,omitempty"`  // 0 means the global default
+	HealthThreshold int               `json:"health_check_threshold,omitempty"`        // 0 means the global default
 	Status          Status            `json:"status"`
 	Metadata        map[string]string `json:"metadata,omitempty"`
 	RegisteredAt    time.Time         `json:"registered_at"`
 	LastCheckedAt   time.Time         `json:"last_checked_at"`
 	FailureCount    int               `json:"failure_count"`
+	LeaseTTL        int               `json:"lease_ttl_seconds,omitempty"` // 0 means no lease
+	LastHeartbeatAt time.Time         `json:"last_heartbeat_at"`
+
+	RegistrationTokenID string `json:"registration_token_id,omitempty"` // Token the service self-registered with, if any
 }
 
 // NewService creates a new service instance with the given parameters.
 // It generates a unique ID and initializes the service in healthy status.
-// The protocol defaults to "http" and can be changed after creation.
+// The protocol and health check type default to "http" and can be changed
+// after creation.
 func NewService(name, host string, port int, healthCheckPath string) *Service {
 	return &Service{
 		ID:              uuid.New().String(),
@@ -47,11 +84,13 @@ func NewService(name, host string, port int, healthCheckPath string) *Service {
 		Port:            port,
 		Protocol:        "http", // Default
 		HealthCheckPath: healthCheckPath,
+		HealthCheckType: HealthCheckHTTP,
 		Status:          StatusHealthy,
 		Metadata:        make(map[string]string),
 		RegisteredAt:    time.Now(),
 		LastCheckedAt:   time.Now(),
 		FailureCount:    0,
+		LastHeartbeatAt: time.Now(),
 	}
 }
 
@@ -68,21 +107,46 @@ func (s *Service) HealthCheckURL() string {
 }
 
 // MarkHealthy marks the service as healthy and resets the failure count.
-// This should be called when a health check succeeds.
+// This should be called when a health check succeeds. A draining service
+// stays draining.
 func (s *Service) MarkHealthy() {
-	s.Status = StatusHealthy
+	if s.Status != StatusDraining {
+		s.Status = StatusHealthy
+	}
 	s.FailureCount = 0
 	s.LastCheckedAt = time.Now()
 }
 
 // MarkUnhealthy increments the failure count and marks as unhealthy if threshold reached.
 // The threshold parameter specifies how many consecutive failures trigger unhealthy status.
-// This should be called when a health check fails.
+// This should be called when a health check fails. A draining service stays draining.
 func (s *Service) MarkUnhealthy(threshold int) {
 	s.FailureCount++
 	s.LastCheckedAt = time.Now()
 
-	if s.FailureCount >= threshold {
+	if s.FailureCount >= threshold && s.Status != StatusDraining {
 		s.Status = StatusUnhealthy
 	}
 }
+
+// HasLease reports whether the service was registered with a lease TTL.
+// Leased services are expired by the lease reaper when heartbeats stop.
+func (s *Service) HasLease() bool {
+	return s.LeaseTTL > 0
+}
+
+// LeaseExpiresAt returns the time at which the current lease runs out.
+// The result is meaningless for services without a lease.
+func (s *Service) LeaseExpiresAt() time.Time {
+	return s.LastHeartbeatAt.Add(time.Duration(s.LeaseTTL) * time.Second)
+}
+
+// LeaseExpired reports whether the service holds a lease that has run out at the given time.
+func (s *Service) LeaseExpired(now time.Time) bool {
+	return s.HasLease() && now.After(s.LeaseExpiresAt())
+}
+
+// RenewLease records a heartbeat, extending the lease by another TTL.
+func (s *Service) RenewLease() {
+	s.LastHeartbeatAt = time.Now()
+}
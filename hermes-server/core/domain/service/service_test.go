@@ -137,3 +137,37 @@ func TestService_Metadata(t *testing.T) {
 		t.Errorf("Expected metadata environment 'production', got %s", svc.Metadata["environment"])
 	}
 }
+
+func TestService_Lease(t *testing.T) {
+	svc := NewService("test-service", "localhost", 8080, "/health")
+	now := time.Now()
+
+	if svc.HasLease() || svc.LeaseExpired(now.Add(time.Hour)) {
+		t.Error("Expected service without TTL to hold no lease")
+	}
+
+	svc.LeaseTTL = 30
+	svc.LastHeartbeatAt = now.Add(-20 * time.Second)
+	if svc.LeaseExpired(now) {
+		t.Error("Expected lease to still be valid after 20s of a 30s TTL")
+	}
+	if !svc.LeaseExpired(now.Add(15 * time.Second)) {
+		t.Error("Expected lease to be expired after 35s of a 30s TTL")
+	}
+
+	svc.RenewLease()
+	if svc.LeaseExpired(now.Add(15 * time.Second)) {
+		t.Error("Expected renewed lease to be valid")
+	}
+}
+
+func TestService_MarkKeepsDraining(t *testing.T) {
+	svc := NewService("test-service", "localhost", 8080, "/health")
+	svc.Status = StatusDraining
+
+	svc.MarkHealthy()
+	svc.MarkUnhealthy(1)
+	if svc.Status != StatusDraining {
+		t.Errorf("Expected status %s, got %s", StatusDraining, svc.Status)
+	}
+}
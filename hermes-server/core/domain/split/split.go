@@ -0,0 +1,96 @@
+// Package split defines the weighted traffic splits applied to routed services.
+package split
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Target is a variant of a service: the instances whose metadata contains
+// all of Selector, and the share of requests they receive. A target with an
+// empty selector takes the instances selected by no other target.
+type Target struct {
+	Name     string            `json:"name"`
+	Selector map[string]string `json:"selector,omitempty"`
+	Weight   int               `json:"weight"`
+}
+
+// TrafficSplit divides the requests to a service between its targets in
+// proportion to their weights. Instances selected by no target get no
+// traffic while the split is in effect. When StickyCookie is set, clients are
+// kept on the variant named by that cookie as long as it has a weight.
+type TrafficSplit struct {
+	ServiceName  string    `json:"service_name"`
+	Targets      []Target  `json:"targets"`
+	StickyCookie string    `json:"sticky_cookie,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Validate checks that the split names a service and has uniquely named
+// targets, non-negative weights of which at least one is positive, at most
+// one catch-all target, and a valid cookie name.
+func (s *TrafficSplit) Validate() error {
+	if s.ServiceName == "" {
+		return errors.New("service name is required")
+	}
+	if len(s.Targets) == 0 {
+		return errors.New("at least one target is required")
+	}
+
+	names := make(map[string]bool, len(s.Targets))
+	total, catchAll := 0, 0
+	for _, t := range s.Targets {
+		if t.Name == "" {
+			return errors.New("targets must be named")
+		}
+		if names[t.Name] {
+			return errors.New("target names must be unique")
+		}
+		names[t.Name] = true
+		if t.Weight < 0 {
+			return errors.New("weights must not be negative")
+		}
+		total += t.Weight
+		if len(t.Selector) == 0 {
+			catchAll++
+		}
+	}
+	if total == 0 {
+		return errors.New("at least one target needs a positive weight")
+	}
+	if catchAll > 1 {
+		return errors.New("at most one target may have an empty selector")
+	}
+	if s.StickyCookie != "" && strings.ContainsAny(s.StickyCookie, " \t;,=\"()<>@:/\\[]?{}") {
+		return errors.New("invalid sticky_cookie name")
+	}
+	return nil
+}
+
+// TargetFor returns the index of the target an instance with the given
+// metadata belongs to, or -1 if it belongs to none. Targets with a selector
+// are tried in order before the catch-all target.
+func (s *TrafficSplit) TargetFor(metadata map[string]string) int {
+	catchAll := -1
+	for i, t := range s.Targets {
+		if len(t.Selector) == 0 {
+			catchAll = i
+			continue
+		}
+		if selects(t.Selector, metadata) {
+			return i
+		}
+	}
+	return catchAll
+}
+
+// selects reports whether metadata contains all key-value pairs of selector.
+func selects(selector, metadata map[string]string) bool {
+	for key, value := range selector {
+		if v, exists := metadata[key]; !exists || v != value {
+			return false
+		}
+	}
+	return true
+}
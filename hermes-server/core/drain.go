@@ -0,0 +1,147 @@
+package core
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"nfcunha/hermes/hermes-server/core/domain/service"
+)
+
+// DrainManager coordinates graceful removal of service instances.
+// A draining instance no longer receives new requests from the RoutingService;
+// once its in-flight count drops to zero, or its drain deadline passes,
+// it is deregistered from the registry.
+type DrainManager struct {
+	registry       *ServiceRegistry
+	inflight       *InFlightTracker
+	interval       time.Duration
+	defaultTimeout time.Duration
+	deadlines      map[string]time.Time // Key: service ID
+	mu             sync.Mutex
+	stopChan       chan struct{}
+}
+
+// NewDrainManager creates a drain manager that checks draining instances every
+// interval. Drains started without an explicit timeout use defaultTimeout.
+func NewDrainManager(reg *ServiceRegistry, inflight *InFlightTracker, interval, defaultTimeout time.Duration) *DrainManager {
+	return &DrainManager{
+		registry:       reg,
+		inflight:       inflight,
+		interval:       interval,
+		defaultTimeout: defaultTimeout,
+		deadlines:      make(map[string]time.Time),
+		stopChan:       make(chan struct{}),
+	}
+}
+
+// Drain puts a service instance into draining mode.
+// The instance is deregistered once it has no in-flight requests or when
+// timeout elapses (0 means use the default timeout). Draining an instance
+// that is already draining keeps its original deadline.
+// Returns an error if the service is not found.
+func (d *DrainManager) Drain(id string, timeout time.Duration) (*service.Service, error) {
+	if timeout <= 0 {
+		timeout = d.defaultTimeout
+	}
+
+	svc, err := d.registry.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, exists := d.deadlines[id]; exists {
+		return svc, nil
+	}
+
+	if err := d.registry.UpdateStatus(id, service.StatusDraining); err != nil {
+		log.Printf("Failed to mark service %s as draining: %v", id, err)
+		return nil, errors.New("failed to drain service")
+	}
+	d.deadlines[id] = time.Now().Add(timeout)
+
+	log.Printf("Draining service %s (%s), deadline in %v", svc.Name, svc.ID, timeout)
+	return svc, nil
+}
+
+// Deadline returns the drain deadline of an instance, if it is draining.
+func (d *DrainManager) Deadline(id string) (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	deadline, exists := d.deadlines[id]
+	return deadline, exists
+}
+
+// Start begins periodic drain processing in the current goroutine.
+// This method blocks until Stop() is called, so it should typically be
+// run in a separate goroutine using: go drainer.Start()
+func (d *DrainManager) Start() {
+	log.Printf("Starting drain manager: interval=%v, default timeout=%v", d.interval, d.defaultTimeout)
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.process(time.Now())
+		case <-d.stopChan:
+			log.Println("Drain manager stopped")
+			return
+		}
+	}
+}
+
+// Stop signals the drain manager to stop.
+func (d *DrainManager) Stop() {
+	close(d.stopChan)
+}
+
+// process deregisters draining instances that are idle or past their deadline.
+// Instances found draining without a tracked deadline (for example after a
+// restart) are adopted with the default timeout.
+func (d *DrainManager) process(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	present := make(map[string]bool)
+	for _, svc := range d.registry.List() {
+		if svc.Status != service.StatusDraining {
+			continue
+		}
+		present[svc.ID] = true
+
+		deadline, exists := d.deadlines[svc.ID]
+		if !exists {
+			deadline = now.Add(d.defaultTimeout)
+			d.deadlines[svc.ID] = deadline
+		}
+
+		inflight := d.inflight.Count(svc.ID)
+		if inflight > 0 && now.Before(deadline) {
+			continue
+		}
+
+		if inflight > 0 {
+			log.Printf("Drain deadline passed for %s (%s) with %d requests in flight", svc.Name, svc.ID, inflight)
+		}
+		if err := d.registry.Deregister(svc.ID); err != nil {
+			log.Printf("Failed to deregister drained service %s: %v", svc.ID, err)
+			continue
+		}
+		delete(d.deadlines, svc.ID)
+		delete(present, svc.ID)
+	}
+
+	// Forget instances that were removed or revived by other means
+	for id := range d.deadlines {
+		if !present[id] {
+			delete(d.deadlines, id)
+		}
+	}
+}
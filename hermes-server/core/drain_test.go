@@ -0,0 +1,108 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"nfcunha/hermes/hermes-server/core/domain/service"
+)
+
+func TestDrainManager_DeregistersWhenIdle(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	reg := NewServiceRegistry(db)
+	inflight := NewInFlightTracker()
+	drainer := NewDrainManager(reg, inflight, time.Second, time.Minute)
+
+	svc := service.NewService("api", "localhost", 8080, "/health")
+	other := service.NewService("api", "localhost", 8081, "/health")
+	reg.Register(svc)
+	reg.Register(other)
+
+	inflight.Acquire(svc.ID)
+	if _, err := drainer.Drain(svc.ID, 0); err != nil {
+		t.Fatalf("Expected drain to succeed, got %v", err)
+	}
+
+	// New requests only go to the remaining instance
+	healthy := reg.GetHealthy("api")
+	if len(healthy) != 1 || healthy[0].ID != other.ID {
+		t.Fatalf("Expected only %s to be routable, got %d instances", other.ID, len(healthy))
+	}
+
+	// In-flight request keeps the instance registered
+	drainer.process(time.Now())
+	if _, err := reg.GetByID(svc.ID); err != nil {
+		t.Fatal("Expected draining instance with in-flight requests to remain registered")
+	}
+
+	// Once idle, it is deregistered
+	inflight.Release(svc.ID)
+	drainer.process(time.Now())
+	if _, err := reg.GetByID(svc.ID); err == nil {
+		t.Error("Expected idle draining instance to be deregistered")
+	}
+	if _, exists := drainer.Deadline(svc.ID); exists {
+		t.Error("Expected drain deadline to be cleared after removal")
+	}
+}
+
+func TestDrainManager_DeadlineForcesRemoval(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	reg := NewServiceRegistry(db)
+	inflight := NewInFlightTracker()
+	drainer := NewDrainManager(reg, inflight, time.Second, time.Minute)
+
+	svc := service.NewService("api", "localhost", 8080, "/health")
+	reg.Register(svc)
+
+	inflight.Acquire(svc.ID)
+	drainer.Drain(svc.ID, 5*time.Second)
+
+	drainer.process(time.Now().Add(time.Second))
+	if _, err := reg.GetByID(svc.ID); err != nil {
+		t.Fatal("Expected instance to remain registered before the deadline")
+	}
+
+	drainer.process(time.Now().Add(6 * time.Second))
+	if _, err := reg.GetByID(svc.ID); err == nil {
+		t.Error("Expected instance to be deregistered after the deadline")
+	}
+}
+
+func TestDrainManager_AdoptsPersistedDrainingInstances(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	reg := NewServiceRegistry(db)
+	inflight := NewInFlightTracker()
+	drainer := NewDrainManager(reg, inflight, time.Second, time.Minute)
+
+	svc := service.NewService("api", "localhost", 8080, "/health")
+	svc.Status = service.StatusDraining
+	reg.Register(svc)
+	inflight.Acquire(svc.ID)
+
+	now := time.Now()
+	drainer.process(now)
+	deadline, exists := drainer.Deadline(svc.ID)
+	if !exists {
+		t.Fatal("Expected draining instance to be adopted")
+	}
+	if !deadline.Equal(now.Add(time.Minute)) {
+		t.Errorf("Expected default deadline %v, got %v", now.Add(time.Minute), deadline)
+	}
+}
+
+func TestDrainManager_NotFound(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	drainer := NewDrainManager(NewServiceRegistry(db), NewInFlightTracker(), time.Second, time.Minute)
+	if _, err := drainer.Drain("non-existent-id", 0); err == nil {
+		t.Error("Expected error draining unknown service")
+	}
+}
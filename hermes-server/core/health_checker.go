@@ -2,45 +2,67 @@ package core
 
 import (
 	"context"
-	"io"
 	"log"
-	"net/http"
+	"math/rand"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"nfcunha/hermes/hermes-server/core/domain/healthlog"
 	"nfcunha/hermes/hermes-server/core/domain/service"
 )
 
+// healthScheduleTick is how often the checker looks for services whose next
+// check is due. It bounds how precisely per-service intervals are honoured.
+const healthScheduleTick = 250 * time.Millisecond
+
+// healthCheckJitter is the fraction of the interval by which each scheduled
+// check is randomly moved, so that services registered together do not keep
+// being checked in lockstep.
+const healthCheckJitter = 0.1
+
 // HealthChecker performs periodic health checks on registered services.
 // It runs in a background goroutine and updates service status based on
-// health check results. Health check logs are persisted to the database
-// for historical analysis and debugging.
+// health check results. Each service is checked according to its health
+// check type (see HealthProber) on its own schedule: services may override
+// the global interval, timeout and failure threshold at registration.
+// Health check logs are persisted to the database for historical analysis
+// and debugging.
 type HealthChecker struct {
 	registry         *ServiceRegistry
-	client           *http.Client
+	prober           *HealthProber
 	interval         time.Duration
 	timeout          time.Duration
 	failureThreshold int
+	tick             time.Duration
+	schedule         map[string]time.Time // Key: service ID, value: next check
+	running          map[string]bool      // Key: service ID, checks in progress
+	mu               sync.Mutex
 	stopChan         chan struct{}
 	healthLogRepo    *healthlog.Repository
+	metrics          *Metrics
 }
 
-// NewHealthChecker creates a new health checker with the given registry and health log repository.
-// Configuration is loaded from environment variables:
+// NewHealthChecker creates a new health checker with the given registry, health log
+// repository and metrics (which may be nil).
+// Default settings are loaded from environment variables:
 //   - HERMES_HEALTH_CHECK_INTERVAL: how often to check (default: 30s)
-//   - HERMES_HEALTH_CHECK_TIMEOUT: HTTP timeout for checks (default: 5s)
+//   - HERMES_HEALTH_CHECK_TIMEOUT: timeout for checks (default: 5s)
 //   - HERMES_HEALTH_CHECK_THRESHOLD: failures before marking unhealthy (default: 3)
-func NewHealthChecker(reg *ServiceRegistry, healthLogRepo *healthlog.Repository) *HealthChecker {
+func NewHealthChecker(reg *ServiceRegistry, healthLogRepo *healthlog.Repository, metrics *Metrics) *HealthChecker {
 	return &HealthChecker{
 		registry:         reg,
-		client:           &http.Client{Timeout: getTimeout()},
+		prober:           NewHealthProber(),
 		interval:         getInterval(),
 		timeout:          getTimeout(),
 		failureThreshold: getFailureThreshold(),
+		tick:             healthScheduleTick,
+		schedule:         make(map[string]time.Time),
+		running:          make(map[string]bool),
 		stopChan:         make(chan struct{}),
 		healthLogRepo:    healthLogRepo,
+		metrics:          metrics,
 	}
 }
 
@@ -48,16 +70,16 @@ func NewHealthChecker(reg *ServiceRegistry, healthLogRepo *healthlog.Repository)
 // This method blocks until Stop() is called, so it should typically be
 // run in a separate goroutine using: go checker.Start()
 func (c *HealthChecker) Start() {
-	log.Printf("Starting health checker: interval=%v, timeout=%v, threshold=%d",
+	log.Printf("Starting health checker: interval=%v, timeout=%v, threshold=%d (per-service overrides apply)",
 		c.interval, c.timeout, c.failureThreshold)
 
-	ticker := time.NewTicker(c.interval)
+	ticker := time.NewTicker(c.tick)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
-			c.checkAll()
+		case now := <-ticker.C:
+			c.checkDue(now)
 		case <-c.stopChan:
 			log.Println("Health checker stopped")
 			return
@@ -71,71 +93,123 @@ func (c *HealthChecker) Stop() {
 	close(c.stopChan)
 }
 
-// checkAll checks health of all registered services
-func (c *HealthChecker) checkAll() {
+// checkDue starts a check for every service whose next check time has come.
+// Newly seen services get a random first check time within their interval;
+// services that are no longer registered are dropped from the schedule.
+func (c *HealthChecker) checkDue(now time.Time) {
 	services := c.registry.List()
 
-	log.Printf("Running health checks for %d services", len(services))
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
+	seen := make(map[string]bool, len(services))
 	for _, svc := range services {
-		go c.check(svc)
+		seen[svc.ID] = true
+
+		// Draining instances are on their way out; checks must not revive them
+		if svc.Status == service.StatusDraining {
+			continue
+		}
+
+		interval := c.intervalFor(svc)
+		next, scheduled := c.schedule[svc.ID]
+		if !scheduled {
+			c.schedule[svc.ID] = now.Add(time.Duration(rand.Int63n(int64(interval))))
+			continue
+		}
+		if now.Before(next) || c.running[svc.ID] {
+			continue
+		}
+
+		c.schedule[svc.ID] = now.Add(jitter(interval))
+		c.running[svc.ID] = true
+		go func(svc *service.Service) {
+			c.check(svc)
+
+			c.mu.Lock()
+			delete(c.running, svc.ID)
+			c.mu.Unlock()
+		}(svc)
+	}
+
+	for id := range c.schedule {
+		if !seen[id] {
+			delete(c.schedule, id)
+		}
 	}
 }
 
-// check performs health check on a single service
-func (c *HealthChecker) check(svc *service.Service) {
-	startTime := time.Now()
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
-	defer cancel()
+// intervalFor returns the check interval of a service.
+func (c *HealthChecker) intervalFor(svc *service.Service) time.Duration {
+	if svc.HealthInterval > 0 {
+		return time.Duration(svc.HealthInterval) * time.Second
+	}
+	return c.interval
+}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", svc.HealthCheckURL(), nil)
-	if err != nil {
-		log.Printf("Failed to create health check request for %s: %v", svc.Name, err)
-		c.logHealthCheck(svc.ID, "error", err.Error(), "", 0)
-		c.handleFailure(svc)
-		return
+// timeoutFor returns the check timeout of a service.
+func (c *HealthChecker) timeoutFor(svc *service.Service) time.Duration {
+	if svc.HealthTimeout > 0 {
+		return time.Duration(svc.HealthTimeout) * time.Second
 	}
+	return c.timeout
+}
 
-	resp, err := c.client.Do(req)
-	responseTime := time.Since(startTime).Milliseconds()
+// HealthCheckTimeout returns the check timeout of a service: its own timeout,
+// or HERMES_HEALTH_CHECK_TIMEOUT. It is used for checks made outside the
+// health checker, such as the one made when a service registers.
+func HealthCheckTimeout(svc *service.Service) time.Duration {
+	if svc.HealthTimeout > 0 {
+		return time.Duration(svc.HealthTimeout) * time.Second
+	}
+	return getTimeout()
+}
 
-	if err != nil {
-		log.Printf("Health check failed for %s (%s): %v", svc.Name, svc.ID, err)
-		c.logHealthCheck(svc.ID, "unhealthy", err.Error(), "", responseTime)
-		c.handleFailure(svc)
-		return
+// thresholdFor returns the number of failures that mark a service unhealthy.
+func (c *HealthChecker) thresholdFor(svc *service.Service) int {
+	if svc.HealthThreshold > 0 {
+		return svc.HealthThreshold
 	}
-	defer resp.Body.Close()
+	return c.failureThreshold
+}
 
-	// Read response body (limit to 10KB to avoid memory issues)
-	bodyBytes, err := io.ReadAll(io.LimitReader(resp.Body, 10*1024))
-	responseBody := ""
-	if err == nil {
-		responseBody = string(bodyBytes)
+// jitter returns the interval moved randomly by up to healthCheckJitter in either direction.
+func jitter(interval time.Duration) time.Duration {
+	spread := int64(float64(interval) * healthCheckJitter)
+	if spread <= 0 {
+		return interval
 	}
+	return interval + time.Duration(rand.Int63n(2*spread+1)-spread)
+}
 
-	// Consider 2xx status codes as healthy
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		svc.MarkHealthy()
-		// Persist status change to database
-		if err := c.registry.UpdateStatus(svc.ID, svc.Status); err != nil {
+// check performs a health check on a single service using its health check type
+func (c *HealthChecker) check(svc *service.Service) {
+	startTime := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeoutFor(svc))
+	defer cancel()
+
+	result := c.prober.Probe(ctx, svc)
+	elapsed := time.Since(startTime)
+	responseTime := elapsed.Milliseconds()
+	c.metrics.ObserveHealthCheck(svc.Name, svc.ID, result.Status, elapsed)
+
+	if result.Healthy() {
+		if err := c.registry.RecordHealthCheck(svc.ID, true, c.thresholdFor(svc)); err != nil {
 			log.Printf("Failed to persist healthy status for %s: %v", svc.Name, err)
 		}
-		c.logHealthCheck(svc.ID, "healthy", "", responseBody, responseTime)
-		log.Printf("Health check passed for %s (%s): status=%d, time=%dms", svc.Name, svc.ID, resp.StatusCode, responseTime)
-	} else {
-		errorMsg := "HTTP " + strconv.Itoa(resp.StatusCode)
-		log.Printf("Health check failed for %s (%s): status=%d", svc.Name, svc.ID, resp.StatusCode)
-		c.logHealthCheck(svc.ID, "unhealthy", errorMsg, responseBody, responseTime)
-		c.handleFailure(svc)
+		c.logHealthCheck(svc.ID, result.Status, "", result.Body, responseTime)
+		log.Printf("Health check passed for %s (%s): type=%s, time=%dms", svc.Name, svc.ID, svc.HealthCheckType, responseTime)
+		return
 	}
+
+	log.Printf("Health check failed for %s (%s): %s", svc.Name, svc.ID, result.Error)
+	c.logHealthCheck(svc.ID, result.Status, result.Error, result.Body, responseTime)
+	c.handleFailure(svc)
 }
 
 // handleFailure handles a failed health check
 func (c *HealthChecker) handleFailure(svc *service.Service) {
-	svc.MarkUnhealthy(c.failureThreshold)
-	// Persist status change to database
-	if err := c.registry.UpdateStatus(svc.ID, svc.Status); err != nil {
+	if err := c.registry.RecordHealthCheck(svc.ID, false, c.thresholdFor(svc)); err != nil {
 		log.Printf("Failed to persist unhealthy status for %s: %v", svc.Name, err)
 	}
 }
@@ -147,7 +221,7 @@ func getInterval() time.Duration {
 		return 30 * time.Second
 	}
 	duration, err := time.ParseDuration(val)
-	if err != nil {
+	if err != nil || duration <= 0 {
 		return 30 * time.Second
 	}
 	return duration
@@ -159,7 +233,7 @@ func getTimeout() time.Duration {
 		return 5 * time.Second
 	}
 	duration, err := time.ParseDuration(val)
-	if err != nil {
+	if err != nil || duration <= 0 {
 		return 5 * time.Second
 	}
 	return duration
@@ -171,7 +245,7 @@ func getFailureThreshold() int {
 		return 3
 	}
 	threshold, err := strconv.Atoi(val)
-	if err != nil {
+	if err != nil || threshold < 1 {
 		return 3
 	}
 	return threshold
@@ -0,0 +1,164 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"nfcunha/hermes/hermes-server/core/domain/service"
+)
+
+// waitForChecks waits until no health checks are running
+func waitForChecks(t *testing.T, checker *HealthChecker) {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		checker.mu.Lock()
+		running := len(checker.running)
+		checker.mu.Unlock()
+		if running == 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("Health checks did not finish in time")
+}
+
+func TestHealthChecker_PerServiceSchedule(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer backend.Close()
+
+	fast := registerTestBackend(t, reg, "fast", backend)
+	fast.HealthInterval = 1
+	fast.HealthThreshold = 1
+	slow := registerTestBackend(t, reg, "slow", backend)
+	slow.HealthInterval = 60
+
+	checker := NewHealthChecker(reg, nil, nil)
+	now := time.Now()
+
+	// First pass only schedules the services within their interval
+	checker.checkDue(now)
+	if next := checker.schedule[fast.ID]; next.After(now.Add(time.Second)) {
+		t.Errorf("Expected first check of fast service within 1s, got %v", next.Sub(now))
+	}
+
+	checker.checkDue(now.Add(2 * time.Second))
+	waitForChecks(t, checker)
+
+	if fast.Status != service.StatusUnhealthy {
+		t.Errorf("Expected fast service to be unhealthy after one failure (threshold 1), got %s", fast.Status)
+	}
+	if next := checker.schedule[slow.ID]; next.After(now.Add(70 * time.Second)) {
+		t.Errorf("Expected slow service to be scheduled within its own 60s interval, got %v", next.Sub(now))
+	}
+	if next := checker.schedule[fast.ID]; next.Before(now.Add(2900*time.Millisecond)) || next.After(now.Add(3100*time.Millisecond)) {
+		t.Errorf("Expected next check of fast service about 1s later, got %v", next.Sub(now))
+	}
+}
+
+func TestHealthChecker_DropsDeregisteredServices(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+
+	svc := service.NewService("api", "localhost", 8080, "/health")
+	reg.Register(svc)
+
+	checker := NewHealthChecker(reg, nil, nil)
+	checker.checkDue(time.Now())
+	if _, scheduled := checker.schedule[svc.ID]; !scheduled {
+		t.Fatal("Expected service to be scheduled")
+	}
+
+	reg.Deregister(svc.ID)
+	checker.checkDue(time.Now())
+	if _, scheduled := checker.schedule[svc.ID]; scheduled {
+		t.Error("Expected deregistered service to be dropped from the schedule")
+	}
+}
+
+func TestHealthChecker_Overrides(t *testing.T) {
+	checker := &HealthChecker{interval: 30 * time.Second, timeout: 5 * time.Second, failureThreshold: 3}
+	svc := service.NewService("api", "localhost", 8080, "/health")
+
+	if checker.intervalFor(svc) != 30*time.Second || checker.timeoutFor(svc) != 5*time.Second || checker.thresholdFor(svc) != 3 {
+		t.Error("Expected global defaults without overrides")
+	}
+
+	svc.HealthInterval, svc.HealthTimeout, svc.HealthThreshold = 10, 2, 5
+	if checker.intervalFor(svc) != 10*time.Second || checker.timeoutFor(svc) != 2*time.Second || checker.thresholdFor(svc) != 5 {
+		t.Error("Expected per-service overrides to apply")
+	}
+}
+
+func TestHealthCheckTimeout(t *testing.T) {
+	t.Setenv("HERMES_HEALTH_CHECK_TIMEOUT", "8s")
+	svc := service.NewService("api", "localhost", 8080, "/health")
+
+	if got := HealthCheckTimeout(svc); got != 8*time.Second {
+		t.Errorf("Expected the global timeout without an override, got %v", got)
+	}
+	svc.HealthTimeout = 2
+	if got := HealthCheckTimeout(svc); got != 2*time.Second {
+		t.Errorf("Expected the service's own timeout, got %v", got)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if got := jitter(10 * time.Second); got < 9*time.Second || got > 11*time.Second {
+			t.Fatalf("Expected jittered interval within 10%% of 10s, got %v", got)
+		}
+	}
+}
+
+func TestHealthChecker_InFlightCheckKeepsDrain(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+
+	probing := make(chan struct{}, 1)
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probing <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	svc := registerTestBackend(t, reg, "api", backend)
+	drainer := NewDrainManager(reg, NewInFlightTracker(), time.Second, time.Minute)
+	checker := NewHealthChecker(reg, nil, nil)
+
+	// Start a check, and drain the instance while the probe is running
+	now := time.Now()
+	checker.schedule[svc.ID] = now
+	checker.checkDue(now)
+	select {
+	case <-probing:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a health check to be running")
+	}
+	if _, err := drainer.Drain(svc.ID, 0); err != nil {
+		t.Fatalf("Failed to drain: %v", err)
+	}
+	close(release)
+	waitForChecks(t, checker)
+
+	if svc.Status != service.StatusDraining {
+		t.Errorf("Expected the passing check to keep the instance draining, got %s", svc.Status)
+	}
+	if restored, _ := NewServiceRegistry(db).GetByID(svc.ID); restored.Status != service.StatusDraining {
+		t.Errorf("Expected the draining status to be persisted, got %s", restored.Status)
+	}
+	if err := reg.UpdateStatus(svc.ID, service.StatusHealthy); err == nil || svc.Status != service.StatusDraining {
+		t.Errorf("Expected a draining instance not to be revived, got %s (err: %v)", svc.Status, err)
+	}
+}
@@ -0,0 +1,266 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/http2"
+	"nfcunha/hermes/hermes-server/core/domain/service"
+)
+
+// maxHealthBodyBytes limits how much of a health check response is read.
+const maxHealthBodyBytes = 10 * 1024 // 10KB
+
+// gRPC health checking protocol (grpc.health.v1) serving statuses.
+const (
+	grpcHealthUnknown        = 0
+	grpcHealthServing        = 1
+	grpcHealthNotServing     = 2
+	grpcHealthServiceUnknown = 3
+)
+
+// HealthProbeResult is the outcome of a single health check.
+type HealthProbeResult struct {
+	Status string // "healthy", "unhealthy", or "error" (the check could not be run)
+	Error  string // Why the check failed, empty when healthy
+	Body   string // Response body, for HTTP-based checks
+}
+
+// Healthy reports whether the probed instance is healthy.
+func (r HealthProbeResult) Healthy() bool {
+	return r.Status == "healthy"
+}
+
+// HealthProber runs a single health check against a service instance using
+// the check type the instance was registered with.
+type HealthProber struct {
+	client     *http.Client // HTTP checks
+	grpcClient *http.Client // gRPC checks over TLS
+	h2cClient  *http.Client // gRPC checks over cleartext HTTP/2
+}
+
+// NewHealthProber creates a health prober. Timeouts are taken from the
+// context passed to Probe.
+func NewHealthProber() *HealthProber {
+	return &HealthProber{
+		client:     &http.Client{},
+		grpcClient: &http.Client{Transport: &http2.Transport{}},
+		h2cClient: &http.Client{Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, addr)
+			},
+		}},
+	}
+}
+
+// Probe checks the health of an instance, dispatching on its health check type.
+func (p *HealthProber) Probe(ctx context.Context, svc *service.Service) HealthProbeResult {
+	switch svc.HealthCheckType {
+	case service.HealthCheckTCP:
+		return p.probeTCP(ctx, svc)
+	case service.HealthCheckGRPC:
+		return p.probeGRPC(ctx, svc)
+	case service.HealthCheckHTTPExpect:
+		return p.probeHTTP(ctx, svc, true)
+	default:
+		return p.probeHTTP(ctx, svc, false)
+	}
+}
+
+// probeHTTP sends a GET to the health check URL. Without expectations any
+// 2xx status is healthy; with them the status and body must match.
+func (p *HealthProber) probeHTTP(ctx context.Context, svc *service.Service, expect bool) HealthProbeResult {
+	req, err := http.NewRequestWithContext(ctx, "GET", svc.HealthCheckURL(), nil)
+	if err != nil {
+		return HealthProbeResult{Status: "error", Error: err.Error()}
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return HealthProbeResult{Status: "unhealthy", Error: err.Error()}
+	}
+	defer resp.Body.Close()
+
+	// Read response body (limit to 10KB to avoid memory issues)
+	bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, maxHealthBodyBytes))
+	body := string(bodyBytes)
+
+	statusOK := resp.StatusCode >= 200 && resp.StatusCode < 300
+	if expect && svc.ExpectStatus != 0 {
+		statusOK = resp.StatusCode == svc.ExpectStatus
+	}
+	if !statusOK {
+		return HealthProbeResult{Status: "unhealthy", Error: "HTTP " + strconv.Itoa(resp.StatusCode), Body: body}
+	}
+
+	if expect && svc.ExpectBody != "" {
+		pattern, err := regexp.Compile(svc.ExpectBody)
+		if err != nil {
+			return HealthProbeResult{Status: "error", Error: "invalid expected body pattern: " + err.Error(), Body: body}
+		}
+		if !pattern.MatchString(body) {
+			return HealthProbeResult{Status: "unhealthy", Error: "response body does not match " + strconv.Quote(svc.ExpectBody), Body: body}
+		}
+	}
+
+	return HealthProbeResult{Status: "healthy", Body: body}
+}
+
+// probeTCP checks that a TCP connection to the instance can be opened.
+func (p *HealthProber) probeTCP(ctx context.Context, svc *service.Service) HealthProbeResult {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(svc.Host, strconv.Itoa(svc.Port)))
+	if err != nil {
+		return HealthProbeResult{Status: "unhealthy", Error: err.Error()}
+	}
+	conn.Close()
+	return HealthProbeResult{Status: "healthy"}
+}
+
+// probeGRPC calls grpc.health.v1.Health/Check over HTTP/2. Cleartext
+// instances are reached with h2c, https instances over TLS.
+func (p *HealthProber) probeGRPC(ctx context.Context, svc *service.Service) HealthProbeResult {
+	serviceName := strings.TrimPrefix(svc.HealthCheckPath, "/")
+	url := svc.BaseURL() + "/grpc.health.v1.Health/Check"
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(encodeGRPCHealthRequest(serviceName)))
+	if err != nil {
+		return HealthProbeResult{Status: "error", Error: err.Error()}
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	client := p.h2cClient
+	if svc.Protocol == "https" {
+		client = p.grpcClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return HealthProbeResult{Status: "unhealthy", Error: err.Error()}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return HealthProbeResult{Status: "unhealthy", Error: "HTTP " + strconv.Itoa(resp.StatusCode)}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHealthBodyBytes))
+	if err != nil {
+		return HealthProbeResult{Status: "unhealthy", Error: err.Error()}
+	}
+
+	// grpc-status is sent as a trailer, or as a header for trailers-only responses
+	grpcStatus := resp.Trailer.Get("Grpc-Status")
+	grpcMessage := resp.Trailer.Get("Grpc-Message")
+	if grpcStatus == "" {
+		grpcStatus = resp.Header.Get("Grpc-Status")
+		grpcMessage = resp.Header.Get("Grpc-Message")
+	}
+	if grpcStatus != "0" {
+		msg := "grpc-status " + grpcStatus
+		if grpcMessage != "" {
+			msg += ": " + grpcMessage
+		}
+		return HealthProbeResult{Status: "unhealthy", Error: msg}
+	}
+
+	status, err := decodeGRPCHealthResponse(body)
+	if err != nil {
+		return HealthProbeResult{Status: "unhealthy", Error: err.Error()}
+	}
+	if status != grpcHealthServing {
+		return HealthProbeResult{Status: "unhealthy", Error: "serving status " + grpcServingStatusName(status), Body: grpcServingStatusName(status)}
+	}
+	return HealthProbeResult{Status: "healthy", Body: grpcServingStatusName(status)}
+}
+
+// encodeGRPCHealthRequest builds a length-prefixed gRPC message holding a
+// HealthCheckRequest, whose only field is `string service = 1`.
+func encodeGRPCHealthRequest(serviceName string) []byte {
+	var msg []byte
+	if serviceName != "" {
+		msg = append(msg, 0x0a) // field 1, wire type 2 (length-delimited)
+		msg = binary.AppendUvarint(msg, uint64(len(serviceName)))
+		msg = append(msg, serviceName...)
+	}
+
+	frame := make([]byte, 5, 5+len(msg))
+	frame[0] = 0 // uncompressed
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+// decodeGRPCHealthResponse extracts the serving status from a length-prefixed
+// gRPC message holding a HealthCheckResponse (`ServingStatus status = 1`).
+func decodeGRPCHealthResponse(frame []byte) (uint64, error) {
+	if len(frame) < 5 {
+		return 0, errors.New("truncated grpc response")
+	}
+	if frame[0] != 0 {
+		return 0, errors.New("compressed grpc response not supported")
+	}
+	length := binary.BigEndian.Uint32(frame[1:5])
+	if uint32(len(frame)-5) < length {
+		return 0, errors.New("truncated grpc response")
+	}
+	msg := frame[5 : 5+length]
+
+	// Walk the fields; an absent status field means UNKNOWN (0)
+	status := uint64(grpcHealthUnknown)
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return 0, errors.New("malformed grpc response")
+		}
+		msg = msg[n:]
+
+		switch key & 0x7 {
+		case 0: // varint
+			val, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return 0, errors.New("malformed grpc response")
+			}
+			msg = msg[n:]
+			if key>>3 == 1 {
+				status = val
+			}
+		case 2: // length-delimited
+			size, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < size {
+				return 0, errors.New("malformed grpc response")
+			}
+			msg = msg[n+int(size):]
+		default:
+			return 0, errors.New("malformed grpc response")
+		}
+	}
+	return status, nil
+}
+
+// grpcServingStatusName returns the protocol name of a serving status.
+func grpcServingStatusName(status uint64) string {
+	switch status {
+	case grpcHealthUnknown:
+		return "UNKNOWN"
+	case grpcHealthServing:
+		return "SERVING"
+	case grpcHealthNotServing:
+		return "NOT_SERVING"
+	case grpcHealthServiceUnknown:
+		return "SERVICE_UNKNOWN"
+	default:
+		return fmt.Sprintf("status(%d)", status)
+	}
+}
@@ -0,0 +1,194 @@
+package core
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"nfcunha/hermes/hermes-server/core/domain/service"
+)
+
+// newProbeTarget creates a service pointing at the given test server URL
+func newProbeTarget(t *testing.T, rawURL string, checkType service.HealthCheckType, path string) *service.Service {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %v", err)
+	}
+	port, _ := strconv.Atoi(u.Port())
+	svc := service.NewService("probe", u.Hostname(), port, path)
+	svc.HealthCheckType = checkType
+	return svc
+}
+
+// probe runs a single health check with a short timeout
+func probe(svc *service.Service) HealthProbeResult {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return NewHealthProber().Probe(ctx, svc)
+}
+
+// newGRPCHealthServer starts a cleartext HTTP/2 server answering
+// grpc.health.v1.Health/Check with the serving status for the requested service
+func newGRPCHealthServer(t *testing.T, statuses map[string]uint64) *httptest.Server {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/grpc.health.v1.Health/Check" || r.Header.Get("Content-Type") != "application/grpc" {
+			t.Errorf("Unexpected gRPC request: %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		frame, _ := io.ReadAll(r.Body)
+
+		// Decode the requested service name (field 1) from the request message
+		name := ""
+		if len(frame) > 7 {
+			name = string(frame[7:])
+		}
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		status, known := statuses[name]
+		if !known {
+			w.Header().Set("Grpc-Status", "5") // NOT_FOUND, sent trailers-only
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		msg := []byte{0x08, byte(status)}
+		out := make([]byte, 5)
+		binary.BigEndian.PutUint32(out[1:], uint32(len(msg)))
+		w.Write(append(out, msg...))
+		w.Header().Set("Grpc-Status", "0")
+	})
+	return httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+}
+
+func TestHealthProber_HTTP(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			w.Write([]byte(`{"status":"ok"}`))
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer backend.Close()
+
+	if result := probe(newProbeTarget(t, backend.URL, service.HealthCheckHTTP, "/health")); !result.Healthy() {
+		t.Errorf("Expected healthy, got %+v", result)
+	}
+	result := probe(newProbeTarget(t, backend.URL, service.HealthCheckHTTP, "/down"))
+	if result.Status != "unhealthy" || result.Error != "HTTP 503" {
+		t.Errorf("Expected unhealthy with HTTP 503, got %+v", result)
+	}
+}
+
+func TestHealthProber_HTTPExpect(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"status":"degraded"}`))
+	}))
+	defer backend.Close()
+
+	tests := []struct {
+		name         string
+		expectStatus int
+		expectBody   string
+		healthy      bool
+	}{
+		{name: "status matches", expectStatus: http.StatusAccepted, healthy: true},
+		{name: "status differs", expectStatus: http.StatusOK, healthy: false},
+		{name: "body matches", expectBody: `"status":"(ok|degraded)"`, healthy: true},
+		{name: "body differs", expectBody: `"status":"ok"`, healthy: false},
+	}
+
+	for _, tt := range tests {
+		svc := newProbeTarget(t, backend.URL, service.HealthCheckHTTPExpect, "/health")
+		svc.ExpectStatus = tt.expectStatus
+		svc.ExpectBody = tt.expectBody
+		if result := probe(svc); result.Healthy() != tt.healthy {
+			t.Errorf("%s: expected healthy=%v, got %+v", tt.name, tt.healthy, result)
+		}
+	}
+}
+
+func TestHealthProber_TCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := "http://" + listener.Addr().String()
+
+	svc := newProbeTarget(t, addr, service.HealthCheckTCP, "")
+	if result := probe(svc); !result.Healthy() {
+		t.Errorf("Expected healthy while listening, got %+v", result)
+	}
+
+	listener.Close()
+	if result := probe(svc); result.Healthy() {
+		t.Error("Expected unhealthy after listener closed")
+	}
+}
+
+func TestHealthProber_GRPC(t *testing.T) {
+	backend := newGRPCHealthServer(t, map[string]uint64{
+		"":             grpcHealthServing,
+		"orders.v1":    grpcHealthServing,
+		"inventory.v1": grpcHealthNotServing,
+	})
+	defer backend.Close()
+
+	tests := []struct {
+		name    string
+		path    string
+		healthy bool
+	}{
+		{name: "whole server", path: "", healthy: true},
+		{name: "serving service", path: "orders.v1", healthy: true},
+		{name: "not serving service", path: "inventory.v1", healthy: false},
+		{name: "unknown service", path: "payments.v1", healthy: false},
+	}
+
+	for _, tt := range tests {
+		result := probe(newProbeTarget(t, backend.URL, service.HealthCheckGRPC, tt.path))
+		if result.Healthy() != tt.healthy {
+			t.Errorf("%s: expected healthy=%v, got %+v", tt.name, tt.healthy, result)
+		}
+	}
+}
+
+func TestDecodeGRPCHealthResponse(t *testing.T) {
+	// Empty message: status field absent means UNKNOWN
+	if status, err := decodeGRPCHealthResponse([]byte{0, 0, 0, 0, 0}); err != nil || status != grpcHealthUnknown {
+		t.Errorf("Expected UNKNOWN for empty message, got %d (%v)", status, err)
+	}
+	if _, err := decodeGRPCHealthResponse([]byte{0, 0, 0, 0, 2, 0x08}); err == nil {
+		t.Error("Expected error for truncated message")
+	}
+}
+
+func TestRegistry_HealthCheckTypePersistence(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	reg := NewServiceRegistry(db)
+	svc := service.NewService("search", "localhost", 9200, "/_cluster/health")
+	svc.HealthCheckType = service.HealthCheckHTTPExpect
+	svc.ExpectStatus = http.StatusOK
+	svc.ExpectBody = `"status":"green"`
+	reg.Register(svc)
+
+	retrieved, err := NewServiceRegistry(db).GetByID(svc.ID)
+	if err != nil {
+		t.Fatalf("Expected service after reload, got error: %v", err)
+	}
+	if retrieved.HealthCheckType != service.HealthCheckHTTPExpect || retrieved.ExpectStatus != http.StatusOK || retrieved.ExpectBody != svc.ExpectBody {
+		t.Errorf("Expected health check settings to survive reload, got type=%s status=%d body=%q",
+			retrieved.HealthCheckType, retrieved.ExpectStatus, retrieved.ExpectBody)
+	}
+}
@@ -0,0 +1,221 @@
+package core
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// jwksMinRefresh is the minimum time between two JWKS fetches, so tokens
+// with unknown key IDs cannot make Hermes hammer the JWKS endpoint.
+const jwksMinRefresh = 30 * time.Second
+
+// maxJWKSBytes limits how much of a JWKS response is read.
+const maxJWKSBytes = 1 << 20 // 1MB
+
+// JWKS fetches and caches the public keys Aegis signs tokens with. Keys are
+// refetched once the refresh interval has passed, or early (at most every
+// jwksMinRefresh) when a token names a key ID that is not cached. If a fetch
+// fails, the keys already cached are kept. Fetches happen outside the lock,
+// one at a time: while one is in progress, lookups of cached keys are served
+// at once and lookups of unknown key IDs wait for its result.
+type JWKS struct {
+	url             string
+	client          *http.Client
+	refreshInterval time.Duration
+	keys            map[string]jwk // Key: key ID
+	fetchedAt       time.Time
+	attemptedAt     time.Time
+	refreshing      chan struct{} // Closed once the fetch in progress is done, nil if none
+	mu              sync.Mutex
+}
+
+// jwk is a parsed JSON Web Key.
+type jwk struct {
+	alg string // Algorithm the key is restricted to, empty if any
+	key crypto.PublicKey
+}
+
+// NewJWKS creates a key cache for the JWKS document at url.
+func NewJWKS(url string, refreshInterval, timeout time.Duration) *JWKS {
+	return &JWKS{
+		url:             url,
+		client:          &http.Client{Timeout: timeout},
+		refreshInterval: refreshInterval,
+		keys:            make(map[string]jwk),
+	}
+}
+
+// key returns the public key with the given key ID.
+func (j *JWKS) key(kid string) (jwk, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	key, found := j.keys[kid]
+	stale := now.Sub(j.fetchedAt) >= j.refreshInterval
+	switch {
+	case (stale || !found) && j.refreshing == nil && now.Sub(j.attemptedAt) >= jwksMinRefresh:
+		j.attemptedAt = now
+		done := make(chan struct{})
+		j.refreshing = done
+		j.mu.Unlock()
+		keys, err := j.fetch()
+		j.mu.Lock()
+		if err != nil {
+			log.Printf("Failed to refresh JWKS from %s: %v", j.url, err)
+		} else {
+			j.keys = keys
+			j.fetchedAt = now
+			log.Printf("Loaded %d signing keys from JWKS", len(keys))
+		}
+		j.refreshing = nil
+		close(done)
+	case !found && j.refreshing != nil:
+		// The fetch in progress may bring the key
+		done := j.refreshing
+		j.mu.Unlock()
+		<-done
+		j.mu.Lock()
+	default:
+		return key, found
+	}
+	key, found = j.keys[kid]
+	return key, found
+}
+
+// fetch fetches and parses the key set.
+func (j *JWKS) fetch() (map[string]jwk, error) {
+	resp, err := j.client.Get(j.url)
+	if err != nil {
+		log.Printf("JWKS request failed: %v", err)
+		return nil, errors.New("JWKS request failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("JWKS endpoint returned status %d", resp.StatusCode)
+		return nil, errors.New("JWKS unavailable")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSBytes))
+	if err != nil {
+		log.Printf("Failed to read JWKS response: %v", err)
+		return nil, errors.New("failed to read JWKS")
+	}
+
+	return parseJWKS(body)
+}
+
+// parseJWKS parses a JWKS document. Keys that are not signing keys or whose
+// type is not supported (RSA, EC, Ed25519) are skipped.
+func parseJWKS(data []byte) (map[string]jwk, error) {
+	var doc struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Alg string `json:"alg"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		log.Printf("Failed to unmarshal JWKS: %v", err)
+		return nil, errors.New("invalid JWKS")
+	}
+
+	keys := make(map[string]jwk)
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var key crypto.PublicKey
+		var err error
+		switch k.Kty {
+		case "RSA":
+			key, err = parseRSAKey(k.N, k.E)
+		case "EC":
+			key, err = parseECKey(k.Crv, k.X, k.Y)
+		case "OKP":
+			key, err = parseEd25519Key(k.Crv, k.X)
+		default:
+			continue
+		}
+		if err != nil {
+			log.Printf("Skipping JWKS key %q: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = jwk{alg: k.Alg, key: key}
+	}
+	return keys, nil
+}
+
+func parseRSAKey(n, e string) (*rsa.PublicKey, error) {
+	modulus, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil || len(modulus) == 0 {
+		return nil, errors.New("invalid RSA modulus")
+	}
+	exponent, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil || len(exponent) == 0 || len(exponent) > 4 {
+		return nil, errors.New("invalid RSA exponent")
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(modulus),
+		E: int(new(big.Int).SetBytes(exponent).Int64()),
+	}, nil
+}
+
+func parseECKey(crv, x, y string) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, errors.New("unsupported curve")
+	}
+
+	xBytes, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil {
+		return nil, errors.New("invalid EC point")
+	}
+	yBytes, err := base64.RawURLEncoding.DecodeString(y)
+	if err != nil {
+		return nil, errors.New("invalid EC point")
+	}
+	key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(xBytes), Y: new(big.Int).SetBytes(yBytes)}
+	if !curve.IsOnCurve(key.X, key.Y) {
+		return nil, errors.New("invalid EC point")
+	}
+	return key, nil
+}
+
+func parseEd25519Key(crv, x string) (ed25519.PublicKey, error) {
+	if crv != "Ed25519" {
+		return nil, errors.New("unsupported curve")
+	}
+	key, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid Ed25519 key")
+	}
+	return ed25519.PublicKey(key), nil
+}
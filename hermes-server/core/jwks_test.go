@@ -0,0 +1,183 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ed25519JWK returns a JWK document entry for a new Ed25519 key
+func ed25519JWK(t *testing.T, kid string) map[string]string {
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %v", err)
+	}
+	return map[string]string{"kty": "OKP", "kid": kid, "crv": "Ed25519", "x": b64(public)}
+}
+
+// jwksServer serves the given keys as a JWKS, counting its calls. Requests
+// wait while hold is set, until release is closed.
+type jwksServer struct {
+	server  *httptest.Server
+	keys    atomic.Value // []map[string]string
+	calls   atomic.Int32
+	fail    atomic.Bool
+	hold    atomic.Bool
+	release chan struct{}
+}
+
+func newJWKSServer(t *testing.T, keys ...map[string]string) *jwksServer {
+	s := &jwksServer{release: make(chan struct{})}
+	s.keys.Store(keys)
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.calls.Add(1)
+		if s.hold.Load() {
+			<-s.release
+		}
+		if s.fail.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"keys": s.keys.Load()})
+	}))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+func TestParseJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EC key: %v", err)
+	}
+	rsaJWK := map[string]string{
+		"kty": "RSA", "kid": "rsa", "use": "sig", "alg": "RS256",
+		"n": b64(rsaKey.N.Bytes()),
+		"e": b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+	}
+	encJWK := map[string]string{"kty": "RSA", "kid": "enc", "use": "enc", "n": rsaJWK["n"], "e": rsaJWK["e"]}
+	data, _ := json.Marshal(map[string]any{"keys": []map[string]string{
+		rsaJWK,
+		encJWK,
+		{
+			"kty": "EC", "kid": "ec", "crv": "P-256",
+			"x": b64(ecKey.X.FillBytes(make([]byte, 32))),
+			"y": b64(ecKey.Y.FillBytes(make([]byte, 32))),
+		},
+		ed25519JWK(t, "ed"),
+		{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+		{"kty": "EC", "kid": "off-curve", "crv": "P-256", "x": b64([]byte{1}), "y": b64([]byte{2})},
+		{"kty": "OKP", "kid": "x25519", "crv": "X25519", "x": b64(make([]byte, 32))},
+	}})
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		t.Fatalf("Failed to parse JWKS: %v", err)
+	}
+	if len(keys) != 3 {
+		t.Errorf("Expected the RSA, EC and Ed25519 signing keys only, got %d keys", len(keys))
+	}
+	if key, ok := keys["rsa"].key.(*rsa.PublicKey); !ok || key.N.Cmp(rsaKey.N) != 0 || key.E != rsaKey.E || keys["rsa"].alg != "RS256" {
+		t.Errorf("Unexpected RSA key: %+v", keys["rsa"])
+	}
+	if key, ok := keys["ec"].key.(*ecdsa.PublicKey); !ok || !key.Equal(&ecKey.PublicKey) {
+		t.Errorf("Unexpected EC key: %+v", keys["ec"])
+	}
+	if _, ok := keys["ed"].key.(ed25519.PublicKey); !ok {
+		t.Errorf("Unexpected Ed25519 key: %+v", keys["ed"])
+	}
+
+	if _, err := parseJWKS([]byte("not json")); err == nil {
+		t.Error("Expected an invalid document to be rejected")
+	}
+}
+
+func TestJWKS_RefreshIsRateLimited(t *testing.T) {
+	server := newJWKSServer(t, ed25519JWK(t, "a"))
+	jwks := NewJWKS(server.server.URL, time.Hour, 5*time.Second)
+
+	if _, found := jwks.key("a"); !found || server.calls.Load() != 1 {
+		t.Fatalf("Expected the key to be fetched, found %v after %d calls", found, server.calls.Load())
+	}
+
+	// Unknown key IDs don't cause a fetch within jwksMinRefresh of the last one
+	for i := 0; i < 5; i++ {
+		if _, found := jwks.key("b"); found {
+			t.Fatal("Expected an unknown key ID not to be found")
+		}
+	}
+	if calls := server.calls.Load(); calls != 1 {
+		t.Errorf("Expected no refetch within the minimum interval, got %d calls", calls)
+	}
+
+	// Past it, an unknown key ID is looked up again
+	server.keys.Store([]map[string]string{ed25519JWK(t, "a"), ed25519JWK(t, "b")})
+	jwks.attemptedAt = time.Time{}
+	if _, found := jwks.key("b"); !found || server.calls.Load() != 2 {
+		t.Errorf("Expected the new key to be fetched, found %v after %d calls", found, server.calls.Load())
+	}
+
+	// A failed refresh keeps the cached keys
+	server.fail.Store(true)
+	jwks.fetchedAt = time.Time{}
+	jwks.attemptedAt = time.Time{}
+	if _, found := jwks.key("a"); !found || server.calls.Load() != 3 {
+		t.Errorf("Expected the cached key to be kept, found %v after %d calls", found, server.calls.Load())
+	}
+}
+
+func TestJWKS_SingleFetchOutsideTheLock(t *testing.T) {
+	server := newJWKSServer(t, ed25519JWK(t, "a"))
+	jwks := NewJWKS(server.server.URL, time.Hour, 5*time.Second)
+	if _, found := jwks.key("a"); !found {
+		t.Fatal("Expected the key to be fetched")
+	}
+
+	// A refresh is held up by the JWKS endpoint
+	server.keys.Store([]map[string]string{ed25519JWK(t, "a"), ed25519JWK(t, "b")})
+	server.hold.Store(true)
+	jwks.mu.Lock()
+	jwks.fetchedAt = time.Time{}
+	jwks.attemptedAt = time.Time{}
+	jwks.mu.Unlock()
+	go jwks.key("a")
+	waitFor(t, func() bool { return server.calls.Load() == 2 })
+
+	// Cached keys are served meanwhile
+	if _, found := jwks.key("a"); !found {
+		t.Error("Expected the cached key to be served during the refresh")
+	}
+
+	// Unknown key IDs wait for the refresh in progress rather than starting another
+	var wg sync.WaitGroup
+	var found atomic.Int32
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := jwks.key("b"); ok {
+				found.Add(1)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(server.release)
+	wg.Wait()
+
+	if found.Load() != 5 || server.calls.Load() != 2 {
+		t.Errorf("Expected all lookups to get the key from a single refresh, got %d found after %d calls", found.Load(), server.calls.Load())
+	}
+}
@@ -0,0 +1,206 @@
+package core
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	_ "crypto/sha256" // Register SHA-256 for crypto.Hash
+	_ "crypto/sha512" // Register SHA-384 and SHA-512 for crypto.Hash
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// jwtClockSkew is the tolerance applied to the exp and nbf claims to absorb
+// clock differences between Aegis and Hermes.
+const jwtClockSkew = 30 * time.Second
+
+// jwtHashes maps the supported signature algorithms to their hash.
+var jwtHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+	"EdDSA": 0, // Ed25519 signs the message itself
+}
+
+// ecdsaCurves maps the ECDSA algorithms to the curve their keys must use.
+var ecdsaCurves = map[string]string{"ES256": "P-256", "ES384": "P-384", "ES512": "P-521"}
+
+// jwtHeader is the JOSE header of a token.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// jwtClaims holds the claims Hermes reads from Aegis tokens.
+type jwtClaims struct {
+	Sub         string          `json:"sub"`
+	Subject     string          `json:"subject"`
+	Roles       []string        `json:"roles"`
+	Permissions []string        `json:"permissions"`
+	Exp         int64           `json:"exp"`
+	Nbf         int64           `json:"nbf"`
+	Iss         string          `json:"iss"`
+	Aud         json.RawMessage `json:"aud"`
+}
+
+// verifyJWT validates a token locally against the JWKS keys. The second
+// return value is false when the token cannot be checked locally (not a JWT,
+// unsupported algorithm, unknown key ID), in which case Aegis must decide.
+// A token that is checked locally gets a definitive result: valid, or
+// invalid with the reason in Error.
+func verifyJWT(token string, jwks *JWKS, issuer, audience string) (*ValidateTokenResponse, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, false
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, false
+	}
+	if _, ok := jwtHashes[header.Alg]; !ok {
+		return nil, false
+	}
+	key, ok := jwks.key(header.Kid)
+	if !ok {
+		return nil, false
+	}
+
+	if key.alg != "" && key.alg != header.Alg {
+		return &ValidateTokenResponse{Valid: false, Error: "algorithm mismatch"}, true
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return &ValidateTokenResponse{Valid: false, Error: "malformed signature"}, true
+	}
+	if err := verifySignature(header.Alg, key.key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return &ValidateTokenResponse{Valid: false, Error: err.Error()}, true
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return &ValidateTokenResponse{Valid: false, Error: "malformed claims"}, true
+	}
+	if err := checkClaims(&claims, issuer, audience, time.Now()); err != nil {
+		return &ValidateTokenResponse{Valid: false, Error: err.Error()}, true
+	}
+
+	subject := claims.Subject
+	if subject == "" {
+		subject = claims.Sub
+	}
+	return &ValidateTokenResponse{
+		Valid: true,
+		User: &AegisUser{
+			ID:          claims.Sub,
+			Subject:     subject,
+			Roles:       claims.Roles,
+			Permissions: claims.Permissions,
+		},
+		ExpiresAt: time.Unix(claims.Exp, 0),
+	}, true
+}
+
+// decodeSegment decodes a base64url-encoded JSON token segment.
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// verifySignature checks a token signature with the given algorithm and key.
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	if alg == "EdDSA" {
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok || !ed25519.Verify(pub, signed, signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+
+	hash := jwtHashes[alg]
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "RS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPKCS1v15(pub, hash, digest, signature) != nil {
+			return errors.New("invalid signature")
+		}
+	case "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok || rsa.VerifyPSS(pub, hash, digest, signature, nil) != nil {
+			return errors.New("invalid signature")
+		}
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("invalid signature")
+		}
+		if pub.Curve.Params().Name != ecdsaCurves[alg] {
+			return errors.New("invalid signature")
+		}
+		// The signature is r and s concatenated, each padded to the curve size
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+	}
+	return nil
+}
+
+// checkClaims validates the time, issuer and audience claims. The issuer and
+// audience are only checked when configured.
+func checkClaims(claims *jwtClaims, issuer, audience string, now time.Time) error {
+	if claims.Sub == "" {
+		return errors.New("missing subject")
+	}
+	if claims.Exp == 0 {
+		return errors.New("missing expiration")
+	}
+	if now.After(time.Unix(claims.Exp, 0).Add(jwtClockSkew)) {
+		return errors.New("token expired")
+	}
+	if claims.Nbf != 0 && now.Add(jwtClockSkew).Before(time.Unix(claims.Nbf, 0)) {
+		return errors.New("token not yet valid")
+	}
+	if issuer != "" && claims.Iss != issuer {
+		return errors.New("invalid issuer")
+	}
+	if audience != "" && !hasAudience(claims.Aud, audience) {
+		return errors.New("invalid audience")
+	}
+	return nil
+}
+
+// hasAudience reports whether the aud claim, a string or a list of strings,
+// contains the audience.
+func hasAudience(raw json.RawMessage, audience string) bool {
+	var single string
+	if json.Unmarshal(raw, &single) == nil {
+		return single == audience
+	}
+	var list []string
+	if json.Unmarshal(raw, &list) == nil {
+		for _, aud := range list {
+			if aud == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package core
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testIssuer signs tokens and serves its keys as a JWKS, alongside a mock
+// Aegis validate endpoint that counts its calls.
+type testIssuer struct {
+	rsaKey      *rsa.PrivateKey
+	ecKey       *ecdsa.PrivateKey
+	server      *httptest.Server
+	aegisCalls  atomic.Int32
+	aegisResult ValidateTokenResponse
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EC key: %v", err)
+	}
+
+	issuer := &testIssuer{rsaKey: rsaKey, ecKey: ecKey}
+	issuer.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/aegis/api/auth/jwks":
+			json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+				{
+					"kty": "RSA", "kid": "rsa-1", "use": "sig", "alg": "RS256",
+					"n": b64(rsaKey.N.Bytes()),
+					"e": b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+				},
+				{
+					"kty": "EC", "kid": "ec-1", "crv": "P-256",
+					"x": b64(ecKey.X.FillBytes(make([]byte, 32))),
+					"y": b64(ecKey.Y.FillBytes(make([]byte, 32))),
+				},
+			}})
+		case "/aegis/api/auth/validate":
+			issuer.aegisCalls.Add(1)
+			json.NewEncoder(w).Encode(issuer.aegisResult)
+		}
+	}))
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+// client creates an Aegis client validating JWTs with the issuer's keys.
+func (ti *testIssuer) client() *AegisClient {
+	client := NewAegisClient(ti.server.URL, 5*time.Second)
+	client.SetJWKS(NewJWKS(ti.server.URL+"/aegis/api/auth/jwks", time.Hour, 5*time.Second), "aegis", "")
+	return client
+}
+
+// sign creates a token with the given algorithm, key ID and claims.
+func (ti *testIssuer) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	var err error
+	switch alg {
+	case "RS256":
+		signature, err = rsa.SignPKCS1v15(rand.Reader, ti.rsaKey, crypto.SHA256, digest[:])
+	case "ES256":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, ti.ecKey, digest[:])
+		if err == nil {
+			signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+	}
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signed + "." + b64(signature)
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// validClaims returns claims of a token valid for an hour.
+func validClaims() map[string]any {
+	return map[string]any{
+		"sub":         "user-1",
+		"subject":     "alice@example.com",
+		"roles":       []string{"admin"},
+		"permissions": []string{"read:all"},
+		"iss":         "aegis",
+		"exp":         time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestValidateToken_VerifiesJWTLocally(t *testing.T) {
+	issuer := newTestIssuer(t)
+	client := issuer.client()
+
+	for _, alg := range []string{"RS256", "ES256"} {
+		kid := map[string]string{"RS256": "rsa-1", "ES256": "ec-1"}[alg]
+		resp, err := client.ValidateToken(issuer.sign(t, alg, kid, validClaims()))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", alg, err)
+		}
+		if !resp.Valid || resp.User.ID != "user-1" || resp.User.Subject != "alice@example.com" {
+			t.Errorf("%s: expected valid token for user-1, got %+v", alg, resp)
+		}
+		if len(resp.User.Roles) != 1 || resp.User.Roles[0] != "admin" {
+			t.Errorf("%s: expected admin role, got %v", alg, resp.User.Roles)
+		}
+	}
+	if calls := issuer.aegisCalls.Load(); calls != 0 {
+		t.Errorf("Expected no Aegis calls, got %d", calls)
+	}
+}
+
+func TestValidateToken_RejectsJWTLocally(t *testing.T) {
+	issuer := newTestIssuer(t)
+	client := issuer.client()
+
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	wrongIssuer := validClaims()
+	wrongIssuer["iss"] = "someone-else"
+	tampered := issuer.sign(t, "RS256", "rsa-1", validClaims())
+	tampered = tampered[:len(tampered)-4] + "AAAA"
+
+	tests := []struct {
+		name  string
+		token string
+		error string
+	}{
+		{name: "expired", token: issuer.sign(t, "RS256", "rsa-1", expired), error: "token expired"},
+		{name: "wrong issuer", token: issuer.sign(t, "RS256", "rsa-1", wrongIssuer), error: "invalid issuer"},
+		{name: "bad signature", token: tampered, error: "invalid signature"},
+		{name: "algorithm mismatch", token: issuer.sign(t, "ES256", "rsa-1", validClaims()), error: "algorithm mismatch"},
+	}
+
+	for _, tt := range tests {
+		resp, err := client.ValidateToken(tt.token)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if resp.Valid || resp.Error != tt.error {
+			t.Errorf("%s: expected invalid token (%s), got %+v", tt.name, tt.error, resp)
+		}
+	}
+	if calls := issuer.aegisCalls.Load(); calls != 0 {
+		t.Errorf("Expected no Aegis calls, got %d", calls)
+	}
+}
+
+func TestValidateToken_UnknownKeyFallsBackToAegis(t *testing.T) {
+	issuer := newTestIssuer(t)
+	issuer.aegisResult = ValidateTokenResponse{Valid: true, User: &AegisUser{ID: "user-2"}}
+	client := issuer.client()
+
+	resp, err := client.ValidateToken(issuer.sign(t, "RS256", "rotated-key", validClaims()))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !resp.Valid || resp.User.ID != "user-2" {
+		t.Errorf("Expected Aegis result, got %+v", resp)
+	}
+	if calls := issuer.aegisCalls.Load(); calls != 1 {
+		t.Errorf("Expected 1 Aegis call, got %d", calls)
+	}
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"log"
+	"time"
+
+	"nfcunha/hermes/hermes-server/core/domain/service"
+)
+
+// LeaseReaper expires self-registered services whose lease was not renewed.
+// An expired instance is handed to the DrainManager, which stops new traffic
+// to it and deregisters it once in-flight requests finish or the drain
+// period passes.
+type LeaseReaper struct {
+	registry    *ServiceRegistry
+	drainer     *DrainManager
+	interval    time.Duration
+	drainPeriod time.Duration
+	stopChan    chan struct{}
+}
+
+// NewLeaseReaper creates a lease reaper that scans the registry every interval
+// and drains expired instances for at most drainPeriod before removal.
+func NewLeaseReaper(reg *ServiceRegistry, drainer *DrainManager, interval, drainPeriod time.Duration) *LeaseReaper {
+	return &LeaseReaper{
+		registry:    reg,
+		drainer:     drainer,
+		interval:    interval,
+		drainPeriod: drainPeriod,
+		stopChan:    make(chan struct{}),
+	}
+}
+
+// Start begins periodic lease scanning in the current goroutine.
+// This method blocks until Stop() is called, so it should typically be
+// run in a separate goroutine using: go reaper.Start()
+func (r *LeaseReaper) Start() {
+	log.Printf("Starting lease reaper: interval=%v, drain period=%v", r.interval, r.drainPeriod)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.reap(time.Now())
+		case <-r.stopChan:
+			log.Println("Lease reaper stopped")
+			return
+		}
+	}
+}
+
+// Stop signals the lease reaper to stop.
+func (r *LeaseReaper) Stop() {
+	close(r.stopChan)
+}
+
+// reap drains every instance whose lease ran out before now.
+func (r *LeaseReaper) reap(now time.Time) {
+	for _, svc := range r.registry.List() {
+		if !svc.LeaseExpired(now) || svc.Status == service.StatusDraining {
+			continue
+		}
+
+		log.Printf("Lease expired for %s (%s), draining", svc.Name, svc.ID)
+		if _, err := r.drainer.Drain(svc.ID, r.drainPeriod); err != nil {
+			log.Printf("Failed to drain expired service %s: %v", svc.ID, err)
+		}
+	}
+}
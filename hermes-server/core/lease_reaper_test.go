@@ -0,0 +1,81 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"nfcunha/hermes/hermes-server/core/domain/service"
+)
+
+func TestLeaseReaper_DrainsThenDeregisters(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	reg := NewServiceRegistry(db)
+	inflight := NewInFlightTracker()
+	drainer := NewDrainManager(reg, inflight, time.Second, time.Minute)
+
+	leased := service.NewService("leased-api", "localhost", 8080, "/health")
+	leased.LeaseTTL = 10
+	leased.LastHeartbeatAt = time.Now().Add(-time.Minute)
+	unleased := service.NewService("plain-api", "localhost", 8081, "/health")
+	unleased.LastHeartbeatAt = time.Now().Add(-time.Hour)
+	reg.Register(leased)
+	reg.Register(unleased)
+
+	reaper := NewLeaseReaper(reg, drainer, time.Second, 30*time.Second)
+	now := time.Now()
+
+	// Expired instance is drained but still registered while requests are in flight
+	inflight.Acquire(leased.ID)
+	reaper.reap(now)
+	drainer.process(now)
+
+	svc, err := reg.GetByID(leased.ID)
+	if err != nil {
+		t.Fatalf("Expected expired service to still be registered, got error: %v", err)
+	}
+	if svc.Status != service.StatusDraining {
+		t.Errorf("Expected status %s, got %s", service.StatusDraining, svc.Status)
+	}
+	if len(reg.GetHealthy("leased-api")) != 0 {
+		t.Error("Expected draining instance to be excluded from healthy instances")
+	}
+
+	// Once the lease drain period passes the instance is removed
+	drainer.process(now.Add(31 * time.Second))
+	if _, err := reg.GetByID(leased.ID); err == nil {
+		t.Error("Expected expired service to be deregistered")
+	}
+
+	// Services without a lease are never reaped
+	if _, err := reg.GetByID(unleased.ID); err != nil {
+		t.Errorf("Expected unleased service to remain registered, got error: %v", err)
+	}
+}
+
+func TestRegistry_LeasePersistence(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	reg := NewServiceRegistry(db)
+	svc := service.NewService("leased-api", "localhost", 8080, "/health")
+	svc.LeaseTTL = 15
+	reg.Register(svc)
+
+	if _, err := reg.RenewLease(svc.ID); err != nil {
+		t.Fatalf("Expected heartbeat to succeed, got %v", err)
+	}
+
+	reloaded := NewServiceRegistry(db)
+	retrieved, err := reloaded.GetByID(svc.ID)
+	if err != nil {
+		t.Fatalf("Expected service after reload, got error: %v", err)
+	}
+	if retrieved.LeaseTTL != 15 {
+		t.Errorf("Expected lease TTL 15, got %d", retrieved.LeaseTTL)
+	}
+	if retrieved.LastHeartbeatAt.Unix() != svc.LastHeartbeatAt.Unix() {
+		t.Errorf("Expected heartbeat %v, got %v", svc.LastHeartbeatAt, retrieved.LastHeartbeatAt)
+	}
+}
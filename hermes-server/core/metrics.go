@@ -0,0 +1,433 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultLatencyBuckets are the histogram upper bounds, in seconds, used for
+// all latency metrics.
+var defaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics collects gateway, health checker and Aegis metrics and renders them
+// in the Prometheus text exposition format. A nil *Metrics is valid and
+// records nothing, so components can be used without metrics (e.g. in tests).
+type Metrics struct {
+	requests                *counterVec
+	requestDuration         *histogramVec
+	upstreamRequests        *counterVec
+	upstreamDuration        *histogramVec
+	healthChecks            *counterVec
+	healthCheckDuration     *histogramVec
+	aegisValidations        *counterVec
+	aegisValidationDuration *histogramVec
+	tokenValidations        *counterVec
+	concurrencyQueueDepth   *gaugeVec
+	concurrencyRejections   *counterVec
+	configReloads           *counterVec
+	splitRequests           *counterVec
+	mirrorRequests          *counterVec
+	mirrorDuration          *histogramVec
+	mirrorDropped           *counterVec
+}
+
+// NewMetrics creates an empty metrics collection.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests: newCounterVec("hermes_requests_total",
+			"Requests routed to a service, by response status class (error: no upstream response).",
+			"service", "code_class"),
+		requestDuration: newHistogramVec("hermes_request_duration_seconds",
+			"Total time spent routing a request, including retries.",
+			"service"),
+		upstreamRequests: newCounterVec("hermes_upstream_requests_total",
+			"Requests sent to a service instance, by response status class (error: no response).",
+			"service", "instance", "code_class"),
+		upstreamDuration: newHistogramVec("hermes_upstream_request_duration_seconds",
+			"Time spent on a single request to a service instance.",
+			"service", "instance"),
+		healthChecks: newCounterVec("hermes_health_checks_total",
+			"Health checks run, by result (healthy, unhealthy, error).",
+			"service", "instance", "result"),
+		healthCheckDuration: newHistogramVec("hermes_health_check_duration_seconds",
+			"Time taken by health checks.",
+			"service", "instance"),
+		aegisValidations: newCounterVec("hermes_aegis_validations_total",
+			"Token validations sent to Aegis, by result (valid, invalid, error).",
+			"result"),
+		aegisValidationDuration: newHistogramVec("hermes_aegis_validation_duration_seconds",
+			"Time taken by token validation calls to Aegis."),
+		tokenValidations: newCounterVec("hermes_token_validations_total",
+			"Token validations by where they were decided (jwks, cache, aegis) and result (valid, invalid, error).",
+			"source", "result"),
+		concurrencyQueueDepth: newGaugeVec("hermes_concurrency_queue_depth",
+			"Requests waiting for a free concurrency slot of a service.",
+			"service"),
+		concurrencyRejections: newCounterVec("hermes_concurrency_rejections_total",
+			"Requests shed by the concurrency limiter, by reason (queue_full, queue_timeout).",
+			"service", "reason"),
+		configReloads: newCounterVec("hermes_config_reloads_total",
+			"Route config file loads, by result (success, failure).",
+			"result"),
+		splitRequests: newCounterVec("hermes_split_requests_total",
+			"Requests routed by a traffic split, by the variant they were sent to.",
+			"service", "variant"),
+		mirrorRequests: newCounterVec("hermes_mirror_requests_total",
+			"Mirrored copies of requests sent to a target service, by response status class (error: no response).",
+			"service", "mirror", "code_class"),
+		mirrorDuration: newHistogramVec("hermes_mirror_request_duration_seconds",
+			"Time taken by mirrored copies of requests.",
+			"service", "mirror"),
+		mirrorDropped: newCounterVec("hermes_mirror_dropped_total",
+			"Mirrored copies not sent, by reason (overloaded, no_instances, body_too_large, invalid_request).",
+			"service", "mirror", "reason"),
+	}
+}
+
+// UnknownService is the service label of requests routed to a service with no
+// registered instance, so that arbitrary names in request paths don't each
+// create a series.
+const UnknownService = "unknown"
+
+// ObserveRequest records a request routed to a service.
+func (m *Metrics) ObserveRequest(serviceName string, status int, failed bool, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.requests.inc(serviceName, codeClass(status, failed))
+	m.requestDuration.observe(duration.Seconds(), serviceName)
+}
+
+// ObserveUpstream records a single attempt sent to a service instance.
+func (m *Metrics) ObserveUpstream(serviceName, instanceID string, status int, failed bool, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.upstreamRequests.inc(serviceName, instanceID, codeClass(status, failed))
+	m.upstreamDuration.observe(duration.Seconds(), serviceName, instanceID)
+}
+
+// ObserveHealthCheck records the result of a health check.
+func (m *Metrics) ObserveHealthCheck(serviceName, instanceID, result string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.healthChecks.inc(serviceName, instanceID, result)
+	m.healthCheckDuration.observe(duration.Seconds(), serviceName, instanceID)
+}
+
+// ObserveAegisValidation records a token validation call to Aegis.
+func (m *Metrics) ObserveAegisValidation(result string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.aegisValidations.inc(result)
+	m.aegisValidationDuration.observe(duration.Seconds())
+}
+
+// ObserveTokenValidation records a token validation and where it was decided.
+func (m *Metrics) ObserveTokenValidation(source, result string) {
+	if m == nil {
+		return
+	}
+	m.tokenValidations.inc(source, result)
+}
+
+// SetConcurrencyQueueDepth records the number of requests queued for a service.
+func (m *Metrics) SetConcurrencyQueueDepth(serviceName string, depth int) {
+	if m == nil {
+		return
+	}
+	m.concurrencyQueueDepth.set(float64(depth), serviceName)
+}
+
+// ObserveConcurrencyRejection records a request shed by the concurrency limiter.
+func (m *Metrics) ObserveConcurrencyRejection(serviceName, reason string) {
+	if m == nil {
+		return
+	}
+	m.concurrencyRejections.inc(serviceName, reason)
+}
+
+// ObserveConfigReload records a load of the route config file.
+func (m *Metrics) ObserveConfigReload(result string) {
+	if m == nil {
+		return
+	}
+	m.configReloads.inc(result)
+}
+
+// ObserveSplit records a request sent to a variant of a traffic split.
+func (m *Metrics) ObserveSplit(serviceName, variant string) {
+	if m == nil {
+		return
+	}
+	m.splitRequests.inc(serviceName, variant)
+}
+
+// ObserveMirror records a mirrored copy of a request sent to a target service.
+func (m *Metrics) ObserveMirror(serviceName, target string, status int, failed bool, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mirrorRequests.inc(serviceName, target, codeClass(status, failed))
+	m.mirrorDuration.observe(duration.Seconds(), serviceName, target)
+}
+
+// ObserveMirrorDropped records a mirrored copy that was not sent.
+func (m *Metrics) ObserveMirrorDropped(serviceName, target, reason string) {
+	if m == nil {
+		return
+	}
+	m.mirrorDropped.inc(serviceName, target, reason)
+}
+
+// Write renders all metrics in the Prometheus text exposition format.
+// Registry size by status is computed from the registry at call time.
+func (m *Metrics) Write(w io.Writer, reg *ServiceRegistry) error {
+	var b strings.Builder
+
+	if reg != nil {
+		counts := make(map[string]int)
+		for _, svc := range reg.List() {
+			counts[string(svc.Status)]++
+		}
+		statuses := make([]string, 0, len(counts))
+		for status := range counts {
+			statuses = append(statuses, status)
+		}
+		sort.Strings(statuses)
+
+		writeHeader(&b, "hermes_registry_services", "Registered service instances by status.", "gauge")
+		for _, status := range statuses {
+			fmt.Fprintf(&b, "hermes_registry_services%s %d\n", formatLabels([]string{"status"}, []string{status}), counts[status])
+		}
+	}
+
+	if m != nil {
+		m.requests.write(&b)
+		m.requestDuration.write(&b)
+		m.upstreamRequests.write(&b)
+		m.upstreamDuration.write(&b)
+		m.healthChecks.write(&b)
+		m.healthCheckDuration.write(&b)
+		m.aegisValidations.write(&b)
+		m.aegisValidationDuration.write(&b)
+		m.tokenValidations.write(&b)
+		m.concurrencyQueueDepth.write(&b)
+		m.concurrencyRejections.write(&b)
+		m.configReloads.write(&b)
+		m.splitRequests.write(&b)
+		m.mirrorRequests.write(&b)
+		m.mirrorDuration.write(&b)
+		m.mirrorDropped.write(&b)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// codeClass maps a status code to its class ("2xx", "5xx", ...), or "error"
+// when no response was received.
+func codeClass(status int, failed bool) string {
+	if failed || status < 100 || status > 599 {
+		return "error"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// counterVec is a counter partitioned by label values.
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+	values map[string]*counterSeries // Key: joined label values
+	mu     sync.Mutex
+}
+
+type counterSeries struct {
+	labelValues []string
+	value       float64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]*counterSeries)}
+}
+
+func (v *counterVec) inc(labelValues ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	key := strings.Join(labelValues, "\xff")
+	series, exists := v.values[key]
+	if !exists {
+		series = &counterSeries{labelValues: labelValues}
+		v.values[key] = series
+	}
+	series.value++
+}
+
+func (v *counterVec) write(b *strings.Builder) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	writeHeader(b, v.name, v.help, "counter")
+	for _, key := range sortedKeys(v.values) {
+		series := v.values[key]
+		fmt.Fprintf(b, "%s%s %s\n", v.name, formatLabels(v.labels, series.labelValues), formatFloat(series.value))
+	}
+}
+
+// gaugeVec is a gauge partitioned by label values.
+type gaugeVec struct {
+	name   string
+	help   string
+	labels []string
+	values map[string]*counterSeries // Key: joined label values
+	mu     sync.Mutex
+}
+
+func newGaugeVec(name, help string, labels ...string) *gaugeVec {
+	return &gaugeVec{name: name, help: help, labels: labels, values: make(map[string]*counterSeries)}
+}
+
+func (v *gaugeVec) set(value float64, labelValues ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	key := strings.Join(labelValues, "\xff")
+	series, exists := v.values[key]
+	if !exists {
+		series = &counterSeries{labelValues: labelValues}
+		v.values[key] = series
+	}
+	series.value = value
+}
+
+func (v *gaugeVec) write(b *strings.Builder) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	writeHeader(b, v.name, v.help, "gauge")
+	for _, key := range sortedKeys(v.values) {
+		series := v.values[key]
+		fmt.Fprintf(b, "%s%s %s\n", v.name, formatLabels(v.labels, series.labelValues), formatFloat(series.value))
+	}
+}
+
+// histogramVec is a histogram partitioned by label values.
+type histogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	values  map[string]*histogramSeries // Key: joined label values
+	mu      sync.Mutex
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64 // Per bucket, not cumulative
+	count       uint64
+	sum         float64
+}
+
+func newHistogramVec(name, help string, labels ...string) *histogramVec {
+	return &histogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: defaultLatencyBuckets,
+		values:  make(map[string]*histogramSeries),
+	}
+}
+
+func (v *histogramVec) observe(value float64, labelValues ...string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	key := strings.Join(labelValues, "\xff")
+	series, exists := v.values[key]
+	if !exists {
+		series = &histogramSeries{labelValues: labelValues, counts: make([]uint64, len(v.buckets))}
+		v.values[key] = series
+	}
+
+	for i, bound := range v.buckets {
+		if value <= bound {
+			series.counts[i]++
+			break
+		}
+	}
+	series.count++
+	series.sum += value
+}
+
+func (v *histogramVec) write(b *strings.Builder) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	writeHeader(b, v.name, v.help, "histogram")
+	bucketLabels := append(append([]string{}, v.labels...), "le")
+	for _, key := range sortedKeys(v.values) {
+		series := v.values[key]
+
+		var cumulative uint64
+		for i, bound := range v.buckets {
+			cumulative += series.counts[i]
+			labelValues := append(append([]string{}, series.labelValues...), formatFloat(bound))
+			fmt.Fprintf(b, "%s_bucket%s %d\n", v.name, formatLabels(bucketLabels, labelValues), cumulative)
+		}
+		labelValues := append(append([]string{}, series.labelValues...), "+Inf")
+		fmt.Fprintf(b, "%s_bucket%s %d\n", v.name, formatLabels(bucketLabels, labelValues), series.count)
+		fmt.Fprintf(b, "%s_sum%s %s\n", v.name, formatLabels(v.labels, series.labelValues), formatFloat(series.sum))
+		fmt.Fprintf(b, "%s_count%s %d\n", v.name, formatLabels(v.labels, series.labelValues), series.count)
+	}
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric family.
+func writeHeader(b *strings.Builder, name, help, metricType string) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, metricType)
+}
+
+// formatLabels renders a label set, e.g. {service="api",code_class="2xx"}.
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + `="` + escapeLabelValue(values[i]) + `"`
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// escapeLabelValue escapes backslashes, double quotes and newlines.
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// formatFloat renders a sample value the way Prometheus expects.
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// sortedKeys returns map keys in sorted order for stable output.
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,144 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nfcunha/hermes/hermes-server/core/domain/service"
+)
+
+// renderMetrics returns the text exposition output of the metrics
+func renderMetrics(t *testing.T, m *Metrics, reg *ServiceRegistry) string {
+	var b strings.Builder
+	if err := m.Write(&b, reg); err != nil {
+		t.Fatalf("Failed to write metrics: %v", err)
+	}
+	return b.String()
+}
+
+// expectMetricLines fails the test for every line missing from the output
+func expectMetricLines(t *testing.T, output string, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("Expected metrics output to contain %q, got:\n%s", line, output)
+		}
+	}
+}
+
+func TestMetrics_CounterAndHistogram(t *testing.T) {
+	m := NewMetrics()
+	m.ObserveRequest("api", http.StatusOK, false, 20*time.Millisecond)
+	m.ObserveRequest("api", http.StatusNotFound, false, 2*time.Second)
+	m.ObserveRequest("api", 0, true, time.Millisecond)
+
+	expectMetricLines(t, renderMetrics(t, m, nil),
+		"# TYPE hermes_requests_total counter",
+		`hermes_requests_total{service="api",code_class="2xx"} 1`,
+		`hermes_requests_total{service="api",code_class="4xx"} 1`,
+		`hermes_requests_total{service="api",code_class="error"} 1`,
+		"# TYPE hermes_request_duration_seconds histogram",
+		`hermes_request_duration_seconds_bucket{service="api",le="0.005"} 1`,
+		`hermes_request_duration_seconds_bucket{service="api",le="0.025"} 2`,
+		`hermes_request_duration_seconds_bucket{service="api",le="2.5"} 3`,
+		`hermes_request_duration_seconds_bucket{service="api",le="+Inf"} 3`,
+		`hermes_request_duration_seconds_count{service="api"} 3`,
+	)
+}
+
+func TestMetrics_EscapesLabelValues(t *testing.T) {
+	m := NewMetrics()
+	m.ObserveHealthCheck(`we"ird\name`, "id-1", "healthy", time.Millisecond)
+
+	expectMetricLines(t, renderMetrics(t, m, nil),
+		`hermes_health_checks_total{service="we\"ird\\name",instance="id-1",result="healthy"} 1`,
+	)
+}
+
+func TestMetrics_NilIsNoop(t *testing.T) {
+	var m *Metrics
+	m.ObserveRequest("api", http.StatusOK, false, time.Millisecond)
+	m.ObserveAegisValidation("valid", time.Millisecond)
+
+	if output := renderMetrics(t, m, nil); output != "" {
+		t.Errorf("Expected no output for nil metrics, got %q", output)
+	}
+}
+
+func TestMetrics_RegistryByStatus(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+
+	for i := 0; i < 2; i++ {
+		reg.Register(service.NewService("api", "localhost", 8080+i, "/health"))
+	}
+	down := service.NewService("billing", "localhost", 9090, "/health")
+	reg.Register(down)
+	reg.UpdateStatus(down.ID, service.StatusUnhealthy)
+
+	expectMetricLines(t, renderMetrics(t, NewMetrics(), reg),
+		`hermes_registry_services{status="healthy"} 2`,
+		`hermes_registry_services{status="unhealthy"} 1`,
+	)
+}
+
+func TestRoutingService_RecordsMetrics(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+
+	var hits int32
+	backend := newCountingBackend(http.StatusServiceUnavailable, &hits)
+	defer backend.Close()
+	svc := registerTestBackend(t, reg, "api", backend)
+
+	routing := newTestRoutingService(reg)
+	routing.metrics = NewMetrics()
+	if _, err := routeTestRequest(t, routing, "GET", "api", "/"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Names of services that were never registered share a single series
+	for _, name := range []string{"missing", "typo"} {
+		if _, err := routeTestRequest(t, routing, "GET", name, "/"); err == nil {
+			t.Fatalf("Expected routing to %s to fail", name)
+		}
+	}
+
+	metrics := renderMetrics(t, routing.metrics, nil)
+	expectMetricLines(t, metrics,
+		`hermes_requests_total{service="api",code_class="5xx"} 1`,
+		`hermes_upstream_requests_total{service="api",instance="`+svc.ID+`",code_class="5xx"} 1`,
+		`hermes_requests_total{service="unknown",code_class="error"} 2`,
+	)
+	if strings.Contains(metrics, `service="missing"`) {
+		t.Error("Expected unregistered service names not to be used as labels")
+	}
+}
+
+func TestAegisClient_RecordsValidationMetrics(t *testing.T) {
+	aegis := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"valid":false,"error":"token expired"}`))
+	}))
+	defer aegis.Close()
+
+	m := NewMetrics()
+	client := NewAegisClient(aegis.URL, time.Second)
+	client.SetMetrics(m)
+	client.ValidateToken("expired")
+
+	unreachable := NewAegisClient("http://127.0.0.1:1", time.Second)
+	unreachable.SetMetrics(m)
+	unreachable.ValidateToken("any")
+
+	expectMetricLines(t, renderMetrics(t, m, nil),
+		`hermes_aegis_validations_total{result="invalid"} 1`,
+		`hermes_aegis_validations_total{result="error"} 1`,
+		"hermes_aegis_validation_duration_seconds_count 2",
+	)
+}
@@ -0,0 +1,184 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"nfcunha/hermes/hermes-server/core/domain/healthlog"
+	"nfcunha/hermes/hermes-server/core/domain/service"
+)
+
+// HealthStatusEjected is the health log status recorded when passive outlier
+// detection takes an instance out of rotation.
+const HealthStatusEjected = "ejected"
+
+// outlierBuckets is the number of buckets the sliding window is divided into.
+const outlierBuckets = 10
+
+// OutlierConfig holds passive outlier detection thresholds.
+type OutlierConfig struct {
+	Window         time.Duration // Sliding window over which failure rates are computed
+	MinRequests    int           // Requests needed in the window before an instance can be ejected
+	FailurePercent int           // Failure rate (0-100) that ejects an instance (0: disabled)
+	BaseEjection   time.Duration // Ejection period for the first ejection, doubled on each repeat
+	MaxEjection    time.Duration // Upper bound for the ejection period
+}
+
+// OutlierDetector watches the outcome of proxied requests and ejects
+// instances whose rate of 5xx responses, connection errors and timeouts over
+// a sliding window exceeds the configured threshold. Unlike the circuit
+// breaker, which reacts to consecutive failures, it catches instances that
+// fail intermittently. Ejections are recorded in the health check logs.
+type OutlierDetector struct {
+	cfg           OutlierConfig
+	healthLogRepo *healthlog.Repository
+	instances     map[string]*outlierStats // Key: instance ID
+	mu            sync.Mutex
+}
+
+// outlierStats holds the sliding window and ejection state of one instance.
+type outlierStats struct {
+	buckets       [outlierBuckets]outlierBucket
+	ejectedUntil  time.Time
+	lastEjectedAt time.Time
+	ejectionCount int // Consecutive ejections, drives the exponential ejection period
+}
+
+// outlierBucket counts requests that fell into one slice of the window.
+type outlierBucket struct {
+	epoch    int64 // Index of the time slice this bucket currently holds
+	total    int
+	failures int
+}
+
+// NewOutlierDetector creates an outlier detector. Ejections are written to
+// the health log repository, which may be nil.
+func NewOutlierDetector(cfg OutlierConfig, healthLogRepo *healthlog.Repository) *OutlierDetector {
+	return &OutlierDetector{
+		cfg:           cfg,
+		healthLogRepo: healthLogRepo,
+		instances:     make(map[string]*outlierStats),
+	}
+}
+
+// Ejected reports whether an instance is currently ejected.
+func (d *OutlierDetector) Ejected(svc *service.Service) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stats, exists := d.instances[svc.ID]
+	return exists && time.Now().Before(stats.ejectedUntil)
+}
+
+// Forget drops the window and ejection state of an instance, e.g. once it is
+// deregistered.
+func (d *OutlierDetector) Forget(svc *service.Service) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.instances, svc.ID)
+}
+
+// Record reports the outcome of a request sent to an instance and ejects the
+// instance if its failure rate over the window crosses the threshold.
+func (d *OutlierDetector) Record(svc *service.Service, failed bool) {
+	if d.cfg.FailurePercent <= 0 {
+		return
+	}
+	now := time.Now()
+
+	d.mu.Lock()
+	stats, exists := d.instances[svc.ID]
+	if !exists {
+		stats = &outlierStats{}
+		d.instances[svc.ID] = stats
+	}
+
+	// Outcomes of requests that were already in flight when the instance
+	// was ejected do not count towards the next ejection
+	if now.Before(stats.ejectedUntil) {
+		d.mu.Unlock()
+		return
+	}
+
+	stats.add(now, d.bucketWidth(), failed)
+	total, failures := stats.totals(now, d.bucketWidth())
+	if total < d.cfg.MinRequests || failures*100 < total*d.cfg.FailurePercent {
+		d.mu.Unlock()
+		return
+	}
+
+	// Forget earlier ejections once the instance has behaved for a while
+	if now.Sub(stats.lastEjectedAt) > d.cfg.MaxEjection+d.cfg.Window {
+		stats.ejectionCount = 0
+	}
+	stats.ejectionCount++
+	period := d.ejectionPeriod(stats.ejectionCount)
+	stats.ejectedUntil = now.Add(period)
+	stats.lastEjectedAt = now
+	stats.buckets = [outlierBuckets]outlierBucket{}
+	d.mu.Unlock()
+
+	msg := fmt.Sprintf("%d of %d requests failed in the last %v, ejected for %v", failures, total, d.cfg.Window, period)
+	log.Printf("Outlier detection ejected %s (%s): %s", svc.Name, svc.ID, msg)
+	d.logEjection(svc.ID, msg)
+}
+
+// ejectionPeriod returns the ejection period for the nth consecutive ejection.
+func (d *OutlierDetector) ejectionPeriod(count int) time.Duration {
+	period := d.cfg.BaseEjection
+	for i := 1; i < count && period < d.cfg.MaxEjection; i++ {
+		period *= 2
+	}
+	if period > d.cfg.MaxEjection {
+		period = d.cfg.MaxEjection
+	}
+	return period
+}
+
+// bucketWidth returns the time slice covered by one bucket.
+func (d *OutlierDetector) bucketWidth() time.Duration {
+	width := d.cfg.Window / outlierBuckets
+	if width <= 0 {
+		width = time.Millisecond
+	}
+	return width
+}
+
+// logEjection stores the ejection in the health check logs.
+func (d *OutlierDetector) logEjection(serviceID, msg string) {
+	if d.healthLogRepo == nil {
+		return
+	}
+
+	if err := d.healthLogRepo.Create(serviceID, HealthStatusEjected, msg, "", 0); err != nil {
+		log.Printf("Failed to log ejection for service %s: %v", serviceID, err)
+	}
+}
+
+// add counts a request outcome in the bucket for the current time slice.
+func (s *outlierStats) add(now time.Time, width time.Duration, failed bool) {
+	epoch := now.UnixNano() / int64(width)
+	bucket := &s.buckets[epoch%outlierBuckets]
+	if bucket.epoch != epoch {
+		*bucket = outlierBucket{epoch: epoch}
+	}
+	bucket.total++
+	if failed {
+		bucket.failures++
+	}
+}
+
+// totals sums the buckets that still fall within the window.
+func (s *outlierStats) totals(now time.Time, width time.Duration) (total, failures int) {
+	current := now.UnixNano() / int64(width)
+	for _, bucket := range s.buckets {
+		if current-bucket.epoch < outlierBuckets {
+			total += bucket.total
+			failures += bucket.failures
+		}
+	}
+	return total, failures
+}
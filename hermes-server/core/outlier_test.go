@@ -0,0 +1,170 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"nfcunha/hermes/hermes-server/core/domain/healthlog"
+	"nfcunha/hermes/hermes-server/core/domain/service"
+)
+
+// newTestOutlierDetector creates an outlier detector with short periods for tests
+func newTestOutlierDetector() *OutlierDetector {
+	return NewOutlierDetector(OutlierConfig{
+		Window:         time.Second,
+		MinRequests:    4,
+		FailurePercent: 50,
+		BaseEjection:   50 * time.Millisecond,
+		MaxEjection:    200 * time.Millisecond,
+	}, nil)
+}
+
+func TestOutlierDetector_EjectsOnFailureRate(t *testing.T) {
+	detector := newTestOutlierDetector()
+	svc := service.NewService("api", "localhost", 8080, "/health")
+
+	// Alternating failures: a circuit breaker would never see consecutive failures
+	detector.Record(svc, true)
+	detector.Record(svc, false)
+	detector.Record(svc, true)
+	if detector.Ejected(svc) {
+		t.Fatal("Expected instance not to be ejected below minimum request count")
+	}
+	detector.Record(svc, false)
+
+	if !detector.Ejected(svc) {
+		t.Fatal("Expected instance to be ejected at 50% failure rate")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if detector.Ejected(svc) {
+		t.Error("Expected ejection to expire after the base ejection period")
+	}
+}
+
+func TestOutlierDetector_HealthyTrafficNotEjected(t *testing.T) {
+	detector := newTestOutlierDetector()
+	svc := service.NewService("api", "localhost", 8080, "/health")
+
+	for i := 0; i < 20; i++ {
+		detector.Record(svc, i%4 == 0)
+	}
+	if detector.Ejected(svc) {
+		t.Error("Expected instance with 25% failure rate not to be ejected")
+	}
+}
+
+func TestOutlierDetector_EjectionPeriodGrows(t *testing.T) {
+	detector := newTestOutlierDetector()
+
+	expected := []time.Duration{50 * time.Millisecond, 100 * time.Millisecond, 200 * time.Millisecond, 200 * time.Millisecond}
+	for i, want := range expected {
+		if got := detector.ejectionPeriod(i + 1); got != want {
+			t.Errorf("Ejection %d: expected %v, got %v", i+1, want, got)
+		}
+	}
+}
+
+func TestOutlierDetector_ForgetsDeregisteredInstances(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+	detector := newTestOutlierDetector()
+	reg.OnDeregister(detector.Forget)
+
+	svc := service.NewService("api", "localhost", 8080, "/health")
+	reg.Register(svc)
+	for i := 0; i < 4; i++ {
+		detector.Record(svc, true)
+	}
+
+	reg.Deregister(svc.ID)
+	detector.mu.Lock()
+	_, exists := detector.instances[svc.ID]
+	detector.mu.Unlock()
+	if exists {
+		t.Error("Expected the outlier state of a deregistered instance to be dropped")
+	}
+}
+
+func TestOutlierDetector_LogsEjection(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+	repo := healthlog.NewRepository(db)
+
+	svc := service.NewService("api", "localhost", 8080, "/health")
+	if err := reg.Register(svc); err != nil {
+		t.Fatalf("Failed to register service: %v", err)
+	}
+
+	detector := NewOutlierDetector(newTestOutlierDetector().cfg, repo)
+	for i := 0; i < 4; i++ {
+		detector.Record(svc, true)
+	}
+
+	logs, err := repo.GetByServiceID(svc.ID, 10)
+	if err != nil {
+		t.Fatalf("Failed to read health logs: %v", err)
+	}
+	if len(logs) != 1 || logs[0].Status != HealthStatusEjected {
+		t.Fatalf("Expected a single '%s' health log, got %+v", HealthStatusEjected, logs)
+	}
+}
+
+func TestRoutingService_SkipsEjectedInstance(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+
+	var healthyHits int32
+	healthy := newCountingBackend(http.StatusOK, &healthyHits)
+	defer healthy.Close()
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer flaky.Close()
+
+	flakySvc := registerTestBackend(t, reg, "api", flaky)
+	registerTestBackend(t, reg, "api", healthy)
+
+	routing := newTestRoutingService(reg)
+	for i := 0; i < 4; i++ {
+		routing.outliers.Record(flakySvc, true)
+	}
+
+	for i := 0; i < 4; i++ {
+		w, err := routeTestRequest(t, routing, "GET", "api", "/")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected ejected instance to be skipped, got status %d", w.Code)
+		}
+	}
+}
+
+func TestRoutingService_AllEjectedFallsBack(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+
+	var hits int32
+	backend := newCountingBackend(http.StatusOK, &hits)
+	defer backend.Close()
+	svc := registerTestBackend(t, reg, "api", backend)
+
+	routing := newTestRoutingService(reg)
+	for i := 0; i < 4; i++ {
+		routing.outliers.Record(svc, true)
+	}
+
+	if _, err := routeTestRequest(t, routing, "GET", "api", "/"); err != nil {
+		t.Fatalf("Expected request to reach the only instance, got %v", err)
+	}
+	if hits != 1 {
+		t.Errorf("Expected 1 request to reach the backend, got %d", hits)
+	}
+}
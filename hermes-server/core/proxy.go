@@ -4,87 +4,108 @@
 package core
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"io"
-	"log"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// Errors returned when a backend cannot serve a forwarded request.
+// They are used by callers to tell backend failures apart from other errors.
+var (
+	// ErrBackendUnavailable is returned when the backend cannot be reached.
+	ErrBackendUnavailable = errors.New("backend request failed")
+	// ErrBackendTimeout is returned when the backend does not respond in time.
+	ErrBackendTimeout = errors.New("backend request timed out")
+	// ErrBackendRefused is returned when no connection to the backend could be
+	// established, so the request was never sent.
+	ErrBackendRefused = errors.New("backend connection failed")
+	// ErrClientCanceled is returned when the client went away before the
+	// backend responded. It says nothing about the backend's health.
+	ErrClientCanceled = errors.New("client canceled request")
+)
+
+// StatusClientClosedRequest is the non-standard status recorded for requests
+// whose client went away before a response could be sent.
+const StatusClientClosedRequest = 499
+
+// retryableStatusError is returned instead of relaying a backend response
+// whose status code the caller asked to retry on. It holds the response, with
+// its body buffered, so that it can still be relayed if no retry happens.
+type retryableStatusError struct {
+	status int
+	resp   *http.Response
+}
+
+func (e *retryableStatusError) Error() string {
+	return "backend returned retryable status " + strconv.Itoa(e.status)
+}
+
+// forwardOptions adjust a single forwarding attempt.
+type forwardOptions struct {
+	headerTimeout time.Duration // Time allowed until response headers arrive (0: client default)
+	retryStatus   map[int]bool  // Response statuses returned as errors instead of being relayed
+}
+
 // ProxyService handles forwarding HTTP requests to backend services.
 // It preserves HTTP methods, headers, query parameters, and request bodies
 // while adding standard forwarding headers (X-Forwarded-*).
 type ProxyService struct {
-	client *http.Client
+	client        *http.Client
+	flushInterval time.Duration
 }
 
-// NewProxyService creates a new ProxyService instance with sensible defaults.
-// The default HTTP client has a 30-second timeout and does not follow redirects.
-func NewProxyService() *ProxyService {
+// NewProxyService creates a new ProxyService instance.
+// Parameters:
+//   - responseHeaderTimeout: how long to wait for the backend's response headers.
+//     The response body is not bounded, so long-polling and streaming responses
+//     keep flowing until the backend finishes or the client disconnects.
+//   - flushInterval: how often buffered response data is flushed to the client
+//     (0 flushes only at the end, negative flushes after every write).
+//     Server-Sent Events and responses of unknown length are always flushed
+//     immediately.
+//
+// The HTTP client does not follow redirects.
+func NewProxyService(responseHeaderTimeout, flushInterval time.Duration) *ProxyService {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = responseHeaderTimeout
+
 	return &ProxyService{
 		client: &http.Client{
-			Timeout: 30 * time.Second,
+			Transport: transport,
 			CheckRedirect: func(req *http.Request, via []*http.Request) error {
 				return http.ErrUseLastResponse // Don't follow redirects
 			},
 		},
+		flushInterval: flushInterval,
 	}
 }
 
-// Forward forwards a request to the target backend URL.
-// Parameters:
-//   - c: Gin context containing the original request
-//   - targetBaseURL: base URL of the backend service (e.g., "http://api:8080")
-//   - stripPrefix: path prefix to remove before forwarding (e.g., "/api/v1")
-//   - timeout: request timeout (0 means use default client timeout)
-//
-// The method preserves the HTTP method, headers, body, and query parameters.
-// Standard forwarding headers (X-Forwarded-For, X-Forwarded-Proto) are added.
-func (p *ProxyService) Forward(c *gin.Context, targetBaseURL string, stripPrefix string, timeout time.Duration) error {
-	// Build target URL
-	targetURL, err := p.buildTargetURL(c.Request, targetBaseURL, stripPrefix)
-	if err != nil {
-		log.Printf("Failed to build target URL: %v", err)
-		return errors.New("failed to build target URL")
-	}
-
-	log.Printf("Forwarding request to: %s", targetURL.String())
-
-	// Create proxy request
-	proxyReq, err := p.createProxyRequest(c.Request, targetURL)
-	if err != nil {
-		log.Printf("Failed to create proxy request: %v", err)
-		return errors.New("failed to create proxy request")
-	}
-
-	// Apply timeout if specified
-	if timeout > 0 {
-		client := &http.Client{
-			Timeout: timeout,
-			CheckRedirect: func(req *http.Request, via []*http.Request) error {
-				return http.ErrUseLastResponse
-			},
-		}
-		return p.doRequest(c, proxyReq, client)
-	}
-
-	return p.doRequest(c, proxyReq, p.client)
-}
-
 // ForwardToURL forwards a request to a specific target URL.
-// This is a simpler version of Forward that takes a complete URL string.
-// Query parameters from the original request are appended to the target URL.
+// The method preserves the HTTP method, headers and body, and adds the
+// standard forwarding headers (X-Forwarded-For, X-Forwarded-Host,
+// X-Forwarded-Proto). Query parameters from the original request are
+// appended to the target URL.
 func (p *ProxyService) ForwardToURL(c *gin.Context, targetURL string) error {
-	log.Printf("Forwarding request to: %s", targetURL)
+	return p.forwardToURL(c, targetURL, forwardOptions{})
+}
+
+// forwardToURL forwards a request to a specific target URL with per-attempt options.
+func (p *ProxyService) forwardToURL(c *gin.Context, targetURL string, opts forwardOptions) error {
+	Logf(c, "Forwarding request to: %s", targetURL)
 
 	// Parse the target URL
 	parsedURL, err := url.Parse(targetURL)
 	if err != nil {
-		log.Printf("Invalid target URL %s: %v", targetURL, err)
+		Logf(c, "Invalid target URL %s: %v", targetURL, err)
 		return errors.New("invalid target URL")
 	}
 
@@ -97,52 +118,39 @@ func (p *ProxyService) ForwardToURL(c *gin.Context, targetURL string) error {
 		}
 	}
 
+	// Protocol upgrades (e.g. WebSocket) are tunneled over a hijacked connection
+	if isUpgradeRequest(c.Request) {
+		return p.forwardUpgrade(c, parsedURL)
+	}
+
 	// Create proxy request
 	proxyReq, err := p.createProxyRequest(c.Request, parsedURL)
 	if err != nil {
-		log.Printf("Failed to create proxy request: %v", err)
+		Logf(c, "Failed to create proxy request: %v", err)
 		return errors.New("failed to create proxy request")
 	}
 
-	return p.doRequest(c, proxyReq, p.client)
-}
-
-// buildTargetURL constructs the target URL for the backend request.
-func (p *ProxyService) buildTargetURL(req *http.Request, targetBaseURL string, stripPrefix string) (*url.URL, error) {
-	targetURL, err := url.Parse(targetBaseURL)
-	if err != nil {
-		log.Printf("Failed to parse target URL %s: %v", targetBaseURL, err)
-		return nil, errors.New("invalid target URL")
-	}
-
-	// Handle path
-	path := req.URL.Path
-	if stripPrefix != "" {
-		path = strings.TrimPrefix(path, stripPrefix)
-	}
-
-	// Ensure path starts with /
-	if path != "" && !strings.HasPrefix(path, "/") {
-		path = "/" + path
-	}
-
-	// Combine paths
-	targetURL.Path = strings.TrimSuffix(targetURL.Path, "/") + path
-
-	// Copy query parameters
-	targetURL.RawQuery = req.URL.RawQuery
-
-	return targetURL, nil
+	return p.doRequest(c, proxyReq, p.client, opts)
 }
 
 // createProxyRequest creates a new HTTP request for the backend.
+// The backend request shares the original request's context, so it is
+// cancelled when the client disconnects.
 func (p *ProxyService) createProxyRequest(original *http.Request, targetURL *url.URL) (*http.Request, error) {
 	// Create new request
-	proxyReq, err := http.NewRequest(original.Method, targetURL.String(), original.Body)
+	proxyReq, err := http.NewRequestWithContext(original.Context(), original.Method, targetURL.String(), original.Body)
 	if err != nil {
 		return nil, err
 	}
+	proxyReq.ContentLength = original.ContentLength
+	copyForwardedHeaders(original, proxyReq.Header)
 
+	return proxyReq, nil
+}
+
+// copyForwardedHeaders copies the headers of the original request to header,
+// except hop-by-hop headers, and sets the forwarding headers.
+func copyForwardedHeaders(original *http.Request, header http.Header) {
 	// Copy headers
 	for key, values := range original.Header {
 		// Skip hop-by-hop headers
@@ -150,32 +158,96 @@ func (p *ProxyService) createProxyRequest(original *http.Request, targetURL *url
 			continue
 		}
 		for _, value := range values {
-			proxyReq.Header.Add(key, value)
+			header.Add(key, value)
 		}
 	}
 
 	// Set forwarding headers
 	if original.RemoteAddr != "" {
-		proxyReq.Header.Set("X-Forwarded-For", original.RemoteAddr)
+		header.Set("X-Forwarded-For", original.RemoteAddr)
 	}
-	proxyReq.Header.Set("X-Forwarded-Proto", original.URL.Scheme)
+	header.Set("X-Forwarded-Proto", original.URL.Scheme)
 	if original.Host != "" {
-		proxyReq.Header.Set("X-Forwarded-Host", original.Host)
+		header.Set("X-Forwarded-Host", original.Host)
 	}
 
-	return proxyReq, nil
+	// Forward the request ID and continue the trace from the current span
+	InjectRequestID(original.Context(), header)
+	InjectTraceContext(original.Context(), header)
 }
 
 // doRequest executes the proxy request and copies the response.
-func (p *ProxyService) doRequest(c *gin.Context, proxyReq *http.Request, client *http.Client) error {
+func (p *ProxyService) doRequest(c *gin.Context, proxyReq *http.Request, client *http.Client, opts forwardOptions) error {
+	// Bound the wait for response headers without limiting the body stream
+	headerTimedOut := func() bool { return false }
+	if opts.headerTimeout > 0 {
+		ctx, cancel := context.WithCancel(proxyReq.Context())
+		defer cancel()
+		timer := time.AfterFunc(opts.headerTimeout, cancel)
+		proxyReq = proxyReq.WithContext(ctx)
+		headerTimedOut = func() bool { return !timer.Stop() }
+	}
+
 	// Execute request
 	resp, err := client.Do(proxyReq)
+	timedOut := headerTimedOut()
 	if err != nil {
-		log.Printf("Backend request failed: %v", err)
-		return errors.New("backend request failed")
+		if c.Request.Context().Err() != nil {
+			Logf(c, "Client disconnected before backend responded: %v", err)
+			return ErrClientCanceled
+		}
+		if timedOut || isTimeout(err) {
+			Logf(c, "Backend request timed out: %v", err)
+			return ErrBackendTimeout
+		}
+		if isDialError(err) {
+			Logf(c, "Backend connection failed: %v", err)
+			return ErrBackendRefused
+		}
+		Logf(c, "Backend request failed: %v", err)
+		return ErrBackendUnavailable
 	}
 	defer resp.Body.Close()
 
+	if opts.retryStatus[resp.StatusCode] {
+		buffered, err := bufferResponseBody(resp)
+		if err != nil {
+			Logf(c, "Failed to read retryable response body: %v", err)
+			return ErrBackendUnavailable
+		}
+		if buffered {
+			Logf(c, "Backend returned retryable status %d", resp.StatusCode)
+			return &retryableStatusError{status: resp.StatusCode, resp: resp}
+		}
+		Logf(c, "Backend returned retryable status %d with a body too large to buffer, relaying it", resp.StatusCode)
+	}
+
+	return p.copyResponse(c, resp)
+}
+
+// bufferResponseBody reads a response body into memory, so the response can
+// be relayed after the connection is released. It returns false if the body
+// is too large to buffer, in which case the body is left readable.
+func bufferResponseBody(resp *http.Response) (bool, error) {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRetryBodyBytes+1))
+	if err != nil {
+		return false, err
+	}
+	if len(body) > maxRetryBodyBytes {
+		// Too large: stitch the consumed prefix back in front of the remainder
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return false, nil
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return true, nil
+}
+
+// copyResponse copies the backend response status, headers and body to the client.
+func (p *ProxyService) copyResponse(c *gin.Context, resp *http.Response) error {
 	// Copy response headers
 	for key, values := range resp.Header {
 		if isHopByHopHeader(key) {
@@ -189,15 +261,46 @@ func (p *ProxyService) doRequest(c *gin.Context, proxyReq *http.Request, client
 	// Copy status code
 	c.Status(resp.StatusCode)
 
-	// Copy response body
-	if _, err := io.Copy(c.Writer, resp.Body); err != nil {
-		log.Printf("Failed to copy response body: %v", err)
+	// Copy response body, flushing as configured for streaming responses
+	var dst io.Writer = c.Writer
+	if flushInterval := p.flushIntervalFor(resp); flushInterval != 0 {
+		c.Writer.WriteHeaderNow()
+		c.Writer.Flush()
+		disableWriteDeadline(c)
+
+		flusher := newFlushWriter(c.Writer, flushInterval)
+		defer flusher.stop()
+		dst = flusher
+	}
+
+	if _, err := io.Copy(dst, resp.Body); err != nil {
+		if c.Request.Context().Err() != nil {
+			Logf(c, "Client disconnected, stopped streaming response: %v", err)
+			return nil
+		}
+		Logf(c, "Failed to copy response body: %v", err)
 		return errors.New("failed to copy response body")
 	}
 
 	return nil
 }
 
+// isTimeout reports whether an error was caused by a timeout.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// isDialError reports whether an error happened while connecting to the
+// backend, meaning no part of the request was sent.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
 // isHopByHopHeader returns true if the header is a hop-by-hop header.
 // These headers are meaningful only for a single transport-level connection.
 func isHopByHopHeader(header string) bool {
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// flushIntervalFor returns the flush interval to use for a backend response.
+// Server-Sent Events and responses of unknown length (chunked, long-poll)
+// are flushed after every write; other responses use the configured interval.
+func (p *ProxyService) flushIntervalFor(resp *http.Response) time.Duration {
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil && mediaType == "text/event-stream" {
+		return -1
+	}
+	if resp.ContentLength == -1 {
+		return -1
+	}
+	return p.flushInterval
+}
+
+// disableWriteDeadline clears the server write deadline for the current
+// response so that long-lived streams are not cut off by WriteTimeout.
+func disableWriteDeadline(c *gin.Context) {
+	// Not all writers support deadlines (e.g. test recorders); that is fine
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+}
+
+// flushWriter wraps a response writer and flushes written data to the client,
+// either immediately (negative interval) or at most interval after a write.
+type flushWriter struct {
+	dst      gin.ResponseWriter
+	interval time.Duration
+
+	mu           sync.Mutex // protects writes, flushes and the fields below
+	timer        *time.Timer
+	flushPending bool
+	stopped      bool
+}
+
+func newFlushWriter(dst gin.ResponseWriter, interval time.Duration) *flushWriter {
+	return &flushWriter{dst: dst, interval: interval}
+}
+
+func (w *flushWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n, err := w.dst.Write(data)
+	if err != nil {
+		return n, err
+	}
+
+	if w.interval < 0 {
+		w.dst.Flush()
+		return n, nil
+	}
+
+	if !w.flushPending {
+		w.flushPending = true
+		if w.timer == nil {
+			w.timer = time.AfterFunc(w.interval, w.delayedFlush)
+		} else {
+			w.timer.Reset(w.interval)
+		}
+	}
+	return n, nil
+}
+
+func (w *flushWriter) delayedFlush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// stop() may have run while this callback was waiting for the lock
+	if !w.flushPending || w.stopped {
+		return
+	}
+	w.dst.Flush()
+	w.flushPending = false
+}
+
+// stop cancels any pending delayed flush. The final flush is left to the
+// HTTP server when the handler returns.
+func (w *flushWriter) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.stopped = true
+	w.flushPending = false
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
@@ -0,0 +1,133 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestProxyService_StreamsServerSentEvents(t *testing.T) {
+	next := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 1; i <= 3; i++ {
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			w.(http.Flusher).Flush()
+
+			// Wait until the client has seen the event before sending the next
+			select {
+			case <-next:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}))
+	defer backend.Close()
+	gateway := newTestGateway(backend.URL)
+	defer gateway.Close()
+
+	resp, err := http.Get(gateway.URL + "/events")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				lines <- line
+			}
+		}
+		close(lines)
+	}()
+
+	for i := 1; i <= 3; i++ {
+		select {
+		case line := <-lines:
+			if expected := fmt.Sprintf("data: %d", i); line != expected {
+				t.Fatalf("Expected %q, got %q", expected, line)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Event %d was not flushed to the client", i)
+		}
+		next <- struct{}{}
+	}
+}
+
+func TestProxyService_ClientDisconnectCancelsBackend(t *testing.T) {
+	cancelled := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: ready\n\n")
+		w.(http.Flusher).Flush()
+
+		<-r.Context().Done()
+		close(cancelled)
+	}))
+	defer backend.Close()
+	gateway := newTestGateway(backend.URL)
+	defer gateway.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", gateway.URL+"/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+
+	// Read the first event, then hang up
+	bufio.NewReader(resp.Body).ReadString('\n')
+	cancel()
+	resp.Body.Close()
+
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected backend request to be cancelled after client disconnect")
+	}
+}
+
+func TestProxyService_FlushIntervalFor(t *testing.T) {
+	prx := NewProxyService(30*time.Second, 100*time.Millisecond)
+
+	tests := []struct {
+		name          string
+		contentType   string
+		contentLength int64
+		expected      time.Duration
+	}{
+		{name: "event stream", contentType: "text/event-stream; charset=utf-8", contentLength: -1, expected: -1},
+		{name: "unknown length", contentType: "application/json", contentLength: -1, expected: -1},
+		{name: "fixed length", contentType: "application/json", contentLength: 42, expected: 100 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{}, ContentLength: tt.contentLength}
+		resp.Header.Set("Content-Type", tt.contentType)
+		if got := prx.flushIntervalFor(resp); got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestFlushWriter_DelayedFlush(t *testing.T) {
+	c := newTestContext(t)
+	w := newFlushWriter(c.Writer, 20*time.Millisecond)
+	defer w.stop()
+
+	w.Write([]byte("chunk"))
+	time.Sleep(60 * time.Millisecond)
+
+	w.mu.Lock()
+	pending := w.flushPending
+	w.mu.Unlock()
+	if pending {
+		t.Error("Expected pending flush to run after the interval")
+	}
+}
@@ -0,0 +1,192 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// upgradeDialTimeout bounds how long connecting to the backend, and then the
+// handshake, may each take when tunneling an upgraded (e.g. WebSocket) connection.
+const upgradeDialTimeout = 10 * time.Second
+
+// isUpgradeRequest reports whether the request asks to switch protocols,
+// e.g. a WebSocket handshake ("Connection: Upgrade" plus an Upgrade header).
+func isUpgradeRequest(req *http.Request) bool {
+	return req.Header.Get("Upgrade") != "" && headerHasToken(req.Header, "Connection", "upgrade")
+}
+
+// headerHasToken reports whether a comma-separated header contains the token.
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// forwardUpgrade proxies a protocol upgrade request to the backend.
+// The handshake is sent over a dedicated connection; if the backend answers
+// 101 Switching Protocols, the client connection is hijacked and bytes are
+// tunneled in both directions until either side closes. Any other response
+// is relayed to the client as a normal HTTP response.
+func (p *ProxyService) forwardUpgrade(c *gin.Context, targetURL *url.URL) error {
+	proxyReq, err := p.createProxyRequest(c.Request, targetURL)
+	if err != nil {
+		Logf(c, "Failed to create upgrade request: %v", err)
+		return errors.New("failed to create proxy request")
+	}
+
+	// Restore the upgrade headers stripped as hop-by-hop
+	upgradeType := c.Request.Header.Get("Upgrade")
+	proxyReq.Header.Set("Connection", "Upgrade")
+	proxyReq.Header.Set("Upgrade", upgradeType)
+
+	backendConn, err := dialBackend(targetURL)
+	if err != nil {
+		Logf(c, "Failed to connect to backend for upgrade: %v", err)
+		if isTimeout(err) {
+			return ErrBackendTimeout
+		}
+		return ErrBackendRefused
+	}
+
+	// Bound the handshake, and abort it if the client goes away
+	backendConn.SetDeadline(time.Now().Add(upgradeDialTimeout))
+	stopAbort := context.AfterFunc(c.Request.Context(), func() {
+		backendConn.SetDeadline(time.Now())
+	})
+
+	backendReader := bufio.NewReader(backendConn)
+	resp, err := sendUpgradeRequest(proxyReq, backendConn, backendReader)
+	if err != nil || !stopAbort() {
+		backendConn.Close()
+		if c.Request.Context().Err() != nil {
+			Logf(c, "Client disconnected during upgrade handshake")
+			return ErrClientCanceled
+		}
+		Logf(c, "Upgrade handshake failed: %v", err)
+		if isTimeout(err) {
+			return ErrBackendTimeout
+		}
+		return ErrBackendUnavailable
+	}
+	backendConn.SetDeadline(time.Time{})
+
+	// Backend declined the upgrade: relay its answer as a regular response
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer backendConn.Close()
+		defer resp.Body.Close()
+		return p.copyResponse(c, resp)
+	}
+
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), upgradeType) {
+		backendConn.Close()
+		Logf(c, "Backend switched to unexpected protocol %q (requested %q)", resp.Header.Get("Upgrade"), upgradeType)
+		return errors.New("backend upgrade protocol mismatch")
+	}
+
+	clientConn, clientBuf, err := c.Writer.Hijack()
+	if err != nil {
+		backendConn.Close()
+		Logf(c, "Failed to hijack client connection: %v", err)
+		return errors.New("connection upgrade not supported")
+	}
+	defer clientConn.Close()
+	defer backendConn.Close()
+
+	// The server may have set deadlines for the original request
+	clientConn.SetDeadline(time.Time{})
+
+	if err := writeSwitchingProtocols(clientBuf.Writer, resp); err != nil {
+		Logf(c, "Failed to send upgrade response to client: %v", err)
+		return nil
+	}
+
+	Logf(c, "Upgraded connection to %s (%s)", targetURL.Host, upgradeType)
+	tunnel(clientConn, clientBuf.Reader, backendConn, backendReader)
+	return nil
+}
+
+// dialBackend opens a raw connection to the backend, using TLS for https targets.
+func dialBackend(targetURL *url.URL) (net.Conn, error) {
+	host := targetURL.Host
+	if targetURL.Port() == "" {
+		if targetURL.Scheme == "https" {
+			host = net.JoinHostPort(targetURL.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(targetURL.Hostname(), "80")
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: upgradeDialTimeout}
+	if targetURL.Scheme == "https" {
+		return tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: targetURL.Hostname()})
+	}
+	return dialer.Dial("tcp", host)
+}
+
+// sendUpgradeRequest writes the upgrade request to the backend connection and
+// reads the backend's response.
+func sendUpgradeRequest(proxyReq *http.Request, backendConn net.Conn, backendReader *bufio.Reader) (*http.Response, error) {
+	if err := proxyReq.Write(backendConn); err != nil {
+		return nil, err
+	}
+	return http.ReadResponse(backendReader, proxyReq)
+}
+
+// writeSwitchingProtocols writes the backend's 101 response to the client,
+// keeping the Upgrade and Connection headers.
+func writeSwitchingProtocols(w *bufio.Writer, resp *http.Response) error {
+	if _, err := fmt.Fprintf(w, "HTTP/1.1 %s\r\n", resp.Status); err != nil {
+		return err
+	}
+	if err := resp.Header.Write(w); err != nil {
+		return err
+	}
+	if _, err := w.WriteString("\r\n"); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// tunnel copies bytes between client and backend until either side closes.
+// Readers are used instead of the raw connections so that bytes already
+// buffered during the handshake are not lost.
+func tunnel(clientConn net.Conn, clientReader io.Reader, backendConn net.Conn, backendReader io.Reader) {
+	done := make(chan struct{}, 2)
+
+	go func() {
+		io.Copy(backendConn, clientReader)
+		closeWrite(backendConn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(clientConn, backendReader)
+		closeWrite(clientConn)
+		done <- struct{}{}
+	}()
+
+	// Wait for one direction to finish, then tear down both
+	<-done
+}
+
+// closeWrite half-closes a connection if supported so the peer sees EOF.
+func closeWrite(conn net.Conn) {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+	}
+}
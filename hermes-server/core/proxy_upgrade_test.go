@@ -0,0 +1,171 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newEchoUpgradeBackend starts a backend that switches to a line-echo
+// protocol when asked to upgrade to "echo", and rejects anything else.
+func newEchoUpgradeBackend(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "echo" || !headerHasToken(r.Header, "Connection", "upgrade") {
+			http.Error(w, "upgrade required", http.StatusBadRequest)
+			return
+		}
+
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Backend hijack failed: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n")
+		buf.Flush()
+
+		for {
+			line, err := buf.ReadString('\n')
+			if err != nil {
+				return
+			}
+			buf.WriteString("echo: " + line)
+			buf.Flush()
+		}
+	}))
+}
+
+// newTestGateway starts a gateway that forwards every request to the backend.
+func newTestGateway(backendURL string) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	prx := NewProxyService(30*time.Second, 0)
+	engine.Any("/*path", func(c *gin.Context) {
+		if err := prx.ForwardToURL(c, backendURL+c.Param("path")); err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		}
+	})
+	return httptest.NewServer(engine)
+}
+
+func TestProxyService_UpgradeTunnel(t *testing.T) {
+	backend := newEchoUpgradeBackend(t)
+	defer backend.Close()
+	gateway := newTestGateway(backend.URL)
+	defer gateway.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(gateway.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Failed to connect to gateway: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	conn.Write([]byte("GET /stream HTTP/1.1\r\nHost: gateway\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n"))
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Failed to read handshake response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected status %d, got %d", http.StatusSwitchingProtocols, resp.StatusCode)
+	}
+	if resp.Header.Get("Upgrade") != "echo" {
+		t.Errorf("Expected Upgrade header 'echo', got %q", resp.Header.Get("Upgrade"))
+	}
+
+	for _, msg := range []string{"hello\n", "world\n"} {
+		conn.Write([]byte(msg))
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read tunneled data: %v", err)
+		}
+		if line != "echo: "+msg {
+			t.Errorf("Expected %q, got %q", "echo: "+msg, line)
+		}
+	}
+}
+
+func TestProxyService_UpgradeRejectedByBackend(t *testing.T) {
+	backend := newEchoUpgradeBackend(t)
+	defer backend.Close()
+	gateway := newTestGateway(backend.URL)
+	defer gateway.Close()
+
+	req, _ := http.NewRequest("GET", gateway.URL+"/stream", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected backend status %d to be relayed, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func TestProxyService_UpgradeHandshakeFollowsClient(t *testing.T) {
+	// The backend accepts connections but never answers the handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	c.Request = httptest.NewRequest("GET", "/stream", nil).WithContext(ctx)
+	c.Request.Header.Set("Connection", "Upgrade")
+	c.Request.Header.Set("Upgrade", "echo")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- NewProxyService(30*time.Second, 0).ForwardToURL(c, "http://"+listener.Addr().String()+"/stream")
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrClientCanceled) {
+			t.Errorf("Expected a client cancellation, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the handshake to be abandoned when the client went away")
+	}
+}
+
+func TestIsUpgradeRequest(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	if isUpgradeRequest(req) {
+		t.Error("Expected plain request not to be an upgrade")
+	}
+
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	if !isUpgradeRequest(req) {
+		t.Error("Expected request with Connection: Upgrade to be an upgrade")
+	}
+}
@@ -0,0 +1,363 @@
+package core
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"nfcunha/hermes/hermes-server/core/domain/limit"
+)
+
+// rateLimitSweepInterval is how often buckets that have refilled completely
+// are dropped. A full bucket behaves exactly like a missing one, so this
+// only bounds memory use.
+const rateLimitSweepInterval = time.Minute
+
+// RateLimitResult is the outcome of taking a token from a bucket.
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int           // Bucket capacity
+	Remaining  int           // Whole tokens left after this request
+	RetryAfter time.Duration // Time until the next token, when not allowed
+	Reset      time.Duration // Time until the bucket is full again
+}
+
+// RateLimitBucket is a point-in-time view of a client's token bucket.
+type RateLimitBucket struct {
+	Key      string    `json:"key"`
+	Tokens   float64   `json:"tokens"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// tokenBucket holds the tokens of one client of a service.
+type tokenBucket struct {
+	tokens   float64
+	updated  time.Time // When tokens was last refilled
+	lastSeen time.Time
+}
+
+// RateLimiter applies token bucket rate limits to routed services. Services
+// without their own limit get the default limit; each service keeps separate
+// buckets, keyed as selected by its limit. Limits are persisted to the
+// database, except those declared in the route config file, which take
+// precedence and cannot be changed through the API. The limiter is
+// thread-safe.
+type RateLimiter struct {
+	limits    map[string]*limit.RateLimit        // Key: service name
+	static    map[string]*limit.RateLimit        // Key: service name, from the route config file
+	buckets   map[string]map[string]*tokenBucket // Key: service name, then client key
+	defaults  limit.RateLimit
+	lastSweep time.Time
+	mu        sync.Mutex
+	db        *sql.DB
+}
+
+// NewRateLimiter creates a rate limiter and loads the limits saved in the
+// database. A default rate of 0 leaves services without their own limit
+// unlimited. If loading fails, a warning is logged but the limiter is still
+// created.
+func NewRateLimiter(db *sql.DB, defaults limit.RateLimit) *RateLimiter {
+	defaults.ServiceName = ""
+	defaults.UpdatedAt = time.Time{}
+	defaults.Burst = effectiveBurst(&defaults)
+
+	rl := &RateLimiter{
+		limits:    make(map[string]*limit.RateLimit),
+		static:    make(map[string]*limit.RateLimit),
+		buckets:   make(map[string]map[string]*tokenBucket),
+		defaults:  defaults,
+		lastSweep: time.Now(),
+		db:        db,
+	}
+
+	if db != nil {
+		if err := rl.loadFromDatabase(); err != nil {
+			log.Printf("Warning: failed to load rate limits from database: %v", err)
+		}
+	}
+
+	return rl
+}
+
+// Get returns the limit of a service, or the default limit if none is set.
+func (rl *RateLimiter) Get(serviceName string) *limit.RateLimit {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	return rl.limitFor(serviceName)
+}
+
+// Default returns the limit of services without their own limit.
+func (rl *RateLimiter) Default() limit.RateLimit {
+	return rl.defaults
+}
+
+// List returns all explicitly set limits sorted by service name.
+func (rl *RateLimiter) List() []*limit.RateLimit {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	limits := make([]*limit.RateLimit, 0, len(rl.limits)+len(rl.static))
+	for _, l := range rl.static {
+		limits = append(limits, l)
+	}
+	for name, l := range rl.limits {
+		if _, exists := rl.static[name]; !exists {
+			limits = append(limits, l)
+		}
+	}
+	sort.Slice(limits, func(i, j int) bool {
+		return limits[i].ServiceName < limits[j].ServiceName
+	})
+	return limits
+}
+
+// Set validates and stores the limit of a service, replacing any previous
+// one. A burst of 0 is set to the rate rounded up. The buckets of the service
+// are reset so that the new limit applies immediately. Returns an error if the
+// service's limit is declared in the route config file.
+func (rl *RateLimiter) Set(l *limit.RateLimit) error {
+	if err := l.Validate(); err != nil {
+		return err
+	}
+	l.Burst = effectiveBurst(l)
+	l.Source = ""
+	l.UpdatedAt = time.Now()
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if _, exists := rl.static[l.ServiceName]; exists {
+		return errors.New("rate limit is managed by the route config file")
+	}
+	if err := rl.saveToDatabase(l); err != nil {
+		log.Printf("Failed to persist rate limit for %s: %v", l.ServiceName, err)
+		return errors.New("failed to save rate limit")
+	}
+	rl.limits[l.ServiceName] = l
+	delete(rl.buckets, l.ServiceName)
+
+	log.Printf("Rate limit set: %s (%v/s, burst %d, per %s)", l.ServiceName, l.RequestsPerSecond, l.Burst, l.Key)
+	return nil
+}
+
+// Delete removes the limit of a service, reverting it to the default.
+// Returns an error if the service has no limit or if its limit is declared in
+// the route config file.
+func (rl *RateLimiter) Delete(serviceName string) error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if _, exists := rl.static[serviceName]; exists {
+		return errors.New("rate limit is managed by the route config file")
+	}
+	if _, exists := rl.limits[serviceName]; !exists {
+		return errors.New("rate limit not found")
+	}
+	if rl.db != nil {
+		if _, err := rl.db.Exec("DELETE FROM rate_limits WHERE service_name = ?", serviceName); err != nil {
+			log.Printf("Failed to delete rate limit for %s: %v", serviceName, err)
+			return errors.New("failed to delete rate limit")
+		}
+	}
+	delete(rl.limits, serviceName)
+	delete(rl.buckets, serviceName)
+
+	log.Printf("Rate limit removed: %s", serviceName)
+	return nil
+}
+
+// SetStatic replaces the limits declared in the route config file. The
+// limits must be valid. Buckets of services whose limit changed are reset.
+func (rl *RateLimiter) SetStatic(limits []*limit.RateLimit) {
+	static := make(map[string]*limit.RateLimit, len(limits))
+	now := time.Now()
+	for _, l := range limits {
+		l.Burst = effectiveBurst(l)
+		l.Source = limit.SourceConfigFile
+		l.UpdatedAt = now
+		static[l.ServiceName] = l
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	for name, l := range static {
+		if old, exists := rl.static[name]; !exists || !sameRateLimit(old, l) {
+			delete(rl.buckets, name)
+		}
+	}
+	for name := range rl.static {
+		if _, exists := static[name]; !exists {
+			delete(rl.buckets, name)
+		}
+	}
+	rl.static = static
+}
+
+// Allow takes a token from the bucket of a client of a service. The key
+// identifies the client as selected by the service's limit. Requests to
+// unlimited services are always allowed.
+func (rl *RateLimiter) Allow(serviceName, key string) RateLimitResult {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	l := rl.limitFor(serviceName)
+	if l.Unlimited() {
+		return RateLimitResult{Allowed: true}
+	}
+
+	now := time.Now()
+	rl.sweep(now)
+
+	buckets, exists := rl.buckets[serviceName]
+	if !exists {
+		buckets = make(map[string]*tokenBucket)
+		rl.buckets[serviceName] = buckets
+	}
+	b, exists := buckets[key]
+	if !exists {
+		b = &tokenBucket{tokens: float64(l.Burst), updated: now}
+		buckets[key] = b
+	}
+	b.tokens = refill(b, l, now)
+	b.updated = now
+	b.lastSeen = now
+
+	result := RateLimitResult{Limit: l.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - b.tokens) / l.RequestsPerSecond)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = secondsToDuration((float64(l.Burst) - b.tokens) / l.RequestsPerSecond)
+	return result
+}
+
+// Buckets returns the current buckets of a service sorted by key. Buckets
+// that have refilled completely may already have been dropped.
+func (rl *RateLimiter) Buckets(serviceName string) []RateLimitBucket {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	l := rl.limitFor(serviceName)
+	now := time.Now()
+	buckets := make([]RateLimitBucket, 0, len(rl.buckets[serviceName]))
+	for key, b := range rl.buckets[serviceName] {
+		buckets = append(buckets, RateLimitBucket{
+			Key:      key,
+			Tokens:   math.Round(refill(b, l, now)*100) / 100,
+			LastSeen: b.lastSeen,
+		})
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Key < buckets[j].Key
+	})
+	return buckets
+}
+
+// limitFor returns the limit applied to a service. Must be called with the lock held.
+func (rl *RateLimiter) limitFor(serviceName string) *limit.RateLimit {
+	if l, exists := rl.static[serviceName]; exists {
+		return l
+	}
+	if l, exists := rl.limits[serviceName]; exists {
+		return l
+	}
+	l := rl.defaults
+	l.ServiceName = serviceName
+	return &l
+}
+
+// sweep drops buckets that have refilled completely, at most once per
+// sweep interval. Must be called with the lock held.
+func (rl *RateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	rl.lastSweep = now
+
+	for serviceName, buckets := range rl.buckets {
+		l := rl.limitFor(serviceName)
+		for key, b := range buckets {
+			if l.Unlimited() || refill(b, l, now) >= float64(l.Burst) {
+				delete(buckets, key)
+			}
+		}
+		if len(buckets) == 0 {
+			delete(rl.buckets, serviceName)
+		}
+	}
+}
+
+// refill returns the tokens of a bucket at the given time.
+func refill(b *tokenBucket, l *limit.RateLimit, now time.Time) float64 {
+	tokens := b.tokens + now.Sub(b.updated).Seconds()*l.RequestsPerSecond
+	return math.Min(tokens, float64(l.Burst))
+}
+
+// sameRateLimit reports whether two limits fill and key their buckets alike.
+func sameRateLimit(a, b *limit.RateLimit) bool {
+	return a.RequestsPerSecond == b.RequestsPerSecond && a.Burst == b.Burst && a.Key == b.Key
+}
+
+// effectiveBurst returns the burst of a limit, defaulting to its rate
+// rounded up.
+func effectiveBurst(l *limit.RateLimit) int {
+	if l.Burst > 0 || l.Unlimited() {
+		return l.Burst
+	}
+	return int(math.Ceil(l.RequestsPerSecond))
+}
+
+// secondsToDuration converts fractional seconds to a duration.
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// loadFromDatabase loads all limits on startup.
+func (rl *RateLimiter) loadFromDatabase() error {
+	rows, err := rl.db.Query(`SELECT service_name, requests_per_second, burst, key_type, updated_at FROM rate_limits`)
+	if err != nil {
+		log.Printf("Failed to query rate limits: %v", err)
+		return errors.New("failed to query rate limits")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		l := &limit.RateLimit{}
+		var updatedAt string
+		if err := rows.Scan(&l.ServiceName, &l.RequestsPerSecond, &l.Burst, &l.Key, &updatedAt); err != nil {
+			log.Printf("Warning: failed to scan rate limit row: %v", err)
+			continue
+		}
+		if l.UpdatedAt, err = time.Parse(time.RFC3339, updatedAt); err != nil {
+			l.UpdatedAt = time.Now()
+		}
+		rl.limits[l.ServiceName] = l
+	}
+
+	if len(rl.limits) > 0 {
+		log.Printf("Loaded %d rate limits from database", len(rl.limits))
+	}
+	return rows.Err()
+}
+
+// saveToDatabase inserts or replaces a limit. Must be called with the lock held.
+func (rl *RateLimiter) saveToDatabase(l *limit.RateLimit) error {
+	if rl.db == nil {
+		return nil
+	}
+
+	_, err := rl.db.Exec(`
+		INSERT OR REPLACE INTO rate_limits (service_name, requests_per_second, burst, key_type, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, l.ServiceName, l.RequestsPerSecond, l.Burst, l.Key, l.UpdatedAt.Format(time.RFC3339))
+	return err
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"nfcunha/hermes/hermes-server/core/domain/limit"
+)
+
+func TestRateLimiter_TokenBucket(t *testing.T) {
+	rl := NewRateLimiter(nil, limit.RateLimit{RequestsPerSecond: 1, Burst: 2, Key: limit.KeyIP})
+
+	for i := 0; i < 2; i++ {
+		if result := rl.Allow("orders", "ip:10.0.0.1"); !result.Allowed || result.Remaining != 1-i {
+			t.Fatalf("Request %d: expected to be allowed with %d remaining, got %+v", i+1, 1-i, result)
+		}
+	}
+
+	result := rl.Allow("orders", "ip:10.0.0.1")
+	if result.Allowed {
+		t.Fatal("Expected request beyond the burst to be rejected")
+	}
+	if result.Limit != 2 || result.RetryAfter <= 0 || result.RetryAfter > time.Second {
+		t.Errorf("Expected limit 2 and a retry within a second, got %+v", result)
+	}
+
+	// Other clients and other services have their own buckets
+	if !rl.Allow("orders", "ip:10.0.0.2").Allowed {
+		t.Error("Expected another client to be allowed")
+	}
+	if !rl.Allow("billing", "ip:10.0.0.1").Allowed {
+		t.Error("Expected another service to be allowed")
+	}
+
+	buckets := rl.Buckets("orders")
+	if len(buckets) != 2 || buckets[0].Key != "ip:10.0.0.1" || buckets[0].Tokens >= 1 {
+		t.Errorf("Expected an empty bucket for the limited client, got %+v", buckets)
+	}
+}
+
+func TestRateLimiter_ServiceLimits(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	rl := NewRateLimiter(db, limit.RateLimit{Key: limit.KeyIP})
+	if !rl.Allow("orders", "ip:10.0.0.1").Allowed {
+		t.Error("Expected services to be unlimited without a default rate")
+	}
+
+	if err := rl.Set(&limit.RateLimit{ServiceName: "orders", RequestsPerSecond: 2.5, Key: limit.KeyService}); err != nil {
+		t.Fatalf("Failed to set limit: %v", err)
+	}
+	if err := rl.Set(&limit.RateLimit{ServiceName: "invalid", RequestsPerSecond: 1, Key: "tenant"}); err == nil {
+		t.Error("Expected an unknown key type to be rejected")
+	}
+
+	// A new limiter sees the saved limit, with the burst defaulting to the rate rounded up
+	reloaded := NewRateLimiter(db, limit.RateLimit{Key: limit.KeyIP})
+	l := reloaded.Get("orders")
+	if l.RequestsPerSecond != 2.5 || l.Burst != 3 || l.Key != limit.KeyService {
+		t.Errorf("Expected saved limit, got %+v", l)
+	}
+
+	if err := reloaded.Delete("orders"); err != nil {
+		t.Fatalf("Failed to delete limit: %v", err)
+	}
+	if l := NewRateLimiter(db, limit.RateLimit{Key: limit.KeyIP}).Get("orders"); !l.Unlimited() {
+		t.Errorf("Expected deleted limit to revert to the default, got %+v", l)
+	}
+}
@@ -0,0 +1,208 @@
+package core
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+	"nfcunha/hermes/hermes-server/core/domain/regtoken"
+	"nfcunha/hermes/hermes-server/core/domain/service"
+)
+
+// RegistrationTokenHeader is the request header carrying a registration token.
+const RegistrationTokenHeader = "X-Registration-Token"
+
+// registrationTokenPrefix marks registration token secrets.
+const registrationTokenPrefix = "hrt_"
+
+// Errors returned when a registration token does not authorize a request.
+var (
+	// ErrTokenRequired is returned for requests without a token while tokens
+	// are required, and for instances registered with a token or joining a
+	// service that has such instances.
+	ErrTokenRequired = errors.New("registration token required")
+	// ErrInvalidToken is returned for unknown, revoked or expired tokens.
+	ErrInvalidToken = errors.New("invalid registration token")
+	// ErrTokenServiceNotAllowed is returned when the service name is out of
+	// the token's scope.
+	ErrTokenServiceNotAllowed = errors.New("token not valid for this service")
+	// ErrTokenSourceNotAllowed is returned when the client is outside the
+	// token's networks.
+	ErrTokenSourceNotAllowed = errors.New("source address not allowed")
+	// ErrTokenInstanceNotAllowed is returned when an instance is managed with
+	// another token than the one it registered with.
+	ErrTokenInstanceNotAllowed = errors.New("token not valid for this instance")
+)
+
+// RegistrationTokens issues and checks the tokens that authorize services to
+// self-register. A token is scoped to service names and optionally to client
+// networks, and an instance registered with a token can only heartbeat and
+// self-drain with that same token. When tokens are required, requests without
+// a valid token are rejected; otherwise only a token that is sent is checked.
+// A nil *RegistrationTokens accepts every request.
+type RegistrationTokens struct {
+	repo     *regtoken.Repository
+	required bool
+}
+
+// NewRegistrationTokens creates the registration token service.
+func NewRegistrationTokens(repo *regtoken.Repository, required bool) *RegistrationTokens {
+	return &RegistrationTokens{repo: repo, required: required}
+}
+
+// Issue creates a token allowed to register the given service names from the
+// given networks (empty for any). A nil expiresAt creates a token that does
+// not expire. Returns the secret, which is only available at this point.
+func (rt *RegistrationTokens) Issue(description string, serviceNames, sourceCIDRs []string, expiresAt *time.Time) (string, *regtoken.Token, error) {
+	if len(serviceNames) == 0 {
+		return "", nil, errors.New("at least one service name is required")
+	}
+	for _, cidr := range sourceCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return "", nil, errors.New("invalid source CIDR: " + cidr)
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", nil, errors.New("expiry must be in the future")
+	}
+
+	secret, err := newSecret(registrationTokenPrefix)
+	if err != nil {
+		return "", nil, errors.New("failed to generate token")
+	}
+
+	token := &regtoken.Token{
+		ID:           uuid.NewString(),
+		Description:  description,
+		ServiceNames: serviceNames,
+		SourceCIDRs:  sourceCIDRs,
+		CreatedAt:    time.Now().UTC(),
+		ExpiresAt:    expiresAt,
+	}
+	if err := rt.repo.Create(token, hashSecret(secret)); err != nil {
+		log.Printf("Failed to store registration token: %v", err)
+		return "", nil, errors.New("failed to store token")
+	}
+
+	log.Printf("Registration token issued: %s for %v", token.ID, serviceNames)
+	return secret, token, nil
+}
+
+// List returns all registration tokens, without their secrets.
+func (rt *RegistrationTokens) List() ([]regtoken.Token, error) {
+	tokens, err := rt.repo.List()
+	if err != nil {
+		log.Printf("Failed to list registration tokens: %v", err)
+		return nil, errors.New("failed to list tokens")
+	}
+	return tokens, nil
+}
+
+// Revoke deletes a registration token. Services already registered with it
+// stay registered, but can no longer heartbeat or drain with it.
+func (rt *RegistrationTokens) Revoke(id string) error {
+	if err := rt.repo.Delete(id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("token not found")
+		}
+		log.Printf("Failed to revoke registration token %s: %v", id, err)
+		return errors.New("failed to revoke token")
+	}
+
+	log.Printf("Registration token revoked: %s", id)
+	return nil
+}
+
+// Authorize checks that the secret (possibly empty) allows clientIP to
+// register an instance of serviceName, and returns the ID of the token used
+// ("" without a token). The error is one of ErrTokenRequired,
+// ErrInvalidToken, ErrTokenServiceNotAllowed and ErrTokenSourceNotAllowed.
+func (rt *RegistrationTokens) Authorize(secret, serviceName, clientIP string) (string, error) {
+	if rt == nil {
+		return "", nil
+	}
+	if secret == "" {
+		if rt.required {
+			return "", ErrTokenRequired
+		}
+		return "", nil
+	}
+
+	token, err := rt.repo.GetByHash(hashSecret(secret))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to look up registration token: %v", err)
+		}
+		return "", ErrInvalidToken
+	}
+	now := time.Now()
+	if token.Expired(now) {
+		return "", ErrInvalidToken
+	}
+	if !token.AllowsService(serviceName) {
+		log.Printf("Registration token %s used for out-of-scope service %s", token.ID, serviceName)
+		return "", ErrTokenServiceNotAllowed
+	}
+	if !ipInCIDRs(clientIP, token.SourceCIDRs) {
+		log.Printf("Registration token %s used from disallowed address %s", token.ID, clientIP)
+		return "", ErrTokenSourceNotAllowed
+	}
+
+	if err := rt.repo.TouchLastUsed(token.ID, now.UTC()); err != nil {
+		log.Printf("Warning: failed to record use of registration token %s: %v", token.ID, err)
+	}
+	return token.ID, nil
+}
+
+// AuthorizeInstance checks that the secret (possibly empty) allows clientIP
+// to heartbeat or drain a registered instance. An instance registered with a
+// token requires that same token, still valid for its service and client.
+// An instance registered without a token accepts no token, and only while
+// tokens are not required. Returns ErrTokenInstanceNotAllowed for another
+// token, or one of the errors of Authorize.
+func (rt *RegistrationTokens) AuthorizeInstance(secret string, svc *service.Service, clientIP string) error {
+	if rt == nil {
+		return nil
+	}
+	if svc.RegistrationTokenID == "" {
+		if secret != "" {
+			return ErrTokenInstanceNotAllowed
+		}
+		_, err := rt.Authorize("", svc.Name, clientIP)
+		return err
+	}
+	if secret == "" {
+		return ErrTokenRequired
+	}
+
+	tokenID, err := rt.Authorize(secret, svc.Name, clientIP)
+	if err != nil {
+		return err
+	}
+	if tokenID != svc.RegistrationTokenID {
+		log.Printf("Registration token %s used for instance %s registered with another token", tokenID, svc.ID)
+		return ErrTokenInstanceNotAllowed
+	}
+	return nil
+}
+
+// ipInCIDRs reports whether ip is in one of the networks. An empty list
+// allows every address.
+func ipInCIDRs(ip string, cidrs []string) bool {
+	if len(cidrs) == 0 {
+		return true
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, cidr := range cidrs {
+		if _, network, err := net.ParseCIDR(cidr); err == nil && network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
@@ -16,10 +16,11 @@ import (
 // and persists all changes to the database for durability across restarts.
 // Registry is thread-safe and can be accessed concurrently.
 type ServiceRegistry struct {
-	services map[string]*service.Service   // Key: service ID
-	byName   map[string][]*service.Service // Key: service name
-	mu       sync.RWMutex
-	db       *sql.DB
+	services     map[string]*service.Service   // Key: service ID
+	byName       map[string][]*service.Service // Key: service name
+	onDeregister []func(*service.Service)
+	mu           sync.RWMutex
+	db           *sql.DB
 }
 
 // NewServiceRegistry creates a new service registry with the given database connection.
@@ -42,7 +43,8 @@ func NewServiceRegistry(db *sql.DB) *ServiceRegistry {
 
 // Register adds a new service to the registry and persists it to the database.
 // It performs validation to prevent duplicate registrations based on service ID
-// or the combination of (name, host, port).
+// or the combination of (name, host, port). A draining instance does not hold
+// its address, so that its successor can register while it finishes.
 // Returns an error if the service is already registered or if database persistence fails.
 func (r *ServiceRegistry) Register(svc *service.Service) error {
 	r.mu.Lock()
@@ -55,35 +57,60 @@ func (r *ServiceRegistry) Register(svc *service.Service) error {
 
 	// Check for duplicate (name, host, port) combination
 	for _, existing := range r.services {
-		if existing.Name == svc.Name && existing.Host == svc.Host && existing.Port == svc.Port {
+		if existing.Name == svc.Name && existing.Host == svc.Host && existing.Port == svc.Port && existing.Status != service.StatusDraining {
 			log.Printf("Service with name '%s' already registered at %s:%d", svc.Name, svc.Host, svc.Port)
 			return errors.New("service already registered at this address")
 		}
 	}
 
-	r.services[svc.ID] = svc
-	r.byName[svc.Name] = append(r.byName[svc.Name], svc)
-
-	// Persist to database
+	// Persist first, so that no instance lives only in memory
 	if err := r.saveToDatabase(svc); err != nil {
-		log.Printf("Warning: failed to persist service to database: %v", err)
+		log.Printf("Failed to persist service %s to database: %v", svc.ID, err)
+		return errors.New("failed to save service")
 	}
 
+	r.services[svc.ID] = svc
+	r.byName[svc.Name] = append(r.byName[svc.Name], svc)
+
 	log.Printf("Service registered: %s (%s) at %s", svc.Name, svc.ID, svc.BaseURL())
 	return nil
 }
 
+// OnDeregister registers a function called with every service removed from
+// the registry, so that state kept per instance elsewhere can be dropped.
+// It is called without the registry lock held.
+func (r *ServiceRegistry) OnDeregister(fn func(*service.Service)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.onDeregister = append(r.onDeregister, fn)
+}
+
 // Deregister removes a service from the registry by its ID.
 // It removes the service from both in-memory indexes and the database.
 // Returns an error if the service is not found.
 func (r *ServiceRegistry) Deregister(id string) error {
+	svc, listeners, err := r.remove(id)
+	if err != nil {
+		return err
+	}
+
+	for _, fn := range listeners {
+		fn(svc)
+	}
+	return nil
+}
+
+// remove deletes a service from the registry and returns it along with the
+// deregistration listeners to notify.
+func (r *ServiceRegistry) remove(id string) (*service.Service, []func(*service.Service), error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	svc, exists := r.services[id]
 	if !exists {
 		log.Printf("Service not found for deregistration: %s", id)
-		return errors.New("service not found")
+		return nil, nil, errors.New("service not found")
 	}
 
 	// Remove from services map
@@ -109,7 +136,7 @@ func (r *ServiceRegistry) Deregister(id string) error {
 	}
 
 	log.Printf("Service deregistered: %s (%s)", svc.Name, svc.ID)
-	return nil
+	return svc, r.onDeregister, nil
 }
 
 // GetByID retrieves a service by its unique ID.
@@ -143,6 +170,15 @@ func (r *ServiceRegistry) GetByName(name string) ([]*service.Service, error) {
 	return instances, nil
 }
 
+// IsRegistered reports whether any instance of a service is registered,
+// whatever its status.
+func (r *ServiceRegistry) IsRegistered(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.byName[name]) > 0
+}
+
 // GetHealthy retrieves all healthy instances of a service by name.
 // This is useful for load balancing and routing to only available instances.
 // Returns an empty slice if no healthy instances are found.
@@ -177,9 +213,9 @@ func (r *ServiceRegistry) List() []*service.Service {
 }
 
 // UpdateStatus updates the health status of a service identified by ID.
-// This is typically called by the health checker to reflect the current state.
-// Changes are persisted to the database.
-// Returns an error if the service is not found or if database persistence fails.
+// Changes are persisted to the database. A draining service cannot be moved
+// to another status: it is only removed once drained.
+// Returns an error if the service is not found or is draining.
 func (r *ServiceRegistry) UpdateStatus(id string, status service.Status) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -189,6 +225,10 @@ func (r *ServiceRegistry) UpdateStatus(id string, status service.Status) error {
 		log.Printf("Service not found for status update: %s", id)
 		return errors.New("service not found")
 	}
+	if svc.Status == service.StatusDraining && status != service.StatusDraining {
+		log.Printf("Ignoring status %s for draining service %s", status, id)
+		return errors.New("service is draining")
+	}
 
 	svc.Status = status
 
@@ -200,11 +240,72 @@ func (r *ServiceRegistry) UpdateStatus(id string, status service.Status) error {
 	return nil
 }
 
+// RecordHealthCheck applies the result of a health check to a service and
+// persists it, failing it after threshold consecutive failures. A service that
+// started draining while the check was in flight stays draining.
+// Returns an error if the service is not found.
+func (r *ServiceRegistry) RecordHealthCheck(id string, healthy bool, threshold int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	svc, exists := r.services[id]
+	if !exists {
+		log.Printf("Service not found for health check result: %s", id)
+		return errors.New("service not found")
+	}
+
+	if healthy {
+		svc.MarkHealthy()
+	} else {
+		svc.MarkUnhealthy(threshold)
+	}
+
+	if err := r.updateStatusInDatabase(id, svc.Status); err != nil {
+		log.Printf("Warning: failed to update service status in database: %v", err)
+	}
+
+	return nil
+}
+
+// RenewLease records a heartbeat for a leased service, extending its lease.
+// Returns an error if the service is not found, holds no lease, or is draining.
+func (r *ServiceRegistry) RenewLease(id string) (*service.Service, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	svc, exists := r.services[id]
+	if !exists {
+		log.Printf("Service not found for heartbeat: %s", id)
+		return nil, errors.New("service not found")
+	}
+	if !svc.HasLease() {
+		return nil, errors.New("service has no lease")
+	}
+	if svc.Status == service.StatusDraining {
+		return nil, errors.New("service is draining")
+	}
+
+	svc.RenewLease()
+
+	if _, err := r.db.Exec(
+		"UPDATE services SET last_heartbeat_at = ? WHERE id = ?",
+		svc.LastHeartbeatAt.Format(time.RFC3339), id,
+	); err != nil {
+		log.Printf("Warning: failed to persist heartbeat for service %s: %v", id, err)
+	}
+
+	return svc, nil
+}
+
 // loadFromDatabase loads all services from the database on startup
 func (r *ServiceRegistry) loadFromDatabase() error {
 	rows, err := r.db.Query(`
 		SELECT id, name, host, port, protocol, health_check_path, status, 
-		       metadata, registered_at, last_checked_at, failure_count
+		       metadata, registered_at, last_checked_at, failure_count,
+		       lease_ttl_seconds, last_heartbeat_at,
+		       health_check_type, health_check_expect_status, health_check_expect_body,
+		       health_check_interval_seconds, health_check_timeout_seconds, health_check_threshold,
+		       registration_token_id
 		FROM services
 	`)
 	if err != nil {
@@ -218,13 +319,17 @@ func (r *ServiceRegistry) loadFromDatabase() error {
 		svc := &service.Service{
 			Metadata: make(map[string]string),
 		}
-		var metadataJSON sql.NullString
+		var metadataJSON, lastHeartbeatAt sql.NullString
 		var registeredAt, lastCheckedAt string
 
 		err := rows.Scan(
 			&svc.ID, &svc.Name, &svc.Host, &svc.Port, &svc.Protocol,
 			&svc.HealthCheckPath, &svc.Status, &metadataJSON,
 			&registeredAt, &lastCheckedAt, &svc.FailureCount,
+			&svc.LeaseTTL, &lastHeartbeatAt,
+			&svc.HealthCheckType, &svc.ExpectStatus, &svc.ExpectBody,
+			&svc.HealthInterval, &svc.HealthTimeout, &svc.HealthThreshold,
+			&svc.RegistrationTokenID,
 		)
 		if err != nil {
 			log.Printf("Warning: failed to scan service row: %v", err)
@@ -238,6 +343,9 @@ func (r *ServiceRegistry) loadFromDatabase() error {
 		if svc.LastCheckedAt, err = time.Parse(time.RFC3339, lastCheckedAt); err != nil {
 			svc.LastCheckedAt = time.Now()
 		}
+		if svc.LastHeartbeatAt, err = time.Parse(time.RFC3339, lastHeartbeatAt.String); err != nil {
+			svc.LastHeartbeatAt = svc.RegisteredAt
+		}
 
 		// Parse metadata JSON
 		if metadataJSON.Valid && metadataJSON.String != "" {
@@ -259,7 +367,9 @@ func (r *ServiceRegistry) loadFromDatabase() error {
 	return rows.Err()
 }
 
-// saveToDatabase persists a service to the database
+// saveToDatabase persists a service to the database. The row of a draining
+// instance at the same address is replaced, so its successor is the one that
+// outlives a restart.
 func (r *ServiceRegistry) saveToDatabase(svc *service.Service) error {
 	metadataJSON, err := json.Marshal(svc.Metadata)
 	if err != nil {
@@ -268,16 +378,25 @@ func (r *ServiceRegistry) saveToDatabase(svc *service.Service) error {
 	}
 
 	_, err = r.db.Exec(`
-		INSERT INTO services (
+		INSERT OR REPLACE INTO services (
 			id, name, host, port, protocol, health_check_path, status,
-			metadata, registered_at, last_checked_at, failure_count
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			metadata, registered_at, last_checked_at, failure_count,
+			lease_ttl_seconds, last_heartbeat_at,
+			health_check_type, health_check_expect_status, health_check_expect_body,
+			health_check_interval_seconds, health_check_timeout_seconds, health_check_threshold,
+			registration_token_id
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`,
 		svc.ID, svc.Name, svc.Host, svc.Port, svc.Protocol,
 		svc.HealthCheckPath, svc.Status, string(metadataJSON),
 		svc.RegisteredAt.Format(time.RFC3339),
 		svc.LastCheckedAt.Format(time.RFC3339),
 		svc.FailureCount,
+		svc.LeaseTTL,
+		svc.LastHeartbeatAt.Format(time.RFC3339),
+		svc.HealthCheckType, svc.ExpectStatus, svc.ExpectBody,
+		svc.HealthInterval, svc.HealthTimeout, svc.HealthThreshold,
+		svc.RegistrationTokenID,
 	)
 
 	return err
@@ -7,6 +7,7 @@ import (
 
 	_ "github.com/mattn/go-sqlite3"
 	"nfcunha/hermes/hermes-server/core/domain/service"
+	"nfcunha/hermes/hermes-server/database"
 )
 
 // TestPersistenceWithRealDatabase tests persistence using a file-based SQLite database
@@ -22,25 +23,9 @@ func TestPersistenceWithRealDatabase(t *testing.T) {
 		t.Fatalf("Failed to open database: %v", err)
 	}
 
-	// Create table
-	_, err = db1.Exec(`
-		CREATE TABLE IF NOT EXISTS services (
-			id TEXT PRIMARY KEY,
-			name TEXT NOT NULL,
-			host TEXT NOT NULL,
-			port INTEGER NOT NULL,
-			protocol TEXT NOT NULL DEFAULT 'http',
-			health_check_path TEXT NOT NULL,
-			status TEXT NOT NULL DEFAULT 'healthy',
-			metadata TEXT,
-			registered_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			last_checked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			failure_count INTEGER DEFAULT 0,
-			UNIQUE(name, host, port)
-		)
-	`)
-	if err != nil {
-		t.Fatalf("Failed to create table: %v", err)
+	// Create schema
+	if err := database.Migrate(db1); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
 	}
 
 	// Register services
@@ -178,29 +163,8 @@ func TestDatabaseMigration(t *testing.T) {
 	}
 	defer db.Close()
 
-	// Run the actual migration SQL (copy from migrations.go)
-	migration := `
-		CREATE TABLE IF NOT EXISTS services (
-			id TEXT PRIMARY KEY,
-			name TEXT NOT NULL,
-			host TEXT NOT NULL,
-			port INTEGER NOT NULL,
-			protocol TEXT NOT NULL DEFAULT 'http',
-			health_check_path TEXT NOT NULL,
-			status TEXT NOT NULL DEFAULT 'healthy',
-			metadata TEXT,
-			registered_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			last_checked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			failure_count INTEGER DEFAULT 0,
-			UNIQUE(name, host, port)
-		);
-
-		CREATE INDEX IF NOT EXISTS idx_services_name ON services(name);
-		CREATE INDEX IF NOT EXISTS idx_services_status ON services(status);
-	`
-
-	_, err = db.Exec(migration)
-	if err != nil {
+	// Run the actual migrations
+	if err := database.Migrate(db); err != nil {
 		t.Fatalf("Migration failed: %v", err)
 	}
 
@@ -7,6 +7,7 @@ import (
 
 	_ "github.com/mattn/go-sqlite3"
 	"nfcunha/hermes/hermes-server/core/domain/service"
+	"nfcunha/hermes/hermes-server/database"
 )
 
 // setupTestDB creates an in-memory SQLite database for testing
@@ -16,25 +17,9 @@ func setupTestDB(t *testing.T) *sql.DB {
 		t.Fatalf("Failed to open test database: %v", err)
 	}
 
-	// Create services table
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS services (
-			id TEXT PRIMARY KEY,
-			name TEXT NOT NULL,
-			host TEXT NOT NULL,
-			port INTEGER NOT NULL,
-			protocol TEXT NOT NULL DEFAULT 'http',
-			health_check_path TEXT NOT NULL,
-			status TEXT NOT NULL DEFAULT 'healthy',
-			metadata TEXT,
-			registered_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			last_checked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			failure_count INTEGER DEFAULT 0,
-			UNIQUE(name, host, port)
-		)
-	`)
-	if err != nil {
-		t.Fatalf("Failed to create test table: %v", err)
+	// Create schema using the real migrations
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
 	}
 
 	return db
@@ -142,6 +127,56 @@ func TestRegistry_Register_SameNameDifferentHost(t *testing.T) {
 	}
 }
 
+func TestRegistry_Register_SameAddressAsDraining(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	reg := NewServiceRegistry(db)
+	svc1 := service.NewService("api-service", "localhost", 8080, "/health")
+	svc2 := service.NewService("api-service", "localhost", 8080, "/health")
+
+	if err := reg.Register(svc1); err != nil {
+		t.Fatalf("Expected no error registering first service, got %v", err)
+	}
+	if err := reg.UpdateStatus(svc1.ID, service.StatusDraining); err != nil {
+		t.Fatalf("Failed to drain first service: %v", err)
+	}
+
+	// The successor of a draining instance may take its address
+	if err := reg.Register(svc2); err != nil {
+		t.Fatalf("Expected no error registering at the address of a draining service, got %v", err)
+	}
+	if services, _ := reg.GetByName("api-service"); len(services) != 2 {
+		t.Errorf("Expected both services until the drain completes, got %d", len(services))
+	}
+
+	// The successor is the one saved for the next start, along with its updates
+	if err := reg.UpdateStatus(svc2.ID, service.StatusUnhealthy); err != nil {
+		t.Fatalf("Failed to update the successor's status: %v", err)
+	}
+	reloaded := NewServiceRegistry(db)
+	if svc, err := reloaded.GetByID(svc2.ID); err != nil || svc.Status != service.StatusUnhealthy {
+		t.Errorf("Expected the successor to be reloaded from the database with its status, got %v (err: %v)", svc, err)
+	}
+	if services, _ := reloaded.GetByName("api-service"); len(services) != 1 {
+		t.Errorf("Expected only the successor to be reloaded, got %d services", len(services))
+	}
+}
+
+func TestRegistry_Register_FailsWhenNotSaved(t *testing.T) {
+	db := setupTestDB(t)
+	reg := NewServiceRegistry(db)
+	db.Close()
+
+	svc := service.NewService("api-service", "localhost", 8080, "/health")
+	if err := reg.Register(svc); err == nil || err.Error() != "failed to save service" {
+		t.Fatalf("Expected the registration to fail when it cannot be saved, got %v", err)
+	}
+	if _, err := reg.GetByID(svc.ID); err == nil {
+		t.Error("Expected an unsaved service not to be registered")
+	}
+}
+
 func TestRegistry_Register_DifferentNameSameHostPort(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
@@ -333,6 +368,7 @@ func TestRegistry_DatabasePersistence(t *testing.T) {
 	reg1 := NewServiceRegistry(db)
 	svc1 := service.NewService("test-service-1", "localhost", 8080, "/health")
 	svc2 := service.NewService("test-service-2", "localhost", 8081, "/health")
+	svc2.RegistrationTokenID = "token-1"
 
 	if err := reg1.Register(svc1); err != nil {
 		t.Fatalf("Failed to register service 1: %v", err)
@@ -371,6 +407,9 @@ func TestRegistry_DatabasePersistence(t *testing.T) {
 	if retrieved2.Status != service.StatusUnhealthy {
 		t.Errorf("Expected status %s, got %s", service.StatusUnhealthy, retrieved2.Status)
 	}
+	if retrieved2.RegistrationTokenID != "token-1" {
+		t.Errorf("Expected registration token token-1, got %q", retrieved2.RegistrationTokenID)
+	}
 
 	// Verify deregister persists
 	if err := reg2.Deregister(svc1.ID); err != nil {
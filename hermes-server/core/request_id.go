@@ -0,0 +1,52 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDKey is the gin context key holding the ID of the current request.
+const RequestIDKey = "request_id"
+
+// requestIDContextKey is the request context key holding the request ID and
+// the header it is forwarded in.
+type requestIDContextKey struct{}
+
+type requestID struct {
+	header string
+	id     string
+}
+
+// ContextWithRequestID returns a context carrying the request ID, to be
+// forwarded to backends in the given header.
+func ContextWithRequestID(ctx context.Context, header, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestID{header: header, id: id})
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, or "" if none.
+func RequestIDFromContext(ctx context.Context) string {
+	rid, _ := ctx.Value(requestIDContextKey{}).(requestID)
+	return rid.id
+}
+
+// InjectRequestID sets the request ID carried by ctx on the headers of an
+// outgoing request. Without a request ID the headers are left as they are.
+func InjectRequestID(ctx context.Context, header http.Header) {
+	if rid, ok := ctx.Value(requestIDContextKey{}).(requestID); ok && rid.id != "" {
+		header.Set(rid.header, rid.id)
+	}
+}
+
+// Logf logs a message about the current request, prefixed with its request ID
+// so gateway and backend log lines can be matched.
+func Logf(c *gin.Context, format string, args ...any) {
+	if id := c.GetString(RequestIDKey); id != "" {
+		log.Printf("[%s] %s", id, fmt.Sprintf(format, args...))
+		return
+	}
+	log.Printf(format, args...)
+}
@@ -0,0 +1,36 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRoutingService_ForwardsRequestID(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+
+	var received string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("X-Correlation-ID")
+	}))
+	defer backend.Close()
+	registerTestBackend(t, reg, "api", backend)
+
+	// The client's header is replaced by the ID assigned by the middleware
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/hermes/route/api/", nil)
+	c.Request.Header.Set("X-Correlation-ID", "client-supplied")
+	c.Request = c.Request.WithContext(ContextWithRequestID(c.Request.Context(), "X-Correlation-ID", "req-99"))
+
+	if err := newTestRoutingService(reg).RouteToService(c, "api", "/"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if received != "req-99" {
+		t.Errorf("Expected backend to receive request ID req-99, got %q", received)
+	}
+}
@@ -0,0 +1,148 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"nfcunha/hermes/hermes-server/core/domain/service"
+)
+
+// Metadata keys read from service registrations to override the retry policy.
+const (
+	// MetadataRetryAttempts sets the maximum number of attempts, including the first.
+	MetadataRetryAttempts = "retry_attempts"
+	// MetadataRetryPerTryTimeout bounds how long each attempt waits for response headers (e.g. "2s").
+	MetadataRetryPerTryTimeout = "retry_per_try_timeout"
+	// MetadataRetryBackoff sets the base delay between attempts (e.g. "50ms").
+	MetadataRetryBackoff = "retry_backoff"
+	// MetadataRetryOn lists response status codes that trigger a retry (e.g. "502,503,504").
+	MetadataRetryOn = "retry_on"
+)
+
+// maxRetryBodyBytes is the largest request body buffered for replay, and the
+// largest response body kept while retrying on its status. Requests with
+// larger bodies are forwarded once, without retries, and such responses are
+// relayed as they are.
+const maxRetryBodyBytes = 1 << 20 // 1MB
+
+// maxRetryBackoff caps the exponential backoff between attempts.
+const maxRetryBackoff = 2 * time.Second
+
+// RetryPolicy controls how failed requests are retried on other instances.
+type RetryPolicy struct {
+	Attempts      int           // Maximum attempts per request, including the first (1: no retries)
+	PerTryTimeout time.Duration // Time each attempt may wait for response headers (0: proxy default)
+	Backoff       time.Duration // Base delay between attempts, doubled after each retry
+	RetryOn       map[int]bool  // Response status codes that trigger a retry
+}
+
+// ParseRetryOn parses a comma-separated list of HTTP status codes.
+func ParseRetryOn(value string) (map[int]bool, error) {
+	codes := make(map[int]bool)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		code, err := strconv.Atoi(part)
+		if err != nil || code < 100 || code > 599 {
+			return nil, errors.New("invalid retry status code")
+		}
+		codes[code] = true
+	}
+	return codes, nil
+}
+
+// retryPolicyFor returns the retry policy for an instance, applying
+// metadata overrides on top of the defaults.
+func retryPolicyFor(defaults RetryPolicy, svc *service.Service) RetryPolicy {
+	policy := defaults
+	if val, err := strconv.Atoi(svc.Metadata[MetadataRetryAttempts]); err == nil && val > 0 {
+		policy.Attempts = val
+	}
+	if val, err := time.ParseDuration(svc.Metadata[MetadataRetryPerTryTimeout]); err == nil && val >= 0 {
+		policy.PerTryTimeout = val
+	}
+	if val, err := time.ParseDuration(svc.Metadata[MetadataRetryBackoff]); err == nil && val >= 0 {
+		policy.Backoff = val
+	}
+	if raw := svc.Metadata[MetadataRetryOn]; raw != "" {
+		if codes, err := ParseRetryOn(raw); err == nil {
+			policy.RetryOn = codes
+		}
+	}
+	if policy.Attempts < 1 {
+		policy.Attempts = 1
+	}
+	return policy
+}
+
+// backoffFor returns the delay before the given retry (1 for the first retry).
+func (p RetryPolicy) backoffFor(retry int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < retry && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryBackoff {
+		delay = maxRetryBackoff
+	}
+	return delay
+}
+
+// isIdempotent reports whether a request method may safely be sent twice.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// isRetryable reports whether a failed attempt may be retried on another instance.
+// Connection failures are retried for any method since nothing reached the
+// backend; other failures only for idempotent methods.
+func isRetryable(method string, err error) bool {
+	if errors.Is(err, ErrBackendRefused) {
+		return true
+	}
+	if !isIdempotent(method) {
+		return false
+	}
+	var statusErr *retryableStatusError
+	return errors.Is(err, ErrBackendUnavailable) || errors.Is(err, ErrBackendTimeout) || errors.As(err, &statusErr)
+}
+
+// bufferRequestBody reads the request body into memory so it can be replayed
+// on a later attempt. It returns false if the body is too large to buffer, in
+// which case the request body is left readable but cannot be replayed.
+func bufferRequestBody(req *http.Request) ([]byte, bool, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true, nil
+	}
+	if req.ContentLength > maxRetryBodyBytes {
+		return nil, false, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxRetryBodyBytes+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(body) > maxRetryBodyBytes {
+		// Too large: stitch the consumed prefix back in front of the remainder
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+		return nil, false, nil
+	}
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, true, nil
+}
@@ -0,0 +1,277 @@
+package core
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core/domain/service"
+)
+
+// newRetryRoutingService creates a routing service that retries on 503
+func newRetryRoutingService(reg *ServiceRegistry, attempts int) *RoutingService {
+	return NewRoutingService(reg, NewProxyService(5*time.Second, 0), NewInFlightTracker(), newTestBreaker(), newTestOutlierDetector(), nil, nil, nil, nil, RetryPolicy{
+		Attempts: attempts,
+		Backoff:  time.Millisecond,
+		RetryOn:  map[int]bool{http.StatusServiceUnavailable: true},
+	}, SubsetConfig{})
+}
+
+// newCountingBackend starts a backend that counts requests and answers with
+// the given status, echoing the request body (or "ok" if it is empty)
+func newCountingBackend(status int, hits *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		body, _ := io.ReadAll(r.Body)
+		if len(body) == 0 {
+			body = []byte("ok")
+		}
+		w.WriteHeader(status)
+		w.Write(body)
+	}))
+}
+
+func TestRoutingService_RetriesConnectionFailureForAnyMethod(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	registerTestBackend(t, reg, "api", down)
+	down.Close()
+
+	var hits int32
+	healthy := newCountingBackend(http.StatusOK, &hits)
+	defer healthy.Close()
+	registerTestBackend(t, reg, "api", healthy)
+
+	routing := newRetryRoutingService(reg, 2)
+
+	for i := 0; i < 2; i++ {
+		gin.SetMode(gin.TestMode)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/hermes/route/api/orders", strings.NewReader("payload"))
+
+		if err := routing.RouteToService(c, "api", "/orders"); err != nil {
+			t.Fatalf("Request %d: expected retry to succeed, got %v", i, err)
+		}
+		if w.Code != http.StatusOK || w.Body.String() != "payload" {
+			t.Errorf("Request %d: expected replayed body with status 200, got %d %q", i, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRoutingService_RetriesIdempotentOnRetryableStatus(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+
+	var unavailableHits, healthyHits int32
+	unavailable := newCountingBackend(http.StatusServiceUnavailable, &unavailableHits)
+	defer unavailable.Close()
+	healthy := newCountingBackend(http.StatusOK, &healthyHits)
+	defer healthy.Close()
+	registerTestBackend(t, reg, "api", unavailable)
+	registerTestBackend(t, reg, "api", healthy)
+
+	routing := newRetryRoutingService(reg, 3)
+
+	for i := 0; i < 4; i++ {
+		w, err := routeTestRequest(t, routing, "GET", "api", "/items")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status 200 after retry, got %d", w.Code)
+		}
+	}
+	if healthyHits != 4 {
+		t.Errorf("Expected 4 requests to reach the healthy instance, got %d", healthyHits)
+	}
+}
+
+func TestRoutingService_DoesNotRetryNonIdempotentResponse(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+
+	var hits int32
+	unavailable := newCountingBackend(http.StatusServiceUnavailable, &hits)
+	defer unavailable.Close()
+	other := newCountingBackend(http.StatusServiceUnavailable, &hits)
+	defer other.Close()
+	registerTestBackend(t, reg, "api", unavailable)
+	registerTestBackend(t, reg, "api", other)
+
+	routing := newRetryRoutingService(reg, 3)
+
+	w, err := routeTestRequest(t, routing, "POST", "api", "/orders")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected backend status 503 to be relayed, got %d", w.Code)
+	}
+	if hits != 1 {
+		t.Errorf("Expected a single attempt for POST, got %d", hits)
+	}
+}
+
+func TestRoutingService_LastAttemptRelaysResponse(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+
+	var hits int32
+	for i := 0; i < 3; i++ {
+		backend := newCountingBackend(http.StatusServiceUnavailable, &hits)
+		defer backend.Close()
+		registerTestBackend(t, reg, "api", backend)
+	}
+
+	routing := newRetryRoutingService(reg, 2)
+
+	w, err := routeTestRequest(t, routing, "GET", "api", "/items")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected final 503 to be relayed, got %d", w.Code)
+	}
+	if hits != 2 {
+		t.Errorf("Expected 2 attempts, got %d", hits)
+	}
+}
+
+func TestRetryPolicyFor_MetadataOverrides(t *testing.T) {
+	defaults := RetryPolicy{Attempts: 1, Backoff: 50 * time.Millisecond, RetryOn: map[int]bool{502: true}}
+	svc := service.NewService("api", "localhost", 8080, "/health")
+	svc.Metadata = map[string]string{
+		MetadataRetryAttempts:      "3",
+		MetadataRetryPerTryTimeout: "2s",
+		MetadataRetryOn:            "500, 503",
+	}
+
+	policy := retryPolicyFor(defaults, svc)
+	if policy.Attempts != 3 || policy.PerTryTimeout != 2*time.Second || policy.Backoff != 50*time.Millisecond {
+		t.Errorf("Unexpected policy: %+v", policy)
+	}
+	if !policy.RetryOn[500] || !policy.RetryOn[503] || policy.RetryOn[502] {
+		t.Errorf("Expected retry-on override {500, 503}, got %v", policy.RetryOn)
+	}
+}
+
+func TestParseRetryOn(t *testing.T) {
+	if _, err := ParseRetryOn("502,abc"); err == nil {
+		t.Error("Expected error for non-numeric status code")
+	}
+	codes, err := ParseRetryOn("")
+	if err != nil || len(codes) != 0 {
+		t.Errorf("Expected empty set for empty list, got %v (%v)", codes, err)
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{Backoff: 100 * time.Millisecond}
+	if got := policy.backoffFor(1); got != 100*time.Millisecond {
+		t.Errorf("Expected 100ms for first retry, got %v", got)
+	}
+	if got := policy.backoffFor(3); got != 400*time.Millisecond {
+		t.Errorf("Expected 400ms for third retry, got %v", got)
+	}
+	if got := policy.backoffFor(20); got != maxRetryBackoff {
+		t.Errorf("Expected backoff to be capped at %v, got %v", maxRetryBackoff, got)
+	}
+}
+
+func TestRoutingService_PerTryTimeoutRetriesElsewhere(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+
+	release := make(chan struct{})
+	defer close(release)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	var hits int32
+	fast := newCountingBackend(http.StatusOK, &hits)
+	defer fast.Close()
+	registerTestBackend(t, reg, "api", slow)
+	registerTestBackend(t, reg, "api", fast)
+
+	routing := NewRoutingService(reg, NewProxyService(5*time.Second, 0), NewInFlightTracker(), newTestBreaker(), newTestOutlierDetector(), nil, nil, nil, nil, RetryPolicy{
+		Attempts:      2,
+		PerTryTimeout: 50 * time.Millisecond,
+	}, SubsetConfig{})
+
+	for i := 0; i < 2; i++ {
+		w, err := routeTestRequest(t, routing, "GET", "api", "/items")
+		if err != nil {
+			t.Fatalf("Expected retry after per-try timeout, got %v", err)
+		}
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", w.Code)
+		}
+	}
+}
+
+func TestRoutingService_RelaysResponseWhenNoRetryHappens(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+
+	var hits int32
+	unavailable := newCountingBackend(http.StatusServiceUnavailable, &hits)
+	defer unavailable.Close()
+	busy := newCountingBackend(http.StatusOK, &hits)
+	defer busy.Close()
+	registerTestBackend(t, reg, "api", unavailable)
+	busySvc := registerTestBackend(t, reg, "api", busy)
+
+	// The only other instance is at its concurrency limit
+	routing := newRetryRoutingService(reg, 3)
+	routing.concurrency = NewConcurrencyLimiter(ConcurrencyConfig{MaxInstanceRequests: 1}, nil)
+	routing.concurrency.AcquireInstance(nil, []*service.Service{busySvc}, func(available []*service.Service) *service.Service {
+		return available[0]
+	})
+
+	w, err := routeTestRequest(t, routing, "GET", "api", "/items")
+	if err != nil {
+		t.Fatalf("Expected the backend response to be relayed, got %v", err)
+	}
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != "ok" {
+		t.Errorf("Expected the backend's 503 and body, got %d %q", w.Code, w.Body.String())
+	}
+
+	// Or when the client goes away during the backoff
+	db2 := setupTestDB(t)
+	defer db2.Close()
+	reg = NewServiceRegistry(db2)
+	registerTestBackend(t, reg, "api", unavailable)
+	other := newCountingBackend(http.StatusServiceUnavailable, &hits)
+	defer other.Close()
+	registerTestBackend(t, reg, "api", other)
+
+	routing = newRetryRoutingService(reg, 3)
+	routing.retry.Backoff = time.Minute
+	w = httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	c.Request = httptest.NewRequest("GET", "/hermes/route/api/items", nil).WithContext(ctx)
+	if err := routing.RouteToService(c, "api", "/items"); err != nil || w.Code != http.StatusServiceUnavailable || w.Body.String() != "ok" {
+		t.Errorf("Expected the backend's 503 after a canceled backoff, got %d %q (err: %v)", w.Code, w.Body.String(), err)
+	}
+}
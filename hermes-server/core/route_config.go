@@ -0,0 +1,328 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"nfcunha/hermes/hermes-server/core/domain/limit"
+	"nfcunha/hermes/hermes-server/core/domain/policy"
+	"nfcunha/hermes/hermes-server/core/domain/routerule"
+	"nfcunha/hermes/hermes-server/core/domain/service"
+)
+
+// MetadataSource marks service instances declared in the route config file,
+// so that they can be updated or removed when the file changes.
+const MetadataSource = "hermes_source"
+
+// SourceConfigFile is the MetadataSource value of instances declared in the
+// route config file.
+const SourceConfigFile = "config_file"
+
+// RouteConfig is a validated route config file: the static service instances,
+// route rules, route policies and rate limits it declares.
+type RouteConfig struct {
+	Instances  []*service.Service
+	Rules      []*routerule.Rule
+	Policies   []*policy.RoutePolicy
+	RateLimits []*limit.RateLimit
+}
+
+// routeConfigFile is the YAML layout of the route config file. Services are
+// keyed by name; their fields match those of the registration API. Route
+// rules are matched at the gateway root.
+type routeConfigFile struct {
+	Services map[string]routeServiceFile `yaml:"services"`
+	Routes   []routeRuleFile             `yaml:"routes"`
+}
+
+type routeServiceFile struct {
+	Protocol                string              `yaml:"protocol"`
+	HealthCheckPath         string              `yaml:"health_check_path"`
+	HealthCheckType         string              `yaml:"health_check_type"`
+	HealthCheckExpectStatus int                 `yaml:"health_check_expect_status"`
+	HealthCheckExpectBody   string              `yaml:"health_check_expect_body"`
+	HealthCheckInterval     int                 `yaml:"health_check_interval_seconds"`
+	HealthCheckTimeout      int                 `yaml:"health_check_timeout_seconds"`
+	HealthCheckThreshold    int                 `yaml:"health_check_threshold"`
+	Balancer                string              `yaml:"balancer"` // Shorthand for the lb_strategy metadata key
+	HashKey                 string              `yaml:"hash_key"` // Shorthand for the lb_hash_key metadata key
+	Timeout                 string              `yaml:"timeout"`  // Shorthand for the retry_per_try_timeout metadata key
+	Retry                   *routeRetryFile     `yaml:"retry"`
+	Metadata                map[string]string   `yaml:"metadata"`
+	Instances               []routeInstanceFile `yaml:"instances"`
+	Auth                    *routeAuthFile      `yaml:"auth"`
+	RateLimit               *routeRateLimitFile `yaml:"rate_limit"`
+}
+
+type routeRuleFile struct {
+	Name          string            `yaml:"name"`
+	Priority      int               `yaml:"priority"`
+	Hosts         []string          `yaml:"hosts"`
+	PathPrefix    string            `yaml:"path_prefix"`
+	PathRegex     string            `yaml:"path_regex"`
+	Methods       []string          `yaml:"methods"`
+	Headers       map[string]string `yaml:"headers"`
+	Service       string            `yaml:"service"`
+	StripPrefix   bool              `yaml:"strip_prefix"`
+	Rewrite       string            `yaml:"rewrite"`
+	SubsetHeaders map[string]string `yaml:"subset_headers"`
+}
+
+type routeInstanceFile struct {
+	Host     string            `yaml:"host"`
+	Port     int               `yaml:"port"`
+	Weight   int               `yaml:"weight"` // Shorthand for the lb_weight metadata key
+	Metadata map[string]string `yaml:"metadata"`
+}
+
+type routeRetryFile struct {
+	Attempts int    `yaml:"attempts"`
+	Backoff  string `yaml:"backoff"`
+	RetryOn  string `yaml:"retry_on"`
+}
+
+type routeAuthFile struct {
+	Access      string   `yaml:"access"`
+	Roles       []string `yaml:"roles"`
+	Permissions []string `yaml:"permissions"`
+}
+
+type routeRateLimitFile struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	Burst             int     `yaml:"burst"`
+	Key               string  `yaml:"key"`
+}
+
+// ParseRouteConfig parses and validates a route config file. Unknown fields
+// are rejected, so that typos do not silently drop settings. An empty file, or
+// one without services or routes, is rejected too: it is more likely a file
+// caught mid-save than a wish to drop everything, which takes an explicit
+// "services: {}". Returns an error naming the offending service or route if
+// any declaration is invalid.
+func ParseRouteConfig(data []byte) (*RouteConfig, error) {
+	var file routeConfigFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err == io.EOF {
+		return nil, errors.New("route config file is empty")
+	} else if err != nil {
+		return nil, errors.New("invalid YAML: " + err.Error())
+	}
+	if file.Services == nil && file.Routes == nil {
+		return nil, errors.New(`route config file declares no services or routes (use "services: {}" to declare none)`)
+	}
+
+	names := make([]string, 0, len(file.Services))
+	for name := range file.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cfg := &RouteConfig{}
+	for _, name := range names {
+		if err := cfg.addService(name, file.Services[name]); err != nil {
+			return nil, errors.New("service " + strconv.Quote(name) + ": " + err.Error())
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, r := range file.Routes {
+		rule := &routerule.Rule{
+			Name:          r.Name,
+			Priority:      r.Priority,
+			Hosts:         r.Hosts,
+			PathPrefix:    r.PathPrefix,
+			PathRegex:     r.PathRegex,
+			Methods:       r.Methods,
+			Headers:       r.Headers,
+			ServiceName:   r.Service,
+			StripPrefix:   r.StripPrefix,
+			Rewrite:       r.Rewrite,
+			SubsetHeaders: r.SubsetHeaders,
+		}
+		if err := rule.Validate(); err != nil {
+			return nil, errors.New("route " + strconv.Quote(r.Name) + ": " + err.Error())
+		}
+		if seen[rule.Name] {
+			return nil, errors.New("route " + strconv.Quote(r.Name) + ": duplicate name")
+		}
+		seen[rule.Name] = true
+		cfg.Rules = append(cfg.Rules, rule)
+	}
+	return cfg, nil
+}
+
+// addService validates a service declaration and adds its instances, policy
+// and rate limit to the config.
+func (cfg *RouteConfig) addService(name string, svc routeServiceFile) error {
+	if name == "" {
+		return errors.New("name is required")
+	}
+
+	metadata, err := serviceMetadata(svc)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for _, inst := range svc.Instances {
+		if inst.Host == "" || inst.Port < 1 || inst.Port > 65535 {
+			return errors.New("instances need a host and a port between 1 and 65535")
+		}
+		address := inst.Host + ":" + strconv.Itoa(inst.Port)
+		if seen[address] {
+			return errors.New("duplicate instance " + address)
+		}
+		seen[address] = true
+		if inst.Weight < 0 {
+			return errors.New("instance weight must not be negative")
+		}
+
+		instance := service.NewService(name, inst.Host, inst.Port, svc.HealthCheckPath)
+		if err := applyRouteHealthCheck(instance, svc); err != nil {
+			return err
+		}
+		for key, value := range metadata {
+			instance.Metadata[key] = value
+		}
+		for key, value := range inst.Metadata {
+			instance.Metadata[key] = value
+		}
+		if inst.Weight > 0 {
+			instance.Metadata[MetadataWeight] = strconv.Itoa(inst.Weight)
+		}
+		instance.Metadata[MetadataSource] = SourceConfigFile
+		cfg.Instances = append(cfg.Instances, instance)
+	}
+
+	if svc.Auth != nil {
+		p := &policy.RoutePolicy{
+			ServiceName: name,
+			Access:      policy.Access(svc.Auth.Access),
+			Roles:       svc.Auth.Roles,
+			Permissions: svc.Auth.Permissions,
+		}
+		if err := p.Validate(); err != nil {
+			return err
+		}
+		cfg.Policies = append(cfg.Policies, p)
+	}
+
+	if svc.RateLimit != nil {
+		l := &limit.RateLimit{
+			ServiceName:       name,
+			RequestsPerSecond: svc.RateLimit.RequestsPerSecond,
+			Burst:             svc.RateLimit.Burst,
+			Key:               limit.KeyType(svc.RateLimit.Key),
+		}
+		if l.Key == "" {
+			l.Key = limit.KeyIP
+		}
+		if err := l.Validate(); err != nil {
+			return err
+		}
+		cfg.RateLimits = append(cfg.RateLimits, l)
+	}
+
+	return nil
+}
+
+// serviceMetadata returns the metadata shared by all instances of a service,
+// with the balancer, timeout and retry shorthands applied.
+func serviceMetadata(svc routeServiceFile) (map[string]string, error) {
+	metadata := make(map[string]string, len(svc.Metadata))
+	for key, value := range svc.Metadata {
+		metadata[key] = value
+	}
+
+	if svc.Balancer != "" {
+		metadata[MetadataBalancer] = svc.Balancer
+	}
+	if svc.HashKey != "" {
+		metadata[MetadataHashKey] = svc.HashKey
+	}
+	if svc.Timeout != "" {
+		metadata[MetadataRetryPerTryTimeout] = svc.Timeout
+	}
+	if svc.Retry != nil {
+		if svc.Retry.Attempts < 0 {
+			return nil, errors.New("retry attempts must not be negative")
+		}
+		if svc.Retry.Attempts > 0 {
+			metadata[MetadataRetryAttempts] = strconv.Itoa(svc.Retry.Attempts)
+		}
+		if svc.Retry.Backoff != "" {
+			metadata[MetadataRetryBackoff] = svc.Retry.Backoff
+		}
+		if svc.Retry.RetryOn != "" {
+			metadata[MetadataRetryOn] = svc.Retry.RetryOn
+		}
+	}
+
+	if !IsValidStrategy(metadata[MetadataBalancer]) {
+		return nil, errors.New("unknown load balancing strategy")
+	}
+	for _, key := range []string{MetadataRetryPerTryTimeout, MetadataRetryBackoff} {
+		if value, exists := metadata[key]; exists {
+			if d, err := time.ParseDuration(value); err != nil || d < 0 {
+				return nil, errors.New("invalid duration for " + key)
+			}
+		}
+	}
+	if _, err := ParseRetryOn(metadata[MetadataRetryOn]); err != nil {
+		return nil, errors.New("invalid retry status codes")
+	}
+	return metadata, nil
+}
+
+// applyRouteHealthCheck sets the protocol and health check of an instance,
+// with the same rules as the registration API.
+func applyRouteHealthCheck(instance *service.Service, svc routeServiceFile) error {
+	switch svc.Protocol {
+	case "":
+	case "http", "https":
+		instance.Protocol = svc.Protocol
+	default:
+		return errors.New("protocol must be http or https")
+	}
+
+	if svc.HealthCheckType != "" {
+		instance.HealthCheckType = service.HealthCheckType(svc.HealthCheckType)
+	}
+	if !service.IsValidHealthCheckType(instance.HealthCheckType) {
+		return errors.New("unknown health check type")
+	}
+	switch instance.HealthCheckType {
+	case service.HealthCheckHTTP, service.HealthCheckHTTPExpect:
+		if instance.HealthCheckPath == "" {
+			return errors.New("health_check_path is required for HTTP health checks")
+		}
+	}
+	if instance.HealthCheckType == service.HealthCheckHTTPExpect {
+		if svc.HealthCheckExpectStatus != 0 && (svc.HealthCheckExpectStatus < 100 || svc.HealthCheckExpectStatus > 599) {
+			return errors.New("invalid health_check_expect_status")
+		}
+		if _, err := regexp.Compile(svc.HealthCheckExpectBody); err != nil {
+			return errors.New("invalid health_check_expect_body pattern")
+		}
+		instance.ExpectStatus = svc.HealthCheckExpectStatus
+		instance.ExpectBody = svc.HealthCheckExpectBody
+	}
+
+	if svc.HealthCheckInterval < 0 || svc.HealthCheckTimeout < 0 || svc.HealthCheckThreshold < 0 {
+		return errors.New("health check interval, timeout and threshold must not be negative")
+	}
+	if svc.HealthCheckInterval > 0 && svc.HealthCheckTimeout > svc.HealthCheckInterval {
+		return errors.New("health check timeout must not exceed the interval")
+	}
+	instance.HealthInterval = svc.HealthCheckInterval
+	instance.HealthTimeout = svc.HealthCheckTimeout
+	instance.HealthThreshold = svc.HealthCheckThreshold
+	return nil
+}
@@ -0,0 +1,234 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"nfcunha/hermes/hermes-server/core/domain/service"
+)
+
+// routeConfigProbeTimeout bounds the initial health check of instances added
+// by the route config file.
+const routeConfigProbeTimeout = 5 * time.Second
+
+// RouteConfigLoader applies the route config file to the registry, the route
+// table, the route policy store and the rate limiter. A file is only applied
+// once it has been parsed and validated completely, so a bad file leaves the
+// running configuration untouched. Instances declared in the file are marked with
+// MetadataSource; instances registered through the API are never modified.
+type RouteConfigLoader struct {
+	path     string
+	interval time.Duration
+	registry *ServiceRegistry
+	drainer  *DrainManager
+	policies *RoutePolicyStore
+	limiter  *RateLimiter
+	table    *RouteTable
+	prober   *HealthProber
+	metrics  *Metrics
+	checksum [sha256.Size]byte // Content of the last file read
+	mu       sync.Mutex        // Serializes loads
+	stopChan chan struct{}
+}
+
+// NewRouteConfigLoader creates a loader for the route config file at path,
+// which Start checks for changes every interval. Removed instances are
+// drained with the drain manager's default timeout.
+func NewRouteConfigLoader(path string, interval time.Duration, reg *ServiceRegistry, drainer *DrainManager, policies *RoutePolicyStore, limiter *RateLimiter, table *RouteTable, metrics *Metrics) *RouteConfigLoader {
+	return &RouteConfigLoader{
+		path:     path,
+		interval: interval,
+		registry: reg,
+		drainer:  drainer,
+		policies: policies,
+		limiter:  limiter,
+		table:    table,
+		prober:   NewHealthProber(),
+		metrics:  metrics,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Load reads, validates and applies the route config file. Route rules, route
+// policies and rate limits are replaced as a whole; instances are reconciled
+// with those already registered from the file: unchanged instances are kept,
+// new and changed ones are health checked and registered, and instances no
+// longer declared or replaced by changed ones are drained. Nothing is applied
+// until the new instances have been health checked. Returns an error, without
+// applying anything, if the file cannot be read or is invalid.
+func (l *RouteConfigLoader) Load() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		log.Printf("Failed to read route config file %s: %v", l.path, err)
+		l.metrics.ObserveConfigReload("failure")
+		return errors.New("failed to read route config file")
+	}
+	l.checksum = sha256.Sum256(data)
+
+	cfg, err := ParseRouteConfig(data)
+	if err != nil {
+		log.Printf("Rejected route config file %s: %v", l.path, err)
+		l.metrics.ObserveConfigReload("failure")
+		return err
+	}
+
+	added, kept, removed := l.reconcile(cfg.Instances)
+	l.policies.SetStatic(cfg.Policies)
+	l.limiter.SetStatic(cfg.RateLimits)
+	l.table.SetStatic(cfg.Rules)
+
+	log.Printf("Route config loaded from %s: %d instances added, %d unchanged, %d removed, %d routes, %d policies, %d rate limits",
+		l.path, added, kept, removed, len(cfg.Rules), len(cfg.Policies), len(cfg.RateLimits))
+	l.metrics.ObserveConfigReload("success")
+	return nil
+}
+
+// Start begins watching the route config file in the current goroutine,
+// reloading it whenever its content changes. A rejected file is not retried
+// until it changes again.
+// This method blocks until Stop() is called, so it should typically be
+// run in a separate goroutine using: go loader.Start()
+func (l *RouteConfigLoader) Start() {
+	log.Printf("Watching route config file %s: interval=%v", l.path, l.interval)
+
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if l.changed() {
+				l.Load()
+			}
+		case <-l.stopChan:
+			log.Println("Route config watcher stopped")
+			return
+		}
+	}
+}
+
+// Stop signals the route config watcher to stop.
+func (l *RouteConfigLoader) Stop() {
+	close(l.stopChan)
+}
+
+// changed reports whether the content of the file differs from the last one read.
+func (l *RouteConfigLoader) changed() bool {
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return sha256.Sum256(data) != l.checksum
+}
+
+// reconcile brings the instances registered from the file in line with the
+// declared ones. Instances already draining are left to finish. Must be
+// called with the lock held.
+func (l *RouteConfigLoader) reconcile(declared []*service.Service) (added, kept, removed int) {
+	current := make(map[string]*service.Service)
+	for _, svc := range l.registry.List() {
+		if svc.Metadata[MetadataSource] == SourceConfigFile && svc.Status != service.StatusDraining {
+			current[instanceKey(svc)] = svc
+		}
+	}
+
+	var register []*service.Service
+	for _, svc := range declared {
+		key := instanceKey(svc)
+		if existing, exists := current[key]; exists && sameInstance(existing, svc) {
+			delete(current, key)
+			kept++
+			continue
+		}
+		register = append(register, svc)
+	}
+
+	// Probe before touching the registry, so that replaced instances keep
+	// serving until their successors are ready.
+	l.probe(register)
+
+	for _, svc := range register {
+		key := instanceKey(svc)
+		if existing, exists := current[key]; exists {
+			// The old instance finishes its requests while the new one takes over
+			delete(current, key)
+			if _, err := l.drainer.Drain(existing.ID, 0); err != nil {
+				log.Printf("Failed to replace %s (%s) from route config: %v", existing.Name, existing.ID, err)
+				continue
+			}
+		}
+		if err := l.registry.Register(svc); err != nil {
+			log.Printf("Failed to register %s at %s from route config: %v", svc.Name, svc.BaseURL(), err)
+			continue
+		}
+		added++
+	}
+
+	for _, svc := range current {
+		if _, err := l.drainer.Drain(svc.ID, 0); err != nil {
+			log.Printf("Failed to drain %s (%s) removed from route config: %v", svc.Name, svc.ID, err)
+			continue
+		}
+		removed++
+	}
+	return added, kept, removed
+}
+
+// probe health checks the instances concurrently and marks those that fail
+// as unhealthy, like the registration API does.
+func (l *RouteConfigLoader) probe(instances []*service.Service) {
+	var wg sync.WaitGroup
+	for _, svc := range instances {
+		wg.Add(1)
+		go func(svc *service.Service) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), routeConfigProbeTimeout)
+			defer cancel()
+			if result := l.prober.Probe(ctx, svc); !result.Healthy() {
+				log.Printf("Initial health check failed for %s at %s, registering as unhealthy: %s", svc.Name, svc.BaseURL(), result.Error)
+				svc.Status = service.StatusUnhealthy
+			}
+		}(svc)
+	}
+	wg.Wait()
+}
+
+// instanceKey identifies an instance by name and address.
+func instanceKey(svc *service.Service) string {
+	return svc.Name + "\xff" + svc.Host + ":" + strconv.Itoa(svc.Port)
+}
+
+// sameInstance reports whether two instances at the same address are
+// configured alike.
+func sameInstance(a, b *service.Service) bool {
+	if a.Protocol != b.Protocol ||
+		a.HealthCheckPath != b.HealthCheckPath ||
+		a.HealthCheckType != b.HealthCheckType ||
+		a.ExpectStatus != b.ExpectStatus ||
+		a.ExpectBody != b.ExpectBody ||
+		a.HealthInterval != b.HealthInterval ||
+		a.HealthTimeout != b.HealthTimeout ||
+		a.HealthThreshold != b.HealthThreshold ||
+		len(a.Metadata) != len(b.Metadata) {
+		return false
+	}
+	for key, value := range a.Metadata {
+		if other, exists := b.Metadata[key]; !exists || other != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,387 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"nfcunha/hermes/hermes-server/core/domain/limit"
+	"nfcunha/hermes/hermes-server/core/domain/policy"
+	"nfcunha/hermes/hermes-server/core/domain/service"
+)
+
+func TestParseRouteConfig(t *testing.T) {
+	cfg, err := ParseRouteConfig([]byte(`
+services:
+  orders:
+    health_check_path: /health
+    balancer: least_requests
+    timeout: 2s
+    retry:
+      attempts: 3
+      retry_on: "503"
+    instances:
+      - host: 10.0.0.1
+        port: 8080
+        weight: 3
+      - host: 10.0.0.2
+        port: 8080
+        metadata:
+          zone: b
+    auth:
+      access: roles
+      roles: [admin]
+    rate_limit:
+      requests_per_second: 10
+routes:
+  - name: orders-api
+    hosts: [api.example.com]
+    path_prefix: /orders
+    strip_prefix: true
+    service: orders
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse route config: %v", err)
+	}
+
+	if len(cfg.Instances) != 2 {
+		t.Fatalf("Expected 2 instances, got %d", len(cfg.Instances))
+	}
+	first := cfg.Instances[0]
+	if first.Name != "orders" || first.Host != "10.0.0.1" || first.HealthCheckPath != "/health" {
+		t.Errorf("Unexpected instance: %+v", first)
+	}
+	expected := map[string]string{
+		MetadataBalancer:           "least_requests",
+		MetadataRetryPerTryTimeout: "2s",
+		MetadataRetryAttempts:      "3",
+		MetadataRetryOn:            "503",
+		MetadataWeight:             "3",
+		MetadataSource:             SourceConfigFile,
+	}
+	for key, value := range expected {
+		if first.Metadata[key] != value {
+			t.Errorf("Expected metadata %s=%q, got %q", key, value, first.Metadata[key])
+		}
+	}
+	if cfg.Instances[1].Metadata["zone"] != "b" || cfg.Instances[1].Metadata[MetadataWeight] != "" {
+		t.Errorf("Expected per-instance metadata only on the second instance, got %v", cfg.Instances[1].Metadata)
+	}
+
+	if len(cfg.Policies) != 1 || cfg.Policies[0].Access != policy.AccessRoles || cfg.Policies[0].ServiceName != "orders" {
+		t.Errorf("Unexpected policies: %+v", cfg.Policies)
+	}
+	if len(cfg.RateLimits) != 1 || cfg.RateLimits[0].Key != limit.KeyIP || cfg.RateLimits[0].RequestsPerSecond != 10 {
+		t.Errorf("Unexpected rate limits: %+v", cfg.RateLimits)
+	}
+	if len(cfg.Rules) != 1 || cfg.Rules[0].ServiceName != "orders" || !cfg.Rules[0].StripPrefix {
+		t.Errorf("Unexpected route rules: %+v", cfg.Rules)
+	}
+}
+
+func TestParseRouteConfig_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{"unknown field", "services:\n  orders:\n    balancr: random\n", "invalid YAML"},
+		{"unknown balancer", "services:\n  orders:\n    balancer: fastest\n", "unknown load balancing strategy"},
+		{"bad timeout", "services:\n  orders:\n    timeout: soon\n", "invalid duration"},
+		{"bad retry codes", "services:\n  orders:\n    retry:\n      retry_on: abc\n", "invalid retry status codes"},
+		{"missing port", "services:\n  orders:\n    instances:\n      - host: a\n", "port"},
+		{"duplicate instance", "services:\n  orders:\n    health_check_path: /h\n    instances:\n      - {host: a, port: 1}\n      - {host: a, port: 1}\n", "duplicate instance"},
+		{"missing health path", "services:\n  orders:\n    instances:\n      - {host: a, port: 1}\n", "health_check_path is required"},
+		{"bad access", "services:\n  orders:\n    auth:\n      access: everyone\n", "orders"},
+		{"route without service", "routes:\n  - name: r\n    path_prefix: /r\n", "service_name is required"},
+		{"duplicate route", "routes:\n  - {name: r, path_prefix: /r, service: a}\n  - {name: r, path_prefix: /s, service: a}\n", "duplicate name"},
+		{"empty file", "", "empty"},
+		{"bare services key", "services:\n", "no services or routes"},
+		{"bad rate limit key", "services:\n  orders:\n    rate_limit:\n      requests_per_second: 1\n      key: cookie\n", "key must be"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRouteConfig([]byte(tt.yaml))
+			if err == nil {
+				t.Fatal("Expected the route config to be rejected")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %q", tt.want, err.Error())
+			}
+		})
+	}
+}
+
+// newRouteConfigBackend starts a healthy backend and returns its host and port.
+func newRouteConfigBackend(t *testing.T) (string, string) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse backend URL: %v", err)
+	}
+	return u.Hostname(), u.Port()
+}
+
+func writeRouteConfig(t *testing.T, path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write route config: %v", err)
+	}
+}
+
+func TestRouteConfigLoader_Reload(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	reg := NewServiceRegistry(db)
+	drainer := NewDrainManager(reg, NewInFlightTracker(), time.Second, time.Minute)
+	policies := NewRoutePolicyStore(db, policy.AccessPublic)
+	limiter := NewRateLimiter(db, limit.RateLimit{})
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	loader := NewRouteConfigLoader(path, time.Second, reg, drainer, policies, limiter, NewRouteTable(db), nil)
+
+	hostA, portA := newRouteConfigBackend(t)
+	hostB, portB := newRouteConfigBackend(t)
+
+	// An instance registered through the API is left alone
+	dynamic := service.NewService("orders", "10.0.0.9", 8080, "/health")
+	if err := reg.Register(dynamic); err != nil {
+		t.Fatalf("Failed to register service: %v", err)
+	}
+
+	writeRouteConfig(t, path, `
+services:
+  orders:
+    health_check_path: /health
+    instances:
+      - {host: `+hostA+`, port: `+portA+`}
+      - {host: `+hostB+`, port: `+portB+`}
+    auth:
+      access: authenticated
+    rate_limit:
+      requests_per_second: 5
+`)
+	if err := loader.Load(); err != nil {
+		t.Fatalf("Failed to load route config: %v", err)
+	}
+	if instances, _ := reg.GetByName("orders"); len(instances) != 3 {
+		t.Fatalf("Expected 3 instances, got %d", len(instances))
+	}
+	if p := policies.Get("orders"); p.Access != policy.AccessAuthenticated || p.Source != policy.SourceConfigFile {
+		t.Errorf("Expected the file's policy, got %+v", p)
+	}
+	if err := policies.Delete("orders"); err == nil {
+		t.Error("Expected the file's policy not to be deletable")
+	}
+	if l := limiter.Get("orders"); l.RequestsPerSecond != 5 || l.Burst != 5 {
+		t.Errorf("Expected the file's rate limit, got %+v", l)
+	}
+	kept := instanceAt(reg, portA)
+
+	// A bad file is rejected and changes nothing
+	writeRouteConfig(t, path, "services:\n  orders:\n    balancer: fastest\n")
+	if err := loader.Load(); err == nil {
+		t.Fatal("Expected the bad route config to be rejected")
+	}
+	if instances, _ := reg.GetByName("orders"); len(instances) != 3 {
+		t.Errorf("Expected the bad file to leave 3 instances, got %d", len(instances))
+	}
+	if p := policies.Get("orders"); p.Access != policy.AccessAuthenticated {
+		t.Errorf("Expected the bad file to keep the policy, got %s", p.Access)
+	}
+
+	// Removing an instance and the auth rule drains the instance and
+	// reverts to the default policy
+	writeRouteConfig(t, path, `
+services:
+  orders:
+    health_check_path: /health
+    instances:
+      - {host: `+hostA+`, port: `+portA+`}
+`)
+	if err := loader.Load(); err != nil {
+		t.Fatalf("Failed to reload route config: %v", err)
+	}
+	if svc := instanceAt(reg, portA); svc == nil || svc.ID != kept.ID {
+		t.Error("Expected the unchanged instance to be kept")
+	}
+	for _, svc := range reg.List() {
+		if svc.Port != kept.Port && svc.Metadata[MetadataSource] == SourceConfigFile && svc.Status != service.StatusDraining {
+			t.Errorf("Expected the removed instance to be draining, got %s", svc.Status)
+		}
+	}
+	if svc, err := reg.GetByID(dynamic.ID); err != nil || svc.Status == service.StatusDraining {
+		t.Error("Expected the instance registered through the API to be left alone")
+	}
+	if p := policies.Get("orders"); p.Access != policy.AccessPublic {
+		t.Errorf("Expected the default policy once the auth rule is removed, got %s", p.Access)
+	}
+	if l := limiter.Get("orders"); !l.Unlimited() {
+		t.Errorf("Expected the default rate limit once the rule is removed, got %+v", l)
+	}
+}
+
+func TestRouteConfigLoader_ReplacesInstancesGracefully(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	reg := NewServiceRegistry(db)
+	drainer := NewDrainManager(reg, NewInFlightTracker(), time.Second, time.Minute)
+	policies := NewRoutePolicyStore(db, policy.AccessPublic)
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	loader := NewRouteConfigLoader(path, time.Second, reg, drainer, policies, NewRateLimiter(db, limit.RateLimit{}), NewRouteTable(db), nil)
+
+	// The backend's health checks are held up while hold is set
+	var hold atomic.Bool
+	probing := make(chan struct{}, 1)
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hold.Load() {
+			probing <- struct{}{}
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+
+	writeRouteConfig(t, path, `
+services:
+  orders:
+    health_check_path: /health
+    instances:
+      - {host: `+u.Hostname()+`, port: `+u.Port()+`}
+`)
+	if err := loader.Load(); err != nil {
+		t.Fatalf("Failed to load route config: %v", err)
+	}
+	old := instanceAt(reg, u.Port())
+
+	// Nothing of a reload is applied while its instances are being probed
+	writeRouteConfig(t, path, `
+services:
+  orders:
+    health_check_path: /health
+    auth:
+      access: authenticated
+    instances:
+      - {host: `+u.Hostname()+`, port: `+u.Port()+`, metadata: {version: v2}}
+`)
+	hold.Store(true)
+	loaded := make(chan error, 1)
+	go func() { loaded <- loader.Load() }()
+	<-probing
+	if p := policies.Get("orders"); p.Access != policy.AccessPublic {
+		t.Errorf("Expected the policy to change only once the probe is done, got %s", p.Access)
+	}
+	if healthy := reg.GetHealthy("orders"); len(healthy) != 1 || healthy[0].ID != old.ID {
+		t.Errorf("Expected the old instance to keep serving during the probe, got %v", healthy)
+	}
+	hold.Store(false)
+	close(release)
+	if err := <-loaded; err != nil {
+		t.Fatalf("Failed to reload route config: %v", err)
+	}
+	if p := policies.Get("orders"); p.Access != policy.AccessAuthenticated {
+		t.Errorf("Expected the file's policy after the reload, got %s", p.Access)
+	}
+
+	// The changed instance replaces the old one, which is drained
+	if svc, err := reg.GetByID(old.ID); err != nil || svc.Status != service.StatusDraining {
+		t.Errorf("Expected the replaced instance to be draining, got %v (err: %v)", svc, err)
+	}
+	healthy := reg.GetHealthy("orders")
+	if len(healthy) != 1 || healthy[0].ID == old.ID || healthy[0].Metadata["version"] != "v2" {
+		t.Errorf("Expected the new instance to serve, got %v", healthy)
+	}
+}
+
+func TestRouteConfigLoader_IgnoresEmptyFile(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	reg := NewServiceRegistry(db)
+	drainer := NewDrainManager(reg, NewInFlightTracker(), time.Second, time.Minute)
+	policies := NewRoutePolicyStore(db, policy.AccessPublic)
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	loader := NewRouteConfigLoader(path, time.Second, reg, drainer, policies, NewRateLimiter(db, limit.RateLimit{}), NewRouteTable(db), nil)
+
+	host, port := newRouteConfigBackend(t)
+	writeRouteConfig(t, path, `
+services:
+  orders:
+    health_check_path: /health
+    instances:
+      - {host: `+host+`, port: `+port+`}
+    auth:
+      access: authenticated
+`)
+	if err := loader.Load(); err != nil {
+		t.Fatalf("Failed to load route config: %v", err)
+	}
+
+	// A file truncated mid-save leaves the running configuration alone
+	for _, content := range []string{"", "services:\n"} {
+		writeRouteConfig(t, path, content)
+		if err := loader.Load(); err == nil {
+			t.Fatalf("Expected %q to be rejected", content)
+		}
+		if healthy := reg.GetHealthy("orders"); len(healthy) != 1 {
+			t.Errorf("Expected the instance to keep serving, got %d healthy", len(healthy))
+		}
+		if p := policies.Get("orders"); p.Access != policy.AccessAuthenticated {
+			t.Errorf("Expected the file's policy to be kept, got %s", p.Access)
+		}
+	}
+
+	// Removing everything takes an explicit empty declaration
+	writeRouteConfig(t, path, "services: {}\n")
+	if err := loader.Load(); err != nil {
+		t.Fatalf("Failed to load an explicitly empty route config: %v", err)
+	}
+	if healthy := reg.GetHealthy("orders"); len(healthy) != 0 {
+		t.Errorf("Expected the instance to be drained, got %d healthy", len(healthy))
+	}
+}
+
+func TestRouteConfigLoader_WatchesFile(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	reg := NewServiceRegistry(db)
+	drainer := NewDrainManager(reg, NewInFlightTracker(), time.Second, time.Minute)
+	policies := NewRoutePolicyStore(db, policy.AccessPublic)
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	loader := NewRouteConfigLoader(path, 10*time.Millisecond, reg, drainer, policies, NewRateLimiter(db, limit.RateLimit{}), NewRouteTable(db), nil)
+
+	writeRouteConfig(t, path, "services:\n  orders:\n    auth:\n      access: authenticated\n")
+	if err := loader.Load(); err != nil {
+		t.Fatalf("Failed to load route config: %v", err)
+	}
+	go loader.Start()
+	defer loader.Stop()
+
+	writeRouteConfig(t, path, "services:\n  orders:\n    auth:\n      access: roles\n      roles: [admin]\n")
+	waitFor(t, func() bool { return policies.Get("orders").Access == policy.AccessRoles })
+}
+
+// instanceAt returns the instance registered on port from the route config.
+func instanceAt(reg *ServiceRegistry, port string) *service.Service {
+	for _, svc := range reg.List() {
+		if strconv.Itoa(svc.Port) == port && svc.Metadata[MetadataSource] == SourceConfigFile {
+			return svc
+		}
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package core
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"nfcunha/hermes/hermes-server/core/domain/policy"
+)
+
+// RoutePolicyStore holds the access policies of routed services, keyed by
+// service name, with database persistence. Policies declared in the route
+// config file take precedence over those set through the API and cannot be
+// changed through it. Services without a policy get the default access
+// level. The store is thread-safe.
+type RoutePolicyStore struct {
+	policies      map[string]*policy.RoutePolicy // Key: service name
+	static        map[string]*policy.RoutePolicy // Key: service name, from the route config file
+	defaultAccess policy.Access
+	mu            sync.RWMutex
+	db            *sql.DB
+}
+
+// NewRoutePolicyStore creates a policy store and loads the policies saved in
+// the database. If loading fails, a warning is logged but the store is still
+// created.
+func NewRoutePolicyStore(db *sql.DB, defaultAccess policy.Access) *RoutePolicyStore {
+	s := &RoutePolicyStore{
+		policies:      make(map[string]*policy.RoutePolicy),
+		static:        make(map[string]*policy.RoutePolicy),
+		defaultAccess: defaultAccess,
+		db:            db,
+	}
+
+	if db != nil {
+		if err := s.loadFromDatabase(); err != nil {
+			log.Printf("Warning: failed to load route policies from database: %v", err)
+		}
+	}
+
+	return s
+}
+
+// Get returns the policy of a service, or the default policy if none is set.
+func (s *RoutePolicyStore) Get(serviceName string) *policy.RoutePolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if p, exists := s.static[serviceName]; exists {
+		return p
+	}
+	if p, exists := s.policies[serviceName]; exists {
+		return p
+	}
+	return &policy.RoutePolicy{ServiceName: serviceName, Access: s.defaultAccess}
+}
+
+// List returns all explicitly set policies sorted by service name.
+func (s *RoutePolicyStore) List() []*policy.RoutePolicy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	policies := make([]*policy.RoutePolicy, 0, len(s.policies)+len(s.static))
+	for _, p := range s.static {
+		policies = append(policies, p)
+	}
+	for name, p := range s.policies {
+		if _, exists := s.static[name]; !exists {
+			policies = append(policies, p)
+		}
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].ServiceName < policies[j].ServiceName
+	})
+	return policies
+}
+
+// DefaultAccess returns the access level of services without a policy.
+func (s *RoutePolicyStore) DefaultAccess() policy.Access {
+	return s.defaultAccess
+}
+
+// Set validates and stores the policy of a service, replacing any previous one.
+// Returns an error if the service's policy is declared in the route config file.
+func (s *RoutePolicyStore) Set(p *policy.RoutePolicy) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	p.Source = ""
+	p.UpdatedAt = time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.static[p.ServiceName]; exists {
+		return errors.New("route policy is managed by the route config file")
+	}
+	if err := s.saveToDatabase(p); err != nil {
+		log.Printf("Failed to persist route policy for %s: %v", p.ServiceName, err)
+		return errors.New("failed to save route policy")
+	}
+	s.policies[p.ServiceName] = p
+
+	log.Printf("Route policy set: %s (%s)", p.ServiceName, p.Access)
+	return nil
+}
+
+// Delete removes the policy of a service, reverting it to the default.
+// Returns an error if the service has no policy or if its policy is declared
+// in the route config file.
+func (s *RoutePolicyStore) Delete(serviceName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.static[serviceName]; exists {
+		return errors.New("route policy is managed by the route config file")
+	}
+	if _, exists := s.policies[serviceName]; !exists {
+		return errors.New("route policy not found")
+	}
+	if s.db != nil {
+		if _, err := s.db.Exec("DELETE FROM route_policies WHERE service_name = ?", serviceName); err != nil {
+			log.Printf("Failed to delete route policy for %s: %v", serviceName, err)
+			return errors.New("failed to delete route policy")
+		}
+	}
+	delete(s.policies, serviceName)
+
+	log.Printf("Route policy removed: %s", serviceName)
+	return nil
+}
+
+// SetStatic replaces the policies declared in the route config file. The
+// policies must be valid.
+func (s *RoutePolicyStore) SetStatic(policies []*policy.RoutePolicy) {
+	static := make(map[string]*policy.RoutePolicy, len(policies))
+	now := time.Now()
+	for _, p := range policies {
+		p.Source = policy.SourceConfigFile
+		p.UpdatedAt = now
+		static[p.ServiceName] = p
+	}
+
+	s.mu.Lock()
+	s.static = static
+	s.mu.Unlock()
+}
+
+// loadFromDatabase loads all policies on startup.
+func (s *RoutePolicyStore) loadFromDatabase() error {
+	rows, err := s.db.Query(`SELECT service_name, access, roles, permissions, updated_at FROM route_policies`)
+	if err != nil {
+		log.Printf("Failed to query route policies: %v", err)
+		return errors.New("failed to query route policies")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p := &policy.RoutePolicy{}
+		var rolesJSON, permissionsJSON, updatedAt string
+		if err := rows.Scan(&p.ServiceName, &p.Access, &rolesJSON, &permissionsJSON, &updatedAt); err != nil {
+			log.Printf("Warning: failed to scan route policy row: %v", err)
+			continue
+		}
+		if err := json.Unmarshal([]byte(rolesJSON), &p.Roles); err != nil {
+			log.Printf("Warning: failed to parse roles of route policy %s: %v", p.ServiceName, err)
+		}
+		if err := json.Unmarshal([]byte(permissionsJSON), &p.Permissions); err != nil {
+			log.Printf("Warning: failed to parse permissions of route policy %s: %v", p.ServiceName, err)
+		}
+		if p.UpdatedAt, err = time.Parse(time.RFC3339, updatedAt); err != nil {
+			p.UpdatedAt = time.Now()
+		}
+		s.policies[p.ServiceName] = p
+	}
+
+	if len(s.policies) > 0 {
+		log.Printf("Loaded %d route policies from database", len(s.policies))
+	}
+	return rows.Err()
+}
+
+// saveToDatabase inserts or replaces a policy. Must be called with the lock held.
+func (s *RoutePolicyStore) saveToDatabase(p *policy.RoutePolicy) error {
+	if s.db == nil {
+		return nil
+	}
+
+	rolesJSON, err := json.Marshal(p.Roles)
+	if err != nil {
+		return err
+	}
+	permissionsJSON, err := json.Marshal(p.Permissions)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`
+		INSERT OR REPLACE INTO route_policies (service_name, access, roles, permissions, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, p.ServiceName, p.Access, string(rolesJSON), string(permissionsJSON), p.UpdatedAt.Format(time.RFC3339))
+	return err
+}
@@ -0,0 +1,37 @@
+package core
+
+import (
+	"testing"
+
+	"nfcunha/hermes/hermes-server/core/domain/policy"
+)
+
+func TestRoutePolicyStore_PersistsPolicies(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	store := NewRoutePolicyStore(db, policy.AccessAuthenticated)
+	if err := store.Set(&policy.RoutePolicy{ServiceName: "billing", Access: policy.AccessRoles, Roles: []string{"admin"}}); err != nil {
+		t.Fatalf("Failed to set policy: %v", err)
+	}
+	if err := store.Set(&policy.RoutePolicy{ServiceName: "invalid", Access: policy.AccessPermissions}); err == nil {
+		t.Error("Expected a permissions policy without permissions to be rejected")
+	}
+
+	// A new store sees the saved policy
+	reloaded := NewRoutePolicyStore(db, policy.AccessAuthenticated)
+	p := reloaded.Get("billing")
+	if p.Access != policy.AccessRoles || len(p.Roles) != 1 || p.Roles[0] != "admin" {
+		t.Errorf("Expected saved roles policy, got %+v", p)
+	}
+	if p := reloaded.Get("orders"); p.Access != policy.AccessAuthenticated {
+		t.Errorf("Expected default access for services without a policy, got %s", p.Access)
+	}
+
+	if err := reloaded.Delete("billing"); err != nil {
+		t.Fatalf("Failed to delete policy: %v", err)
+	}
+	if p := NewRoutePolicyStore(db, policy.AccessPublic).Get("billing"); p.Access != policy.AccessPublic {
+		t.Errorf("Expected deleted policy to revert to the default, got %s", p.Access)
+	}
+}
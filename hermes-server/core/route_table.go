@@ -0,0 +1,275 @@
+package core
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core/domain/routerule"
+)
+
+// RoutedServiceKey is the context key holding the service of the route rule
+// matched by a request at the gateway root.
+const RoutedServiceKey = "routed_service"
+
+// RoutedService returns the service a request is routed to: the service of
+// the matched route rule, or else the :serviceName parameter of the route
+// endpoint.
+func RoutedService(c *gin.Context) string {
+	if name := c.GetString(RoutedServiceKey); name != "" {
+		return name
+	}
+	return c.Param("serviceName")
+}
+
+// RouteTable holds the rules mapping requests at the gateway root to routed
+// services, keyed by rule name, with database persistence. Rules declared in
+// the route config file take precedence over those set through the API and
+// cannot be changed through it. The table is thread-safe.
+type RouteTable struct {
+	rules   map[string]*routerule.Rule // Key: rule name
+	static  map[string]*routerule.Rule // Key: rule name, from the route config file
+	ordered []*routerule.Rule          // Rules in match order
+	mu      sync.RWMutex
+	db      *sql.DB
+}
+
+// NewRouteTable creates a route table and loads the rules saved in the
+// database. If loading fails, a warning is logged but the table is still
+// created.
+func NewRouteTable(db *sql.DB) *RouteTable {
+	t := &RouteTable{
+		rules:  make(map[string]*routerule.Rule),
+		static: make(map[string]*routerule.Rule),
+		db:     db,
+	}
+
+	if db != nil {
+		if err := t.loadFromDatabase(); err != nil {
+			log.Printf("Warning: failed to load route rules from database: %v", err)
+		}
+	}
+	t.reorder()
+
+	return t
+}
+
+// Match returns the first rule matching the request, or nil if none does.
+// Rules are tried by priority (highest first), then by path prefix length
+// (longest first), then by name.
+func (t *RouteTable) Match(req *http.Request) *routerule.Rule {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for _, r := range t.ordered {
+		if r.Matches(req) {
+			return r
+		}
+	}
+	return nil
+}
+
+// Get returns a rule by name.
+// Returns an error if no rule with the given name exists.
+func (t *RouteTable) Get(name string) (*routerule.Rule, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if r, exists := t.static[name]; exists {
+		return r, nil
+	}
+	if r, exists := t.rules[name]; exists {
+		return r, nil
+	}
+	return nil, errors.New("route rule not found")
+}
+
+// List returns all rules in match order.
+func (t *RouteTable) List() []*routerule.Rule {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return append([]*routerule.Rule(nil), t.ordered...)
+}
+
+// Set validates and stores a rule, replacing any previous rule of the same
+// name. Returns an error if the rule is declared in the route config file.
+func (t *RouteTable) Set(r *routerule.Rule) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	r.Source = ""
+	r.UpdatedAt = time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, exists := t.static[r.Name]; exists {
+		return errors.New("route rule is managed by the route config file")
+	}
+	if err := t.saveToDatabase(r); err != nil {
+		log.Printf("Failed to persist route rule %s: %v", r.Name, err)
+		return errors.New("failed to save route rule")
+	}
+	t.rules[r.Name] = r
+	t.reorder()
+
+	log.Printf("Route rule set: %s -> %s", r.Name, r.ServiceName)
+	return nil
+}
+
+// Delete removes a rule.
+// Returns an error if the rule does not exist or is declared in the route
+// config file.
+func (t *RouteTable) Delete(name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, exists := t.static[name]; exists {
+		return errors.New("route rule is managed by the route config file")
+	}
+	if _, exists := t.rules[name]; !exists {
+		return errors.New("route rule not found")
+	}
+	if t.db != nil {
+		if _, err := t.db.Exec("DELETE FROM route_rules WHERE name = ?", name); err != nil {
+			log.Printf("Failed to delete route rule %s: %v", name, err)
+			return errors.New("failed to delete route rule")
+		}
+	}
+	delete(t.rules, name)
+	t.reorder()
+
+	log.Printf("Route rule removed: %s", name)
+	return nil
+}
+
+// SetStatic replaces the rules declared in the route config file. The rules
+// must be valid.
+func (t *RouteTable) SetStatic(rules []*routerule.Rule) {
+	static := make(map[string]*routerule.Rule, len(rules))
+	now := time.Now()
+	for _, r := range rules {
+		r.Source = routerule.SourceConfigFile
+		r.UpdatedAt = now
+		static[r.Name] = r
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.static = static
+	t.reorder()
+}
+
+// reorder rebuilds the match order. Must be called with the lock held.
+func (t *RouteTable) reorder() {
+	ordered := make([]*routerule.Rule, 0, len(t.rules)+len(t.static))
+	for _, r := range t.static {
+		ordered = append(ordered, r)
+	}
+	for name, r := range t.rules {
+		if _, exists := t.static[name]; !exists {
+			ordered = append(ordered, r)
+		}
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if len(a.PathPrefix) != len(b.PathPrefix) {
+			return len(a.PathPrefix) > len(b.PathPrefix)
+		}
+		return a.Name < b.Name
+	})
+	t.ordered = ordered
+}
+
+// loadFromDatabase loads all rules on startup. Rules that no longer validate
+// are skipped.
+func (t *RouteTable) loadFromDatabase() error {
+	rows, err := t.db.Query(`
+		SELECT name, priority, hosts, path_prefix, path_regex, methods, headers,
+		       service_name, strip_prefix, rewrite, subset_headers, updated_at
+		FROM route_rules
+	`)
+	if err != nil {
+		log.Printf("Failed to query route rules: %v", err)
+		return errors.New("failed to query route rules")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r := &routerule.Rule{}
+		var hostsJSON, methodsJSON, headersJSON, subsetJSON, updatedAt string
+		if err := rows.Scan(&r.Name, &r.Priority, &hostsJSON, &r.PathPrefix, &r.PathRegex, &methodsJSON, &headersJSON,
+			&r.ServiceName, &r.StripPrefix, &r.Rewrite, &subsetJSON, &updatedAt); err != nil {
+			log.Printf("Warning: failed to scan route rule row: %v", err)
+			continue
+		}
+		if err := json.Unmarshal([]byte(hostsJSON), &r.Hosts); err != nil {
+			log.Printf("Warning: failed to parse hosts of route rule %s: %v", r.Name, err)
+		}
+		if err := json.Unmarshal([]byte(methodsJSON), &r.Methods); err != nil {
+			log.Printf("Warning: failed to parse methods of route rule %s: %v", r.Name, err)
+		}
+		if err := json.Unmarshal([]byte(headersJSON), &r.Headers); err != nil {
+			log.Printf("Warning: failed to parse headers of route rule %s: %v", r.Name, err)
+		}
+		if err := json.Unmarshal([]byte(subsetJSON), &r.SubsetHeaders); err != nil {
+			log.Printf("Warning: failed to parse subset headers of route rule %s: %v", r.Name, err)
+		}
+		if r.UpdatedAt, err = time.Parse(time.RFC3339, updatedAt); err != nil {
+			r.UpdatedAt = time.Now()
+		}
+		if err := r.Validate(); err != nil {
+			log.Printf("Warning: skipping invalid route rule %s: %v", r.Name, err)
+			continue
+		}
+		t.rules[r.Name] = r
+	}
+
+	if len(t.rules) > 0 {
+		log.Printf("Loaded %d route rules from database", len(t.rules))
+	}
+	return rows.Err()
+}
+
+// saveToDatabase inserts or replaces a rule. Must be called with the lock held.
+func (t *RouteTable) saveToDatabase(r *routerule.Rule) error {
+	if t.db == nil {
+		return nil
+	}
+
+	hostsJSON, err := json.Marshal(r.Hosts)
+	if err != nil {
+		return err
+	}
+	methodsJSON, err := json.Marshal(r.Methods)
+	if err != nil {
+		return err
+	}
+	headersJSON, err := json.Marshal(r.Headers)
+	if err != nil {
+		return err
+	}
+	subsetJSON, err := json.Marshal(r.SubsetHeaders)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.db.Exec(`
+		INSERT OR REPLACE INTO route_rules (name, priority, hosts, path_prefix, path_regex, methods, headers,
+		                                    service_name, strip_prefix, rewrite, subset_headers, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, r.Name, r.Priority, string(hostsJSON), r.PathPrefix, r.PathRegex, string(methodsJSON), string(headersJSON),
+		r.ServiceName, r.StripPrefix, r.Rewrite, string(subsetJSON), r.UpdatedAt.Format(time.RFC3339))
+	return err
+}
@@ -0,0 +1,130 @@
+package core
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"nfcunha/hermes/hermes-server/core/domain/routerule"
+)
+
+func TestRouteTable_Match(t *testing.T) {
+	table := NewRouteTable(nil)
+	rules := []*routerule.Rule{
+		{Name: "api", PathPrefix: "/api", ServiceName: "api"},
+		{Name: "users", PathPrefix: "/api/users", ServiceName: "users", StripPrefix: true},
+		{Name: "admin-host", Hosts: []string{"*.admin.example.com"}, ServiceName: "admin"},
+		{Name: "v2", PathPrefix: "/api", Headers: map[string]string{"X-Version": "2"}, Priority: 10, ServiceName: "api-v2"},
+		{Name: "writes", PathRegex: `^/orders/(\d+)$`, Methods: []string{"post"}, Rewrite: "/v1/orders/$1", ServiceName: "orders"},
+	}
+	for _, r := range rules {
+		if err := table.Set(r); err != nil {
+			t.Fatalf("Failed to set rule %s: %v", r.Name, err)
+		}
+	}
+
+	tests := []struct {
+		method, url string
+		headers     map[string]string
+		rule, path  string
+	}{
+		{"GET", "http://gw/api/items", nil, "api", "/api/items"},
+		{"GET", "http://gw/api/users/42", nil, "users", "/42"},
+		{"GET", "http://gw/api/users", nil, "users", "/"},
+		{"GET", "http://gw/apis", nil, "", ""},
+		{"GET", "http://gw/api/users/42", map[string]string{"X-Version": "2"}, "v2", "/api/users/42"},
+		{"GET", "http://eu.admin.example.com:8080/dashboard", nil, "admin-host", "/dashboard"},
+		{"GET", "http://admin.example.com/dashboard", nil, "", ""},
+		{"POST", "http://gw/orders/7", nil, "writes", "/v1/orders/7"},
+		{"GET", "http://gw/orders/7", nil, "", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.url, nil)
+		for name, value := range tt.headers {
+			req.Header.Set(name, value)
+		}
+		rule := table.Match(req)
+		if tt.rule == "" {
+			if rule != nil {
+				t.Errorf("%s %s: expected no match, got %s", tt.method, tt.url, rule.Name)
+			}
+			continue
+		}
+		if rule == nil || rule.Name != tt.rule {
+			t.Errorf("%s %s: expected rule %s, got %+v", tt.method, tt.url, tt.rule, rule)
+			continue
+		}
+		if path := rule.TargetPath(req.URL.Path); path != tt.path {
+			t.Errorf("%s %s: expected target path %s, got %s", tt.method, tt.url, tt.path, path)
+		}
+	}
+}
+
+func TestRouteTable_Validation(t *testing.T) {
+	table := NewRouteTable(nil)
+	invalid := []*routerule.Rule{
+		{Name: "no-service", PathPrefix: "/a"},
+		{Name: "no-match", ServiceName: "a"},
+		{Name: "both-paths", PathPrefix: "/a", PathRegex: "^/a", ServiceName: "a"},
+		{Name: "relative", PathPrefix: "a", ServiceName: "a"},
+		{Name: "bad-regex", PathRegex: "(", ServiceName: "a"},
+		{Name: "strip-regex", PathRegex: "^/a", StripPrefix: true, ServiceName: "a"},
+		{Name: "bad-host", Hosts: []string{"a.*.com"}, ServiceName: "a"},
+	}
+	for _, r := range invalid {
+		if err := table.Set(r); err == nil {
+			t.Errorf("Expected rule %s to be rejected", r.Name)
+		}
+	}
+}
+
+func TestRouteTable_PersistsRulesAndProtectsStatic(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	table := NewRouteTable(db)
+	if err := table.Set(&routerule.Rule{
+		Name:          "users",
+		Hosts:         []string{"API.example.com"},
+		PathPrefix:    "/users",
+		Methods:       []string{"get"},
+		Headers:       map[string]string{"X-Tenant": ""},
+		ServiceName:   "users",
+		StripPrefix:   true,
+		SubsetHeaders: map[string]string{"X-Version": "version"},
+	}); err != nil {
+		t.Fatalf("Failed to set rule: %v", err)
+	}
+
+	// A new table sees the saved rule
+	reloaded := NewRouteTable(db)
+	req := httptest.NewRequest("GET", "http://api.example.com/users/1", nil)
+	req.Header.Set("X-Tenant", "acme")
+	if rule := reloaded.Match(req); rule == nil || rule.ServiceName != "users" || rule.TargetPath(req.URL.Path) != "/1" {
+		t.Fatalf("Expected the saved rule to match, got %+v", rule)
+	}
+	req.Header.Set("X-Version", "beta")
+	if subset := reloaded.Match(req).Subset(req); len(subset) != 1 || subset["version"] != "beta" {
+		t.Errorf("Expected the saved subset headers to select version beta, got %v", subset)
+	}
+
+	// Rules from the route config file override and cannot be changed
+	reloaded.SetStatic([]*routerule.Rule{{Name: "users", PathPrefix: "/people", ServiceName: "people"}})
+	if rule, err := reloaded.Get("users"); err != nil || rule.ServiceName != "people" || rule.Source != routerule.SourceConfigFile {
+		t.Errorf("Expected the static rule, got %+v", rule)
+	}
+	if err := reloaded.Delete("users"); err == nil {
+		t.Error("Expected the static rule not to be deletable")
+	}
+	if len(reloaded.List()) != 1 {
+		t.Errorf("Expected the static rule to hide the saved one, got %d rules", len(reloaded.List()))
+	}
+
+	// Removing it from the file uncovers the saved rule
+	reloaded.SetStatic(nil)
+	if err := reloaded.Delete("users"); err != nil {
+		t.Fatalf("Failed to delete rule: %v", err)
+	}
+	if len(NewRouteTable(db).List()) != 0 {
+		t.Error("Expected the deleted rule to be gone from the database")
+	}
+}
@@ -1,33 +1,93 @@
 package core
 
 import (
+	"bytes"
 	"errors"
-	"log"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core/domain/service"
 )
 
 // RoutingService handles routing requests to registered backend services.
-// It uses the service registry to discover healthy instances and forwards
-// requests using the proxy service. Currently uses first-available routing
-// strategy (future: implement load balancing).
+// It uses the service registry to discover healthy instances, selects one
+// of them with the service's load-balancing strategy, and forwards requests
+// using the proxy service.
 type RoutingService struct {
-	registry *ServiceRegistry
-	proxy    *ProxyService
+	registry    *ServiceRegistry
+	proxy       *ProxyService
+	inflight    *InFlightTracker
+	breaker     *CircuitBreaker
+	outliers    *OutlierDetector
+	concurrency *ConcurrencyLimiter
+	splitter    *TrafficSplitter
+	mirrors     *TrafficMirror
+	metrics     *Metrics
+	retry       RetryPolicy
+	subsets     SubsetConfig
+	balancers   map[string]*balancerEntry // Key: service name
+	mu          sync.Mutex
+}
+
+// balancerEntry caches the balancer built for a service name together with
+// the configuration it was built from, so it can be rebuilt when that changes.
+type balancerEntry struct {
+	strategy string
+	hashKey  string
+	balancer Balancer
 }
 
 // NewRoutingService creates a new routing service with the given registry and proxy.
-func NewRoutingService(reg *ServiceRegistry, prx *ProxyService) *RoutingService {
+// The in-flight tracker is shared with components that need per-instance
+// request counts, such as the DrainManager. The circuit breaker and the
+// outlier detector are fed with the outcome of every forwarded request. The
+// concurrency limiter caps in-flight requests and may be nil. The traffic
+// splitter narrows instances to a weighted variant and the traffic mirror
+// copies requests to other services; both may be nil. The retry
+// policy and the subset fallback are the defaults for services that do not
+// override them through metadata. Metrics may be nil.
+func NewRoutingService(reg *ServiceRegistry, prx *ProxyService, inflight *InFlightTracker, breaker *CircuitBreaker, outliers *OutlierDetector, concurrency *ConcurrencyLimiter, splitter *TrafficSplitter, mirrors *TrafficMirror, metrics *Metrics, retry RetryPolicy, subsets SubsetConfig) *RoutingService {
 	return &RoutingService{
-		registry: reg,
-		proxy:    prx,
+		registry:    reg,
+		proxy:       prx,
+		inflight:    inflight,
+		breaker:     breaker,
+		outliers:    outliers,
+		concurrency: concurrency,
+		splitter:    splitter,
+		mirrors:     mirrors,
+		metrics:     metrics,
+		retry:       retry,
+		subsets:     subsets,
+		balancers:   make(map[string]*balancerEntry),
 	}
 }
 
 // RouteToService routes a request to a registered service by name.
-// It looks up healthy instances of the service and forwards the request.
-// Currently uses the first healthy instance found.
-// TODO: Implement load balancing across multiple healthy instances.
+// It looks up healthy instances of the service, picks one using the
+// configured balancer, and forwards the request. Draining instances and
+// instances with an open circuit breaker are never selected, but requests
+// already in flight to them run to completion. Instances ejected by outlier
+// detection are skipped unless every instance has been ejected. Requests
+// selecting a subset by metadata, through the subset header or a route rule,
+// only consider matching instances, or fall back to all of them if the
+// service allows it. For services with a traffic split, only the instances
+// of the variant picked for the request are considered.
+//
+// Requests beyond the service's concurrency limits wait in its queue and are
+// shed once the queue is full or the queue timeout passes.
+//
+// A share of the requests to services with a traffic mirror is copied to the
+// mirror's target service in the background; the copies' responses are
+// discarded.
+//
+// Failed attempts are retried on a different instance according to the
+// service's retry policy: connection failures for any method, and
+// timeouts, transport errors and retry-on statuses for idempotent methods.
 //
 // Parameters:
 //   - c: Gin context containing the request
@@ -36,21 +96,372 @@ func NewRoutingService(reg *ServiceRegistry, prx *ProxyService) *RoutingService
 //
 // Returns an error if no healthy instances are available or if forwarding fails.
 func (s *RoutingService) RouteToService(c *gin.Context, serviceName string, path string) error {
-	log.Printf("Routing request to service '%s' with path '%s'", serviceName, path)
+	start := time.Now()
+	ctx, span := StartSpan(c.Request.Context(), "route", SpanKindInternal)
+	span.SetAttribute("hermes.service", serviceName)
+	c.Request = c.Request.WithContext(ctx)
+
+	err := s.route(c, serviceName, path)
+	canceled := errors.Is(err, ErrClientCanceled)
+	if canceled && !c.Writer.Written() {
+		c.Status(StatusClientClosedRequest)
+	}
+	span.SetError(err)
+	span.End()
+	label := serviceName
+	if !s.registry.IsRegistered(serviceName) {
+		label = UnknownService
+	}
+	s.metrics.ObserveRequest(label, c.Writer.Status(), err != nil && !canceled && !c.Writer.Written(), time.Since(start))
+
+	if entry := accessLogEntry(c); entry != nil {
+		entry.Service = serviceName
+		if err != nil {
+			entry.Error = err.Error()
+		}
+	}
+	return err
+}
+
+// route selects instances and forwards the request, retrying as allowed by the policy.
+func (s *RoutingService) route(c *gin.Context, serviceName string, path string) error {
+	Logf(c, "Routing request to service '%s' with path '%s'", serviceName, path)
 
 	// Get healthy instances of the service
 	instances := s.registry.GetHealthy(serviceName)
 	if len(instances) == 0 {
-		log.Printf("No healthy instances found for service: %s", serviceName)
+		Logf(c, "No healthy instances found for service: %s", serviceName)
 		return errors.New("no healthy instances available")
 	}
 
-	// Use first healthy instance (TODO: implement load balancing)
-	target := instances[0]
-	targetURL := target.BaseURL() + path
+	instances, err := s.withSubset(c, serviceName, instances)
+	if err != nil {
+		return err
+	}
+
+	instances, variant, err := s.splitter.Select(c, serviceName, instances)
+	if err != nil {
+		Logf(c, "No healthy instances in any weighted variant of %s", serviceName)
+		return err
+	}
+	if variant != "" {
+		Logf(c, "Traffic split sent request to variant '%s' of %s", variant, serviceName)
+	}
+
+	instances = s.withoutOutliers(c, serviceName, instances)
+
+	slot, err := s.concurrency.Acquire(c.Request.Context(), serviceName, instances)
+	if err != nil {
+		Logf(c, "Request to %s not admitted: %v", serviceName, err)
+		return err
+	}
+	defer slot.Release()
+
+	policy := retryPolicyFor(s.retry, instances[0])
+	if isUpgradeRequest(c.Request) {
+		// Tunneled connections cannot be replayed
+		policy.Attempts = 1
+	}
 
-	log.Printf("Forwarding request to: %s", targetURL)
+	// Keep the body so it can be sent again on a retry, or to the mirror
+	shadow := s.mirrors.sample(serviceName, c.Request)
+	var body []byte
+	if policy.Attempts > 1 || shadow != nil {
+		buffered, ok, err := bufferRequestBody(c.Request)
+		if err != nil {
+			Logf(c, "Failed to read request body: %v", err)
+			return errors.New("failed to read request body")
+		}
+		if !ok {
+			Logf(c, "Request body too large to buffer, retries and mirroring disabled")
+			policy.Attempts = 1
+			if shadow != nil {
+				s.metrics.ObserveMirrorDropped(serviceName, shadow.Target, "body_too_large")
+				shadow = nil
+			}
+		}
+		body = buffered
+	}
+	if shadow != nil {
+		s.mirrors.send(c, shadow, path, body)
+	}
+
+	tried := make(map[string]bool)
+	for attempt := 1; ; attempt++ {
+		target, candidates := s.selectInstance(c, serviceName, slot, instances, tried)
+		if target == nil {
+			if attempt > 1 {
+				return s.giveUp(c, err)
+			}
+			if len(candidates) > 0 {
+				Logf(c, "All available instances of %s are at their concurrency limit", serviceName)
+				return errors.New("no instances available (concurrency limit)")
+			}
+			Logf(c, "All healthy instances of %s have an open circuit breaker", serviceName)
+			return errors.New("no instances available (circuit open)")
+		}
+		tried[target.ID] = true
+		last := attempt >= policy.Attempts || len(candidates) == 1
+
+		opts := forwardOptions{headerTimeout: policy.PerTryTimeout}
+		if !last && isIdempotent(c.Request.Method) {
+			opts.retryStatus = policy.RetryOn
+		}
+		if attempt > 1 && body != nil {
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		err = s.forward(c, target, target.BaseURL()+path, opts)
+		if err == nil || last || !isRetryable(c.Request.Method, err) {
+			return err
+		}
+
+		delay := policy.backoffFor(attempt)
+		Logf(c, "Attempt %d to %s failed (%v), retrying in %v", attempt, serviceName, err, delay)
+		select {
+		case <-time.After(delay):
+		case <-c.Request.Context().Done():
+			return s.giveUp(c, err)
+		}
+	}
+}
+
+// giveUp ends a request whose last attempt failed without a retry following
+// it. A response kept for a retry on its status is relayed to the client;
+// other failures are returned.
+func (s *RoutingService) giveUp(c *gin.Context, err error) error {
+	var statusErr *retryableStatusError
+	if errors.As(err, &statusErr) {
+		Logf(c, "No retry possible, relaying status %d", statusErr.status)
+		return s.proxy.copyResponse(c, statusErr.resp)
+	}
+	return err
+}
+
+// withSubset narrows instances to those matching the subset selected by the
+// request, if any. When none match, the service's fallback decides between
+// rejecting the request and keeping all instances.
+func (s *RoutingService) withSubset(c *gin.Context, serviceName string, instances []*service.Service) ([]*service.Service, error) {
+	selector, err := s.subsets.requestSubset(c)
+	if err != nil {
+		Logf(c, "Rejected subset header of request to %s: %v", serviceName, err)
+		return nil, err
+	}
+	if selector == nil {
+		return instances, nil
+	}
+
+	matching := make([]*service.Service, 0, len(instances))
+	for _, svc := range instances {
+		if matchesSubset(selector, svc.Metadata) {
+			matching = append(matching, svc)
+		}
+	}
+	if len(matching) > 0 {
+		Logf(c, "Subset %v of %s has %d of %d healthy instances", selector, serviceName, len(matching), len(instances))
+		return matching, nil
+	}
+
+	if subsetFallbackFor(s.subsets.Fallback, instances[0]) == SubsetFallbackAll {
+		Logf(c, "No healthy instances of %s match subset %v, falling back to all instances", serviceName, selector)
+		return instances, nil
+	}
+	Logf(c, "No healthy instances of %s match subset %v", serviceName, selector)
+	return nil, errors.New("no healthy instances match the requested subset")
+}
+
+// forward sends one attempt to the target instance, tracking it as
+// in flight and reporting its outcome to the circuit breaker and the outlier
+// detector, unless the client canceled it first. The instance's concurrency
+// slot, taken when it was selected, is released afterwards.
+func (s *RoutingService) forward(c *gin.Context, target *service.Service, targetURL string, opts forwardOptions) error {
+	Logf(c, "Forwarding request to: %s (instance %s)", targetURL, target.ID)
+
+	// Each attempt gets its own client span, propagated to the backend
+	original := c.Request
+	ctx, span := StartSpan(original.Context(), "backend", SpanKindClient)
+	span.SetAttribute("hermes.instance", target.ID)
+	span.SetAttribute("server.address", target.Host)
+	span.SetAttribute("server.port", target.Port)
+	c.Request = original.WithContext(ctx)
+	defer func() { c.Request = original }()
+
+	defer s.concurrency.ReleaseInstance(target)
+	s.inflight.Acquire(target.ID)
+	defer s.inflight.Release(target.ID)
+
+	start := time.Now()
+	err := s.proxy.forwardToURL(c, targetURL, opts)
+	canceled := errors.Is(err, ErrClientCanceled)
+	failed := isBackendFailure(c, err)
+	if canceled {
+		s.breaker.Release(target)
+	} else {
+		s.breaker.Record(target, !failed)
+		s.outliers.Record(target, failed)
+	}
+
+	status, responded := upstreamStatus(c, err)
+	if canceled {
+		status = StatusClientClosedRequest
+	}
+	elapsed := time.Since(start)
+	s.metrics.ObserveUpstream(target.Name, target.ID, status, !responded && !canceled, elapsed)
+	if entry := accessLogEntry(c); entry != nil {
+		// The last attempt is the one reported
+		entry.InstanceID = target.ID
+		entry.UpstreamStatus = 0
+		if responded {
+			entry.UpstreamStatus = status
+		}
+		entry.UpstreamLatencyMs = float64(elapsed.Microseconds()) / 1000
+	}
+	if responded {
+		span.SetAttribute("http.response.status_code", status)
+	}
+	if failed {
+		span.SetError(backendFailure(err, status))
+	}
+	span.End()
+	return err
+}
+
+// selectInstance picks the instance for the next attempt among those not yet
+// tried, whose circuit breaker admits the request and that are below their
+// concurrency limit, and takes one of its concurrency slots. It returns nil
+// if none is left, along with the candidates that were considered.
+func (s *RoutingService) selectInstance(c *gin.Context, serviceName string, slot *ConcurrencySlot, instances []*service.Service, tried map[string]bool) (*service.Service, []*service.Service) {
+	_, span := StartSpan(c.Request.Context(), "select_instance", SpanKindInternal)
+	defer span.End()
+
+	candidates := make([]*service.Service, 0, len(instances))
+	for _, svc := range instances {
+		if !tried[svc.ID] && s.breaker.Available(svc) {
+			candidates = append(candidates, svc)
+		}
+	}
+	span.SetAttribute("hermes.candidates", len(candidates))
+	if len(candidates) == 0 {
+		span.SetError(errors.New("no instances available"))
+		return nil, candidates
+	}
+
+	balancer := s.balancerFor(c, serviceName, candidates)
+	target := s.concurrency.AcquireInstance(slot, candidates, func(available []*service.Service) *service.Service {
+		// Another request may have taken the last trial of a half-open breaker
+		for len(available) > 0 {
+			picked := balancer.Pick(c, available)
+			if s.breaker.Admit(picked) {
+				return picked
+			}
+			available = withoutInstance(available, picked)
+		}
+		return nil
+	})
+	if target == nil {
+		span.SetError(errors.New("no instances available"))
+		return nil, candidates
+	}
+	span.SetAttribute("hermes.instance", target.ID)
+	return target, candidates
+}
+
+// withoutInstance returns the instances other than svc.
+func withoutInstance(instances []*service.Service, svc *service.Service) []*service.Service {
+	kept := make([]*service.Service, 0, len(instances))
+	for _, instance := range instances {
+		if instance.ID != svc.ID {
+			kept = append(kept, instance)
+		}
+	}
+	return kept
+}
+
+// backendFailure describes a failed attempt for its trace span.
+func backendFailure(err error, status int) error {
+	if err != nil {
+		return err
+	}
+	return errors.New("HTTP " + strconv.Itoa(status))
+}
+
+// upstreamStatus returns the status code the backend answered an attempt
+// with, and false if no response was received.
+func upstreamStatus(c *gin.Context, err error) (int, bool) {
+	var statusErr *retryableStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.status, true
+	}
+	if err != nil {
+		return 0, false
+	}
+	return c.Writer.Status(), true
+}
+
+// withoutOutliers removes instances ejected by outlier detection. If all of
+// them are ejected, they are all kept: a degraded instance is better than none.
+func (s *RoutingService) withoutOutliers(c *gin.Context, serviceName string, instances []*service.Service) []*service.Service {
+	kept := make([]*service.Service, 0, len(instances))
+	for _, svc := range instances {
+		if !s.outliers.Ejected(svc) {
+			kept = append(kept, svc)
+		}
+	}
+	if len(kept) == 0 {
+		Logf(c, "All healthy instances of %s are ejected, ignoring outlier detection", serviceName)
+		return instances
+	}
+	return kept
+}
+
+// isBackendFailure reports whether a forwarding outcome counts against the
+// backend: connection errors, timeouts and 5xx responses.
+func isBackendFailure(c *gin.Context, err error) bool {
+	if err != nil {
+		var statusErr *retryableStatusError
+		if errors.As(err, &statusErr) {
+			return statusErr.status >= http.StatusInternalServerError
+		}
+		return errors.Is(err, ErrBackendUnavailable) || errors.Is(err, ErrBackendTimeout) || errors.Is(err, ErrBackendRefused)
+	}
+	return c.Writer.Status() >= http.StatusInternalServerError
+}
+
+// balancerFor returns the balancer for a service name, creating or
+// rebuilding it when the strategy declared in instance metadata changes.
+// The first instance that declares a strategy wins; the default is round-robin,
+// also used for unknown strategies, which are logged when the balancer is built.
+func (s *RoutingService) balancerFor(c *gin.Context, serviceName string, instances []*service.Service) Balancer {
+	strategy, hashKey := "", ""
+	for _, svc := range instances {
+		if val := svc.Metadata[MetadataBalancer]; val != "" && strategy == "" {
+			strategy = val
+		}
+		if val := svc.Metadata[MetadataHashKey]; val != "" && hashKey == "" {
+			hashKey = val
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, exists := s.balancers[serviceName]
+	if !exists || entry.strategy != strategy || entry.hashKey != hashKey {
+		effective := strategy
+		if !IsValidStrategy(strategy) {
+			Logf(c, "Unknown balancer strategy '%s' for service %s, using %s", strategy, serviceName, StrategyRoundRobin)
+			effective = ""
+		}
+		if effective == "" {
+			effective = StrategyRoundRobin
+		}
+		entry = &balancerEntry{
+			strategy: strategy,
+			hashKey:  hashKey,
+			balancer: NewBalancer(effective, hashKey, s.inflight),
+		}
+		s.balancers[serviceName] = entry
+	}
 
-	// Forward the request using the proxy
-	return s.proxy.ForwardToURL(c, targetURL)
+	return entry.balancer
 }
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core/domain/service"
+)
+
+// testBackendOption adjusts an instance before registerTestBackend registers it
+type testBackendOption func(svc *service.Service)
+
+// withMetadata sets metadata on the instance
+func withMetadata(metadata map[string]string) testBackendOption {
+	return func(svc *service.Service) {
+		for key, value := range metadata {
+			svc.Metadata[key] = value
+		}
+	}
+}
+
+// registerTestBackend registers an httptest server as an instance of the named service
+func registerTestBackend(t *testing.T, reg *ServiceRegistry, name string, backend *httptest.Server, opts ...testBackendOption) *service.Service {
+	u, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse backend URL: %v", err)
+	}
+	port, _ := strconv.Atoi(u.Port())
+
+	svc := service.NewService(name, u.Hostname(), port, "/health")
+	for _, opt := range opts {
+		opt(svc)
+	}
+	if err := reg.Register(svc); err != nil {
+		t.Fatalf("Failed to register backend: %v", err)
+	}
+	return svc
+}
+
+// newTestRoutingService creates a routing service with default test settings
+func newTestRoutingService(reg *ServiceRegistry) *RoutingService {
+	return NewRoutingService(reg, NewProxyService(5*time.Second, 0), NewInFlightTracker(), newTestBreaker(), newTestOutlierDetector(), nil, nil, nil, nil, RetryPolicy{Attempts: 1}, SubsetConfig{})
+}
+
+// testRequestOption adjusts a request before routeTestRequest routes it
+type testRequestOption func(c *gin.Context)
+
+// withHeader sets a request header
+func withHeader(key, value string) testRequestOption {
+	return func(c *gin.Context) {
+		c.Request.Header.Set(key, value)
+	}
+}
+
+// withQuery sets the request's query string
+func withQuery(query string) testRequestOption {
+	return func(c *gin.Context) {
+		c.Request.URL.RawQuery = query
+	}
+}
+
+// withBody sets the request body
+func withBody(body string) testRequestOption {
+	return func(c *gin.Context) {
+		c.Request.Body = io.NopCloser(strings.NewReader(body))
+		c.Request.ContentLength = int64(len(body))
+	}
+}
+
+// withSubset sets the subset selector a route rule derived for the request
+func withSubset(selector map[string]string) testRequestOption {
+	return func(c *gin.Context) {
+		c.Set(SubsetKey, selector)
+	}
+}
+
+// routeTestRequest routes a request through the routing service and returns the recorder
+func routeTestRequest(t *testing.T, routing *RoutingService, method, serviceName, path string, opts ...testRequestOption) (*httptest.ResponseRecorder, error) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, "/hermes/route/"+serviceName+path, nil)
+	for _, opt := range opts {
+		opt(c)
+	}
+	err := routing.RouteToService(c, serviceName, path)
+	return w, err
+}
+
+func TestRoutingService_CircuitBreakerSkipsFailingInstance(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+
+	failingSvc := registerTestBackend(t, reg, "api", failing)
+	registerTestBackend(t, reg, "api", healthy)
+	routing := newTestRoutingService(reg)
+
+	// Round-robin alternates, so the failing instance sees 3 failures in 6 requests
+	for i := 0; i < 6; i++ {
+		routeTestRequest(t, routing, "GET", "api", "/")
+	}
+	if state := routing.breaker.Snapshot(failingSvc.ID).State; state != BreakerOpen {
+		t.Fatalf("Expected breaker of failing instance to be open, got %s", state)
+	}
+
+	for i := 0; i < 4; i++ {
+		w, err := routeTestRequest(t, routing, "GET", "api", "/")
+		if err != nil || w.Code != http.StatusOK {
+			t.Errorf("Expected request to reach healthy instance, got status %d (err: %v)", w.Code, err)
+		}
+	}
+}
+
+func TestRoutingService_AllBreakersOpen(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+
+	// A closed listener yields connection errors
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	registerTestBackend(t, reg, "api", backend)
+	backend.Close()
+	routing := newTestRoutingService(reg)
+
+	for i := 0; i < 3; i++ {
+		if _, err := routeTestRequest(t, routing, "GET", "api", "/"); err == nil {
+			t.Fatal("Expected connection error")
+		}
+	}
+
+	_, err := routeTestRequest(t, routing, "GET", "api", "/")
+	if err == nil || err.Error() != "no instances available (circuit open)" {
+		t.Errorf("Expected open circuit error, got %v", err)
+	}
+}
+
+func TestRoutingService_ClientCancellationIsNotAnOutcome(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer backend.Close()
+	svc := registerTestBackend(t, reg, "api", backend)
+
+	routing := newTestRoutingService(reg)
+	routing.metrics = NewMetrics()
+	gin.SetMode(gin.TestMode)
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		c.Request = httptest.NewRequest("GET", "/hermes/route/api/", nil).WithContext(ctx)
+		err := routing.RouteToService(c, "api", "/")
+		cancel()
+		if !errors.Is(err, ErrClientCanceled) {
+			t.Fatalf("Expected a client cancellation, got %v", err)
+		}
+		if c.Writer.Status() != StatusClientClosedRequest {
+			t.Errorf("Expected status %d to be recorded, got %d", StatusClientClosedRequest, c.Writer.Status())
+		}
+	}
+
+	// Three failures would have opened the breaker
+	if snapshot := routing.breaker.Snapshot(svc.ID); snapshot.State != BreakerClosed || snapshot.ConsecutiveFailures != 0 {
+		t.Errorf("Expected canceled requests not to count as failures, got %+v", snapshot)
+	}
+	var b bytes.Buffer
+	routing.metrics.Write(&b, nil)
+	if !strings.Contains(b.String(), `hermes_requests_total{service="api",code_class="4xx"} 3`) {
+		t.Errorf("Expected canceled requests to be counted as 4xx, got:\n%s", b.String())
+	}
+}
@@ -0,0 +1,28 @@
+package core
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+)
+
+// newSecret generates a random secret with the given prefix (e.g. "hrt_"),
+// which makes secrets easy to recognize in configuration and secret scanners.
+func newSecret(prefix string) (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		log.Printf("Failed to generate secret: %v", err)
+		return "", errors.New("failed to generate secret")
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(random), nil
+}
+
+// hashSecret returns the hex SHA-256 of a secret, which is what gets stored.
+// Secrets are random, so an unsalted fast hash is sufficient.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
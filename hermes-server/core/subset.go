@@ -0,0 +1,113 @@
+package core
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core/domain/service"
+)
+
+// MetadataSubsetFallback is the metadata key read from service registrations
+// to override the subset fallback ("none" or "all").
+const MetadataSubsetFallback = "subset_fallback"
+
+// SubsetKey is the context key holding the instance metadata selector that a
+// route rule derived from the request's headers.
+const SubsetKey = "subset"
+
+// ErrInvalidSubset is returned when a subset header is not a list of
+// key=value pairs.
+var ErrInvalidSubset = errors.New("invalid subset header")
+
+// SubsetFallback decides how requests are routed when no healthy instance
+// matches their subset.
+type SubsetFallback string
+
+const (
+	SubsetFallbackNone SubsetFallback = "none" // Reject the request
+	SubsetFallbackAll  SubsetFallback = "all"  // Route to any healthy instance
+)
+
+// IsValid reports whether the fallback is a known one.
+func (f SubsetFallback) IsValid() bool {
+	return f == SubsetFallbackNone || f == SubsetFallbackAll
+}
+
+// SubsetConfig controls how requests select a subset of a service's
+// instances by metadata.
+type SubsetConfig struct {
+	Header   string         // Request header carrying a selector such as "region=eu,version=beta" (empty: disabled)
+	Fallback SubsetFallback // Default for services that do not override it through metadata (empty: none)
+}
+
+// ParseSubset parses a comma-separated list of key=value pairs into an
+// instance metadata selector.
+func ParseSubset(value string) (map[string]string, error) {
+	selector := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(part, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, ErrInvalidSubset
+		}
+		selector[key] = strings.TrimSpace(val)
+	}
+	return selector, nil
+}
+
+// requestSubset returns the metadata selector of a request: the pairs of the
+// subset header, overridden by those a route rule derived from the request.
+// Returns nil if the request selects no subset.
+func (cfg SubsetConfig) requestSubset(c *gin.Context) (map[string]string, error) {
+	var selector map[string]string
+	if cfg.Header != "" {
+		if value := c.GetHeader(cfg.Header); value != "" {
+			parsed, err := ParseSubset(value)
+			if err != nil {
+				return nil, err
+			}
+			selector = parsed
+		}
+	}
+
+	if ruleSubset, ok := c.Get(SubsetKey); ok {
+		for key, value := range ruleSubset.(map[string]string) {
+			if selector == nil {
+				selector = make(map[string]string)
+			}
+			selector[key] = value
+		}
+	}
+
+	if len(selector) == 0 {
+		return nil, nil
+	}
+	return selector, nil
+}
+
+// subsetFallbackFor returns the subset fallback for an instance, applying
+// its metadata override on top of the default.
+func subsetFallbackFor(defaults SubsetFallback, svc *service.Service) SubsetFallback {
+	if val := SubsetFallback(svc.Metadata[MetadataSubsetFallback]); val.IsValid() {
+		return val
+	}
+	if defaults == "" {
+		return SubsetFallbackNone
+	}
+	return defaults
+}
+
+// matchesSubset reports whether metadata contains all key-value pairs of selector.
+func matchesSubset(selector, metadata map[string]string) bool {
+	for key, value := range selector {
+		if v, exists := metadata[key]; !exists || v != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+package core
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseSubset(t *testing.T) {
+	selector, err := ParseSubset(" region = eu ,version=beta,,")
+	if err != nil {
+		t.Fatalf("Failed to parse subset: %v", err)
+	}
+	if len(selector) != 2 || selector["region"] != "eu" || selector["version"] != "beta" {
+		t.Errorf("Unexpected selector: %v", selector)
+	}
+
+	for _, value := range []string{"region", "=eu", "region=eu,beta"} {
+		if _, err := ParseSubset(value); !errors.Is(err, ErrInvalidSubset) {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestRoutingService_Subset(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+
+	var euStable, euBeta, usStable int32
+	for _, backend := range []struct {
+		hits     *int32
+		metadata map[string]string
+	}{
+		{&euStable, map[string]string{"region": "eu", "version": "stable"}},
+		{&euBeta, map[string]string{"region": "eu", "version": "beta"}},
+		{&usStable, map[string]string{"region": "us", "version": "stable"}},
+	} {
+		server := newCountingBackend(http.StatusOK, backend.hits)
+		defer server.Close()
+		registerTestBackend(t, reg, "api", server, withMetadata(backend.metadata))
+	}
+
+	routing := NewRoutingService(reg, NewProxyService(5*time.Second, 0), NewInFlightTracker(), newTestBreaker(), newTestOutlierDetector(),
+		nil, nil, nil, nil, RetryPolicy{Attempts: 1}, SubsetConfig{Header: "X-Hermes-Subset", Fallback: SubsetFallbackNone})
+
+	// The header selects instances matching all of its pairs
+	for i := 0; i < 4; i++ {
+		if w, err := routeTestRequest(t, routing, "GET", "api", "/", withHeader("X-Hermes-Subset", "region=eu,version=beta")); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("Expected request to succeed, got status %d (err: %v)", w.Code, err)
+		}
+	}
+	if euBeta != 4 || euStable != 0 || usStable != 0 {
+		t.Errorf("Expected all requests on eu-beta, got %d, %d and %d on eu-stable, eu-beta and us-stable", euStable, euBeta, usStable)
+	}
+
+	// Selectors derived by a route rule override the header
+	for i := 0; i < 4; i++ {
+		routeTestRequest(t, routing, "GET", "api", "/", withHeader("X-Hermes-Subset", "region=eu,version=beta"), withSubset(map[string]string{"version": "stable"}))
+	}
+	if euStable != 4 {
+		t.Errorf("Expected the rule's version to win, got %d requests on eu-stable", euStable)
+	}
+
+	// Without a subset, every instance is used
+	for i := 0; i < 6; i++ {
+		routeTestRequest(t, routing, "GET", "api", "/")
+	}
+	if usStable == 0 {
+		t.Error("Expected requests without a subset to reach all instances")
+	}
+
+	// An empty subset is rejected by default
+	if _, err := routeTestRequest(t, routing, "GET", "api", "/", withHeader("X-Hermes-Subset", "region=ap")); err == nil || err.Error() != "no healthy instances match the requested subset" {
+		t.Errorf("Expected an empty subset to be rejected, got %v", err)
+	}
+
+	// An invalid header is reported as such
+	if _, err := routeTestRequest(t, routing, "GET", "api", "/", withHeader("X-Hermes-Subset", "region")); !errors.Is(err, ErrInvalidSubset) {
+		t.Errorf("Expected an invalid subset header error, got %v", err)
+	}
+}
+
+func TestRoutingService_SubsetFallback(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+
+	var stable, lenient int32
+	stableBackend := newCountingBackend(http.StatusOK, &stable)
+	defer stableBackend.Close()
+	registerTestBackend(t, reg, "api", stableBackend, withMetadata(map[string]string{"version": "stable"}))
+	newRouting := func(subsets SubsetConfig) *RoutingService {
+		return NewRoutingService(reg, NewProxyService(5*time.Second, 0), NewInFlightTracker(), newTestBreaker(), newTestOutlierDetector(),
+			nil, nil, nil, nil, RetryPolicy{Attempts: 1}, subsets)
+	}
+
+	// Falling back to all instances when configured globally
+	routing := newRouting(SubsetConfig{Header: "X-Hermes-Subset", Fallback: SubsetFallbackAll})
+	if w, err := routeTestRequest(t, routing, "GET", "api", "/", withHeader("X-Hermes-Subset", "version=beta")); err != nil || w.Code != http.StatusOK || stable != 1 {
+		t.Fatalf("Expected the fallback to reach stable, got status %d (err: %v)", w.Code, err)
+	}
+
+	// A disabled header is ignored
+	routing = newRouting(SubsetConfig{})
+	if _, err := routeTestRequest(t, routing, "GET", "api", "/", withHeader("X-Hermes-Subset", "version=beta")); err != nil || stable != 2 {
+		t.Errorf("Expected the subset header to be ignored, got %v", err)
+	}
+
+	// Services can override the default through metadata
+	db2 := setupTestDB(t)
+	defer db2.Close()
+	reg = NewServiceRegistry(db2)
+	lenientBackend := newCountingBackend(http.StatusOK, &lenient)
+	defer lenientBackend.Close()
+	registerTestBackend(t, reg, "api", lenientBackend, withMetadata(map[string]string{"version": "stable", MetadataSubsetFallback: "all"}))
+	routing = newRouting(SubsetConfig{Header: "X-Hermes-Subset", Fallback: SubsetFallbackNone})
+	if _, err := routeTestRequest(t, routing, "GET", "api", "/", withHeader("X-Hermes-Subset", "version=beta")); err != nil || lenient != 1 {
+		t.Errorf("Expected the service's fallback to apply, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// TokenCacheConfig configures the cache of Aegis validation results.
+type TokenCacheConfig struct {
+	TTL         time.Duration // Maximum time a valid result is reused
+	NegativeTTL time.Duration // Time an invalid result is reused, 0 disables
+	MaxEntries  int           // Results kept before the oldest are evicted
+}
+
+// TokenCache keeps Aegis validation results so that repeated requests with
+// the same token do not each call Aegis. Results are keyed by the SHA-256 of
+// the token, so the cache never holds tokens themselves. A valid result is
+// reused until the TTL passes or the token expires, whichever comes first;
+// an invalid result is reused for NegativeTTL.
+type TokenCache struct {
+	config  TokenCacheConfig
+	entries map[[sha256.Size]byte]tokenCacheEntry
+	mu      sync.Mutex
+}
+
+// tokenCacheEntry is a cached validation result.
+type tokenCacheEntry struct {
+	result  *ValidateTokenResponse
+	expires time.Time
+}
+
+// NewTokenCache creates an empty validation result cache.
+func NewTokenCache(config TokenCacheConfig) *TokenCache {
+	return &TokenCache{
+		config:  config,
+		entries: make(map[[sha256.Size]byte]tokenCacheEntry),
+	}
+}
+
+// Get returns the cached result for a token, if any.
+func (tc *TokenCache) Get(token string) (*ValidateTokenResponse, bool) {
+	key := sha256.Sum256([]byte(token))
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	entry, ok := tc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !time.Now().Before(entry.expires) {
+		delete(tc.entries, key)
+		return nil, false
+	}
+	return entry.result, true
+}
+
+// Put caches the validation result for a token.
+func (tc *TokenCache) Put(token string, result *ValidateTokenResponse) {
+	now := time.Now()
+	var expires time.Time
+	if result.Valid {
+		expires = now.Add(tc.config.TTL)
+		if !result.ExpiresAt.IsZero() && result.ExpiresAt.Before(expires) {
+			expires = result.ExpiresAt
+		}
+	} else {
+		expires = now.Add(tc.config.NegativeTTL)
+	}
+	if !now.Before(expires) {
+		return
+	}
+
+	key := sha256.Sum256([]byte(token))
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if _, exists := tc.entries[key]; !exists && len(tc.entries) >= tc.config.MaxEntries {
+		tc.evict(now)
+	}
+	tc.entries[key] = tokenCacheEntry{result: result, expires: expires}
+}
+
+// evict removes expired entries, or the entry closest to expiry if none has
+// expired. Must be called with the lock held.
+func (tc *TokenCache) evict(now time.Time) {
+	var oldest [sha256.Size]byte
+	var oldestExpires time.Time
+	removed := false
+	for key, entry := range tc.entries {
+		if !now.Before(entry.expires) {
+			delete(tc.entries, key)
+			removed = true
+			continue
+		}
+		if oldestExpires.IsZero() || entry.expires.Before(oldestExpires) {
+			oldest = key
+			oldestExpires = entry.expires
+		}
+	}
+	if !removed && !oldestExpires.IsZero() {
+		delete(tc.entries, oldest)
+	}
+}
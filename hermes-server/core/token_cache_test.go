@@ -0,0 +1,81 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenCache_BoundsValidResultsByExpiry(t *testing.T) {
+	cache := NewTokenCache(TokenCacheConfig{TTL: time.Hour, NegativeTTL: time.Hour, MaxEntries: 10})
+
+	cache.Put("long-lived", &ValidateTokenResponse{Valid: true, ExpiresAt: time.Now().Add(2 * time.Hour)})
+	cache.Put("expiring", &ValidateTokenResponse{Valid: true, ExpiresAt: time.Now().Add(50 * time.Millisecond)})
+	cache.Put("expired", &ValidateTokenResponse{Valid: true, ExpiresAt: time.Now().Add(-time.Second)})
+
+	if _, ok := cache.Get("long-lived"); !ok {
+		t.Error("Expected long-lived token to be cached")
+	}
+	if _, ok := cache.Get("expired"); ok {
+		t.Error("Expected expired token not to be cached")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := cache.Get("expiring"); ok {
+		t.Error("Expected result to be dropped when the token expires")
+	}
+}
+
+func TestTokenCache_EvictsWhenFull(t *testing.T) {
+	cache := NewTokenCache(TokenCacheConfig{TTL: time.Hour, MaxEntries: 2})
+
+	cache.Put("a", &ValidateTokenResponse{Valid: true, ExpiresAt: time.Now().Add(time.Minute)})
+	cache.Put("b", &ValidateTokenResponse{Valid: true})
+	cache.Put("c", &ValidateTokenResponse{Valid: true})
+
+	if _, ok := cache.Get("a"); ok {
+		t.Error("Expected the entry closest to expiry to be evicted")
+	}
+	if _, ok := cache.Get("c"); !ok {
+		t.Error("Expected the new entry to be cached")
+	}
+}
+
+func TestValidateToken_CachesAegisResults(t *testing.T) {
+	calls := 0
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			w.Write([]byte(`{"valid": false, "error": "unknown token"}`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewAegisClient(server.URL, 5*time.Second)
+	client.SetTokenCache(NewTokenCache(TokenCacheConfig{TTL: time.Minute, NegativeTTL: time.Minute, MaxEntries: 10}))
+
+	// Invalid results are cached
+	for i := 0; i < 3; i++ {
+		resp, err := client.ValidateToken("opaque-token")
+		if err != nil || resp.Valid {
+			t.Fatalf("Expected invalid result, got %+v, %v", resp, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 Aegis call for a cached result, got %d", calls)
+	}
+
+	// Errors are not cached
+	status = http.StatusBadGateway
+	for i := 0; i < 2; i++ {
+		if _, err := client.ValidateToken("other-token"); err == nil {
+			t.Fatal("Expected error from Aegis")
+		}
+	}
+	if calls != 3 {
+		t.Errorf("Expected errors to reach Aegis every time, got %d calls", calls)
+	}
+}
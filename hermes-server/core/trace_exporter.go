@@ -0,0 +1,256 @@
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// traceExportTimeout bounds a single export request to the collector.
+const traceExportTimeout = 10 * time.Second
+
+// maxQueuedBatches bounds how many batches of spans are held while the
+// collector is slow or unreachable; further spans are dropped.
+const maxQueuedBatches = 4
+
+// traceExporter batches finished spans and sends them to an OTLP/HTTP
+// collector using the JSON encoding (POST {endpoint}/v1/traces).
+type traceExporter struct {
+	url         string
+	serviceName string
+	batchSize   int
+	interval    time.Duration
+	client      *http.Client
+	queue       []*Span
+	dropped     int
+	mu          sync.Mutex
+	sendMu      sync.Mutex // Serializes exports so batches arrive in order
+	flushChan   chan struct{}
+	stopChan    chan struct{}
+}
+
+func newTraceExporter(cfg TracingConfig) *traceExporter {
+	url := strings.TrimSuffix(cfg.Endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	return &traceExporter{
+		url:         url,
+		serviceName: cfg.ServiceName,
+		batchSize:   cfg.BatchSize,
+		interval:    cfg.FlushInterval,
+		client:      &http.Client{Timeout: traceExportTimeout},
+		flushChan:   make(chan struct{}, 1),
+		stopChan:    make(chan struct{}),
+	}
+}
+
+// enqueue adds a finished span to the queue, waking the export loop once a
+// full batch is waiting.
+func (e *traceExporter) enqueue(span *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.queue) >= e.batchSize*maxQueuedBatches {
+		e.dropped++
+		return
+	}
+	e.queue = append(e.queue, span)
+	if len(e.queue) >= e.batchSize {
+		select {
+		case e.flushChan <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run exports queued spans on every flush interval or full batch until stopped.
+func (e *traceExporter) run() {
+	log.Printf("Starting trace exporter: endpoint=%s, batch=%d, interval=%v", e.url, e.batchSize, e.interval)
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.flush()
+		case <-e.flushChan:
+			e.flush()
+		case <-e.stopChan:
+			log.Println("Trace exporter stopped")
+			return
+		}
+	}
+}
+
+// stop ends the export loop and sends the remaining spans.
+func (e *traceExporter) stop() {
+	close(e.stopChan)
+	e.flush()
+}
+
+// flush sends all queued spans in batches.
+func (e *traceExporter) flush() {
+	e.sendMu.Lock()
+	defer e.sendMu.Unlock()
+
+	for {
+		e.mu.Lock()
+		if e.dropped > 0 {
+			log.Printf("Trace exporter queue full, dropped %d spans", e.dropped)
+			e.dropped = 0
+		}
+		n := len(e.queue)
+		if n > e.batchSize {
+			n = e.batchSize
+		}
+		batch := e.queue[:n:n]
+		e.queue = e.queue[n:]
+		e.mu.Unlock()
+
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil {
+			log.Printf("Failed to export %d spans: %v", len(batch), err)
+		}
+	}
+}
+
+// send posts a batch of spans to the collector.
+func (e *traceExporter) send(batch []*Span) error {
+	payload, err := json.Marshal(e.encode(batch))
+	if err != nil {
+		log.Printf("Failed to marshal spans: %v", err)
+		return errors.New("failed to marshal spans")
+	}
+
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		log.Printf("Trace export request failed: %v", err)
+		return errors.New("collector unreachable")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Printf("Collector rejected spans: status %d", resp.StatusCode)
+		return errors.New("collector rejected spans")
+	}
+	return nil
+}
+
+// OTLP JSON encoding of an ExportTraceServiceRequest. Trace and span IDs are
+// hex strings and 64-bit integers are decimal strings, as the OTLP/JSON
+// mapping requires.
+type otlpTraceRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	TraceState        string          `json:"traceState,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"` // 0: unset, 2: error
+	Message string `json:"message,omitempty"`
+}
+
+// encode converts a batch of spans to an OTLP export request.
+func (e *traceExporter) encode(batch []*Span) otlpTraceRequest {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, span := range batch {
+		span.mu.Lock()
+		encoded := otlpSpan{
+			TraceID:           hex.EncodeToString(span.ctx.TraceID[:]),
+			SpanID:            hex.EncodeToString(span.ctx.SpanID[:]),
+			TraceState:        span.ctx.State,
+			Name:              span.name,
+			Kind:              span.kind,
+			StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+		}
+		if !isZero(span.parentID[:]) {
+			encoded.ParentSpanID = hex.EncodeToString(span.parentID[:])
+		}
+		for _, key := range sortedKeys(span.attributes) {
+			encoded.Attributes = append(encoded.Attributes, otlpAttribute{Key: key, Value: otlpValue(span.attributes[key])})
+		}
+		if span.errMsg != "" {
+			encoded.Status = otlpStatus{Code: 2, Message: span.errMsg}
+		}
+		span.mu.Unlock()
+		spans = append(spans, encoded)
+	}
+
+	serviceName := e.serviceName
+	return otlpTraceRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpAttribute{{Key: "service.name", Value: otlpAnyValue{StringValue: &serviceName}}}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "hermes"}, Spans: spans}},
+	}}}
+}
+
+// otlpValue converts an attribute value to its OTLP representation.
+func otlpValue(value any) otlpAnyValue {
+	switch v := value.(type) {
+	case int:
+		s := strconv.Itoa(v)
+		return otlpAnyValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		return otlpAnyValue{IntValue: &s}
+	case bool:
+		return otlpAnyValue{BoolValue: &v}
+	case string:
+		return otlpAnyValue{StringValue: &v}
+	default:
+		s := fmt.Sprint(v)
+		return otlpAnyValue{StringValue: &s}
+	}
+}
@@ -0,0 +1,294 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// W3C trace context headers (https://www.w3.org/TR/trace-context/).
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// Span kinds, numbered as in OTLP.
+const (
+	SpanKindInternal = 1
+	SpanKindServer   = 2
+	SpanKindClient   = 3
+)
+
+// traceFlagSampled is the traceparent flag marking a trace as sampled.
+const traceFlagSampled = 0x01
+
+// TraceContext identifies a span within a trace, as carried by traceparent.
+type TraceContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+	State   string // Opaque tracestate, passed on unchanged
+}
+
+// Sampled reports whether spans of the trace are recorded.
+func (tc TraceContext) Sampled() bool {
+	return tc.Flags&traceFlagSampled != 0
+}
+
+// Traceparent formats the context as a version 00 traceparent header value.
+func (tc TraceContext) Traceparent() string {
+	return "00-" + hex.EncodeToString(tc.TraceID[:]) + "-" + hex.EncodeToString(tc.SpanID[:]) + "-" + hex.EncodeToString([]byte{tc.Flags})
+}
+
+// ParseTraceparent parses a traceparent header value. Versions other than 00
+// are accepted as long as they start with the version 00 fields.
+func ParseTraceparent(value string) (TraceContext, bool) {
+	var tc TraceContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return tc, false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return tc, false
+	}
+
+	version, err := hex.DecodeString(parts[0])
+	if err != nil || len(version) != 1 {
+		return tc, false
+	}
+	if len(parts[1]) != 32 || !decodeLowerHex(tc.TraceID[:], parts[1]) || isZero(tc.TraceID[:]) {
+		return tc, false
+	}
+	if len(parts[2]) != 16 || !decodeLowerHex(tc.SpanID[:], parts[2]) || isZero(tc.SpanID[:]) {
+		return tc, false
+	}
+	var flags [1]byte
+	if len(parts[3]) != 2 || !decodeLowerHex(flags[:], parts[3]) {
+		return tc, false
+	}
+	tc.Flags = flags[0]
+	return tc, true
+}
+
+// decodeLowerHex decodes lowercase hex into dst, as required by traceparent.
+func decodeLowerHex(dst []byte, s string) bool {
+	if strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Span is a timed operation within a trace. A nil *Span is valid and
+// records nothing, so code can be instrumented whether tracing is on or not.
+type Span struct {
+	tracer     *Tracer
+	ctx        TraceContext
+	parentID   [8]byte
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	attributes map[string]any
+	errMsg     string
+	mu         sync.Mutex
+}
+
+// Context returns the trace context identifying the span.
+func (s *Span) Context() TraceContext {
+	if s == nil {
+		return TraceContext{}
+	}
+	return s.ctx
+}
+
+// SetAttribute attaches a string, integer or boolean attribute to the span.
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes[key] = value
+}
+
+// SetError marks the span as failed. A nil error is ignored.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errMsg = err.Error()
+}
+
+// End completes the span and hands it to the exporter if the trace is sampled.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.ctx.Sampled() {
+		s.tracer.export(s)
+	}
+}
+
+// spanContextKey is the context key under which the active span is stored.
+type spanContextKey struct{}
+
+// ContextWithSpan returns a context carrying the span as the active span.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// SpanFromContext returns the active span, or nil if there is none.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// StartSpan starts a child of the active span in ctx. Without an active span
+// (tracing disabled) it returns ctx unchanged and a nil span.
+func StartSpan(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	span := parent.tracer.newSpan(name, kind, parent.ctx)
+	span.parentID = parent.ctx.SpanID
+	return ContextWithSpan(ctx, span), span
+}
+
+// InjectTraceContext writes the traceparent and tracestate of the active span
+// in ctx to the headers of an outgoing request. Without an active span the
+// headers are left as they are.
+func InjectTraceContext(ctx context.Context, header http.Header) {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	header.Set(TraceparentHeader, span.ctx.Traceparent())
+	if span.ctx.State != "" {
+		header.Set(TracestateHeader, span.ctx.State)
+	} else {
+		header.Del(TracestateHeader)
+	}
+}
+
+// Tracer creates spans and batches finished ones for export to an OTLP/HTTP
+// collector. A nil *Tracer is valid and disables tracing.
+type Tracer struct {
+	exporter *traceExporter
+}
+
+// TracingConfig contains settings for exporting spans.
+type TracingConfig struct {
+	Endpoint      string        // OTLP/HTTP collector base URL, e.g. http://otel-collector:4318
+	ServiceName   string        // service.name resource attribute
+	BatchSize     int           // Spans sent per export request
+	FlushInterval time.Duration // Maximum time a finished span waits before export
+}
+
+// NewTracer creates a tracer exporting to the configured collector. Spans are
+// only sent while Start is running.
+func NewTracer(cfg TracingConfig) *Tracer {
+	return &Tracer{exporter: newTraceExporter(cfg)}
+}
+
+// Start exports finished spans in batches until Stop is called.
+// This method blocks, so it should be run in a separate goroutine.
+func (t *Tracer) Start() {
+	if t == nil {
+		return
+	}
+	t.exporter.run()
+}
+
+// Stop stops the export loop and sends the spans still queued.
+func (t *Tracer) Stop() {
+	if t == nil {
+		return
+	}
+	t.exporter.stop()
+}
+
+// StartServerSpan starts the root span of a request handled by Hermes. The
+// incoming traceparent and tracestate are continued if valid; otherwise a new
+// sampled trace is started.
+func (t *Tracer) StartServerSpan(ctx context.Context, header http.Header, name string) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	parent, ok := ParseTraceparent(header.Get(TraceparentHeader))
+	if !ok {
+		parent = TraceContext{TraceID: newTraceID(), Flags: traceFlagSampled}
+	} else {
+		parent.State = header.Get(TracestateHeader)
+	}
+
+	span := t.newSpan(name, SpanKindServer, parent)
+	span.parentID = parent.SpanID
+	return ContextWithSpan(ctx, span), span
+}
+
+// newSpan creates a span in the same trace as parent, with a fresh span ID.
+func (t *Tracer) newSpan(name string, kind int, parent TraceContext) *Span {
+	ctx := parent
+	ctx.SpanID = newSpanID()
+	return &Span{
+		tracer:     t,
+		ctx:        ctx,
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: make(map[string]any),
+	}
+}
+
+// export queues a finished span.
+func (t *Tracer) export(span *Span) {
+	if t == nil {
+		return
+	}
+	t.exporter.enqueue(span)
+}
+
+func newTraceID() [16]byte {
+	var id [16]byte
+	for isZero(id[:]) {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() [8]byte {
+	var id [8]byte
+	for isZero(id[:]) {
+		rand.Read(id[:])
+	}
+	return id
+}
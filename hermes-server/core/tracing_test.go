@@ -0,0 +1,197 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testCollector is a stand-in OTLP/HTTP collector recording exported spans
+type testCollector struct {
+	server *httptest.Server
+	spans  []otlpSpan
+	mu     sync.Mutex
+}
+
+func newTestCollector(t *testing.T) *testCollector {
+	collector := &testCollector{}
+	collector.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected export request: %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		var req otlpTraceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode export request: %v", err)
+		}
+		collector.mu.Lock()
+		defer collector.mu.Unlock()
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				collector.spans = append(collector.spans, ss.Spans...)
+			}
+		}
+	}))
+	return collector
+}
+
+// byName returns the exported spans indexed by name
+func (c *testCollector) byName() map[string]otlpSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	spans := make(map[string]otlpSpan)
+	for _, span := range c.spans {
+		spans[span.Name] = span
+	}
+	return spans
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"garbage", false},
+	}
+
+	for _, tt := range tests {
+		tc, ok := ParseTraceparent(tt.value)
+		if ok != tt.valid {
+			t.Errorf("%s: expected valid=%v, got %v", tt.value, tt.valid, ok)
+		}
+		if ok && tt.value[:2] == "00" && tc.Traceparent() != tt.value {
+			t.Errorf("Expected %s to round-trip, got %s", tt.value, tc.Traceparent())
+		}
+	}
+}
+
+func TestStartSpan_WithoutTracerIsNoop(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	ctx, span := StartSpan(req.Context(), "route", SpanKindInternal)
+	if span != nil || ctx != req.Context() {
+		t.Error("Expected no span without an active trace")
+	}
+	span.SetAttribute("key", "value")
+	span.End()
+
+	header := http.Header{}
+	header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	InjectTraceContext(ctx, header)
+	if header.Get(TraceparentHeader) != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Error("Expected incoming traceparent to pass through unchanged")
+	}
+}
+
+func TestRoutingService_PropagatesAndExportsTrace(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+
+	var received http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer backend.Close()
+	registerTestBackend(t, reg, "api", backend)
+
+	collector := newTestCollector(t)
+	defer collector.server.Close()
+	tracer := NewTracer(TracingConfig{Endpoint: collector.server.URL, ServiceName: "hermes", BatchSize: 10, FlushInterval: time.Hour})
+
+	// Continue the caller's trace
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/hermes/route/api/", nil)
+	c.Request.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	c.Request.Header.Set(TracestateHeader, "vendor=abc")
+
+	ctx, server := tracer.StartServerSpan(c.Request.Context(), c.Request.Header, "GET /hermes/route/:serviceName/*path")
+	c.Request = c.Request.WithContext(ctx)
+	if err := newTestRoutingService(reg).RouteToService(c, "api", "/"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	server.End()
+	tracer.Stop()
+
+	spans := collector.byName()
+	for _, name := range []string{"route", "select_instance", "backend"} {
+		if spans[name].TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("Expected %s span in the caller's trace, got %+v", name, spans[name])
+		}
+	}
+	root := spans["GET /hermes/route/:serviceName/*path"]
+	if root.ParentSpanID != "00f067aa0ba902b7" || root.Kind != SpanKindServer {
+		t.Errorf("Expected server span to continue the incoming span, got %+v", root)
+	}
+	if spans["route"].ParentSpanID != root.SpanID || spans["backend"].ParentSpanID != spans["route"].SpanID {
+		t.Error("Expected route to be a child of the server span and backend a child of route")
+	}
+
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + spans["backend"].SpanID + "-01"
+	if got := received.Get(TraceparentHeader); got != want {
+		t.Errorf("Expected backend to receive traceparent %s, got %s", want, got)
+	}
+	if got := received.Get(TracestateHeader); got != "vendor=abc" {
+		t.Errorf("Expected tracestate to be passed on, got %q", got)
+	}
+}
+
+func TestTracer_StartsNewTrace(t *testing.T) {
+	collector := newTestCollector(t)
+	defer collector.server.Close()
+	tracer := NewTracer(TracingConfig{Endpoint: collector.server.URL + "/v1/traces", ServiceName: "hermes", BatchSize: 1, FlushInterval: time.Hour})
+	go tracer.Start()
+
+	header := http.Header{}
+	header.Set(TraceparentHeader, "invalid")
+	_, span := tracer.StartServerSpan(httptest.NewRequest("GET", "/", nil).Context(), header, "GET")
+	span.End()
+
+	// A full batch is exported without waiting for the flush interval
+	deadline := time.Now().Add(2 * time.Second)
+	for len(collector.byName()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	tracer.Stop()
+
+	exported, ok := collector.byName()["GET"]
+	if !ok {
+		t.Fatal("Expected span to be exported once the batch was full")
+	}
+	if exported.ParentSpanID != "" || len(exported.TraceID) != 32 {
+		t.Errorf("Expected a new root span, got %+v", exported)
+	}
+}
+
+func TestTracer_UnsampledTraceNotExported(t *testing.T) {
+	collector := newTestCollector(t)
+	defer collector.server.Close()
+	tracer := NewTracer(TracingConfig{Endpoint: collector.server.URL, ServiceName: "hermes", BatchSize: 10, FlushInterval: time.Hour})
+
+	header := http.Header{}
+	header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	ctx, span := tracer.StartServerSpan(httptest.NewRequest("GET", "/", nil).Context(), header, "GET")
+	_, child := StartSpan(ctx, "route", SpanKindInternal)
+	child.End()
+	span.End()
+	tracer.Stop()
+
+	if spans := collector.byName(); len(spans) != 0 {
+		t.Errorf("Expected no spans for an unsampled trace, got %d", len(spans))
+	}
+	if child.Context().Sampled() {
+		t.Error("Expected child span to inherit the unsampled flag")
+	}
+}
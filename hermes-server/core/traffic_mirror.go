@@ -0,0 +1,262 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core/domain/mirror"
+)
+
+// MirrorHeader is set on mirrored requests to the name of the service whose
+// request was copied, so that mirror backends can tell copies apart.
+const MirrorHeader = "X-Hermes-Mirror"
+
+// TrafficMirror holds the traffic mirrors of routed services, keyed by
+// service name, with database persistence, and sends the mirrored copies.
+// Copies go straight to a healthy instance of the target service, outside the
+// balancers, circuit breakers and limits of routed traffic, and at most
+// maxInFlight of them are pending at a time; further copies are dropped. A
+// nil *TrafficMirror mirrors nothing. The mirror is thread-safe.
+type TrafficMirror struct {
+	mirrors  map[string]*mirror.Mirror // Key: service name
+	registry *ServiceRegistry
+	client   *http.Client
+	slots    chan struct{} // One per pending copy
+	metrics  *Metrics
+	mu       sync.RWMutex
+	db       *sql.DB
+}
+
+// mirrorCopy is a routed request copied before it is forwarded, holding
+// everything needed to send it in the background, independently of the
+// original request.
+type mirrorCopy struct {
+	serviceName string
+	target      string
+	method      string
+	path        string
+	header      http.Header
+	body        []byte
+}
+
+// NewTrafficMirror creates a traffic mirror and loads the mirrors saved in the
+// database. Copies are given up after timeout. If loading fails, a warning is
+// logged but the mirror is still created. Metrics may be nil.
+func NewTrafficMirror(db *sql.DB, reg *ServiceRegistry, timeout time.Duration, maxInFlight int, metrics *Metrics) *TrafficMirror {
+	m := &TrafficMirror{
+		mirrors:  make(map[string]*mirror.Mirror),
+		registry: reg,
+		client: &http.Client{
+			Timeout: timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse // Don't follow redirects
+			},
+		},
+		slots:   make(chan struct{}, maxInFlight),
+		metrics: metrics,
+		db:      db,
+	}
+
+	if db != nil {
+		if err := m.loadFromDatabase(); err != nil {
+			log.Printf("Warning: failed to load traffic mirrors from database: %v", err)
+		}
+	}
+
+	return m
+}
+
+// Get returns the mirror of a service.
+// Returns an error if the service has no mirror.
+func (m *TrafficMirror) Get(serviceName string) (*mirror.Mirror, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	mr, exists := m.mirrors[serviceName]
+	if !exists {
+		return nil, errors.New("traffic mirror not found")
+	}
+	return mr, nil
+}
+
+// List returns all mirrors sorted by service name.
+func (m *TrafficMirror) List() []*mirror.Mirror {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	mirrors := make([]*mirror.Mirror, 0, len(m.mirrors))
+	for _, mr := range m.mirrors {
+		mirrors = append(mirrors, mr)
+	}
+	sort.Slice(mirrors, func(i, j int) bool {
+		return mirrors[i].ServiceName < mirrors[j].ServiceName
+	})
+	return mirrors
+}
+
+// Set validates and stores the mirror of a service, replacing any previous one.
+func (m *TrafficMirror) Set(mr *mirror.Mirror) error {
+	if err := mr.Validate(); err != nil {
+		return err
+	}
+	mr.UpdatedAt = time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.saveToDatabase(mr); err != nil {
+		log.Printf("Failed to persist traffic mirror for %s: %v", mr.ServiceName, err)
+		return errors.New("failed to save traffic mirror")
+	}
+	m.mirrors[mr.ServiceName] = mr
+
+	log.Printf("Traffic mirror set: %s -> %s (%v%%)", mr.ServiceName, mr.Target, mr.Percent)
+	return nil
+}
+
+// Delete removes the mirror of a service.
+// Returns an error if the service has no mirror.
+func (m *TrafficMirror) Delete(serviceName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.mirrors[serviceName]; !exists {
+		return errors.New("traffic mirror not found")
+	}
+	if m.db != nil {
+		if _, err := m.db.Exec("DELETE FROM traffic_mirrors WHERE service_name = ?", serviceName); err != nil {
+			log.Printf("Failed to delete traffic mirror for %s: %v", serviceName, err)
+			return errors.New("failed to delete traffic mirror")
+		}
+	}
+	delete(m.mirrors, serviceName)
+
+	log.Printf("Traffic mirror removed: %s", serviceName)
+	return nil
+}
+
+// sample decides whether a request to a service is mirrored, and returns the
+// mirror if so. Protocol upgrades are never mirrored.
+func (m *TrafficMirror) sample(serviceName string, req *http.Request) *mirror.Mirror {
+	if m == nil || isUpgradeRequest(req) {
+		return nil
+	}
+	m.mu.RLock()
+	mr, exists := m.mirrors[serviceName]
+	m.mu.RUnlock()
+	if !exists || rand.Float64()*100 >= mr.Percent {
+		return nil
+	}
+	return mr
+}
+
+// send copies a routed request and sends the copy to the mirror's target in
+// the background. The request body must have been buffered into body, so
+// the original request can still read it. The copy never blocks the caller.
+func (m *TrafficMirror) send(c *gin.Context, mr *mirror.Mirror, path string, body []byte) {
+	cp := &mirrorCopy{
+		serviceName: mr.ServiceName,
+		target:      mr.Target,
+		method:      c.Request.Method,
+		path:        path,
+		header:      make(http.Header),
+		body:        body,
+	}
+	if c.Request.URL.RawQuery != "" {
+		cp.path += "?" + c.Request.URL.RawQuery
+	}
+	copyForwardedHeaders(c.Request, cp.header)
+	cp.header.Set(MirrorHeader, mr.ServiceName)
+
+	select {
+	case m.slots <- struct{}{}:
+	default:
+		Logf(c, "Too many pending mirrored requests, dropping copy to %s", mr.Target)
+		m.metrics.ObserveMirrorDropped(mr.ServiceName, mr.Target, "overloaded")
+		return
+	}
+	go func() {
+		defer func() { <-m.slots }()
+		m.deliver(cp)
+	}()
+}
+
+// deliver sends a copy to a random healthy instance of its target and
+// discards the response.
+func (m *TrafficMirror) deliver(cp *mirrorCopy) {
+	instances := m.registry.GetHealthy(cp.target)
+	if len(instances) == 0 {
+		m.metrics.ObserveMirrorDropped(cp.serviceName, cp.target, "no_instances")
+		return
+	}
+	target := instances[rand.Intn(len(instances))]
+
+	req, err := http.NewRequestWithContext(context.Background(), cp.method, target.BaseURL()+cp.path, bytes.NewReader(cp.body))
+	if err != nil {
+		log.Printf("Failed to create mirrored request to %s: %v", cp.target, err)
+		m.metrics.ObserveMirrorDropped(cp.serviceName, cp.target, "invalid_request")
+		return
+	}
+	req.Header = cp.header
+
+	start := time.Now()
+	resp, err := m.client.Do(req)
+	if err != nil {
+		m.metrics.ObserveMirror(cp.serviceName, cp.target, 0, true, time.Since(start))
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	m.metrics.ObserveMirror(cp.serviceName, cp.target, resp.StatusCode, false, time.Since(start))
+}
+
+// loadFromDatabase loads all mirrors on startup.
+func (m *TrafficMirror) loadFromDatabase() error {
+	rows, err := m.db.Query(`SELECT service_name, target, percent, updated_at FROM traffic_mirrors`)
+	if err != nil {
+		log.Printf("Failed to query traffic mirrors: %v", err)
+		return errors.New("failed to query traffic mirrors")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		mr := &mirror.Mirror{}
+		var updatedAt string
+		if err := rows.Scan(&mr.ServiceName, &mr.Target, &mr.Percent, &updatedAt); err != nil {
+			log.Printf("Warning: failed to scan traffic mirror row: %v", err)
+			continue
+		}
+		if mr.UpdatedAt, err = time.Parse(time.RFC3339, updatedAt); err != nil {
+			mr.UpdatedAt = time.Now()
+		}
+		m.mirrors[mr.ServiceName] = mr
+	}
+
+	if len(m.mirrors) > 0 {
+		log.Printf("Loaded %d traffic mirrors from database", len(m.mirrors))
+	}
+	return rows.Err()
+}
+
+// saveToDatabase inserts or replaces a mirror. Must be called with the lock held.
+func (m *TrafficMirror) saveToDatabase(mr *mirror.Mirror) error {
+	if m.db == nil {
+		return nil
+	}
+
+	_, err := m.db.Exec(`
+		INSERT OR REPLACE INTO traffic_mirrors (service_name, target, percent, updated_at)
+		VALUES (?, ?, ?, ?)
+	`, mr.ServiceName, mr.Target, mr.Percent, mr.UpdatedAt.Format(time.RFC3339))
+	return err
+}
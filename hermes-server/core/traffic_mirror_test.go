@@ -0,0 +1,176 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nfcunha/hermes/hermes-server/core/domain/mirror"
+)
+
+// mirroredRequest is what a mirror backend received
+type mirroredRequest struct {
+	method, uri, body, header string
+	headers                   http.Header
+}
+
+func TestRoutingService_TrafficMirror(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+
+	var primaryBody string
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		primaryBody = string(data)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"status":"created"}`))
+	}))
+	defer primary.Close()
+
+	// The mirror is slow and failing, which the primary must not notice
+	received := make(chan mirroredRequest, 10)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		received <- mirroredRequest{r.Method, r.URL.RequestURI(), string(data), r.Header.Get(MirrorHeader), r.Header}
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer shadow.Close()
+
+	registerTestBackend(t, reg, "api", primary)
+	registerTestBackend(t, reg, "api-v2", shadow)
+
+	metrics := NewMetrics()
+	mirrors := NewTrafficMirror(db, reg, time.Second, 10, metrics)
+	if err := mirrors.Set(&mirror.Mirror{ServiceName: "api", Target: "api-v2", Percent: 100}); err != nil {
+		t.Fatalf("Failed to set mirror: %v", err)
+	}
+	routing := newTestRoutingService(reg)
+	routing.mirrors = mirrors
+
+	start := time.Now()
+	w, err := routeTestRequest(t, routing, "POST", "api", "/orders", withQuery("dry=1"), withBody(`{"id":1}`),
+		withHeader("X-Tenant", "acme"), withHeader("Proxy-Authorization", "Basic c2VjcmV0"))
+	if err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("Expected the primary response, got status %d (err: %v)", w.Code, err)
+	}
+	if elapsed := time.Since(start); elapsed >= 200*time.Millisecond {
+		t.Errorf("Expected the primary not to wait for the mirror, took %v", elapsed)
+	}
+	if primaryBody != `{"id":1}` {
+		t.Errorf("Expected the primary to receive the body, got %q", primaryBody)
+	}
+
+	select {
+	case got := <-received:
+		if got.method != "POST" || got.uri != "/orders?dry=1" || got.body != `{"id":1}` || got.header != "api" {
+			t.Errorf("Unexpected mirrored request: %+v", got)
+		}
+		// Headers are forwarded as for the primary
+		if got.headers.Get("X-Tenant") != "acme" || got.headers.Get("X-Forwarded-Host") == "" || got.headers.Get("Proxy-Authorization") != "" {
+			t.Errorf("Unexpected mirrored headers: %v", got.headers)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the request to be mirrored")
+	}
+
+	// Mirror outcomes are recorded separately from the primary's
+	waitFor(t, func() bool {
+		var b bytes.Buffer
+		metrics.Write(&b, nil)
+		return strings.Contains(b.String(), `hermes_mirror_requests_total{service="api",mirror="api-v2",code_class="5xx"} 1`)
+	})
+}
+
+func TestTrafficMirror_PercentAndOverload(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer primary.Close()
+	release := make(chan struct{})
+	hits := make(chan struct{}, 10)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer shadow.Close()
+	defer close(release)
+
+	registerTestBackend(t, reg, "api", primary)
+	registerTestBackend(t, reg, "api-v2", shadow)
+
+	metrics := NewMetrics()
+	mirrors := NewTrafficMirror(nil, reg, time.Second, 1, metrics)
+	routing := newTestRoutingService(reg)
+	routing.mirrors = mirrors
+
+	// Nothing is copied at 0%
+	if err := mirrors.Set(&mirror.Mirror{ServiceName: "api", Target: "api-v2", Percent: 0}); err != nil {
+		t.Fatalf("Failed to set mirror: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		routeTestRequest(t, routing, "POST", "api", "/orders")
+	}
+
+	// Copies beyond the in-flight limit are dropped, while routing goes on
+	if err := mirrors.Set(&mirror.Mirror{ServiceName: "api", Target: "api-v2", Percent: 100}); err != nil {
+		t.Fatalf("Failed to set mirror: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if w, err := routeTestRequest(t, routing, "POST", "api", "/orders"); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("Expected the primary response, got status %d (err: %v)", w.Code, err)
+		}
+	}
+	<-hits
+	var b bytes.Buffer
+	metrics.Write(&b, nil)
+	if !strings.Contains(b.String(), `hermes_mirror_dropped_total{service="api",mirror="api-v2",reason="overloaded"} 2`) {
+		t.Errorf("Expected 2 copies dropped as overloaded, got:\n%s", b.String())
+	}
+	if len(hits) != 0 {
+		t.Errorf("Expected a single copy to be sent, got %d more", len(hits))
+	}
+}
+
+func TestTrafficMirror_PersistsMirrors(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	mirrors := NewTrafficMirror(db, nil, time.Second, 1, nil)
+	invalid := []*mirror.Mirror{
+		{Target: "b", Percent: 10},
+		{ServiceName: "a", Percent: 10},
+		{ServiceName: "a", Target: "a", Percent: 10},
+		{ServiceName: "a", Target: "b", Percent: 101},
+	}
+	for i, mr := range invalid {
+		if err := mirrors.Set(mr); err == nil {
+			t.Errorf("Expected mirror %d to be rejected", i)
+		}
+	}
+
+	if err := mirrors.Set(&mirror.Mirror{ServiceName: "orders", Target: "orders-v2", Percent: 12.5}); err != nil {
+		t.Fatalf("Failed to set mirror: %v", err)
+	}
+	mr, err := NewTrafficMirror(db, nil, time.Second, 1, nil).Get("orders")
+	if err != nil || mr.Target != "orders-v2" || mr.Percent != 12.5 {
+		t.Fatalf("Expected the saved mirror, got %+v (err: %v)", mr, err)
+	}
+
+	if err := mirrors.Delete("orders"); err != nil {
+		t.Fatalf("Failed to delete mirror: %v", err)
+	}
+	if len(NewTrafficMirror(db, nil, time.Second, 1, nil).List()) != 0 {
+		t.Error("Expected the deleted mirror to be gone from the database")
+	}
+}
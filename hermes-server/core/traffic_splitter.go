@@ -0,0 +1,287 @@
+package core
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core/domain/service"
+	"nfcunha/hermes/hermes-server/core/domain/split"
+)
+
+// TrafficSplitter holds the weighted traffic splits of routed services, keyed
+// by service name, with database persistence, and picks the variant each
+// request is routed to. Services without a split are not affected. A nil
+// *TrafficSplitter splits nothing. The splitter is thread-safe.
+type TrafficSplitter struct {
+	splits  map[string]*split.TrafficSplit // Key: service name
+	metrics *Metrics
+	mu      sync.RWMutex
+	db      *sql.DB
+}
+
+// NewTrafficSplitter creates a traffic splitter and loads the splits saved in
+// the database. If loading fails, a warning is logged but the splitter is
+// still created. Metrics may be nil.
+func NewTrafficSplitter(db *sql.DB, metrics *Metrics) *TrafficSplitter {
+	s := &TrafficSplitter{
+		splits:  make(map[string]*split.TrafficSplit),
+		metrics: metrics,
+		db:      db,
+	}
+
+	if db != nil {
+		if err := s.loadFromDatabase(); err != nil {
+			log.Printf("Warning: failed to load traffic splits from database: %v", err)
+		}
+	}
+
+	return s
+}
+
+// Get returns the split of a service.
+// Returns an error if the service has no split.
+func (s *TrafficSplitter) Get(serviceName string) (*split.TrafficSplit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ts, exists := s.splits[serviceName]
+	if !exists {
+		return nil, errors.New("traffic split not found")
+	}
+	return ts, nil
+}
+
+// List returns all splits sorted by service name.
+func (s *TrafficSplitter) List() []*split.TrafficSplit {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	splits := make([]*split.TrafficSplit, 0, len(s.splits))
+	for _, ts := range s.splits {
+		splits = append(splits, ts)
+	}
+	sort.Slice(splits, func(i, j int) bool {
+		return splits[i].ServiceName < splits[j].ServiceName
+	})
+	return splits
+}
+
+// Set validates and stores the split of a service, replacing any previous
+// one. The new weights apply to the next request.
+func (s *TrafficSplitter) Set(ts *split.TrafficSplit) error {
+	if err := ts.Validate(); err != nil {
+		return err
+	}
+	ts.UpdatedAt = time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.saveToDatabase(ts); err != nil {
+		log.Printf("Failed to persist traffic split for %s: %v", ts.ServiceName, err)
+		return errors.New("failed to save traffic split")
+	}
+	s.splits[ts.ServiceName] = ts
+
+	log.Printf("Traffic split set: %s (%d targets)", ts.ServiceName, len(ts.Targets))
+	return nil
+}
+
+// SetWeights changes the weights of targets of an existing split, keeping its
+// selectors, so that a canary can be ramped up or rolled back. Targets not
+// named in weights keep their weight.
+// Returns an error if the service has no split, a target is unknown or the
+// resulting split is invalid.
+func (s *TrafficSplitter) SetWeights(serviceName string, weights map[string]int) (*split.TrafficSplit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.splits[serviceName]
+	if !exists {
+		return nil, errors.New("traffic split not found")
+	}
+
+	// Requests in flight may still read the current split, so change a copy
+	ts := *current
+	ts.Targets = make([]split.Target, len(current.Targets))
+	copy(ts.Targets, current.Targets)
+	for name, weight := range weights {
+		found := false
+		for i := range ts.Targets {
+			if ts.Targets[i].Name == name {
+				ts.Targets[i].Weight = weight
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, errors.New("unknown target: " + name)
+		}
+	}
+	if err := ts.Validate(); err != nil {
+		return nil, err
+	}
+	ts.UpdatedAt = time.Now()
+
+	if err := s.saveToDatabase(&ts); err != nil {
+		log.Printf("Failed to persist traffic split for %s: %v", serviceName, err)
+		return nil, errors.New("failed to save traffic split")
+	}
+	s.splits[serviceName] = &ts
+
+	log.Printf("Traffic split weights changed: %s %v", serviceName, weights)
+	return &ts, nil
+}
+
+// Delete removes the split of a service, so that all its instances receive
+// traffic again.
+// Returns an error if the service has no split.
+func (s *TrafficSplitter) Delete(serviceName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.splits[serviceName]; !exists {
+		return errors.New("traffic split not found")
+	}
+	if s.db != nil {
+		if _, err := s.db.Exec("DELETE FROM traffic_splits WHERE service_name = ?", serviceName); err != nil {
+			log.Printf("Failed to delete traffic split for %s: %v", serviceName, err)
+			return errors.New("failed to delete traffic split")
+		}
+	}
+	delete(s.splits, serviceName)
+
+	log.Printf("Traffic split removed: %s", serviceName)
+	return nil
+}
+
+// Select returns the instances of the variant a request is routed to, and
+// the variant's name. Only variants with a positive weight and at least one
+// of the given instances are considered. A client presenting the split's
+// sticky cookie stays on the variant it names; otherwise a variant is picked
+// at random by weight, and recorded in the sticky cookie if the split has
+// one. Services without a split get all instances and an empty name.
+// Returns an error if no variant has instances.
+func (s *TrafficSplitter) Select(c *gin.Context, serviceName string, instances []*service.Service) ([]*service.Service, string, error) {
+	if s == nil {
+		return instances, "", nil
+	}
+	s.mu.RLock()
+	ts, exists := s.splits[serviceName]
+	s.mu.RUnlock()
+	if !exists {
+		return instances, "", nil
+	}
+
+	groups := make([][]*service.Service, len(ts.Targets))
+	for _, svc := range instances {
+		if i := ts.TargetFor(svc.Metadata); i >= 0 {
+			groups[i] = append(groups[i], svc)
+		}
+	}
+
+	total := 0
+	for i, t := range ts.Targets {
+		if t.Weight > 0 && len(groups[i]) > 0 {
+			total += t.Weight
+		}
+	}
+	if total == 0 {
+		return nil, "", errors.New("no instances available (traffic split)")
+	}
+
+	chosen := -1
+	if ts.StickyCookie != "" {
+		if cookie, err := c.Request.Cookie(ts.StickyCookie); err == nil {
+			for i, t := range ts.Targets {
+				if t.Name == cookie.Value && t.Weight > 0 && len(groups[i]) > 0 {
+					chosen = i
+					break
+				}
+			}
+		}
+	}
+	if chosen < 0 {
+		n := rand.Intn(total)
+		for i, t := range ts.Targets {
+			if t.Weight <= 0 || len(groups[i]) == 0 {
+				continue
+			}
+			if n < t.Weight {
+				chosen = i
+				break
+			}
+			n -= t.Weight
+		}
+		if ts.StickyCookie != "" {
+			http.SetCookie(c.Writer, &http.Cookie{
+				Name:     ts.StickyCookie,
+				Value:    ts.Targets[chosen].Name,
+				Path:     "/",
+				HttpOnly: true,
+			})
+		}
+	}
+
+	variant := ts.Targets[chosen].Name
+	s.metrics.ObserveSplit(serviceName, variant)
+	return groups[chosen], variant, nil
+}
+
+// loadFromDatabase loads all splits on startup.
+func (s *TrafficSplitter) loadFromDatabase() error {
+	rows, err := s.db.Query(`SELECT service_name, targets, sticky_cookie, updated_at FROM traffic_splits`)
+	if err != nil {
+		log.Printf("Failed to query traffic splits: %v", err)
+		return errors.New("failed to query traffic splits")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		ts := &split.TrafficSplit{}
+		var targetsJSON, updatedAt string
+		if err := rows.Scan(&ts.ServiceName, &targetsJSON, &ts.StickyCookie, &updatedAt); err != nil {
+			log.Printf("Warning: failed to scan traffic split row: %v", err)
+			continue
+		}
+		if err := json.Unmarshal([]byte(targetsJSON), &ts.Targets); err != nil {
+			log.Printf("Warning: failed to parse targets of traffic split %s: %v", ts.ServiceName, err)
+			continue
+		}
+		if ts.UpdatedAt, err = time.Parse(time.RFC3339, updatedAt); err != nil {
+			ts.UpdatedAt = time.Now()
+		}
+		s.splits[ts.ServiceName] = ts
+	}
+
+	if len(s.splits) > 0 {
+		log.Printf("Loaded %d traffic splits from database", len(s.splits))
+	}
+	return rows.Err()
+}
+
+// saveToDatabase inserts or replaces a split. Must be called with the lock held.
+func (s *TrafficSplitter) saveToDatabase(ts *split.TrafficSplit) error {
+	if s.db == nil {
+		return nil
+	}
+
+	targetsJSON, err := json.Marshal(ts.Targets)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`
+		INSERT OR REPLACE INTO traffic_splits (service_name, targets, sticky_cookie, updated_at)
+		VALUES (?, ?, ?, ?)
+	`, ts.ServiceName, string(targetsJSON), ts.StickyCookie, ts.UpdatedAt.Format(time.RFC3339))
+	return err
+}
@@ -0,0 +1,280 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core/domain/service"
+	"nfcunha/hermes/hermes-server/core/domain/split"
+)
+
+// newVariantInstance creates an instance with the given version metadata
+func newVariantInstance(port int, version string) *service.Service {
+	svc := service.NewService("api", "10.0.0.1", port, "/health")
+	svc.ID = "api-" + strconv.Itoa(port)
+	if version != "" {
+		svc.Metadata["version"] = version
+	}
+	return svc
+}
+
+// selectVariant runs Select for a request carrying the given cookies and
+// returns the chosen variant and the response recorder
+func selectVariant(t *testing.T, splitter *TrafficSplitter, instances []*service.Service, cookies ...*http.Cookie) (string, []*service.Service, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/hermes/route/api/", nil)
+	for _, cookie := range cookies {
+		c.Request.AddCookie(cookie)
+	}
+	selected, variant, err := splitter.Select(c, "api", instances)
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	return variant, selected, w
+}
+
+func TestTrafficSplitter_Weights(t *testing.T) {
+	splitter := NewTrafficSplitter(nil, nil)
+	instances := []*service.Service{
+		newVariantInstance(1, "v1"),
+		newVariantInstance(2, "v1"),
+		newVariantInstance(3, "v2"),
+		newVariantInstance(4, ""),
+	}
+
+	// Services without a split keep all instances
+	if variant, selected, _ := selectVariant(t, splitter, instances); variant != "" || len(selected) != 4 {
+		t.Fatalf("Expected no split, got variant %q with %d instances", variant, len(selected))
+	}
+
+	err := splitter.Set(&split.TrafficSplit{
+		ServiceName: "api",
+		Targets: []split.Target{
+			{Name: "stable", Weight: 50},
+			{Name: "canary", Selector: map[string]string{"version": "v2"}, Weight: 50},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to set split: %v", err)
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 2000; i++ {
+		variant, selected, _ := selectVariant(t, splitter, instances)
+		counts[variant]++
+		if variant == "canary" && (len(selected) != 1 || selected[0].Metadata["version"] != "v2") {
+			t.Fatalf("Expected the canary to select the v2 instance, got %d instances", len(selected))
+		}
+		if variant == "stable" && len(selected) != 3 {
+			t.Fatalf("Expected the catch-all target to select the other 3 instances, got %d", len(selected))
+		}
+	}
+	if counts["stable"] < 800 || counts["canary"] < 800 {
+		t.Errorf("Expected an even split, got %v", counts)
+	}
+
+	// Rolling back sends everything to the stable variant
+	if _, err := splitter.SetWeights("api", map[string]int{"canary": 0}); err != nil {
+		t.Fatalf("Failed to set weights: %v", err)
+	}
+	for i := 0; i < 50; i++ {
+		if variant, _, _ := selectVariant(t, splitter, instances); variant != "stable" {
+			t.Fatalf("Expected only stable after rollback, got %s", variant)
+		}
+	}
+
+	// A variant without instances gets no traffic
+	if _, err := splitter.SetWeights("api", map[string]int{"stable": 1, "canary": 100}); err != nil {
+		t.Fatalf("Failed to set weights: %v", err)
+	}
+	for i := 0; i < 50; i++ {
+		if variant, _, _ := selectVariant(t, splitter, instances[:2]); variant != "stable" {
+			t.Fatalf("Expected only stable without v2 instances, got %s", variant)
+		}
+	}
+}
+
+func TestTrafficSplitter_NoVariantAvailable(t *testing.T) {
+	splitter := NewTrafficSplitter(nil, nil)
+	if err := splitter.Set(&split.TrafficSplit{
+		ServiceName: "api",
+		Targets: []split.Target{
+			{Name: "stable", Selector: map[string]string{"version": "v1"}, Weight: 100},
+			{Name: "canary", Selector: map[string]string{"version": "v2"}, Weight: 0},
+		},
+	}); err != nil {
+		t.Fatalf("Failed to set split: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	if _, _, err := splitter.Select(c, "api", []*service.Service{newVariantInstance(1, "v2")}); err == nil {
+		t.Error("Expected an error when only zero-weight variants have instances")
+	}
+}
+
+func TestTrafficSplitter_StickyCookie(t *testing.T) {
+	splitter := NewTrafficSplitter(nil, nil)
+	instances := []*service.Service{newVariantInstance(1, "v1"), newVariantInstance(2, "v2")}
+	if err := splitter.Set(&split.TrafficSplit{
+		ServiceName: "api",
+		Targets: []split.Target{
+			{Name: "stable", Selector: map[string]string{"version": "v1"}, Weight: 1},
+			{Name: "canary", Selector: map[string]string{"version": "v2"}, Weight: 99},
+		},
+		StickyCookie: "hermes_variant",
+	}); err != nil {
+		t.Fatalf("Failed to set split: %v", err)
+	}
+
+	// A new client is assigned a variant and told to keep it
+	variant, _, w := selectVariant(t, splitter, instances)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "hermes_variant" || cookies[0].Value != variant {
+		t.Fatalf("Expected a sticky cookie for variant %s, got %v", variant, cookies)
+	}
+
+	// A returning client stays on its variant whatever the weights
+	for i := 0; i < 50; i++ {
+		got, _, w := selectVariant(t, splitter, instances, &http.Cookie{Name: "hermes_variant", Value: "stable"})
+		if got != "stable" {
+			t.Fatalf("Expected the sticky variant stable, got %s", got)
+		}
+		if len(w.Result().Cookies()) != 0 {
+			t.Fatal("Expected no new cookie for a sticky client")
+		}
+	}
+
+	// Unless its variant is rolled back
+	if _, err := splitter.SetWeights("api", map[string]int{"stable": 0}); err != nil {
+		t.Fatalf("Failed to set weights: %v", err)
+	}
+	got, _, w := selectVariant(t, splitter, instances, &http.Cookie{Name: "hermes_variant", Value: "stable"})
+	if got != "canary" {
+		t.Errorf("Expected a rolled back variant to be left, got %s", got)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].Value != "canary" {
+		t.Errorf("Expected the cookie to be reassigned to canary, got %v", cookies)
+	}
+}
+
+func TestTrafficSplitter_Validation(t *testing.T) {
+	splitter := NewTrafficSplitter(nil, nil)
+	invalid := []*split.TrafficSplit{
+		{ServiceName: "api"},
+		{Targets: []split.Target{{Name: "a", Weight: 1}}},
+		{ServiceName: "api", Targets: []split.Target{{Weight: 1}}},
+		{ServiceName: "api", Targets: []split.Target{{Name: "a", Weight: 1, Selector: map[string]string{"v": "1"}}, {Name: "a", Weight: 1}}},
+		{ServiceName: "api", Targets: []split.Target{{Name: "a", Weight: -1}, {Name: "b", Weight: 2, Selector: map[string]string{"v": "2"}}}},
+		{ServiceName: "api", Targets: []split.Target{{Name: "a", Weight: 0}}},
+		{ServiceName: "api", Targets: []split.Target{{Name: "a", Weight: 1}, {Name: "b", Weight: 1}}},
+		{ServiceName: "api", Targets: []split.Target{{Name: "a", Weight: 1}}, StickyCookie: "bad cookie"},
+	}
+	for i, ts := range invalid {
+		if err := splitter.Set(ts); err == nil {
+			t.Errorf("Expected split %d to be rejected", i)
+		}
+	}
+
+	if err := splitter.Set(&split.TrafficSplit{ServiceName: "api", Targets: []split.Target{{Name: "a", Weight: 1}}}); err != nil {
+		t.Fatalf("Failed to set split: %v", err)
+	}
+	if _, err := splitter.SetWeights("api", map[string]int{"b": 1}); err == nil {
+		t.Error("Expected weights of an unknown target to be rejected")
+	}
+	if _, err := splitter.SetWeights("api", map[string]int{"a": 0}); err == nil {
+		t.Error("Expected weights all zero to be rejected")
+	}
+	if _, err := splitter.SetWeights("other", map[string]int{"a": 1}); err == nil {
+		t.Error("Expected weights of a service without split to be rejected")
+	}
+}
+
+func TestTrafficSplitter_Persistence(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	splitter := NewTrafficSplitter(db, nil)
+	if err := splitter.Set(&split.TrafficSplit{
+		ServiceName: "api",
+		Targets: []split.Target{
+			{Name: "stable", Weight: 90},
+			{Name: "canary", Selector: map[string]string{"version": "v2"}, Weight: 10},
+		},
+		StickyCookie: "variant",
+	}); err != nil {
+		t.Fatalf("Failed to set split: %v", err)
+	}
+	if _, err := splitter.SetWeights("api", map[string]int{"stable": 50, "canary": 50}); err != nil {
+		t.Fatalf("Failed to set weights: %v", err)
+	}
+
+	// A new splitter sees the saved split with its latest weights
+	ts, err := NewTrafficSplitter(db, nil).Get("api")
+	if err != nil {
+		t.Fatalf("Expected the saved split, got %v", err)
+	}
+	if len(ts.Targets) != 2 || ts.Targets[0].Weight != 50 || ts.Targets[1].Selector["version"] != "v2" || ts.StickyCookie != "variant" {
+		t.Errorf("Unexpected saved split: %+v", ts)
+	}
+
+	if err := splitter.Delete("api"); err != nil {
+		t.Fatalf("Failed to delete split: %v", err)
+	}
+	if len(NewTrafficSplitter(db, nil).List()) != 0 {
+		t.Error("Expected the deleted split to be gone from the database")
+	}
+}
+
+func TestRoutingService_TrafficSplit(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	reg := NewServiceRegistry(db)
+
+	hits := make(map[string]int)
+	for _, version := range []string{"v1", "v2"} {
+		version := version
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[version]++
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer backend.Close()
+
+		u, _ := url.Parse(backend.URL)
+		port, _ := strconv.Atoi(u.Port())
+		svc := service.NewService("api", u.Hostname(), port, "/health")
+		svc.Metadata["version"] = version
+		if err := reg.Register(svc); err != nil {
+			t.Fatalf("Failed to register backend: %v", err)
+		}
+	}
+
+	splitter := NewTrafficSplitter(db, nil)
+	if err := splitter.Set(&split.TrafficSplit{
+		ServiceName: "api",
+		Targets: []split.Target{
+			{Name: "stable", Selector: map[string]string{"version": "v1"}, Weight: 0},
+			{Name: "canary", Selector: map[string]string{"version": "v2"}, Weight: 100},
+		},
+	}); err != nil {
+		t.Fatalf("Failed to set split: %v", err)
+	}
+	routing := newTestRoutingService(reg)
+	routing.splitter = splitter
+
+	for i := 0; i < 10; i++ {
+		if w, err := routeTestRequest(t, routing, "GET", "api", "/"); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("Expected request to succeed, got status %d (err: %v)", w.Code, err)
+		}
+	}
+	if hits["v1"] != 0 || hits["v2"] != 10 {
+		t.Errorf("Expected all requests on v2, got %v", hits)
+	}
+}
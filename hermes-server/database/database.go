@@ -43,7 +43,7 @@ func Initialize() error {
 	}
 
 	// Run migrations
-	if err := migrate(); err != nil {
+	if err := migrate(db); err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 
@@ -2,16 +2,35 @@
 package database
 
 import (
+	"database/sql"
+	"fmt"
 	"log"
 )
 
+// Migrate runs all database migrations against the given connection.
+// It is used by Initialize and by tests that need the real schema.
+func Migrate(conn *sql.DB) error {
+	return migrate(conn)
+}
+
 // migrate runs all database migrations to create the schema.
-// Creates two tables:
+// Creates ten tables:
 //   - services: stores registered service information
 //   - health_check_logs: stores health check history
+//   - access_logs: stores routed requests when the SQLite access log sink is used
+//   - route_policies: stores the access policy of routed services
+//   - registration_tokens: stores hashed tokens authorizing self-registration
+//   - api_keys: stores hashed API keys of machine clients
+//   - rate_limits: stores the rate limit of routed services
+//   - route_rules: stores the rules routing requests at the gateway root to services
+//   - traffic_splits: stores the weighted traffic splits of routed services
+//   - traffic_mirrors: stores the services receiving copies of routed requests
+//
+// Columns added after a table was first created are applied through
+// columnMigrations so that existing databases are upgraded in place.
 //
 // Returns an error if any migration fails.
-func migrate() error {
+func migrate(conn *sql.DB) error {
 	migrations := []struct {
 		name string
 		sql  string
@@ -56,20 +75,203 @@ CREATE INDEX IF NOT EXISTS idx_health_logs_service ON health_check_logs(service_
 CREATE INDEX IF NOT EXISTS idx_health_logs_checked_at ON health_check_logs(checked_at);
 			`,
 		},
+		{
+			name: "create_access_logs_table",
+			sql: `
+CREATE TABLE IF NOT EXISTS access_logs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    logged_at TIMESTAMP NOT NULL,
+    request_id TEXT NOT NULL DEFAULT '',
+    method TEXT NOT NULL,
+    path TEXT NOT NULL,
+    service TEXT NOT NULL,
+    instance_id TEXT NOT NULL DEFAULT '',
+    status INTEGER NOT NULL,
+    upstream_status INTEGER NOT NULL DEFAULT 0,
+    upstream_latency_ms REAL NOT NULL DEFAULT 0,
+    latency_ms REAL NOT NULL,
+    bytes_in INTEGER NOT NULL DEFAULT 0,
+    bytes_out INTEGER NOT NULL DEFAULT 0,
+    subject TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_access_logs_service ON access_logs(service);
+CREATE INDEX IF NOT EXISTS idx_access_logs_logged_at ON access_logs(logged_at);
+			`,
+		},
+		{
+			name: "create_route_policies_table",
+			sql: `
+CREATE TABLE IF NOT EXISTS route_policies (
+    service_name TEXT PRIMARY KEY,
+    access TEXT NOT NULL,
+    roles TEXT NOT NULL DEFAULT '[]',
+    permissions TEXT NOT NULL DEFAULT '[]',
+    updated_at TIMESTAMP NOT NULL
+);
+			`,
+		},
+		{
+			name: "create_registration_tokens_table",
+			sql: `
+CREATE TABLE IF NOT EXISTS registration_tokens (
+    id TEXT PRIMARY KEY,
+    token_hash TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    service_names TEXT NOT NULL,
+    source_cidrs TEXT NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP
+);
+			`,
+		},
+		{
+			name: "create_api_keys_table",
+			sql: `
+CREATE TABLE IF NOT EXISTS api_keys (
+    id TEXT PRIMARY KEY,
+    key_hash TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    roles TEXT NOT NULL DEFAULT '[]',
+    permissions TEXT NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP
+);
+			`,
+		},
+		{
+			name: "create_rate_limits_table",
+			sql: `
+CREATE TABLE IF NOT EXISTS rate_limits (
+    service_name TEXT PRIMARY KEY,
+    requests_per_second REAL NOT NULL,
+    burst INTEGER NOT NULL,
+    key_type TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+			`,
+		},
+		{
+			name: "create_route_rules_table",
+			sql: `
+CREATE TABLE IF NOT EXISTS route_rules (
+    name TEXT PRIMARY KEY,
+    priority INTEGER NOT NULL DEFAULT 0,
+    hosts TEXT NOT NULL DEFAULT '[]',
+    path_prefix TEXT NOT NULL DEFAULT '',
+    path_regex TEXT NOT NULL DEFAULT '',
+    methods TEXT NOT NULL DEFAULT '[]',
+    headers TEXT NOT NULL DEFAULT '{}',
+    service_name TEXT NOT NULL,
+    strip_prefix BOOLEAN NOT NULL DEFAULT 0,
+    rewrite TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMP NOT NULL
+);
+			`,
+		},
+		{
+			name: "create_traffic_splits_table",
+			sql: `
+CREATE TABLE IF NOT EXISTS traffic_splits (
+    service_name TEXT PRIMARY KEY,
+    targets TEXT NOT NULL DEFAULT '[]',
+    sticky_cookie TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMP NOT NULL
+);
+			`,
+		},
+		{
+			name: "create_traffic_mirrors_table",
+			sql: `
+CREATE TABLE IF NOT EXISTS traffic_mirrors (
+    service_name TEXT PRIMARY KEY,
+    target TEXT NOT NULL,
+    percent REAL NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+			`,
+		},
+	}
+
+	columnMigrations := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{table: "services", column: "lease_ttl_seconds", definition: "INTEGER NOT NULL DEFAULT 0"},
+		{table: "services", column: "last_heartbeat_at", definition: "TIMESTAMP"},
+		{table: "services", column: "health_check_type", definition: "TEXT NOT NULL DEFAULT 'http'"},
+		{table: "services", column: "health_check_expect_status", definition: "INTEGER NOT NULL DEFAULT 0"},
+		{table: "services", column: "health_check_expect_body", definition: "TEXT NOT NULL DEFAULT ''"},
+		{table: "services", column: "health_check_interval_seconds", definition: "INTEGER NOT NULL DEFAULT 0"},
+		{table: "services", column: "health_check_timeout_seconds", definition: "INTEGER NOT NULL DEFAULT 0"},
+		{table: "services", column: "health_check_threshold", definition: "INTEGER NOT NULL DEFAULT 0"},
+		{table: "services", column: "registration_token_id", definition: "TEXT NOT NULL DEFAULT ''"},
+		{table: "route_rules", column: "subset_headers", definition: "TEXT NOT NULL DEFAULT '{}'"},
 	}
 
 	for _, migration := range migrations {
 		log.Printf("Running migration: %s", migration.name)
-		if _, err := db.Exec(migration.sql); err != nil {
+		if _, err := conn.Exec(migration.sql); err != nil {
 			log.Printf("Migration failed for %s: %v", migration.name, err)
 			return err
 		}
 		log.Printf("Migration completed: %s", migration.name)
 	}
 
+	for _, migration := range columnMigrations {
+		if err := ensureColumn(conn, migration.table, migration.column, migration.definition); err != nil {
+			log.Printf("Migration failed for %s.%s: %v", migration.table, migration.column, err)
+			return err
+		}
+	}
+
 	if len(migrations) == 0 {
 		log.Println("No migrations to run")
 	}
 
 	return nil
 }
+
+// ensureColumn adds a column to a table if it does not exist yet.
+func ensureColumn(conn *sql.DB, table, column, definition string) error {
+	exists, err := columnExists(conn, table, column)
+	if err != nil || exists {
+		return err
+	}
+
+	log.Printf("Running migration: add column %s.%s", table, column)
+	_, err = conn.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// columnExists reports whether a table already has the given column.
+func columnExists(conn *sql.DB, table, column string) (bool, error) {
+	rows, err := conn.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
@@ -0,0 +1,119 @@
+// Package apikey provides HTTP handlers for managing API keys.
+package apikey
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core"
+	"nfcunha/hermes/hermes-server/handler/middleware"
+)
+
+// Handler manages API keys
+type Handler struct {
+	apiKeys *core.APIKeys
+}
+
+// NewHandler creates a new API key handler
+func NewHandler(apiKeys *core.APIKeys) *Handler {
+	return &Handler{
+		apiKeys: apiKeys,
+	}
+}
+
+// RegisterRoutes registers the API key endpoints. All of them require
+// authentication and admin privileges.
+// Routes:
+//   - POST   /api-keys      - Issue an API key
+//   - GET    /api-keys      - List API keys
+//   - DELETE /api-keys/:id  - Revoke an API key
+func (h *Handler) RegisterRoutes(router gin.IRouter, authMiddleware, adminMiddleware gin.HandlerFunc) {
+	keys := router.Group("/api-keys")
+	keys.Use(authMiddleware, adminMiddleware)
+	{
+		keys.POST("", h.handleIssueKey)
+		keys.GET("", h.handleListKeys)
+		keys.DELETE("/:id", h.handleRevokeKey)
+	}
+}
+
+// IssueKeyRequest represents the payload for issuing an API key.
+// ExpiresInSeconds sets the key lifetime (0: the key does not expire).
+type IssueKeyRequest struct {
+	Name             string   `json:"name" binding:"required"`
+	Roles            []string `json:"roles"`
+	Permissions      []string `json:"permissions"`
+	ExpiresInSeconds int      `json:"expires_in_seconds"`
+}
+
+// handleIssueKey creates an API key. The secret is only returned in this response.
+func (h *Handler) handleIssueKey(c *gin.Context) {
+	var req IssueKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.ErrorJSON(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.ExpiresInSeconds < 0 {
+		middleware.ErrorJSON(c, http.StatusBadRequest, "expires_in_seconds must not be negative")
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInSeconds > 0 {
+		t := time.Now().UTC().Add(time.Duration(req.ExpiresInSeconds) * time.Second)
+		expiresAt = &t
+	}
+
+	secret, key, err := h.apiKeys.Issue(req.Name, req.Roles, req.Permissions, expiresAt)
+	if err != nil {
+		status := http.StatusBadRequest
+		if err.Error() == "failed to generate key" || err.Error() == "failed to store key" {
+			status = http.StatusInternalServerError
+		}
+		middleware.ErrorJSON(c, status, err.Error())
+		return
+	}
+
+	core.Logf(c, "API key issued: %s (%s)", key.Name, key.ID)
+	c.JSON(http.StatusCreated, gin.H{
+		"key":         secret,
+		"header":      h.apiKeys.Header(),
+		"id":          key.ID,
+		"name":        key.Name,
+		"roles":       key.Roles,
+		"permissions": key.Permissions,
+		"created_at":  key.CreatedAt,
+		"expires_at":  key.ExpiresAt,
+	})
+}
+
+// handleListKeys returns all API keys without their secrets
+func (h *Handler) handleListKeys(c *gin.Context) {
+	keys, err := h.apiKeys.List()
+	if err != nil {
+		middleware.ErrorJSON(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"keys":  keys,
+		"count": len(keys),
+	})
+}
+
+// handleRevokeKey deletes an API key
+func (h *Handler) handleRevokeKey(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.apiKeys.Revoke(id); err != nil {
+		status := http.StatusInternalServerError
+		if err.Error() == "key not found" {
+			status = http.StatusNotFound
+		}
+		middleware.ErrorJSON(c, status, err.Error())
+		return
+	}
+
+	core.Logf(c, "API key revoked: %s", id)
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
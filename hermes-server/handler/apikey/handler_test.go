@@ -0,0 +1,115 @@
+package apikey
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/mattn/go-sqlite3"
+	"nfcunha/hermes/hermes-server/core"
+	"nfcunha/hermes/hermes-server/core/domain/apikey"
+	"nfcunha/hermes/hermes-server/database"
+	"nfcunha/hermes/hermes-server/handler/middleware"
+)
+
+// setupTestDB creates an in-memory SQLite database for testing
+func setupTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// newTestRouter creates a router with the API key endpoints, open to anyone,
+// and a route protected by AuthMiddleware that echoes the caller's roles.
+func newTestRouter(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	apiKeys := core.NewAPIKeys(apikey.NewRepository(setupTestDB(t)), "X-API-Key")
+	open := func(c *gin.Context) { c.Next() }
+
+	router := gin.New()
+	NewHandler(apiKeys).RegisterRoutes(router, open, open)
+	router.GET("/protected", middleware.AuthMiddleware(nil, apiKeys), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"user_id": c.GetString("user_id"),
+			"roles":   c.GetStringSlice("user_roles"),
+		})
+	})
+	return router
+}
+
+// callProtected calls the protected route with an API key.
+func callProtected(router *gin.Engine, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/protected", nil)
+	req.Header.Set("X-API-Key", key)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAPIKeys_IssueAuthenticateRevoke(t *testing.T) {
+	router := newTestRouter(t)
+
+	req := httptest.NewRequest("POST", "/api-keys", bytes.NewBufferString(`{"name":"ci","roles":["deployer"],"expires_in_seconds":3600}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var issued struct {
+		Key string `json:"key"`
+		ID  string `json:"id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &issued)
+
+	// The key authenticates with its roles
+	w = callProtected(router, issued.Key)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected API key to authenticate, got %d", w.Code)
+	}
+	var identity struct {
+		UserID string   `json:"user_id"`
+		Roles  []string `json:"roles"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &identity)
+	if identity.UserID != "apikey:"+issued.ID || len(identity.Roles) != 1 || identity.Roles[0] != "deployer" {
+		t.Errorf("Expected API key identity, got %+v", identity)
+	}
+
+	// Listing never exposes secrets
+	req = httptest.NewRequest("GET", "/api-keys", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), issued.ID) || strings.Contains(w.Body.String(), issued.Key) {
+		t.Errorf("Expected key list without secrets, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("DELETE", "/api-keys/"+issued.ID, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if w := callProtected(router, issued.Key); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected revoked key to be rejected, got %d", w.Code)
+	}
+}
+
+func TestAPIKeys_RejectsUnknownKey(t *testing.T) {
+	router := newTestRouter(t)
+
+	if w := callProtected(router, "hak_unknown"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
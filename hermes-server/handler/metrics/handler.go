@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core"
+)
+
+// contentType is the Prometheus text exposition format content type
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Handler exposes gateway metrics for Prometheus to scrape
+type Handler struct {
+	metrics  *core.Metrics
+	registry *core.ServiceRegistry
+}
+
+// NewHandler creates a new metrics handler
+func NewHandler(metrics *core.Metrics, registry *core.ServiceRegistry) *Handler {
+	return &Handler{
+		metrics:  metrics,
+		registry: registry,
+	}
+}
+
+// RegisterRoutes registers the metrics endpoint
+func (h *Handler) RegisterRoutes(router gin.IRouter) {
+	router.GET("/metrics", h.handleMetrics)
+}
+
+// handleMetrics renders all metrics in the Prometheus text format
+func (h *Handler) handleMetrics(c *gin.Context) {
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
+	if err := h.metrics.Write(c.Writer, h.registry); err != nil {
+		log.Printf("Failed to write metrics: %v", err)
+	}
+}
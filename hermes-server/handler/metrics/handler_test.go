@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core"
+)
+
+func TestMetrics_Endpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	m := core.NewMetrics()
+	m.ObserveRequest("api", http.StatusOK, false, 10*time.Millisecond)
+
+	router := gin.New()
+	NewHandler(m, nil).RegisterRoutes(router)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Expected Prometheus text content type, got %q", contentType)
+	}
+	if !strings.Contains(w.Body.String(), `hermes_requests_total{service="api",code_class="2xx"} 1`) {
+		t.Errorf("Expected request counter in output, got:\n%s", w.Body.String())
+	}
+}
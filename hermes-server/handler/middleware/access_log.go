@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core"
+)
+
+// AccessLogMiddleware records one access log entry per request. The routing
+// service adds the service, instance and upstream details to the entry; this
+// middleware fills in the rest once the request is complete. A nil logger
+// disables access logging.
+func AccessLogMiddleware(logger *core.AccessLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if logger == nil {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		entry := core.StartAccessLogEntry(c)
+		body := &countingReader{ReadCloser: c.Request.Body}
+		if c.Request.Body != nil {
+			c.Request.Body = body
+		}
+
+		c.Next()
+
+		entry.Time = start.UTC()
+		entry.RequestID = c.GetString(core.RequestIDKey)
+		entry.Method = c.Request.Method
+		entry.Path = c.Request.URL.Path
+		entry.Status = c.Writer.Status()
+		entry.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+		entry.BytesIn = body.n.Load()
+		if size := c.Writer.Size(); size > 0 {
+			entry.BytesOut = int64(size)
+		}
+		entry.Subject = c.GetString("user_subject")
+		logger.Log(entry)
+	}
+}
+
+// countingReader counts the bytes read from a request body. The body may
+// still be read by the transport after the handler has returned, so the count
+// is atomic.
+type countingReader struct {
+	io.ReadCloser
+	n atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core"
+	"nfcunha/hermes/hermes-server/core/domain/accesslog"
+)
+
+// recordingSink keeps access log entries in memory
+type recordingSink struct {
+	entries []*accesslog.Entry
+}
+
+func (s *recordingSink) Write(entry *accesslog.Entry) error {
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	return nil
+}
+
+func TestAccessLogMiddleware_RecordsRequest(t *testing.T) {
+	sink := &recordingSink{}
+	logger := core.NewAccessLogger(sink, core.AccessLogConfig{SampleRate: 1})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/route/:serviceName/*path", func(c *gin.Context) {
+		c.Set(core.RequestIDKey, "req-42")
+		c.Set("user_subject", "alice@example.com")
+		c.Next()
+	}, AccessLogMiddleware(logger), func(c *gin.Context) {
+		io.ReadAll(c.Request.Body)
+		c.String(http.StatusAccepted, "queued")
+	})
+
+	req := httptest.NewRequest("POST", "/route/orders/v1/orders", strings.NewReader(`{"item":"book"}`))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	logger.Stop()
+
+	if len(sink.entries) != 1 {
+		t.Fatalf("Expected 1 access log entry, got %d", len(sink.entries))
+	}
+	entry := sink.entries[0]
+	if entry.Method != "POST" || entry.Path != "/route/orders/v1/orders" || entry.Status != http.StatusAccepted {
+		t.Errorf("Unexpected request fields: %+v", entry)
+	}
+	if entry.BytesIn != 15 || entry.BytesOut != 6 {
+		t.Errorf("Expected 15 bytes in and 6 bytes out, got %d and %d", entry.BytesIn, entry.BytesOut)
+	}
+	if entry.RequestID != "req-42" || entry.Subject != "alice@example.com" {
+		t.Errorf("Expected request ID and subject, got %q and %q", entry.RequestID, entry.Subject)
+	}
+}
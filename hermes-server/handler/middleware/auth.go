@@ -2,7 +2,6 @@
 package middleware
 
 import (
-	"log"
 	"net/http"
 	"strings"
 
@@ -13,58 +12,98 @@ import (
 // AuthMiddleware validates JWT tokens using Aegis.
 // It extracts the Bearer token from the Authorization header,
 // validates it with Aegis, and stores user information in the Gin context.
+// Requests carrying an API key in the API key header are authenticated with
+// apiKeys instead (nil disables API keys); the key's name is the subject.
 // The following context keys are set on success:
-//   - "user_id": string
+//   - "user_id": string ("apikey:<id>" for API keys)
 //   - "user_subject": string
 //   - "user_roles": []string
 //   - "user_permissions": []string
-func AuthMiddleware(aegisClient *core.AegisClient) gin.HandlerFunc {
+func AuthMiddleware(aegisClient *core.AegisClient, apiKeys *core.APIKeys) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Extract token from Authorization header
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			log.Println("Missing Authorization header")
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing authorization token"})
-			c.Abort()
-			return
+		if authenticate(c, aegisClient, apiKeys) {
+			c.Next()
 		}
+	}
+}
 
-		// Extract Bearer token
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			log.Println("Invalid Authorization header format")
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid authorization header"})
-			c.Abort()
-			return
-		}
+// authenticate validates the request's API key or Bearer token and stores
+// the user information in the context. On failure the request is aborted
+// with an error response and false is returned.
+func authenticate(c *gin.Context, aegisClient *core.AegisClient, apiKeys *core.APIKeys) bool {
+	if header := apiKeys.Header(); header != "" && c.GetHeader(header) != "" {
+		return authenticateAPIKey(c, apiKeys, c.GetHeader(header))
+	}
 
-		token := parts[1]
+	// Extract token from Authorization header
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		core.Logf(c, "Missing Authorization header")
+		ErrorJSON(c, http.StatusUnauthorized, "missing authorization token")
+		c.Abort()
+		return false
+	}
 
-		// Validate token with Aegis
-		resp, err := aegisClient.ValidateToken(token)
-		if err != nil {
-			log.Printf("Aegis validation error: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "authentication service unavailable"})
-			c.Abort()
-			return
-		}
+	// Extract Bearer token
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		core.Logf(c, "Invalid Authorization header format")
+		ErrorJSON(c, http.StatusUnauthorized, "invalid authorization header")
+		c.Abort()
+		return false
+	}
 
-		if !resp.Valid {
-			log.Printf("Invalid token: %s", resp.Error)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
-			c.Abort()
-			return
-		}
+	token := parts[1]
+
+	// Validate token with Aegis
+	_, span := core.StartSpan(c.Request.Context(), "auth", core.SpanKindInternal)
+	resp, err := aegisClient.ValidateToken(token)
+	if err != nil {
+		core.Logf(c, "Aegis validation error: %v", err)
+		span.SetError(err)
+		span.End()
+		ErrorJSON(c, http.StatusInternalServerError, "authentication service unavailable")
+		c.Abort()
+		return false
+	}
 
-		// Store user info in context for handlers
-		c.Set("user_id", resp.User.ID)
-		c.Set("user_subject", resp.User.Subject)
-		c.Set("user_roles", resp.User.Roles)
-		c.Set("user_permissions", resp.User.Permissions)
+	span.SetAttribute("auth.valid", resp.Valid)
+	span.End()
+	if !resp.Valid {
+		core.Logf(c, "Invalid token: %s", resp.Error)
+		ErrorJSON(c, http.StatusUnauthorized, "invalid or expired token")
+		c.Abort()
+		return false
+	}
+
+	// Store user info in context for handlers
+	c.Set("user_id", resp.User.ID)
+	c.Set("user_subject", resp.User.Subject)
+	c.Set("user_roles", resp.User.Roles)
+	c.Set("user_permissions", resp.User.Permissions)
+
+	core.Logf(c, "Authenticated user: %s (%s)", resp.User.Subject, resp.User.ID)
+	return true
+}
 
-		log.Printf("Authenticated user: %s (%s)", resp.User.Subject, resp.User.ID)
-		c.Next()
+// authenticateAPIKey validates an API key and stores its identity in the
+// context, like authenticate does for Aegis users.
+func authenticateAPIKey(c *gin.Context, apiKeys *core.APIKeys, secret string) bool {
+	key, err := apiKeys.Authenticate(secret)
+	if err != nil {
+		core.Logf(c, "API key rejected: %v", err)
+		ErrorJSON(c, http.StatusUnauthorized, "invalid or expired API key")
+		c.Abort()
+		return false
 	}
+
+	c.Set("user_id", "apikey:"+key.ID)
+	c.Set("user_subject", key.Name)
+	c.Set("user_roles", key.Roles)
+	c.Set("user_permissions", key.Permissions)
+
+	core.Logf(c, "Authenticated API key: %s (%s)", key.Name, key.ID)
+	return true
 }
 
 // RequireAdmin ensures the authenticated user has the "admin" role.
@@ -72,78 +111,84 @@ func AuthMiddleware(aegisClient *core.AegisClient) gin.HandlerFunc {
 // Returns 403 Forbidden if the user does not have admin role.
 func RequireAdmin() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		roles, exists := c.Get("user_roles")
-		if !exists {
-			log.Println("No roles found in context")
-			c.JSON(http.StatusForbidden, gin.H{"error": "no roles found"})
-			c.Abort()
-			return
+		if requireRole(c, []string{"admin"}, "admin access required") {
+			c.Next()
 		}
+	}
+}
 
-		userRoles, ok := roles.([]string)
-		if !ok {
-			log.Println("Invalid roles format in context")
-			c.JSON(http.StatusForbidden, gin.H{"error": "invalid roles format"})
-			c.Abort()
-			return
-		}
+// requireRole checks that the authenticated user has at least one of the
+// given roles. On failure the request is aborted with a 403 response, using
+// deniedMessage when the roles do not match, and false is returned.
+func requireRole(c *gin.Context, roles []string, deniedMessage string) bool {
+	userRoles, ok := contextStrings(c, "user_roles", "roles")
+	if !ok {
+		return false
+	}
 
-		isAdmin := false
-		for _, role := range userRoles {
-			if role == "admin" {
-				isAdmin = true
-				break
+	for _, role := range userRoles {
+		for _, allowed := range roles {
+			if role == allowed {
+				return true
 			}
 		}
-
-		if !isAdmin {
-			log.Println("Access denied: admin role required")
-			c.JSON(http.StatusForbidden, gin.H{"error": "admin access required"})
-			c.Abort()
-			return
-		}
-
-		c.Next()
 	}
+
+	core.Logf(c, "Access denied: one of roles %v required", roles)
+	ErrorJSON(c, http.StatusForbidden, deniedMessage)
+	c.Abort()
+	return false
 }
 
 // RequirePermission checks if the authenticated user has a specific permission.
 // This middleware must be used after AuthMiddleware.
 // Returns 403 Forbidden if the user does not have the required permission.
-// Note: This middleware is currently unused but kept for future fine-grained access control.
 func RequirePermission(permission string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		permissions, exists := c.Get("user_permissions")
-		if !exists {
-			log.Printf("No permissions found in context")
-			c.JSON(http.StatusForbidden, gin.H{"error": "no permissions found"})
-			c.Abort()
-			return
+		if requirePermission(c, permission) {
+			c.Next()
 		}
+	}
+}
 
-		userPerms, ok := permissions.([]string)
-		if !ok {
-			log.Println("Invalid permissions format in context")
-			c.JSON(http.StatusForbidden, gin.H{"error": "invalid permissions format"})
-			c.Abort()
-			return
-		}
+// requirePermission checks that the authenticated user has the permission.
+// On failure the request is aborted with a 403 response and false is returned.
+func requirePermission(c *gin.Context, permission string) bool {
+	userPerms, ok := contextStrings(c, "user_permissions", "permissions")
+	if !ok {
+		return false
+	}
 
-		hasPermission := false
-		for _, perm := range userPerms {
-			if perm == permission {
-				hasPermission = true
-				break
-			}
+	for _, perm := range userPerms {
+		if perm == permission {
+			return true
 		}
+	}
 
-		if !hasPermission {
-			log.Printf("Access denied: permission '%s' required", permission)
-			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
-			c.Abort()
-			return
-		}
+	core.Logf(c, "Access denied: permission '%s' required", permission)
+	ErrorJSON(c, http.StatusForbidden, "insufficient permissions")
+	c.Abort()
+	return false
+}
+
+// contextStrings reads a string list stored by authenticate. If it is
+// missing or malformed, the request is aborted with a 403 response naming
+// the list (e.g. "no roles found") and false is returned.
+func contextStrings(c *gin.Context, key, name string) ([]string, bool) {
+	value, exists := c.Get(key)
+	if !exists {
+		core.Logf(c, "No %s found in context", name)
+		ErrorJSON(c, http.StatusForbidden, "no "+name+" found")
+		c.Abort()
+		return nil, false
+	}
 
-		c.Next()
+	values, ok := value.([]string)
+	if !ok {
+		core.Logf(c, "Invalid %s format in context", name)
+		ErrorJSON(c, http.StatusForbidden, "invalid "+name+" format")
+		c.Abort()
+		return nil, false
 	}
+	return values, true
 }
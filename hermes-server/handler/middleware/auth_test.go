@@ -30,7 +30,7 @@ func TestAuthMiddleware_ValidToken(t *testing.T) {
 
 	// Create middleware
 	client := core.NewAegisClient(aegisServer.URL, 5*time.Second)
-	middleware := AuthMiddleware(client)
+	middleware := AuthMiddleware(client, nil)
 
 	// Setup Gin
 	gin.SetMode(gin.TestMode)
@@ -73,7 +73,7 @@ func TestAuthMiddleware_ValidToken(t *testing.T) {
 
 func TestAuthMiddleware_MissingToken(t *testing.T) {
 	client := core.NewAegisClient("http://localhost", 5*time.Second)
-	middleware := AuthMiddleware(client)
+	middleware := AuthMiddleware(client, nil)
 
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
@@ -99,7 +99,7 @@ func TestAuthMiddleware_MissingToken(t *testing.T) {
 
 func TestAuthMiddleware_InvalidHeaderFormat(t *testing.T) {
 	client := core.NewAegisClient("http://localhost", 5*time.Second)
-	middleware := AuthMiddleware(client)
+	middleware := AuthMiddleware(client, nil)
 
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
@@ -130,7 +130,7 @@ func TestAuthMiddleware_InvalidToken(t *testing.T) {
 	defer aegisServer.Close()
 
 	client := core.NewAegisClient(aegisServer.URL, 5*time.Second)
-	middleware := AuthMiddleware(client)
+	middleware := AuthMiddleware(client, nil)
 
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
@@ -152,7 +152,7 @@ func TestAuthMiddleware_InvalidToken(t *testing.T) {
 func TestAuthMiddleware_AegisDown(t *testing.T) {
 	// Use invalid URL to simulate Aegis being down
 	client := core.NewAegisClient("http://invalid-host:9999", 1*time.Second)
-	middleware := AuthMiddleware(client)
+	middleware := AuthMiddleware(client, nil)
 
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core"
+	"nfcunha/hermes/hermes-server/core/domain/limit"
+)
+
+// Rate limit headers set on responses of rate limited services.
+const (
+	RateLimitLimitHeader     = "X-RateLimit-Limit"
+	RateLimitRemainingHeader = "X-RateLimit-Remaining"
+	RateLimitResetHeader     = "X-RateLimit-Reset" // Seconds until the bucket is full again
+)
+
+// RateLimitMiddleware applies the rate limit of the routed service (see
+// core.RoutedService). It must run after RoutePolicyMiddleware, so that
+// user and API key limits can use the verified identity; callers of public
+// services are not authenticated and are limited by client IP instead.
+// Rejected requests get 429 with a Retry-After header.
+func RateLimitMiddleware(limiter *core.RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serviceName := core.RoutedService(c)
+		l := limiter.Get(serviceName)
+		if l.Unlimited() {
+			c.Next()
+			return
+		}
+
+		result := limiter.Allow(serviceName, rateLimitKey(c, l.Key))
+		header := c.Writer.Header()
+		header.Set(RateLimitLimitHeader, strconv.Itoa(result.Limit))
+		header.Set(RateLimitRemainingHeader, strconv.Itoa(result.Remaining))
+		header.Set(RateLimitResetHeader, strconv.Itoa(ceilSeconds(result.Reset)))
+
+		if !result.Allowed {
+			core.Logf(c, "Rate limit exceeded for %s", serviceName)
+			header.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			ErrorJSON(c, http.StatusTooManyRequests, "rate limit exceeded")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// rateLimitKey returns the bucket key of the caller for the given key type.
+// User and API key limits fall back to the client IP for callers without
+// such an identity.
+func rateLimitKey(c *gin.Context, keyType limit.KeyType) string {
+	userID := c.GetString("user_id")
+	switch keyType {
+	case limit.KeyService:
+		return "service"
+	case limit.KeyUser:
+		if userID != "" {
+			return "user:" + userID
+		}
+	case limit.KeyAPIKey:
+		if strings.HasPrefix(userID, "apikey:") {
+			return userID
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// ceilSeconds rounds a duration up to whole seconds.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
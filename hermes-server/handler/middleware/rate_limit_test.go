@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core"
+	"nfcunha/hermes/hermes-server/core/domain/limit"
+)
+
+// newRateLimitRouter creates a route endpoint limited by the given limiter.
+// The X-Test-User header stands in for an authenticated user.
+func newRateLimitRouter(limiter *core.RateLimiter) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	identify := func(c *gin.Context) {
+		if user := c.GetHeader("X-Test-User"); user != "" {
+			c.Set("user_id", user)
+		}
+		c.Next()
+	}
+	router.Any("/route/:serviceName/*path", identify, RateLimitMiddleware(limiter), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+// routeRequest sends a request to a service as the given user ("" for anonymous).
+func routeRequest(router *gin.Engine, service, user string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/route/"+service+"/", nil)
+	if user != "" {
+		req.Header.Set("X-Test-User", user)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitMiddleware_RejectsWithHeaders(t *testing.T) {
+	router := newRateLimitRouter(core.NewRateLimiter(nil, limit.RateLimit{RequestsPerSecond: 1, Burst: 1, Key: limit.KeyIP}))
+
+	w := routeRequest(router, "orders", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected first request to pass, got %d", w.Code)
+	}
+	if w.Header().Get(RateLimitLimitHeader) != "1" || w.Header().Get(RateLimitRemainingHeader) != "0" || w.Header().Get(RateLimitResetHeader) != "1" {
+		t.Errorf("Expected rate limit headers, got %v", w.Header())
+	}
+
+	w = routeRequest(router, "orders", "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if w.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected Retry-After of 1 second, got %q", w.Header().Get("Retry-After"))
+	}
+}
+
+func TestRateLimitMiddleware_Keys(t *testing.T) {
+	limiter := core.NewRateLimiter(nil, limit.RateLimit{})
+	limiter.Set(&limit.RateLimit{ServiceName: "per-user", RequestsPerSecond: 1, Key: limit.KeyUser})
+	limiter.Set(&limit.RateLimit{ServiceName: "per-key", RequestsPerSecond: 1, Key: limit.KeyAPIKey})
+	limiter.Set(&limit.RateLimit{ServiceName: "shared", RequestsPerSecond: 1, Key: limit.KeyService})
+	router := newRateLimitRouter(limiter)
+
+	tests := []struct {
+		name     string
+		service  string
+		first    string
+		second   string
+		expected int
+	}{
+		{name: "different users", service: "per-user", first: "alice", second: "bob", expected: http.StatusOK},
+		{name: "same user", service: "per-user", first: "carol", second: "carol", expected: http.StatusTooManyRequests},
+		{name: "different API keys", service: "per-key", first: "apikey:1", second: "apikey:2", expected: http.StatusOK},
+		{name: "users share the client IP", service: "per-key", first: "dave", second: "erin", expected: http.StatusTooManyRequests},
+		{name: "whole service", service: "shared", first: "alice", second: "bob", expected: http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		routeRequest(router, tt.service, tt.first)
+		if w := routeRequest(router, tt.service, tt.second); w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.expected, w.Code)
+		}
+	}
+}
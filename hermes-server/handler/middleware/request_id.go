@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"nfcunha/hermes/hermes-server/core"
+)
+
+// maxRequestIDLength bounds incoming request IDs so that oversized header
+// values are not copied into every log line.
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware assigns every request a correlation ID. An incoming ID
+// in the given header (e.g. X-Request-ID) is kept; otherwise a UUID is
+// generated. The ID is stored under core.RequestIDKey in the gin context and
+// in the request context (so it is forwarded to backends), and is echoed in
+// the response header.
+func RequestIDMiddleware(header string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(header)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+
+		c.Set(core.RequestIDKey, id)
+		c.Request = c.Request.WithContext(core.ContextWithRequestID(c.Request.Context(), header, id))
+		c.Header(header, id)
+		c.Next()
+	}
+}
+
+// validRequestID reports whether an incoming ID can be used as is: non-empty,
+// bounded in length and made of printable ASCII characters.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// ErrorJSON writes an error response body, including the request ID when one
+// was assigned: {"error": message, "request_id": id}.
+func ErrorJSON(c *gin.Context, status int, message string) {
+	body := gin.H{"error": message}
+	if id := c.GetString(core.RequestIDKey); id != "" {
+		body["request_id"] = id
+	}
+	c.JSON(status, body)
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"nfcunha/hermes/hermes-server/core"
+)
+
+// newRequestIDRouter creates a router whose handler fails with an error body
+func newRequestIDRouter(header string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestIDMiddleware(header))
+	router.GET("/fail", func(c *gin.Context) {
+		ErrorJSON(c, http.StatusBadRequest, "something went wrong")
+	})
+	return router
+}
+
+func TestRequestIDMiddleware_KeepsIncomingID(t *testing.T) {
+	router := newRequestIDRouter("X-Correlation-ID")
+
+	req := httptest.NewRequest("GET", "/fail", nil)
+	req.Header.Set("X-Correlation-ID", "abc-123")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if got := w.Header().Get("X-Correlation-ID"); got != "abc-123" {
+		t.Errorf("Expected incoming ID to be echoed, got %q", got)
+	}
+	var body map[string]string
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body["request_id"] != "abc-123" || body["error"] != "something went wrong" {
+		t.Errorf("Expected request ID in error body, got %v", body)
+	}
+}
+
+func TestRequestIDMiddleware_GeneratesID(t *testing.T) {
+	router := newRequestIDRouter("X-Request-ID")
+
+	tests := []struct {
+		name     string
+		incoming string
+	}{
+		{name: "missing", incoming: ""},
+		{name: "too long", incoming: strings.Repeat("a", maxRequestIDLength+1)},
+		{name: "control characters", incoming: "abc\x01def"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/fail", nil)
+		if tt.incoming != "" {
+			req.Header.Set("X-Request-ID", tt.incoming)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if _, err := uuid.Parse(w.Header().Get("X-Request-ID")); err != nil {
+			t.Errorf("%s: expected a generated UUID, got %q", tt.name, w.Header().Get("X-Request-ID"))
+		}
+	}
+}
+
+func TestRequestIDMiddleware_StoresIDInRequestContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestIDMiddleware("X-Request-ID"))
+
+	var fromContext, fromGin string
+	router.GET("/id", func(c *gin.Context) {
+		fromContext = core.RequestIDFromContext(c.Request.Context())
+		fromGin = c.GetString(core.RequestIDKey)
+	})
+
+	req := httptest.NewRequest("GET", "/id", nil)
+	req.Header.Set("X-Request-ID", "req-7")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if fromContext != "req-7" || fromGin != "req-7" {
+		t.Errorf("Expected request ID in both contexts, got %q and %q", fromContext, fromGin)
+	}
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core"
+	"nfcunha/hermes/hermes-server/core/domain/policy"
+)
+
+// Identity headers forwarded to backends of non-public services. Incoming
+// values are always removed, so backends can trust them.
+const (
+	UserIDHeader      = "X-Hermes-User-ID"
+	UserSubjectHeader = "X-Hermes-User-Subject"
+	UserRolesHeader   = "X-Hermes-User-Roles" // Comma-separated
+)
+
+// RoutePolicyMiddleware enforces the access policy of the routed service
+// (see core.RoutedService). Public services are called anonymously; other
+// services require a valid token and, depending on the policy, one of its
+// roles or all of its permissions. The verified identity is forwarded to the
+// backend in the identity headers. API keys are never forwarded.
+func RoutePolicyMiddleware(policies *core.RoutePolicyStore, aegisClient *core.AegisClient, apiKeys *core.APIKeys) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Header.Del(UserIDHeader)
+		c.Request.Header.Del(UserSubjectHeader)
+		c.Request.Header.Del(UserRolesHeader)
+
+		p := policies.Get(core.RoutedService(c))
+		if p.Access != policy.AccessPublic {
+			if !authenticate(c, aegisClient, apiKeys) {
+				return
+			}
+			switch p.Access {
+			case policy.AccessRoles:
+				if !requireRole(c, p.Roles, "insufficient role") {
+					return
+				}
+			case policy.AccessPermissions:
+				for _, permission := range p.Permissions {
+					if !requirePermission(c, permission) {
+						return
+					}
+				}
+			}
+
+			c.Request.Header.Set(UserIDHeader, c.GetString("user_id"))
+			c.Request.Header.Set(UserSubjectHeader, c.GetString("user_subject"))
+			c.Request.Header.Set(UserRolesHeader, strings.Join(c.GetStringSlice("user_roles"), ","))
+		}
+
+		if header := apiKeys.Header(); header != "" {
+			c.Request.Header.Del(header)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core"
+	"nfcunha/hermes/hermes-server/core/domain/policy"
+)
+
+// newRoutePolicyRouter creates a route endpoint guarded by the given policies
+// whose handler echoes the identity headers it receives. The mock Aegis
+// accepts any token for a user with the "ops" role and "orders:read".
+func newRoutePolicyRouter(t *testing.T, policies ...*policy.RoutePolicy) *gin.Engine {
+	aegisServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(core.ValidateTokenResponse{
+			Valid: true,
+			User: &core.AegisUser{
+				ID:          "123",
+				Subject:     "ops@test.com",
+				Roles:       []string{"ops", "user"},
+				Permissions: []string{"orders:read"},
+			},
+		})
+	}))
+	t.Cleanup(aegisServer.Close)
+
+	store := core.NewRoutePolicyStore(nil, policy.AccessPublic)
+	for _, p := range policies {
+		if err := store.Set(p); err != nil {
+			t.Fatalf("Failed to set policy: %v", err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	client := core.NewAegisClient(aegisServer.URL, 5*time.Second)
+	router.Any("/route/:serviceName/*path", RoutePolicyMiddleware(store, client, nil), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"user_id": c.GetHeader(UserIDHeader),
+			"subject": c.GetHeader(UserSubjectHeader),
+			"roles":   c.GetHeader(UserRolesHeader),
+		})
+	})
+	return router
+}
+
+func TestRoutePolicyMiddleware_PublicStripsIdentityHeaders(t *testing.T) {
+	router := newRoutePolicyRouter(t)
+
+	req := httptest.NewRequest("GET", "/route/orders/list", nil)
+	req.Header.Set(UserIDHeader, "spoofed")
+	req.Header.Set(UserRolesHeader, "admin")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var body map[string]string
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body["user_id"] != "" || body["roles"] != "" {
+		t.Errorf("Expected client identity headers to be removed, got %v", body)
+	}
+}
+
+func TestRoutePolicyMiddleware_ForwardsIdentity(t *testing.T) {
+	router := newRoutePolicyRouter(t, &policy.RoutePolicy{ServiceName: "orders", Access: policy.AccessAuthenticated})
+
+	req := httptest.NewRequest("GET", "/route/orders/list", nil)
+	req.Header.Set("Authorization", "Bearer valid-token")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var body map[string]string
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body["user_id"] != "123" || body["subject"] != "ops@test.com" || body["roles"] != "ops,user" {
+		t.Errorf("Expected verified identity headers, got %v", body)
+	}
+}
+
+func TestRoutePolicyMiddleware_EnforcesPolicies(t *testing.T) {
+	router := newRoutePolicyRouter(t,
+		&policy.RoutePolicy{ServiceName: "orders", Access: policy.AccessAuthenticated},
+		&policy.RoutePolicy{ServiceName: "ops-tools", Access: policy.AccessRoles, Roles: []string{"admin", "ops"}},
+		&policy.RoutePolicy{ServiceName: "billing", Access: policy.AccessRoles, Roles: []string{"admin"}},
+		&policy.RoutePolicy{ServiceName: "reports", Access: policy.AccessPermissions, Permissions: []string{"orders:read"}},
+		&policy.RoutePolicy{ServiceName: "ledger", Access: policy.AccessPermissions, Permissions: []string{"orders:read", "ledger:write"}},
+	)
+
+	tests := []struct {
+		name     string
+		service  string
+		token    bool
+		expected int
+	}{
+		{name: "authenticated without token", service: "orders", token: false, expected: http.StatusUnauthorized},
+		{name: "one of the roles", service: "ops-tools", token: true, expected: http.StatusOK},
+		{name: "missing role", service: "billing", token: true, expected: http.StatusForbidden},
+		{name: "all permissions", service: "reports", token: true, expected: http.StatusOK},
+		{name: "missing permission", service: "ledger", token: true, expected: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/route/"+tt.service+"/", nil)
+		if tt.token {
+			req.Header.Set("Authorization", "Bearer valid-token")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.expected, w.Code)
+		}
+	}
+}
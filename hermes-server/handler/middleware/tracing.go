@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core"
+)
+
+// TracingMiddleware starts a server span for every request, continuing the
+// trace from the incoming W3C traceparent/tracestate headers when present.
+// The span is stored in the request context so later spans (auth, routing,
+// backend calls) become its children. A nil tracer disables tracing.
+func TracingMiddleware(tracer *core.Tracer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if tracer == nil {
+			c.Next()
+			return
+		}
+
+		name := c.Request.Method
+		if route := c.FullPath(); route != "" {
+			name += " " + route
+		}
+		ctx, span := tracer.StartServerSpan(c.Request.Context(), c.Request.Header, name)
+		span.SetAttribute("http.request.method", c.Request.Method)
+		span.SetAttribute("url.path", c.Request.URL.Path)
+		if route := c.FullPath(); route != "" {
+			span.SetAttribute("http.route", route)
+		}
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttribute("http.response.status_code", status)
+		if status >= http.StatusInternalServerError {
+			span.SetError(errors.New("HTTP " + strconv.Itoa(status)))
+		}
+		span.End()
+	}
+}
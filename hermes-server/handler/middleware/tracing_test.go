@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core"
+)
+
+func TestTracingMiddleware_ContinuesIncomingTrace(t *testing.T) {
+	// The collector is never reached: the tracer is not started and spans stay queued
+	tracer := core.NewTracer(core.TracingConfig{Endpoint: "http://127.0.0.1:1", ServiceName: "hermes", BatchSize: 10, FlushInterval: time.Hour})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(TracingMiddleware(tracer))
+
+	var traceID string
+	router.GET("/traced", func(c *gin.Context) {
+		span := core.SpanFromContext(c.Request.Context())
+		if span == nil {
+			t.Fatal("Expected server span in request context")
+		}
+		id := span.Context().TraceID
+		traceID = hex.EncodeToString(id[:])
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest("GET", "/traced", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if traceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected incoming trace to be continued, got trace ID %s", traceID)
+	}
+}
+
+func TestTracingMiddleware_NilTracer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(TracingMiddleware(nil))
+	router.GET("/untraced", func(c *gin.Context) {
+		if core.SpanFromContext(c.Request.Context()) != nil {
+			t.Error("Expected no span when tracing is disabled")
+		}
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/untraced", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+}
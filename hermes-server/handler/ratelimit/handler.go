@@ -0,0 +1,126 @@
+// Package ratelimit provides HTTP handlers for managing the rate limits of
+// routed services.
+package ratelimit
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core"
+	"nfcunha/hermes/hermes-server/core/domain/limit"
+	"nfcunha/hermes/hermes-server/handler/middleware"
+)
+
+// Handler manages rate limits
+type Handler struct {
+	limiter *core.RateLimiter
+}
+
+// NewHandler creates a new rate limit handler
+func NewHandler(limiter *core.RateLimiter) *Handler {
+	return &Handler{
+		limiter: limiter,
+	}
+}
+
+// RegisterRoutes registers the rate limit endpoints. All of them require
+// authentication and admin privileges.
+// Routes:
+//   - GET    /rate-limits               - List limits and the default limit
+//   - GET    /rate-limits/:serviceName  - Get the effective limit and buckets of a service
+//   - PUT    /rate-limits/:serviceName  - Set the limit of a service
+//   - DELETE /rate-limits/:serviceName  - Revert a service to the default limit
+func (h *Handler) RegisterRoutes(router gin.IRouter, authMiddleware, adminMiddleware gin.HandlerFunc) {
+	limits := router.Group("/rate-limits")
+	limits.Use(authMiddleware, adminMiddleware)
+	{
+		limits.GET("", h.handleListLimits)
+		limits.GET("/:serviceName", h.handleGetLimit)
+		limits.PUT("/:serviceName", h.handleSetLimit)
+		limits.DELETE("/:serviceName", h.handleDeleteLimit)
+	}
+}
+
+// SetLimitRequest represents the payload for setting a rate limit.
+// A requests_per_second of 0 disables limiting for the service; a burst of 0
+// defaults to requests_per_second rounded up. Key defaults to "ip".
+type SetLimitRequest struct {
+	RequestsPerSecond float64       `json:"requests_per_second"`
+	Burst             int           `json:"burst"`
+	Key               limit.KeyType `json:"key"`
+}
+
+// handleListLimits returns all explicitly set limits
+func (h *Handler) handleListLimits(c *gin.Context) {
+	defaults := h.limiter.Default()
+	c.JSON(http.StatusOK, gin.H{
+		"default": gin.H{
+			"requests_per_second": defaults.RequestsPerSecond,
+			"burst":               defaults.Burst,
+			"key":                 defaults.Key,
+		},
+		"limits": h.limiter.List(),
+	})
+}
+
+// handleGetLimit returns the limit applied to a service, which is the
+// default one if none was set, and the current state of its buckets
+func (h *Handler) handleGetLimit(c *gin.Context) {
+	serviceName := c.Param("serviceName")
+	buckets := h.limiter.Buckets(serviceName)
+	c.JSON(http.StatusOK, gin.H{
+		"limit":   h.limiter.Get(serviceName),
+		"buckets": buckets,
+		"count":   len(buckets),
+	})
+}
+
+// handleSetLimit creates or replaces the limit of a service
+func (h *Handler) handleSetLimit(c *gin.Context) {
+	var req SetLimitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.ErrorJSON(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Key == "" {
+		req.Key = limit.KeyIP
+	}
+
+	l := &limit.RateLimit{
+		ServiceName:       c.Param("serviceName"),
+		RequestsPerSecond: req.RequestsPerSecond,
+		Burst:             req.Burst,
+		Key:               req.Key,
+	}
+	if err := l.Validate(); err != nil {
+		middleware.ErrorJSON(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.limiter.Set(l); err != nil {
+		status := http.StatusInternalServerError
+		if err.Error() == "rate limit is managed by the route config file" {
+			status = http.StatusConflict
+		}
+		middleware.ErrorJSON(c, status, err.Error())
+		return
+	}
+
+	core.Logf(c, "Rate limit for %s set to %v/s", l.ServiceName, l.RequestsPerSecond)
+	c.JSON(http.StatusOK, l)
+}
+
+// handleDeleteLimit removes the limit of a service
+func (h *Handler) handleDeleteLimit(c *gin.Context) {
+	serviceName := c.Param("serviceName")
+	if err := h.limiter.Delete(serviceName); err != nil {
+		status := http.StatusNotFound
+		if err.Error() == "rate limit is managed by the route config file" {
+			status = http.StatusConflict
+		}
+		middleware.ErrorJSON(c, status, err.Error())
+		return
+	}
+
+	core.Logf(c, "Rate limit for %s removed", serviceName)
+	c.JSON(http.StatusOK, gin.H{"message": "rate limit removed"})
+}
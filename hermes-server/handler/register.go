@@ -8,9 +8,16 @@ import (
 	"nfcunha/hermes/hermes-server/core"
 	"nfcunha/hermes/hermes-server/core/domain/healthlog"
 	"nfcunha/hermes/hermes-server/database"
+	"nfcunha/hermes/hermes-server/handler/apikey"
+	"nfcunha/hermes/hermes-server/handler/metrics"
 	"nfcunha/hermes/hermes-server/handler/middleware"
+	"nfcunha/hermes/hermes-server/handler/ratelimit"
 	"nfcunha/hermes/hermes-server/handler/route"
+	"nfcunha/hermes/hermes-server/handler/routepolicy"
+	"nfcunha/hermes/hermes-server/handler/routetable"
 	"nfcunha/hermes/hermes-server/handler/service"
+	"nfcunha/hermes/hermes-server/handler/trafficmirror"
+	"nfcunha/hermes/hermes-server/handler/trafficsplit"
 	"nfcunha/hermes/hermes-server/handler/user"
 )
 
@@ -19,12 +26,21 @@ func CORSMiddleware() gin.HandlerFunc {
 	return middleware.CORSMiddleware()
 }
 
-// RegisterRoutes sets up all API routes under /hermes context path.
-// It creates handlers for user management, service management, and routing.
-func RegisterRoutes(engine *gin.Engine, prx *core.ProxyService, reg *core.ServiceRegistry, aegisClient *core.AegisClient, aegisURL string) {
-	// Create routing service
-	routingService := core.NewRoutingService(reg, prx)
+// TracingMiddleware exposes the tracing middleware from the middleware package.
+func TracingMiddleware(tracer *core.Tracer) gin.HandlerFunc {
+	return middleware.TracingMiddleware(tracer)
+}
+
+// RequestIDMiddleware exposes the request ID middleware from the middleware package.
+func RequestIDMiddleware(header string) gin.HandlerFunc {
+	return middleware.RequestIDMiddleware(header)
+}
 
+// RegisterRoutes sets up all API routes under /hermes context path.
+// It creates handlers for user management, service management, route policies,
+// API keys, rate limits, the route table, traffic splits and mirrors,
+// routing, and metrics. Requests outside /hermes are routed with the route table.
+func RegisterRoutes(engine *gin.Engine, routingService *core.RoutingService, reg *core.ServiceRegistry, drainer *core.DrainManager, breaker *core.CircuitBreaker, concurrency *core.ConcurrencyLimiter, aegisClient *core.AegisClient, aegisURL string, m *core.Metrics, accessLogger *core.AccessLogger, policies *core.RoutePolicyStore, tokens *core.RegistrationTokens, apiKeys *core.APIKeys, limiter *core.RateLimiter, table *core.RouteTable, splitter *core.TrafficSplitter, mirrors *core.TrafficMirror) {
 	// Create health log repository
 	healthLogRepo := healthlog.NewRepository(database.GetDB())
 
@@ -34,8 +50,12 @@ func RegisterRoutes(engine *gin.Engine, prx *core.ProxyService, reg *core.Servic
 		// Health check endpoint (public)
 		hermes.GET("/health", handleHealth)
 
+		// Prometheus metrics endpoint (public)
+		metricsHandler := metrics.NewHandler(m, reg)
+		metricsHandler.RegisterRoutes(hermes)
+
 		// Authentication middleware (used for protected routes)
-		authMiddleware := middleware.AuthMiddleware(aegisClient)
+		authMiddleware := middleware.AuthMiddleware(aegisClient, apiKeys)
 		adminMiddleware := middleware.RequireAdmin()
 
 		// User management handler (Phase 5)
@@ -45,12 +65,47 @@ func RegisterRoutes(engine *gin.Engine, prx *core.ProxyService, reg *core.Servic
 
 		// Service management handler (Phase 4)
 		// Handles service registration, health checks, and lifecycle
-		service.RegisterRoutes(hermes, reg, healthLogRepo, authMiddleware, adminMiddleware)
+		service.RegisterRoutes(hermes, reg, drainer, breaker, concurrency, healthLogRepo, tokens, authMiddleware, adminMiddleware)
+
+		// Route policy handler
+		// Manages who may call each service through the route endpoint
+		policyHandler := routepolicy.NewHandler(policies)
+		policyHandler.RegisterRoutes(hermes, authMiddleware, adminMiddleware)
+
+		// API key handler
+		// Manages the API keys of machine clients
+		apiKeyHandler := apikey.NewHandler(apiKeys)
+		apiKeyHandler.RegisterRoutes(hermes, authMiddleware, adminMiddleware)
+
+		// Rate limit handler
+		// Manages how fast clients may call each service through the route endpoint
+		rateLimitHandler := ratelimit.NewHandler(limiter)
+		rateLimitHandler.RegisterRoutes(hermes, authMiddleware, adminMiddleware)
+
+		// Route table handler
+		// Manages the rules routing requests at the gateway root
+		routeTableHandler := routetable.NewHandler(table)
+		routeTableHandler.RegisterRoutes(hermes, authMiddleware, adminMiddleware)
+
+		// Traffic split handler
+		// Manages the weighted variants of services for canary releases
+		trafficSplitHandler := trafficsplit.NewHandler(splitter)
+		trafficSplitHandler.RegisterRoutes(hermes, authMiddleware, adminMiddleware)
+
+		// Traffic mirror handler
+		// Manages the copies of requests sent to other services
+		trafficMirrorHandler := trafficmirror.NewHandler(mirrors)
+		trafficMirrorHandler.RegisterRoutes(hermes, authMiddleware, adminMiddleware)
 
 		// Service routing handler (Phase 3)
-		// Handles dynamic request routing to registered services
-		routeHandler := route.NewHandler(routingService)
-		routeHandler.RegisterRoutes(hermes)
+		// Handles dynamic request routing to registered services, by name
+		// under /hermes/route and by route rule at the gateway root
+		accessLogMiddleware := middleware.AccessLogMiddleware(accessLogger)
+		policyMiddleware := middleware.RoutePolicyMiddleware(policies, aegisClient, apiKeys)
+		rateLimitMiddleware := middleware.RateLimitMiddleware(limiter)
+		routeHandler := route.NewHandler(routingService, table)
+		routeHandler.RegisterRoutes(hermes, accessLogMiddleware, policyMiddleware, rateLimitMiddleware)
+		routeHandler.RegisterRootRoutes(engine, accessLogMiddleware, policyMiddleware, rateLimitMiddleware)
 	}
 }
 
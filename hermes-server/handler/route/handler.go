@@ -1,29 +1,50 @@
 package route
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"nfcunha/hermes/hermes-server/core"
+	"nfcunha/hermes/hermes-server/core/domain/routerule"
+	"nfcunha/hermes/hermes-server/handler/middleware"
 )
 
+// routeRuleKey is the context key holding the route rule matched by a request.
+const routeRuleKey = "route_rule"
+
 // Handler manages dynamic routing to registered services
 type Handler struct {
 	routingService *core.RoutingService
+	table          *core.RouteTable
 }
 
-// NewHandler creates a new routing handler
-func NewHandler(routingService *core.RoutingService) *Handler {
+// NewHandler creates a new routing handler. The route table maps requests
+// at the gateway root to services.
+func NewHandler(routingService *core.RoutingService, table *core.RouteTable) *Handler {
 	return &Handler{
 		routingService: routingService,
+		table:          table,
 	}
 }
 
 // RegisterRoutes registers routing endpoints
-// Routes all requests matching /route/{serviceName}/*path to registered services
-func (h *Handler) RegisterRoutes(router gin.IRouter) {
+// Routes all requests matching /route/{serviceName}/*path to registered services.
+// Routed requests pass through the access log middleware, the policy
+// middleware enforcing the service's access policy, then the rate limit
+// middleware.
+func (h *Handler) RegisterRoutes(router gin.IRouter, accessLogMiddleware, policyMiddleware, rateLimitMiddleware gin.HandlerFunc) {
 	// Service routing proxy - /route/{serviceName}/*path
-	router.Any("/route/:serviceName/*path", h.handleRouteToService)
+	router.Any("/route/:serviceName/*path", accessLogMiddleware, policyMiddleware, rateLimitMiddleware, h.handleRouteToService)
+}
+
+// RegisterRootRoutes serves the route table at the gateway root: requests
+// that match no other route are matched against the route table and routed
+// to the service of the first matching rule, through the same middlewares as
+// the route endpoint. Requests under /hermes are never matched.
+func (h *Handler) RegisterRootRoutes(engine *gin.Engine, accessLogMiddleware, policyMiddleware, rateLimitMiddleware gin.HandlerFunc) {
+	engine.NoRoute(h.matchRule, accessLogMiddleware, policyMiddleware, rateLimitMiddleware, h.handleRouteRule)
 }
 
 // handleRouteToService proxies requests to registered services
@@ -40,11 +61,69 @@ func (h *Handler) handleRouteToService(c *gin.Context) {
 	// Route request through the routing service
 	err := h.routingService.RouteToService(c, serviceName, path)
 	if err != nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error":   "service unavailable",
-			"service": serviceName,
-			"message": err.Error(),
-		})
+		respondRouteError(c, serviceName, err)
+	}
+}
+
+// matchRule finds the route rule of a request at the gateway root and
+// records its service for the middlewares that follow, and the instance
+// subset its subset headers select for the routing service. Requests
+// matching no rule get 404.
+func (h *Handler) matchRule(c *gin.Context) {
+	path := c.Request.URL.Path
+	if path == "/hermes" || strings.HasPrefix(path, "/hermes/") {
+		middleware.ErrorJSON(c, http.StatusNotFound, "not found")
+		c.Abort()
 		return
 	}
+
+	rule := h.table.Match(c.Request)
+	if rule == nil {
+		middleware.ErrorJSON(c, http.StatusNotFound, "no route matches the request")
+		c.Abort()
+		return
+	}
+
+	core.Logf(c, "Request matched route rule %s", rule.Name)
+	c.Set(core.RoutedServiceKey, rule.ServiceName)
+	c.Set(routeRuleKey, rule)
+	if subset := rule.Subset(c.Request); subset != nil {
+		c.Set(core.SubsetKey, subset)
+	}
+	c.Next()
+}
+
+// handleRouteRule proxies a request matched by a route rule to the rule's
+// service, with the rule's path rewrite applied.
+// Example: rule {path_prefix: /api, strip_prefix: true, service_name: users}
+// sends /api/users/123 -> http://users-host:port/users/123
+func (h *Handler) handleRouteRule(c *gin.Context) {
+	rule := c.MustGet(routeRuleKey).(*routerule.Rule)
+
+	err := h.routingService.RouteToService(c, rule.ServiceName, rule.TargetPath(c.Request.URL.Path))
+	if err != nil {
+		respondRouteError(c, rule.ServiceName, err)
+	}
+}
+
+// respondRouteError reports a request that could not be routed to a service.
+func respondRouteError(c *gin.Context, serviceName string, err error) {
+	// A streamed response may already be partially written, and a client
+	// that went away gets no response
+	if c.Writer.Written() || errors.Is(err, core.ErrClientCanceled) {
+		return
+	}
+	status, reason := http.StatusServiceUnavailable, "service unavailable"
+	if errors.Is(err, core.ErrInvalidSubset) {
+		status, reason = http.StatusBadRequest, "bad request"
+	}
+	body := gin.H{
+		"error":   reason,
+		"service": serviceName,
+		"message": err.Error(),
+	}
+	if id := c.GetString(core.RequestIDKey); id != "" {
+		body["request_id"] = id
+	}
+	c.JSON(status, body)
 }
@@ -0,0 +1,107 @@
+package route
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/mattn/go-sqlite3"
+	"nfcunha/hermes/hermes-server/core"
+	"nfcunha/hermes/hermes-server/core/domain/routerule"
+	"nfcunha/hermes/hermes-server/core/domain/service"
+	"nfcunha/hermes/hermes-server/database"
+)
+
+// setupTestDB creates an in-memory SQLite database for testing
+func setupTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+
+	// Create schema using the real migrations
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	return db
+}
+
+// passthrough stands in for the access log, policy and rate limit middlewares
+func passthrough(c *gin.Context) {
+	c.Next()
+}
+
+func TestRootRoutes_RouteTable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB(t)
+	defer db.Close()
+
+	var gotPath string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.RequestURI()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	reg := core.NewServiceRegistry(db)
+	u, _ := url.Parse(backend.URL)
+	port, _ := strconv.Atoi(u.Port())
+	if err := reg.Register(service.NewService("users", u.Hostname(), port, "/health")); err != nil {
+		t.Fatalf("Failed to register backend: %v", err)
+	}
+
+	table := core.NewRouteTable(db)
+	if err := table.Set(&routerule.Rule{Name: "users", PathPrefix: "/api/users", StripPrefix: true, ServiceName: "users"}); err != nil {
+		t.Fatalf("Failed to set rule: %v", err)
+	}
+
+	routing := core.NewRoutingService(reg, core.NewProxyService(5*time.Second, 0), core.NewInFlightTracker(),
+		core.NewCircuitBreaker(core.BreakerConfig{FailureThreshold: 5, OpenDuration: time.Second, HalfOpenRequests: 1}),
+		core.NewOutlierDetector(core.OutlierConfig{}, nil), nil, nil, nil, nil, core.RetryPolicy{Attempts: 1}, core.SubsetConfig{})
+
+	var routedService string
+	captureService := func(c *gin.Context) {
+		routedService = core.RoutedService(c)
+		c.Next()
+	}
+
+	router := gin.New()
+	h := NewHandler(routing, table)
+	h.RegisterRoutes(router.Group("/hermes"), passthrough, captureService, passthrough)
+	h.RegisterRootRoutes(router, passthrough, captureService, passthrough)
+
+	// Matched at the root, with the prefix stripped
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/users/42?fields=name", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if gotPath != "/42?fields=name" {
+		t.Errorf("Expected backend path /42?fields=name, got %s", gotPath)
+	}
+	if routedService != "users" {
+		t.Errorf("Expected middlewares to see service users, got %q", routedService)
+	}
+
+	// The route endpoint still routes by name
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/hermes/route/users/profile", nil))
+	if w.Code != http.StatusOK || gotPath != "/profile" {
+		t.Errorf("Expected the route endpoint to reach /profile, got %d %s", w.Code, gotPath)
+	}
+
+	// Unmatched requests and unknown management paths get 404
+	for _, path := range []string{"/other", "/hermes/api/users/42"} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Package routepolicy provides HTTP handlers for managing the access policies
+// of routed services.
+package routepolicy
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core"
+	"nfcunha/hermes/hermes-server/core/domain/policy"
+	"nfcunha/hermes/hermes-server/handler/middleware"
+)
+
+// Handler manages route policies
+type Handler struct {
+	policies *core.RoutePolicyStore
+}
+
+// NewHandler creates a new route policy handler
+func NewHandler(policies *core.RoutePolicyStore) *Handler {
+	return &Handler{
+		policies: policies,
+	}
+}
+
+// RegisterRoutes registers the route policy endpoints. All of them require
+// authentication and admin privileges.
+// Routes:
+//   - GET    /route-policies               - List policies and the default access
+//   - GET    /route-policies/:serviceName  - Get the effective policy of a service
+//   - PUT    /route-policies/:serviceName  - Set the policy of a service
+//   - DELETE /route-policies/:serviceName  - Revert a service to the default access
+func (h *Handler) RegisterRoutes(router gin.IRouter, authMiddleware, adminMiddleware gin.HandlerFunc) {
+	policies := router.Group("/route-policies")
+	policies.Use(authMiddleware, adminMiddleware)
+	{
+		policies.GET("", h.handleListPolicies)
+		policies.GET("/:serviceName", h.handleGetPolicy)
+		policies.PUT("/:serviceName", h.handleSetPolicy)
+		policies.DELETE("/:serviceName", h.handleDeletePolicy)
+	}
+}
+
+// SetPolicyRequest represents the payload for setting a route policy.
+// Roles are required for "roles" access (any one of them grants access) and
+// permissions for "permissions" access (all of them are required).
+type SetPolicyRequest struct {
+	Access      policy.Access `json:"access" binding:"required"`
+	Roles       []string      `json:"roles"`
+	Permissions []string      `json:"permissions"`
+}
+
+// handleListPolicies returns all explicitly set policies
+func (h *Handler) handleListPolicies(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"default_access": h.policies.DefaultAccess(),
+		"policies":       h.policies.List(),
+	})
+}
+
+// handleGetPolicy returns the policy applied to a service, which is the
+// default one if none was set
+func (h *Handler) handleGetPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, h.policies.Get(c.Param("serviceName")))
+}
+
+// handleSetPolicy creates or replaces the policy of a service
+func (h *Handler) handleSetPolicy(c *gin.Context) {
+	var req SetPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.ErrorJSON(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	p := &policy.RoutePolicy{
+		ServiceName: c.Param("serviceName"),
+		Access:      req.Access,
+		Roles:       req.Roles,
+		Permissions: req.Permissions,
+	}
+	if err := p.Validate(); err != nil {
+		middleware.ErrorJSON(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.policies.Set(p); err != nil {
+		status := http.StatusInternalServerError
+		if err.Error() == "route policy is managed by the route config file" {
+			status = http.StatusConflict
+		}
+		middleware.ErrorJSON(c, status, err.Error())
+		return
+	}
+
+	core.Logf(c, "Route policy for %s set to %s", p.ServiceName, p.Access)
+	c.JSON(http.StatusOK, p)
+}
+
+// handleDeletePolicy removes the policy of a service
+func (h *Handler) handleDeletePolicy(c *gin.Context) {
+	serviceName := c.Param("serviceName")
+	if err := h.policies.Delete(serviceName); err != nil {
+		status := http.StatusNotFound
+		if err.Error() == "route policy is managed by the route config file" {
+			status = http.StatusConflict
+		}
+		middleware.ErrorJSON(c, status, err.Error())
+		return
+	}
+
+	core.Logf(c, "Route policy for %s removed", serviceName)
+	c.JSON(http.StatusOK, gin.H{"message": "route policy removed"})
+}
@@ -0,0 +1,132 @@
+// Package routetable provides HTTP handlers for managing the route rules
+// served at the gateway root.
+package routetable
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core"
+	"nfcunha/hermes/hermes-server/core/domain/routerule"
+	"nfcunha/hermes/hermes-server/handler/middleware"
+)
+
+// Handler manages route rules
+type Handler struct {
+	table *core.RouteTable
+}
+
+// NewHandler creates a new route table handler
+func NewHandler(table *core.RouteTable) *Handler {
+	return &Handler{
+		table: table,
+	}
+}
+
+// RegisterRoutes registers the route table endpoints. All of them require
+// authentication and admin privileges.
+// Routes:
+//   - GET    /routes        - List rules in match order
+//   - GET    /routes/:name  - Get a rule
+//   - PUT    /routes/:name  - Create or replace a rule
+//   - DELETE /routes/:name  - Remove a rule
+func (h *Handler) RegisterRoutes(router gin.IRouter, authMiddleware, adminMiddleware gin.HandlerFunc) {
+	routes := router.Group("/routes")
+	routes.Use(authMiddleware, adminMiddleware)
+	{
+		routes.GET("", h.handleListRules)
+		routes.GET("/:name", h.handleGetRule)
+		routes.PUT("/:name", h.handleSetRule)
+		routes.DELETE("/:name", h.handleDeleteRule)
+	}
+}
+
+// SetRuleRequest represents the payload for setting a route rule. A rule
+// needs hosts, path_prefix or path_regex; the other conditions are optional.
+type SetRuleRequest struct {
+	Priority      int               `json:"priority"`
+	Hosts         []string          `json:"hosts"`
+	PathPrefix    string            `json:"path_prefix"`
+	PathRegex     string            `json:"path_regex"`
+	Methods       []string          `json:"methods"`
+	Headers       map[string]string `json:"headers"`
+	ServiceName   string            `json:"service_name" binding:"required"`
+	StripPrefix   bool              `json:"strip_prefix"`
+	Rewrite       string            `json:"rewrite"`
+	SubsetHeaders map[string]string `json:"subset_headers"`
+}
+
+// handleListRules returns all rules in the order they are matched
+func (h *Handler) handleListRules(c *gin.Context) {
+	rules := h.table.List()
+	c.JSON(http.StatusOK, gin.H{
+		"routes": rules,
+		"count":  len(rules),
+	})
+}
+
+// handleGetRule returns a rule by name
+func (h *Handler) handleGetRule(c *gin.Context) {
+	rule, err := h.table.Get(c.Param("name"))
+	if err != nil {
+		middleware.ErrorJSON(c, http.StatusNotFound, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// handleSetRule creates or replaces a rule
+func (h *Handler) handleSetRule(c *gin.Context) {
+	var req SetRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.ErrorJSON(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rule := &routerule.Rule{
+		Name:          c.Param("name"),
+		Priority:      req.Priority,
+		Hosts:         req.Hosts,
+		PathPrefix:    req.PathPrefix,
+		PathRegex:     req.PathRegex,
+		Methods:       req.Methods,
+		Headers:       req.Headers,
+		ServiceName:   req.ServiceName,
+		StripPrefix:   req.StripPrefix,
+		Rewrite:       req.Rewrite,
+		SubsetHeaders: req.SubsetHeaders,
+	}
+	if err := rule.Validate(); err != nil {
+		middleware.ErrorJSON(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.table.Set(rule); err != nil {
+		status := http.StatusInternalServerError
+		if err.Error() == "route rule is managed by the route config file" {
+			status = http.StatusConflict
+		}
+		middleware.ErrorJSON(c, status, err.Error())
+		return
+	}
+
+	core.Logf(c, "Route rule %s set to %s", rule.Name, rule.ServiceName)
+	c.JSON(http.StatusOK, rule)
+}
+
+// handleDeleteRule removes a rule
+func (h *Handler) handleDeleteRule(c *gin.Context) {
+	name := c.Param("name")
+	if err := h.table.Delete(name); err != nil {
+		status := http.StatusNotFound
+		if err.Error() == "route rule is managed by the route config file" {
+			status = http.StatusConflict
+		} else if err.Error() == "failed to delete route rule" {
+			status = http.StatusInternalServerError
+		}
+		middleware.ErrorJSON(c, status, err.Error())
+		return
+	}
+
+	core.Logf(c, "Route rule %s removed", name)
+	c.JSON(http.StatusOK, gin.H{"message": "route rule removed"})
+}
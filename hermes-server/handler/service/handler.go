@@ -2,9 +2,11 @@
 package service
 
 import (
-	"io"
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -13,38 +15,60 @@ import (
 	"nfcunha/hermes/hermes-server/core"
 	"nfcunha/hermes/hermes-server/core/domain/healthlog"
 	"nfcunha/hermes/hermes-server/core/domain/service"
+	"nfcunha/hermes/hermes-server/handler/middleware"
 )
 
 // Handler manages service registration and lifecycle.
 // It handles HTTP requests for service registration, deregistration, and health checks.
 type Handler struct {
 	registry      *core.ServiceRegistry
-	healthClient  *http.Client
+	drainer       *core.DrainManager
+	breaker       *core.CircuitBreaker
+	concurrency   *core.ConcurrencyLimiter
+	prober        *core.HealthProber
 	healthLogRepo *healthlog.Repository
+	tokens        *core.RegistrationTokens
 }
 
-// NewHandler creates a new service handler with the given registry and health log repository.
-func NewHandler(reg *core.ServiceRegistry, healthLogRepo *healthlog.Repository) *Handler {
+// NewHandler creates a new service handler with the given registry, drain manager,
+// circuit breaker, concurrency limiter, health log repository and registration
+// tokens (nil: not checked).
+func NewHandler(reg *core.ServiceRegistry, drainer *core.DrainManager, breaker *core.CircuitBreaker, concurrency *core.ConcurrencyLimiter, healthLogRepo *healthlog.Repository, tokens *core.RegistrationTokens) *Handler {
 	return &Handler{
 		registry:      reg,
-		healthClient:  &http.Client{Timeout: 5 * time.Second},
+		drainer:       drainer,
+		breaker:       breaker,
+		concurrency:   concurrency,
+		prober:        core.NewHealthProber(),
 		healthLogRepo: healthLogRepo,
+		tokens:        tokens,
 	}
 }
 
 // RegisterRoutes registers all service management routes with the given router.
 // Routes:
-//   - POST   /register                  (public) - Self-registration endpoint
-//   - POST   /services                  (admin)  - Register a service
-//   - DELETE /services/:id              (admin)  - Deregister a service
-//   - GET    /services                  (admin)  - List all services
-//   - GET    /services/:id              (admin)  - Get service details
-//   - GET    /services/:id/health-logs  (admin)  - Get health check history
-func RegisterRoutes(router gin.IRouter, reg *core.ServiceRegistry, healthLogRepo *healthlog.Repository, authMiddleware, adminMiddleware gin.HandlerFunc) {
-	handler := NewHandler(reg, healthLogRepo)
-
-	// Public self-registration endpoint (no auth required)
+//   - POST   /register                     (token)  - Self-registration endpoint
+//   - PUT    /register/:id/heartbeat       (token)  - Renew a self-registration lease
+//   - POST   /register/:id/drain           (token)  - Drain an instance self-registered with a token
+//   - POST   /services                     (admin)  - Register a service
+//   - DELETE /services/:id                 (admin)  - Deregister a service
+//   - POST   /services/:id/drain           (admin)  - Drain a service instance
+//   - GET    /services                     (admin)  - List all services
+//   - GET    /services/:id                 (admin)  - Get service details
+//   - GET    /services/:id/health-logs     (admin)  - Get health check history
+//   - POST   /registration-tokens          (admin)  - Issue a registration token
+//   - GET    /registration-tokens          (admin)  - List registration tokens
+//   - DELETE /registration-tokens/:id      (admin)  - Revoke a registration token
+//
+// The self-registration endpoints check the registration token sent in the
+// X-Registration-Token header (see core.RegistrationTokens).
+func RegisterRoutes(router gin.IRouter, reg *core.ServiceRegistry, drainer *core.DrainManager, breaker *core.CircuitBreaker, concurrency *core.ConcurrencyLimiter, healthLogRepo *healthlog.Repository, tokens *core.RegistrationTokens, authMiddleware, adminMiddleware gin.HandlerFunc) {
+	handler := NewHandler(reg, drainer, breaker, concurrency, healthLogRepo, tokens)
+
+	// Self-registration endpoints (registration token instead of user auth)
 	router.POST("/register", handler.handleSelfRegister)
+	router.PUT("/register/:id/heartbeat", handler.requireInstanceToken, handler.handleHeartbeat)
+	router.POST("/register/:id/drain", handler.requireTokenBound, handler.requireInstanceToken, handler.handleDrainService)
 
 	services := router.Group("/services")
 	// All service management endpoints require authentication and admin privileges
@@ -52,31 +76,107 @@ func RegisterRoutes(router gin.IRouter, reg *core.ServiceRegistry, healthLogRepo
 	{
 		services.POST("", handler.handleRegisterService)
 		services.DELETE("/:id", handler.handleDeregisterService)
+		services.POST("/:id/drain", handler.handleDrainService)
 		services.GET("", handler.handleListServices)
 		services.GET("/:id", handler.handleGetService)
 		services.GET("/:id/health-logs", handler.handleGetHealthLogs)
 	}
+
+	registrationTokens := router.Group("/registration-tokens")
+	registrationTokens.Use(authMiddleware, adminMiddleware)
+	{
+		registrationTokens.POST("", handler.handleIssueToken)
+		registrationTokens.GET("", handler.handleListTokens)
+		registrationTokens.DELETE("/:id", handler.handleRevokeToken)
+	}
 }
 
 // RegisterRequest represents the payload for registering a new service.
+// HealthCheckPath is required for the HTTP-based health check types and
+// holds the gRPC service name for "grpc" checks.
 type RegisterRequest struct {
 	Name            string            `json:"name" binding:"required"`
 	Host            string            `json:"host" binding:"required"`
 	Port            int               `json:"port" binding:"required"`
-	HealthCheckPath string            `json:"health_check_path" binding:"required"`
+	HealthCheckPath string            `json:"health_check_path"`
 	Protocol        string            `json:"protocol"`
 	Metadata        map[string]string `json:"metadata"`
+	HealthCheckOptions
+}
+
+// HealthCheckOptions holds the optional health check settings accepted by
+// both registration payloads. Zero values fall back to the defaults: an
+// "http" check using the global interval, timeout and failure threshold.
+type HealthCheckOptions struct {
+	HealthCheckType         string `json:"health_check_type"`
+	HealthCheckExpectStatus int    `json:"health_check_expect_status"`
+	HealthCheckExpectBody   string `json:"health_check_expect_body"`
+	HealthCheckInterval     int    `json:"health_check_interval_seconds"`
+	HealthCheckTimeout      int    `json:"health_check_timeout_seconds"`
+	HealthCheckThreshold    int    `json:"health_check_threshold"`
+}
+
+// ServiceDetail is the detailed view of a service instance, combining the
+// registration with live routing state.
+type ServiceDetail struct {
+	*service.Service
+	CircuitBreaker core.BreakerSnapshot     `json:"circuit_breaker"`
+	Concurrency    core.ConcurrencySnapshot `json:"concurrency"`
 }
 
 // SelfRegisterRequest represents the payload for self-registration by external services.
 // Host and Port are optional - if not provided, they will be auto-detected from the request.
+// LeaseTTL is optional - if set, the service must send heartbeats at least every
+// LeaseTTL seconds or it will be drained and deregistered.
 type SelfRegisterRequest struct {
 	Name            string            `json:"name" binding:"required"`
 	Host            string            `json:"host"`
 	Port            int               `json:"port"`
-	HealthCheckPath string            `json:"health_check_path" binding:"required"`
+	HealthCheckPath string            `json:"health_check_path"`
 	Protocol        string            `json:"protocol"`
 	Metadata        map[string]string `json:"metadata"`
+	LeaseTTL        int               `json:"lease_ttl_seconds"`
+	HealthCheckOptions
+}
+
+// applyHealthCheck validates the health check settings of a registration
+// and stores them on the service.
+func applyHealthCheck(svc *service.Service, opts HealthCheckOptions) error {
+	if opts.HealthCheckType != "" {
+		svc.HealthCheckType = service.HealthCheckType(opts.HealthCheckType)
+	}
+	if !service.IsValidHealthCheckType(svc.HealthCheckType) {
+		return errors.New("unknown health check type")
+	}
+
+	switch svc.HealthCheckType {
+	case service.HealthCheckHTTP, service.HealthCheckHTTPExpect:
+		if svc.HealthCheckPath == "" {
+			return errors.New("health_check_path is required for HTTP health checks")
+		}
+	}
+
+	if svc.HealthCheckType == service.HealthCheckHTTPExpect {
+		if opts.HealthCheckExpectStatus != 0 && (opts.HealthCheckExpectStatus < 100 || opts.HealthCheckExpectStatus > 599) {
+			return errors.New("invalid health_check_expect_status")
+		}
+		if _, err := regexp.Compile(opts.HealthCheckExpectBody); err != nil {
+			return errors.New("invalid health_check_expect_body pattern")
+		}
+		svc.ExpectStatus = opts.HealthCheckExpectStatus
+		svc.ExpectBody = opts.HealthCheckExpectBody
+	}
+
+	if opts.HealthCheckInterval < 0 || opts.HealthCheckTimeout < 0 || opts.HealthCheckThreshold < 0 {
+		return errors.New("health check interval, timeout and threshold must not be negative")
+	}
+	if opts.HealthCheckInterval > 0 && opts.HealthCheckTimeout > opts.HealthCheckInterval {
+		return errors.New("health check timeout must not exceed the interval")
+	}
+	svc.HealthInterval = opts.HealthCheckInterval
+	svc.HealthTimeout = opts.HealthCheckTimeout
+	svc.HealthThreshold = opts.HealthCheckThreshold
+	return nil
 }
 
 // handleRegisterService processes service registration requests.
@@ -84,7 +184,16 @@ type SelfRegisterRequest struct {
 func (h *Handler) handleRegisterService(c *gin.Context) {
 	var req RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		middleware.ErrorJSON(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !core.IsValidStrategy(req.Metadata[core.MetadataBalancer]) {
+		middleware.ErrorJSON(c, http.StatusBadRequest, "unknown load balancing strategy")
+		return
+	}
+	if _, err := core.ParseRetryOn(req.Metadata[core.MetadataRetryOn]); err != nil {
+		middleware.ErrorJSON(c, http.StatusBadRequest, "invalid retry status codes")
 		return
 	}
 
@@ -96,10 +205,14 @@ func (h *Handler) handleRegisterService(c *gin.Context) {
 	if req.Metadata != nil {
 		svc.Metadata = req.Metadata
 	}
+	if err := applyHealthCheck(svc, req.HealthCheckOptions); err != nil {
+		middleware.ErrorJSON(c, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	// Perform initial health check but allow registration even if unhealthy
 	if err := h.checkServiceHealth(svc); err != nil {
-		log.Printf("Initial health check failed for %s, registering as unhealthy: %v", svc.Name, err)
+		core.Logf(c, "Initial health check failed for %s, registering as unhealthy: %v", svc.Name, err)
 		svc.Status = "unhealthy"
 	}
 
@@ -107,23 +220,29 @@ func (h *Handler) handleRegisterService(c *gin.Context) {
 	if err := h.registry.Register(svc); err != nil {
 		// Check if it's a duplicate service error
 		if err.Error() == "service with this name, host, and port already exists" {
-			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			middleware.ErrorJSON(c, http.StatusConflict, err.Error())
+			return
+		}
+		if err.Error() == "failed to save service" {
+			middleware.ErrorJSON(c, http.StatusInternalServerError, err.Error())
 			return
 		}
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		middleware.ErrorJSON(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	log.Printf("Service registered: %s at %s", svc.Name, svc.BaseURL())
+	core.Logf(c, "Service registered: %s at %s", svc.Name, svc.BaseURL())
 	c.JSON(http.StatusCreated, svc)
 }
 
-// handleSelfRegister allows external services to register themselves without authentication.
+// handleSelfRegister allows external services to register themselves without
+// user authentication, presenting a registration token for the service name
+// instead (see core.RegistrationTokens).
 // Host and Port are auto-detected from the request if not provided.
 func (h *Handler) handleSelfRegister(c *gin.Context) {
 	var req SelfRegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		middleware.ErrorJSON(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -142,19 +261,35 @@ func (h *Handler) handleSelfRegister(c *gin.Context) {
 
 		if req.Host == "" {
 			req.Host = clientIP
-			log.Printf("Auto-detected host for %s: %s", req.Name, req.Host)
+			core.Logf(c, "Auto-detected host for %s: %s", req.Name, req.Host)
 		}
 
 		// If port is not provided, we can't auto-detect it reliably
 		// Services should provide their actual service port, not the source port
 		if req.Port == 0 {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "port must be provided (cannot auto-detect service port)",
-			})
+			middleware.ErrorJSON(c, http.StatusBadRequest, "port must be provided (cannot auto-detect service port)")
 			return
 		}
 	}
 
+	tokenID, ok := h.authorizeRegistration(c, req.Name)
+	if !ok {
+		return
+	}
+
+	if !core.IsValidStrategy(req.Metadata[core.MetadataBalancer]) {
+		middleware.ErrorJSON(c, http.StatusBadRequest, "unknown load balancing strategy")
+		return
+	}
+	if _, err := core.ParseRetryOn(req.Metadata[core.MetadataRetryOn]); err != nil {
+		middleware.ErrorJSON(c, http.StatusBadRequest, "invalid retry status codes")
+		return
+	}
+	if req.LeaseTTL < 0 {
+		middleware.ErrorJSON(c, http.StatusBadRequest, "lease_ttl_seconds must not be negative")
+		return
+	}
+
 	// Set default protocol if not provided
 	if req.Protocol == "" {
 		req.Protocol = "http"
@@ -163,13 +298,19 @@ func (h *Handler) handleSelfRegister(c *gin.Context) {
 	// Create service domain object
 	svc := service.NewService(req.Name, req.Host, req.Port, req.HealthCheckPath)
 	svc.Protocol = req.Protocol
+	svc.LeaseTTL = req.LeaseTTL
+	svc.RegistrationTokenID = tokenID
 	if req.Metadata != nil {
 		svc.Metadata = req.Metadata
 	}
+	if err := applyHealthCheck(svc, req.HealthCheckOptions); err != nil {
+		middleware.ErrorJSON(c, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	// Perform initial health check but allow registration even if unhealthy
 	if err := h.checkServiceHealth(svc); err != nil {
-		log.Printf("Initial health check failed for %s (self-registered), registering as unhealthy: %v", svc.Name, err)
+		core.Logf(c, "Initial health check failed for %s (self-registered), registering as unhealthy: %v", svc.Name, err)
 		svc.Status = "unhealthy"
 	}
 
@@ -177,56 +318,65 @@ func (h *Handler) handleSelfRegister(c *gin.Context) {
 	if err := h.registry.Register(svc); err != nil {
 		// Check if it's a duplicate service error
 		if err.Error() == "service with this name, host, and port already exists" {
-			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			middleware.ErrorJSON(c, http.StatusConflict, err.Error())
 			return
 		}
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if err.Error() == "failed to save service" {
+			middleware.ErrorJSON(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		middleware.ErrorJSON(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	log.Printf("Service self-registered: %s at %s (from %s)", svc.Name, svc.BaseURL(), c.ClientIP())
+	core.Logf(c, "Service self-registered: %s at %s (from %s)", svc.Name, svc.BaseURL(), c.ClientIP())
 	c.JSON(http.StatusCreated, svc)
 }
 
-// checkServiceHealth verifies that a service's health check endpoint is accessible.
-// Returns an error if the health check fails or returns a non-2xx status code.
-func (h *Handler) checkServiceHealth(svc *service.Service) error {
-	startTime := time.Now()
-	resp, err := h.healthClient.Get(svc.HealthCheckURL())
-	responseTime := time.Since(startTime).Milliseconds()
+// handleHeartbeat renews the lease of a self-registered service.
+// Services registered with lease_ttl_seconds must call this before the lease runs out.
+func (h *Handler) handleHeartbeat(c *gin.Context) {
+	id := c.Param("id")
 
+	svc, err := h.registry.RenewLease(id)
 	if err != nil {
-		log.Printf("Health check failed for %s: %v", svc.Name, err)
-		// Log the failed health check
-		if h.healthLogRepo != nil {
-			h.healthLogRepo.Create(svc.ID, "unhealthy", err.Error(), "", responseTime)
+		switch err.Error() {
+		case "service not found":
+			middleware.ErrorJSON(c, http.StatusNotFound, err.Error())
+		case "service is draining":
+			middleware.ErrorJSON(c, http.StatusConflict, err.Error())
+		default:
+			middleware.ErrorJSON(c, http.StatusBadRequest, err.Error())
 		}
-		return err
+		return
 	}
-	defer resp.Body.Close()
 
-	// Read response body (limit to 10KB)
-	bodyBytes, err := io.ReadAll(io.LimitReader(resp.Body, 10*1024))
-	responseBody := ""
-	if err == nil {
-		responseBody = string(bodyBytes)
-	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":                svc.ID,
+		"lease_ttl_seconds": svc.LeaseTTL,
+		"lease_expires_at":  svc.LeaseExpiresAt(),
+	})
+}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		log.Printf("Health check returned non-2xx status for %s: %d", svc.Name, resp.StatusCode)
-		// Log the unhealthy status with response body
-		if h.healthLogRepo != nil {
-			errorMsg := "HTTP " + strconv.Itoa(resp.StatusCode)
-			h.healthLogRepo.Create(svc.ID, "unhealthy", errorMsg, responseBody, responseTime)
-		}
-		return err
-	}
+// checkServiceHealth runs the service's health check once.
+// Returns an error if the check fails (for HTTP checks: a non-2xx status code).
+func (h *Handler) checkServiceHealth(svc *service.Service) error {
+	ctx, cancel := context.WithTimeout(context.Background(), core.HealthCheckTimeout(svc))
+	defer cancel()
 
-	// Log successful health check with response body
+	startTime := time.Now()
+	result := h.prober.Probe(ctx, svc)
+	responseTime := time.Since(startTime).Milliseconds()
+
+	// Log the health check with its response body
 	if h.healthLogRepo != nil {
-		h.healthLogRepo.Create(svc.ID, "healthy", "", responseBody, responseTime)
+		h.healthLogRepo.Create(svc.ID, result.Status, result.Error, result.Body, responseTime)
 	}
 
+	if !result.Healthy() {
+		log.Printf("Health check failed for %s: %s", svc.Name, result.Error)
+		return errors.New(result.Error)
+	}
 	return nil
 }
 
@@ -235,14 +385,58 @@ func (h *Handler) handleDeregisterService(c *gin.Context) {
 	id := c.Param("id")
 
 	if err := h.registry.Deregister(id); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		middleware.ErrorJSON(c, http.StatusNotFound, err.Error())
 		return
 	}
 
-	log.Printf("Service deregistered: %s", id)
+	core.Logf(c, "Service deregistered: %s", id)
 	c.JSON(http.StatusOK, gin.H{"message": "service deregistered"})
 }
 
+// DrainRequest represents the optional payload for draining a service instance.
+// TimeoutSeconds bounds how long in-flight requests may take before the
+// instance is removed anyway (0 uses the configured default).
+type DrainRequest struct {
+	TimeoutSeconds int `json:"timeout_seconds"`
+}
+
+// handleDrainService stops new traffic to a service instance and deregisters it
+// once its in-flight requests have finished or the drain deadline passes.
+func (h *Handler) handleDrainService(c *gin.Context) {
+	id := c.Param("id")
+
+	var req DrainRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			middleware.ErrorJSON(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.TimeoutSeconds < 0 {
+		middleware.ErrorJSON(c, http.StatusBadRequest, "timeout_seconds must not be negative")
+		return
+	}
+
+	svc, err := h.drainer.Drain(id, time.Duration(req.TimeoutSeconds)*time.Second)
+	if err != nil {
+		if err.Error() == "service not found" {
+			middleware.ErrorJSON(c, http.StatusNotFound, err.Error())
+			return
+		}
+		middleware.ErrorJSON(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	deadline, _ := h.drainer.Deadline(id)
+	core.Logf(c, "Service draining: %s", id)
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":        "service draining",
+		"id":             svc.ID,
+		"status":         svc.Status,
+		"drain_deadline": deadline,
+	})
+}
+
 // handleListServices returns all registered services with their current status.
 func (h *Handler) handleListServices(c *gin.Context) {
 	services := h.registry.List()
@@ -252,17 +446,22 @@ func (h *Handler) handleListServices(c *gin.Context) {
 	})
 }
 
-// handleGetService retrieves detailed information about a specific service by ID.
+// handleGetService retrieves detailed information about a specific service by ID,
+// including the state of its circuit breaker and concurrency limits.
 func (h *Handler) handleGetService(c *gin.Context) {
 	id := c.Param("id")
 
 	svc, err := h.registry.GetByID(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		middleware.ErrorJSON(c, http.StatusNotFound, err.Error())
 		return
 	}
 
-	c.JSON(http.StatusOK, svc)
+	c.JSON(http.StatusOK, ServiceDetail{
+		Service:        svc,
+		CircuitBreaker: h.breaker.Snapshot(svc.ID),
+		Concurrency:    h.concurrency.Snapshot(svc),
+	})
 }
 
 // handleGetHealthLogs retrieves health check logs for a specific service.
@@ -272,7 +471,7 @@ func (h *Handler) handleGetHealthLogs(c *gin.Context) {
 	// Verify service exists
 	_, err := h.registry.GetByID(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "service not found"})
+		middleware.ErrorJSON(c, http.StatusNotFound, "service not found")
 		return
 	}
 
@@ -286,7 +485,7 @@ func (h *Handler) handleGetHealthLogs(c *gin.Context) {
 
 	logs, err := h.healthLogRepo.GetByServiceID(id, limit)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve health logs"})
+		middleware.ErrorJSON(c, http.StatusInternalServerError, "failed to retrieve health logs")
 		return
 	}
 
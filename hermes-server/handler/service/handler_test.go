@@ -7,11 +7,13 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/mattn/go-sqlite3"
 	"nfcunha/hermes/hermes-server/core"
 	"nfcunha/hermes/hermes-server/core/domain/service"
+	"nfcunha/hermes/hermes-server/database"
 )
 
 // setupTestDB creates an in-memory SQLite database for testing
@@ -21,25 +23,9 @@ func setupTestDB(t *testing.T) *sql.DB {
 		t.Fatalf("Failed to open test database: %v", err)
 	}
 
-	// Create services table
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS services (
-			id TEXT PRIMARY KEY,
-			name TEXT NOT NULL,
-			host TEXT NOT NULL,
-			port INTEGER NOT NULL,
-			protocol TEXT NOT NULL DEFAULT 'http',
-			health_check_path TEXT NOT NULL,
-			status TEXT NOT NULL DEFAULT 'healthy',
-			metadata TEXT,
-			registered_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			last_checked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			failure_count INTEGER DEFAULT 0,
-			UNIQUE(name, host, port)
-		)
-	`)
-	if err != nil {
-		t.Fatalf("Failed to create test table: %v", err)
+	// Create schema using the real migrations
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
 	}
 
 	return db
@@ -84,7 +70,7 @@ func TestRegisterService_WithoutAuth(t *testing.T) {
 	reg := core.NewServiceRegistry(db)
 	router := gin.New()
 
-	RegisterRoutes(router, reg, mockAuthFailMiddleware(), mockAdminMiddleware())
+	RegisterRoutes(router, reg, nil, nil, nil, nil, nil, mockAuthFailMiddleware(), mockAdminMiddleware())
 
 	reqBody := RegisterRequest{
 		Name:            "test-api",
@@ -120,7 +106,7 @@ func TestRegisterService_NonAdmin(t *testing.T) {
 	reg := core.NewServiceRegistry(db)
 	router := gin.New()
 
-	RegisterRoutes(router, reg, mockAuthMiddleware(), mockNonAdminMiddleware())
+	RegisterRoutes(router, reg, nil, nil, nil, nil, nil, mockAuthMiddleware(), mockNonAdminMiddleware())
 
 	reqBody := RegisterRequest{
 		Name:            "test-api",
@@ -156,7 +142,7 @@ func TestRegisterService_InvalidHealthCheck(t *testing.T) {
 	reg := core.NewServiceRegistry(db)
 	router := gin.New()
 
-	RegisterRoutes(router, reg, mockAuthMiddleware(), mockAdminMiddleware())
+	RegisterRoutes(router, reg, nil, nil, nil, nil, nil, mockAuthMiddleware(), mockAdminMiddleware())
 
 	reqBody := RegisterRequest{
 		Name:            "test-api",
@@ -172,16 +158,74 @@ func TestRegisterService_InvalidHealthCheck(t *testing.T) {
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
-	if w.Code != http.StatusBadRequest {
-		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	// Services failing the initial health check are registered as unhealthy
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d", http.StatusCreated, w.Code)
 	}
 
 	var response map[string]interface{}
 	json.Unmarshal(w.Body.Bytes(), &response)
 
-	errorStr, ok := response["error"].(string)
-	if !ok || len(errorStr) == 0 {
-		t.Errorf("Expected error message, got %v", response["error"])
+	if response["status"] != string(service.StatusUnhealthy) {
+		t.Errorf("Expected status %s, got %v", service.StatusUnhealthy, response["status"])
+	}
+}
+
+func TestRegisterService_HealthCheckTypes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB(t)
+	defer db.Close()
+
+	reg := core.NewServiceRegistry(db)
+	router := gin.New()
+
+	RegisterRoutes(router, reg, nil, nil, nil, nil, nil, mockAuthMiddleware(), mockAdminMiddleware())
+
+	tests := []struct {
+		name     string
+		req      RegisterRequest
+		expected int
+	}{
+		{
+			name:     "tcp without path",
+			req:      RegisterRequest{Name: "cache", Host: "localhost", Port: 6379, HealthCheckOptions: HealthCheckOptions{HealthCheckType: "tcp"}},
+			expected: http.StatusCreated,
+		},
+		{
+			name:     "http without path",
+			req:      RegisterRequest{Name: "api", Host: "localhost", Port: 8081},
+			expected: http.StatusBadRequest,
+		},
+		{
+			name: "unknown type",
+			req: RegisterRequest{Name: "api", Host: "localhost", Port: 8082, HealthCheckPath: "/health",
+				HealthCheckOptions: HealthCheckOptions{HealthCheckType: "ping"}},
+			expected: http.StatusBadRequest,
+		},
+		{
+			name: "invalid body pattern",
+			req: RegisterRequest{Name: "api", Host: "localhost", Port: 8083, HealthCheckPath: "/health",
+				HealthCheckOptions: HealthCheckOptions{HealthCheckType: "http-expect", HealthCheckExpectBody: "("}},
+			expected: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		bodyJSON, _ := json.Marshal(tt.req)
+		req, _ := http.NewRequest("POST", "/services", bytes.NewBuffer(bodyJSON))
+		req.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d (%s)", tt.name, tt.expected, w.Code, w.Body.String())
+		}
+	}
+
+	services, _ := reg.GetByName("cache")
+	if len(services) != 1 || services[0].HealthCheckType != service.HealthCheckTCP {
+		t.Errorf("Expected cache to be registered with tcp health check, got %+v", services)
 	}
 }
 
@@ -197,7 +241,7 @@ func TestRegisterService_Duplicate(t *testing.T) {
 	reg.Register(svc)
 
 	router := gin.New()
-	RegisterRoutes(router, reg, mockAuthMiddleware(), mockAdminMiddleware())
+	RegisterRoutes(router, reg, nil, nil, nil, nil, nil, mockAuthMiddleware(), mockAdminMiddleware())
 
 	reqBody := RegisterRequest{
 		Name:            "existing-api",
@@ -227,7 +271,7 @@ func TestListServices_WithoutAuth(t *testing.T) {
 	reg := core.NewServiceRegistry(db)
 	router := gin.New()
 
-	RegisterRoutes(router, reg, mockAuthFailMiddleware(), mockAdminMiddleware())
+	RegisterRoutes(router, reg, nil, nil, nil, nil, nil, mockAuthFailMiddleware(), mockAdminMiddleware())
 
 	req, _ := http.NewRequest("GET", "/services", nil)
 	w := httptest.NewRecorder()
@@ -252,7 +296,7 @@ func TestListServices_Success(t *testing.T) {
 	reg.Register(svc2)
 
 	router := gin.New()
-	RegisterRoutes(router, reg, mockAuthMiddleware(), mockAdminMiddleware())
+	RegisterRoutes(router, reg, nil, nil, nil, nil, nil, mockAuthMiddleware(), mockAdminMiddleware())
 
 	req, _ := http.NewRequest("GET", "/services", nil)
 	w := httptest.NewRecorder()
@@ -279,7 +323,7 @@ func TestGetService_WithoutAuth(t *testing.T) {
 	reg := core.NewServiceRegistry(db)
 	router := gin.New()
 
-	RegisterRoutes(router, reg, mockAuthFailMiddleware(), mockAdminMiddleware())
+	RegisterRoutes(router, reg, nil, nil, nil, nil, nil, mockAuthFailMiddleware(), mockAdminMiddleware())
 
 	req, _ := http.NewRequest("GET", "/services/some-id", nil)
 	w := httptest.NewRecorder()
@@ -301,8 +345,11 @@ func TestGetService_Success(t *testing.T) {
 	svc := service.NewService("test-api", "localhost", 8080, "/health")
 	reg.Register(svc)
 
+	breaker := core.NewCircuitBreaker(core.BreakerConfig{FailureThreshold: 1, OpenDuration: time.Minute, HalfOpenRequests: 1})
+	breaker.Record(svc, false)
+
 	router := gin.New()
-	RegisterRoutes(router, reg, mockAuthMiddleware(), mockAdminMiddleware())
+	RegisterRoutes(router, reg, nil, breaker, nil, nil, nil, mockAuthMiddleware(), mockAdminMiddleware())
 
 	req, _ := http.NewRequest("GET", "/services/"+svc.ID, nil)
 	w := httptest.NewRecorder()
@@ -318,6 +365,11 @@ func TestGetService_Success(t *testing.T) {
 	if response["id"] != svc.ID {
 		t.Errorf("Expected service ID %s, got %v", svc.ID, response["id"])
 	}
+
+	breakerState, ok := response["circuit_breaker"].(map[string]interface{})
+	if !ok || breakerState["state"] != string(core.BreakerOpen) {
+		t.Errorf("Expected open circuit breaker, got %v", response["circuit_breaker"])
+	}
 }
 
 func TestGetService_NotFound(t *testing.T) {
@@ -328,7 +380,7 @@ func TestGetService_NotFound(t *testing.T) {
 	reg := core.NewServiceRegistry(db)
 	router := gin.New()
 
-	RegisterRoutes(router, reg, mockAuthMiddleware(), mockAdminMiddleware())
+	RegisterRoutes(router, reg, nil, nil, nil, nil, nil, mockAuthMiddleware(), mockAdminMiddleware())
 
 	req, _ := http.NewRequest("GET", "/services/non-existent-id", nil)
 	w := httptest.NewRecorder()
@@ -347,7 +399,7 @@ func TestDeregisterService_WithoutAuth(t *testing.T) {
 	reg := core.NewServiceRegistry(db)
 	router := gin.New()
 
-	RegisterRoutes(router, reg, mockAuthFailMiddleware(), mockAdminMiddleware())
+	RegisterRoutes(router, reg, nil, nil, nil, nil, nil, mockAuthFailMiddleware(), mockAdminMiddleware())
 
 	req, _ := http.NewRequest("DELETE", "/services/some-id", nil)
 	w := httptest.NewRecorder()
@@ -370,7 +422,7 @@ func TestDeregisterService_Success(t *testing.T) {
 	reg.Register(svc)
 
 	router := gin.New()
-	RegisterRoutes(router, reg, mockAuthMiddleware(), mockAdminMiddleware())
+	RegisterRoutes(router, reg, nil, nil, nil, nil, nil, mockAuthMiddleware(), mockAdminMiddleware())
 
 	req, _ := http.NewRequest("DELETE", "/services/"+svc.ID, nil)
 	w := httptest.NewRecorder()
@@ -402,7 +454,7 @@ func TestDeregisterService_NotFound(t *testing.T) {
 	reg := core.NewServiceRegistry(db)
 	router := gin.New()
 
-	RegisterRoutes(router, reg, mockAuthMiddleware(), mockAdminMiddleware())
+	RegisterRoutes(router, reg, nil, nil, nil, nil, nil, mockAuthMiddleware(), mockAdminMiddleware())
 
 	req, _ := http.NewRequest("DELETE", "/services/non-existent-id", nil)
 	w := httptest.NewRecorder()
@@ -412,3 +464,128 @@ func TestDeregisterService_NotFound(t *testing.T) {
 		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
 	}
 }
+
+func TestHeartbeat_RenewsLease(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB(t)
+	defer db.Close()
+
+	reg := core.NewServiceRegistry(db)
+
+	svc := service.NewService("leased-api", "localhost", 8080, "/health")
+	svc.LeaseTTL = 30
+	svc.LastHeartbeatAt = time.Now().Add(-time.Minute)
+	reg.Register(svc)
+
+	router := gin.New()
+	RegisterRoutes(router, reg, nil, nil, nil, nil, nil, mockAuthFailMiddleware(), mockAdminMiddleware())
+
+	req, _ := http.NewRequest("PUT", "/register/"+svc.ID+"/heartbeat", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if svc.LeaseExpired(time.Now()) {
+		t.Error("Expected lease to be renewed")
+	}
+}
+
+func TestHeartbeat_Errors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB(t)
+	defer db.Close()
+
+	reg := core.NewServiceRegistry(db)
+
+	unleased := service.NewService("plain-api", "localhost", 8080, "/health")
+	reg.Register(unleased)
+
+	draining := service.NewService("leased-api", "localhost", 8081, "/health")
+	draining.LeaseTTL = 30
+	draining.Status = service.StatusDraining
+	reg.Register(draining)
+
+	router := gin.New()
+	RegisterRoutes(router, reg, nil, nil, nil, nil, nil, mockAuthMiddleware(), mockAdminMiddleware())
+
+	tests := []struct {
+		id       string
+		expected int
+	}{
+		{id: "non-existent-id", expected: http.StatusNotFound},
+		{id: unleased.ID, expected: http.StatusBadRequest},
+		{id: draining.ID, expected: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("PUT", "/register/"+tt.id+"/heartbeat", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.expected {
+			t.Errorf("Heartbeat for %s: expected status %d, got %d", tt.id, tt.expected, w.Code)
+		}
+	}
+}
+
+func TestDrainService_AdminAndSelfService(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB(t)
+	defer db.Close()
+
+	reg := core.NewServiceRegistry(db)
+	drainer := core.NewDrainManager(reg, core.NewInFlightTracker(), time.Second, time.Minute)
+
+	adminDrained := service.NewService("api", "localhost", 8080, "/health")
+	selfDrained := service.NewService("api", "localhost", 8081, "/health")
+	selfDrained.RegistrationTokenID = "token-1"
+	unbound := service.NewService("api", "localhost", 8082, "/health")
+	reg.Register(adminDrained)
+	reg.Register(selfDrained)
+	reg.Register(unbound)
+
+	router := gin.New()
+	RegisterRoutes(router, reg, drainer, nil, nil, nil, nil, mockAuthMiddleware(), mockAdminMiddleware())
+
+	req, _ := http.NewRequest("POST", "/services/"+adminDrained.ID+"/drain", bytes.NewBufferString(`{"timeout_seconds":10}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	req, _ = http.NewRequest("POST", "/register/"+selfDrained.ID+"/drain", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusAccepted, w.Code, w.Body.String())
+	}
+
+	for _, svc := range []*service.Service{adminDrained, selfDrained} {
+		if svc.Status != service.StatusDraining {
+			t.Errorf("Expected %s to be draining, got %s", svc.ID, svc.Status)
+		}
+	}
+
+	// Instances not registered with a token can only be drained by an admin
+	req, _ = http.NewRequest("POST", "/register/"+unbound.ID+"/drain", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden || unbound.Status == service.StatusDraining {
+		t.Errorf("Expected status %d without draining, got %d (%s)", http.StatusForbidden, w.Code, unbound.Status)
+	}
+
+	req, _ = http.NewRequest("POST", "/services/non-existent-id/drain", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
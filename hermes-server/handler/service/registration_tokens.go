@@ -0,0 +1,166 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core"
+	"nfcunha/hermes/hermes-server/handler/middleware"
+)
+
+// IssueTokenRequest represents the payload for issuing a registration token.
+// SourceCIDRs limits the networks the token may be used from (empty: any).
+// ExpiresInSeconds sets the token lifetime (0: the token does not expire).
+type IssueTokenRequest struct {
+	Description      string   `json:"description"`
+	ServiceNames     []string `json:"service_names" binding:"required"`
+	SourceCIDRs      []string `json:"source_cidrs"`
+	ExpiresInSeconds int      `json:"expires_in_seconds"`
+}
+
+// authorizeRegistration checks the request's registration token for the
+// service name, and returns the ID of the token used ("" without a token).
+// Where tokens are optional, a service with instances registered with a token
+// still takes no instances without one. On failure an error response is
+// written and false is returned.
+func (h *Handler) authorizeRegistration(c *gin.Context, serviceName string) (string, bool) {
+	tokenID, err := h.tokens.Authorize(c.GetHeader(core.RegistrationTokenHeader), serviceName, c.ClientIP())
+	if err == nil && tokenID == "" && h.hasTokenBoundInstances(serviceName) {
+		err = core.ErrTokenRequired
+	}
+	if err != nil {
+		core.Logf(c, "Registration of %s from %s rejected: %v", serviceName, c.ClientIP(), err)
+		respondTokenError(c, err)
+		return "", false
+	}
+	return tokenID, true
+}
+
+// hasTokenBoundInstances reports whether any instance of the service was
+// registered with a registration token.
+func (h *Handler) hasTokenBoundInstances(serviceName string) bool {
+	for _, svc := range h.registry.List() {
+		if svc.Name == serviceName && svc.RegistrationTokenID != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// requireInstanceToken checks the registration token of heartbeat and drain
+// requests against the token the instance registered with. Unknown instances
+// are passed on so that the handler reports them as not found.
+func (h *Handler) requireInstanceToken(c *gin.Context) {
+	svc, err := h.registry.GetByID(c.Param("id"))
+	if err != nil {
+		c.Next()
+		return
+	}
+	if err := h.tokens.AuthorizeInstance(c.GetHeader(core.RegistrationTokenHeader), svc, c.ClientIP()); err != nil {
+		core.Logf(c, "Request for instance %s from %s rejected: %v", svc.ID, c.ClientIP(), err)
+		respondTokenError(c, err)
+		return
+	}
+	c.Next()
+}
+
+// requireTokenBound rejects self-drains of instances that were not
+// self-registered with a registration token, which only an admin may drain.
+// While tokens are required every self-registered instance has one; this
+// only affects instances registered by an admin or without a token where
+// tokens are optional. Unknown instances are passed on so that the handler
+// reports them as not found.
+func (h *Handler) requireTokenBound(c *gin.Context) {
+	svc, err := h.registry.GetByID(c.Param("id"))
+	if err == nil && svc.RegistrationTokenID == "" {
+		core.Logf(c, "Self-drain of instance %s from %s rejected: not registered with a token", svc.ID, c.ClientIP())
+		middleware.ErrorJSON(c, http.StatusForbidden, "instance was not registered with a registration token; ask an admin to drain it")
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// respondTokenError writes the response for a rejected registration token
+// and aborts the request.
+func respondTokenError(c *gin.Context, err error) {
+	if errors.Is(err, core.ErrTokenRequired) || errors.Is(err, core.ErrInvalidToken) {
+		middleware.ErrorJSON(c, http.StatusUnauthorized, err.Error())
+	} else {
+		middleware.ErrorJSON(c, http.StatusForbidden, err.Error())
+	}
+	c.Abort()
+}
+
+// handleIssueToken creates a registration token. The secret is only returned
+// in this response.
+func (h *Handler) handleIssueToken(c *gin.Context) {
+	var req IssueTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.ErrorJSON(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.ExpiresInSeconds < 0 {
+		middleware.ErrorJSON(c, http.StatusBadRequest, "expires_in_seconds must not be negative")
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInSeconds > 0 {
+		t := time.Now().UTC().Add(time.Duration(req.ExpiresInSeconds) * time.Second)
+		expiresAt = &t
+	}
+
+	secret, token, err := h.tokens.Issue(req.Description, req.ServiceNames, req.SourceCIDRs, expiresAt)
+	if err != nil {
+		status := http.StatusBadRequest
+		if err.Error() == "failed to generate token" || err.Error() == "failed to store token" {
+			status = http.StatusInternalServerError
+		}
+		middleware.ErrorJSON(c, status, err.Error())
+		return
+	}
+
+	core.Logf(c, "Registration token issued: %s", token.ID)
+	c.JSON(http.StatusCreated, gin.H{
+		"token":         secret,
+		"id":            token.ID,
+		"description":   token.Description,
+		"service_names": token.ServiceNames,
+		"source_cidrs":  token.SourceCIDRs,
+		"created_at":    token.CreatedAt,
+		"expires_at":    token.ExpiresAt,
+	})
+}
+
+// handleListTokens returns all registration tokens without their secrets
+func (h *Handler) handleListTokens(c *gin.Context) {
+	tokens, err := h.tokens.List()
+	if err != nil {
+		middleware.ErrorJSON(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tokens": tokens,
+		"count":  len(tokens),
+	})
+}
+
+// handleRevokeToken deletes a registration token
+func (h *Handler) handleRevokeToken(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.tokens.Revoke(id); err != nil {
+		status := http.StatusInternalServerError
+		if err.Error() == "token not found" {
+			status = http.StatusNotFound
+		}
+		middleware.ErrorJSON(c, status, err.Error())
+		return
+	}
+
+	core.Logf(c, "Registration token revoked: %s", id)
+	c.JSON(http.StatusOK, gin.H{"message": "registration token revoked"})
+}
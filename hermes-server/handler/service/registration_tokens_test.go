@@ -0,0 +1,232 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core"
+	"nfcunha/hermes/hermes-server/core/domain/regtoken"
+	"nfcunha/hermes/hermes-server/core/domain/service"
+)
+
+// newTokenRouter creates a router requiring registration tokens, and a
+// healthy backend to register.
+func newTokenRouter(t *testing.T) (*gin.Engine, *httptest.Server) {
+	router, backend, _ := newTokenRouterWithRegistry(t)
+	return router, backend
+}
+
+// newTokenRouterWithRegistry is newTokenRouter also returning the registry.
+func newTokenRouterWithRegistry(t *testing.T) (*gin.Engine, *httptest.Server, *core.ServiceRegistry) {
+	return newRegistrationRouter(t, true)
+}
+
+// newRegistrationRouter is newTokenRouterWithRegistry with tokens required
+// or optional.
+func newRegistrationRouter(t *testing.T, required bool) (*gin.Engine, *httptest.Server, *core.ServiceRegistry) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB(t)
+	t.Cleanup(func() { db.Close() })
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(backend.Close)
+
+	reg := core.NewServiceRegistry(db)
+	drainer := core.NewDrainManager(reg, core.NewInFlightTracker(), time.Second, time.Minute)
+	tokens := core.NewRegistrationTokens(regtoken.NewRepository(db), required)
+	router := gin.New()
+	RegisterRoutes(router, reg, drainer, nil, nil, nil, tokens, mockAuthMiddleware(), mockAdminMiddleware())
+	return router, backend, reg
+}
+
+// issueToken issues a registration token through the admin API.
+func issueToken(t *testing.T, router *gin.Engine, body string) (string, string) {
+	req := httptest.NewRequest("POST", "/registration-tokens", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Token string `json:"token"`
+		ID    string `json:"id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp.Token, resp.ID
+}
+
+// selfRegister registers a service name for the backend with the given token.
+func selfRegister(router *gin.Engine, backend *httptest.Server, name, token string) int {
+	port := backend.URL[strings.LastIndex(backend.URL, ":")+1:]
+	body := `{"name":"` + name + `","host":"127.0.0.1","port":` + port + `,"health_check_path":"/health"}`
+	req := httptest.NewRequest("POST", "/register", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set(core.RegistrationTokenHeader, token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestSelfRegister_RequiresScopedToken(t *testing.T) {
+	router, backend := newTokenRouter(t)
+	token, _ := issueToken(t, router, `{"service_names":["orders"]}`)
+	// httptest requests come from 192.0.2.1
+	otherNetwork, _ := issueToken(t, router, `{"service_names":["orders"],"source_cidrs":["10.0.0.0/8"]}`)
+
+	tests := []struct {
+		name     string
+		service  string
+		token    string
+		expected int
+	}{
+		{name: "missing token", service: "orders", token: "", expected: http.StatusUnauthorized},
+		{name: "unknown token", service: "orders", token: "hrt_unknown", expected: http.StatusUnauthorized},
+		{name: "other service", service: "payments", token: token, expected: http.StatusForbidden},
+		{name: "other network", service: "orders", token: otherNetwork, expected: http.StatusForbidden},
+		{name: "valid token", service: "orders", token: token, expected: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		if code := selfRegister(router, backend, tt.service, tt.token); code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.expected, code)
+		}
+	}
+}
+
+func TestSelfRegister_OptionalTokens(t *testing.T) {
+	router, backend, _ := newRegistrationRouter(t, false)
+	token, _ := issueToken(t, router, `{"service_names":["orders"]}`)
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer other.Close()
+
+	if code := selfRegister(router, backend, "payments", ""); code != http.StatusCreated {
+		t.Errorf("Expected tokenless self-registration to succeed, got %d", code)
+	}
+	if code := selfRegister(router, backend, "orders", token); code != http.StatusCreated {
+		t.Fatalf("Expected self-registration with a token to succeed, got %d", code)
+	}
+
+	// A service with token-bound instances only accepts its tokens
+	if code := selfRegister(router, other, "orders", ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected tokenless registration under a token-bound service to be rejected, got %d", code)
+	}
+	if code := selfRegister(router, other, "orders", token); code != http.StatusCreated {
+		t.Errorf("Expected another instance with the token to register, got %d", code)
+	}
+}
+
+func TestRegistrationTokens_ListAndRevoke(t *testing.T) {
+	router, backend := newTokenRouter(t)
+	token, id := issueToken(t, router, `{"description":"ci","service_names":["orders"],"expires_in_seconds":3600}`)
+
+	req := httptest.NewRequest("GET", "/registration-tokens", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), token) {
+		t.Fatalf("Expected token list without secrets, got %d: %s", w.Code, w.Body.String())
+	}
+	var list struct {
+		Tokens []regtoken.Token `json:"tokens"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list.Tokens) != 1 || list.Tokens[0].ID != id || list.Tokens[0].ExpiresAt == nil {
+		t.Errorf("Expected the issued token with an expiry, got %+v", list.Tokens)
+	}
+
+	req = httptest.NewRequest("DELETE", "/registration-tokens/"+id, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	if code := selfRegister(router, backend, "orders", token); code != http.StatusUnauthorized {
+		t.Errorf("Expected revoked token to be rejected, got %d", code)
+	}
+}
+
+// heartbeat sends a heartbeat for the instance with the given token.
+func heartbeat(router *gin.Engine, id, token string) int {
+	req := httptest.NewRequest("PUT", "/register/"+id+"/heartbeat", nil)
+	if token != "" {
+		req.Header.Set(core.RegistrationTokenHeader, token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestHeartbeat_BoundToRegistrationToken(t *testing.T) {
+	router, backend, reg := newTokenRouterWithRegistry(t)
+	token, id := issueToken(t, router, `{"service_names":["orders"]}`)
+	other, _ := issueToken(t, router, `{"service_names":["orders"]}`)
+
+	if code := selfRegister(router, backend, "orders", token); code != http.StatusCreated {
+		t.Fatalf("Expected self-registration to succeed, got %d", code)
+	}
+	instances, _ := reg.GetByName("orders")
+	selfRegistered := instances[0]
+	selfRegistered.LeaseTTL = 30
+	if selfRegistered.RegistrationTokenID != id {
+		t.Fatalf("Expected the instance to record token %s, got %q", id, selfRegistered.RegistrationTokenID)
+	}
+
+	adminRegistered := service.NewService("orders", "10.0.0.1", 8080, "/health")
+	adminRegistered.LeaseTTL = 30
+	reg.Register(adminRegistered)
+
+	tests := []struct {
+		name     string
+		id       string
+		token    string
+		expected int
+	}{
+		{name: "registering token", id: selfRegistered.ID, token: token, expected: http.StatusOK},
+		{name: "missing token", id: selfRegistered.ID, token: "", expected: http.StatusUnauthorized},
+		{name: "other token for the service", id: selfRegistered.ID, token: other, expected: http.StatusForbidden},
+		{name: "admin-registered instance", id: adminRegistered.ID, token: token, expected: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		if code := heartbeat(router, tt.id, tt.token); code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.expected, code)
+		}
+	}
+}
+
+func TestSelfDrain_WithRegistrationToken(t *testing.T) {
+	router, backend, reg := newTokenRouterWithRegistry(t)
+	token, _ := issueToken(t, router, `{"service_names":["orders"]}`)
+	other, _ := issueToken(t, router, `{"service_names":["orders"]}`)
+
+	if code := selfRegister(router, backend, "orders", token); code != http.StatusCreated {
+		t.Fatalf("Expected self-registration to succeed, got %d", code)
+	}
+	instances, _ := reg.GetByName("orders")
+	svc := instances[0]
+
+	drain := func(token string) int {
+		req := httptest.NewRequest("POST", "/register/"+svc.ID+"/drain", nil)
+		req.Header.Set(core.RegistrationTokenHeader, token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := drain(other); code != http.StatusForbidden {
+		t.Errorf("Expected a drain with another token to be rejected, got %d", code)
+	}
+	if code := drain(token); code != http.StatusAccepted || svc.Status != service.StatusDraining {
+		t.Errorf("Expected the instance to drain itself with its token, got %d (%s)", code, svc.Status)
+	}
+}
@@ -0,0 +1,111 @@
+// Package trafficmirror provides HTTP handlers for managing the traffic
+// mirrors of routed services.
+package trafficmirror
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core"
+	"nfcunha/hermes/hermes-server/core/domain/mirror"
+	"nfcunha/hermes/hermes-server/handler/middleware"
+)
+
+// Handler manages traffic mirrors
+type Handler struct {
+	mirrors *core.TrafficMirror
+}
+
+// NewHandler creates a new traffic mirror handler
+func NewHandler(mirrors *core.TrafficMirror) *Handler {
+	return &Handler{
+		mirrors: mirrors,
+	}
+}
+
+// RegisterRoutes registers the traffic mirror endpoints. All of them require
+// authentication and admin privileges.
+// Routes:
+//   - GET    /traffic-mirrors               - List mirrors
+//   - GET    /traffic-mirrors/:serviceName  - Get the mirror of a service
+//   - PUT    /traffic-mirrors/:serviceName  - Create or replace the mirror of a service
+//   - DELETE /traffic-mirrors/:serviceName  - Stop mirroring a service
+func (h *Handler) RegisterRoutes(router gin.IRouter, authMiddleware, adminMiddleware gin.HandlerFunc) {
+	mirrors := router.Group("/traffic-mirrors")
+	mirrors.Use(authMiddleware, adminMiddleware)
+	{
+		mirrors.GET("", h.handleListMirrors)
+		mirrors.GET("/:serviceName", h.handleGetMirror)
+		mirrors.PUT("/:serviceName", h.handleSetMirror)
+		mirrors.DELETE("/:serviceName", h.handleDeleteMirror)
+	}
+}
+
+// SetMirrorRequest represents the payload for setting a traffic mirror.
+// Target is the registered service receiving copies of percent (0-100) of
+// the service's requests.
+type SetMirrorRequest struct {
+	Target  string  `json:"target" binding:"required"`
+	Percent float64 `json:"percent"`
+}
+
+// handleListMirrors returns all mirrors
+func (h *Handler) handleListMirrors(c *gin.Context) {
+	mirrors := h.mirrors.List()
+	c.JSON(http.StatusOK, gin.H{
+		"traffic_mirrors": mirrors,
+		"count":           len(mirrors),
+	})
+}
+
+// handleGetMirror returns the mirror of a service
+func (h *Handler) handleGetMirror(c *gin.Context) {
+	mr, err := h.mirrors.Get(c.Param("serviceName"))
+	if err != nil {
+		middleware.ErrorJSON(c, http.StatusNotFound, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, mr)
+}
+
+// handleSetMirror creates or replaces the mirror of a service
+func (h *Handler) handleSetMirror(c *gin.Context) {
+	var req SetMirrorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.ErrorJSON(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	mr := &mirror.Mirror{
+		ServiceName: c.Param("serviceName"),
+		Target:      req.Target,
+		Percent:     req.Percent,
+	}
+	if err := mr.Validate(); err != nil {
+		middleware.ErrorJSON(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.mirrors.Set(mr); err != nil {
+		middleware.ErrorJSON(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	core.Logf(c, "Traffic mirror for %s set to %v%% to %s", mr.ServiceName, mr.Percent, mr.Target)
+	c.JSON(http.StatusOK, mr)
+}
+
+// handleDeleteMirror removes the mirror of a service
+func (h *Handler) handleDeleteMirror(c *gin.Context) {
+	serviceName := c.Param("serviceName")
+	if err := h.mirrors.Delete(serviceName); err != nil {
+		status := http.StatusNotFound
+		if err.Error() == "failed to delete traffic mirror" {
+			status = http.StatusInternalServerError
+		}
+		middleware.ErrorJSON(c, status, err.Error())
+		return
+	}
+
+	core.Logf(c, "Traffic mirror for %s removed", serviceName)
+	c.JSON(http.StatusOK, gin.H{"message": "traffic mirror removed"})
+}
@@ -0,0 +1,144 @@
+// Package trafficsplit provides HTTP handlers for managing the weighted
+// traffic splits of routed services.
+package trafficsplit
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"nfcunha/hermes/hermes-server/core"
+	"nfcunha/hermes/hermes-server/core/domain/split"
+	"nfcunha/hermes/hermes-server/handler/middleware"
+)
+
+// Handler manages traffic splits
+type Handler struct {
+	splitter *core.TrafficSplitter
+}
+
+// NewHandler creates a new traffic split handler
+func NewHandler(splitter *core.TrafficSplitter) *Handler {
+	return &Handler{
+		splitter: splitter,
+	}
+}
+
+// RegisterRoutes registers the traffic split endpoints. All of them require
+// authentication and admin privileges.
+// Routes:
+//   - GET    /traffic-splits                      - List splits
+//   - GET    /traffic-splits/:serviceName         - Get the split of a service
+//   - PUT    /traffic-splits/:serviceName         - Create or replace the split of a service
+//   - PATCH  /traffic-splits/:serviceName/weights - Change the weights of targets
+//   - DELETE /traffic-splits/:serviceName         - Remove the split of a service
+func (h *Handler) RegisterRoutes(router gin.IRouter, authMiddleware, adminMiddleware gin.HandlerFunc) {
+	splits := router.Group("/traffic-splits")
+	splits.Use(authMiddleware, adminMiddleware)
+	{
+		splits.GET("", h.handleListSplits)
+		splits.GET("/:serviceName", h.handleGetSplit)
+		splits.PUT("/:serviceName", h.handleSetSplit)
+		splits.PATCH("/:serviceName/weights", h.handleSetWeights)
+		splits.DELETE("/:serviceName", h.handleDeleteSplit)
+	}
+}
+
+// SetSplitRequest represents the payload for setting a traffic split.
+// Each target selects instances by metadata; a target without a selector
+// takes the remaining instances. StickyCookie is optional.
+type SetSplitRequest struct {
+	Targets      []split.Target `json:"targets" binding:"required"`
+	StickyCookie string         `json:"sticky_cookie"`
+}
+
+// SetWeightsRequest represents the payload for changing weights, keyed by
+// target name.
+type SetWeightsRequest struct {
+	Weights map[string]int `json:"weights" binding:"required"`
+}
+
+// handleListSplits returns all splits
+func (h *Handler) handleListSplits(c *gin.Context) {
+	splits := h.splitter.List()
+	c.JSON(http.StatusOK, gin.H{
+		"traffic_splits": splits,
+		"count":          len(splits),
+	})
+}
+
+// handleGetSplit returns the split of a service
+func (h *Handler) handleGetSplit(c *gin.Context) {
+	ts, err := h.splitter.Get(c.Param("serviceName"))
+	if err != nil {
+		middleware.ErrorJSON(c, http.StatusNotFound, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, ts)
+}
+
+// handleSetSplit creates or replaces the split of a service
+func (h *Handler) handleSetSplit(c *gin.Context) {
+	var req SetSplitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.ErrorJSON(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ts := &split.TrafficSplit{
+		ServiceName:  c.Param("serviceName"),
+		Targets:      req.Targets,
+		StickyCookie: req.StickyCookie,
+	}
+	if err := ts.Validate(); err != nil {
+		middleware.ErrorJSON(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.splitter.Set(ts); err != nil {
+		middleware.ErrorJSON(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	core.Logf(c, "Traffic split for %s set with %d targets", ts.ServiceName, len(ts.Targets))
+	c.JSON(http.StatusOK, ts)
+}
+
+// handleSetWeights changes the weights of targets of a split
+func (h *Handler) handleSetWeights(c *gin.Context) {
+	var req SetWeightsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		middleware.ErrorJSON(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	serviceName := c.Param("serviceName")
+	ts, err := h.splitter.SetWeights(serviceName, req.Weights)
+	if err != nil {
+		status := http.StatusBadRequest
+		if err.Error() == "traffic split not found" {
+			status = http.StatusNotFound
+		} else if err.Error() == "failed to save traffic split" {
+			status = http.StatusInternalServerError
+		}
+		middleware.ErrorJSON(c, status, err.Error())
+		return
+	}
+
+	core.Logf(c, "Traffic split weights for %s changed to %v", serviceName, req.Weights)
+	c.JSON(http.StatusOK, ts)
+}
+
+// handleDeleteSplit removes the split of a service
+func (h *Handler) handleDeleteSplit(c *gin.Context) {
+	serviceName := c.Param("serviceName")
+	if err := h.splitter.Delete(serviceName); err != nil {
+		status := http.StatusNotFound
+		if err.Error() == "failed to delete traffic split" {
+			status = http.StatusInternalServerError
+		}
+		middleware.ErrorJSON(c, status, err.Error())
+		return
+	}
+
+	core.Logf(c, "Traffic split for %s removed", serviceName)
+	c.JSON(http.StatusOK, gin.H{"message": "traffic split removed"})
+}
@@ -7,7 +7,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"time"
 
@@ -84,13 +83,13 @@ func (h *Handler) RegisterRoutes(router gin.IRouter, authMiddleware gin.HandlerF
 func (h *Handler) handleLogin(c *gin.Context) {
 	body, err := readRequestBody(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request"})
+		middleware.ErrorJSON(c, http.StatusBadRequest, "failed to read request")
 		return
 	}
 
-	respBody, statusCode, err := h.proxyToAegis("POST", "/aegis/users/login", body)
+	respBody, statusCode, err := h.proxyToAegis(c, "POST", "/aegis/users/login", body)
 	if err != nil {
-		c.JSON(statusCode, gin.H{"error": err.Error()})
+		middleware.ErrorJSON(c, statusCode, err.Error())
 		return
 	}
 
@@ -102,13 +101,13 @@ func (h *Handler) handleLogin(c *gin.Context) {
 func (h *Handler) handleRegisterUser(c *gin.Context) {
 	body, err := readRequestBody(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request"})
+		middleware.ErrorJSON(c, http.StatusBadRequest, "failed to read request")
 		return
 	}
 
-	respBody, statusCode, err := h.proxyToAegis("POST", "/aegis/users/register", body)
+	respBody, statusCode, err := h.proxyToAegis(c, "POST", "/aegis/users/register", body)
 	if err != nil {
-		c.JSON(statusCode, gin.H{"error": err.Error()})
+		middleware.ErrorJSON(c, statusCode, err.Error())
 		return
 	}
 
@@ -118,9 +117,9 @@ func (h *Handler) handleRegisterUser(c *gin.Context) {
 // handleListUsers retrieves all users from Aegis.
 // Only admin users can list users.
 func (h *Handler) handleListUsers(c *gin.Context) {
-	respBody, statusCode, err := h.proxyToAegis("GET", "/aegis/users", nil)
+	respBody, statusCode, err := h.proxyToAegis(c, "GET", "/aegis/users", nil)
 	if err != nil {
-		c.JSON(statusCode, gin.H{"error": err.Error()})
+		middleware.ErrorJSON(c, statusCode, err.Error())
 		return
 	}
 
@@ -133,9 +132,9 @@ func (h *Handler) handleGetUser(c *gin.Context) {
 	userID := c.Param("id")
 	path := fmt.Sprintf("/aegis/users/%s", userID)
 
-	respBody, statusCode, err := h.proxyToAegis("GET", path, nil)
+	respBody, statusCode, err := h.proxyToAegis(c, "GET", path, nil)
 	if err != nil {
-		c.JSON(statusCode, gin.H{"error": err.Error()})
+		middleware.ErrorJSON(c, statusCode, err.Error())
 		return
 	}
 
@@ -150,13 +149,13 @@ func (h *Handler) handleUpdateUser(c *gin.Context) {
 
 	body, err := readRequestBody(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request"})
+		middleware.ErrorJSON(c, http.StatusBadRequest, "failed to read request")
 		return
 	}
 
-	respBody, statusCode, err := h.proxyToAegis("PUT", path, body)
+	respBody, statusCode, err := h.proxyToAegis(c, "PUT", path, body)
 	if err != nil {
-		c.JSON(statusCode, gin.H{"error": err.Error()})
+		middleware.ErrorJSON(c, statusCode, err.Error())
 		return
 	}
 
@@ -169,9 +168,9 @@ func (h *Handler) handleDeleteUser(c *gin.Context) {
 	userID := c.Param("id")
 	path := fmt.Sprintf("/aegis/users/%s", userID)
 
-	respBody, statusCode, err := h.proxyToAegis("DELETE", path, nil)
+	respBody, statusCode, err := h.proxyToAegis(c, "DELETE", path, nil)
 	if err != nil {
-		c.JSON(statusCode, gin.H{"error": err.Error()})
+		middleware.ErrorJSON(c, statusCode, err.Error())
 		return
 	}
 
@@ -186,13 +185,13 @@ func (h *Handler) handleAddRole(c *gin.Context) {
 
 	body, err := readRequestBody(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request"})
+		middleware.ErrorJSON(c, http.StatusBadRequest, "failed to read request")
 		return
 	}
 
-	respBody, statusCode, err := h.proxyToAegis("POST", path, body)
+	respBody, statusCode, err := h.proxyToAegis(c, "POST", path, body)
 	if err != nil {
-		c.JSON(statusCode, gin.H{"error": err.Error()})
+		middleware.ErrorJSON(c, statusCode, err.Error())
 		return
 	}
 
@@ -206,9 +205,9 @@ func (h *Handler) handleRemoveRole(c *gin.Context) {
 	roleID := c.Param("roleId")
 	path := fmt.Sprintf("/aegis/users/%s/roles/%s", userID, roleID)
 
-	respBody, statusCode, err := h.proxyToAegis("DELETE", path, nil)
+	respBody, statusCode, err := h.proxyToAegis(c, "DELETE", path, nil)
 	if err != nil {
-		c.JSON(statusCode, gin.H{"error": err.Error()})
+		middleware.ErrorJSON(c, statusCode, err.Error())
 		return
 	}
 
@@ -223,13 +222,13 @@ func (h *Handler) handleAddPermission(c *gin.Context) {
 
 	body, err := readRequestBody(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request"})
+		middleware.ErrorJSON(c, http.StatusBadRequest, "failed to read request")
 		return
 	}
 
-	respBody, statusCode, err := h.proxyToAegis("POST", path, body)
+	respBody, statusCode, err := h.proxyToAegis(c, "POST", path, body)
 	if err != nil {
-		c.JSON(statusCode, gin.H{"error": err.Error()})
+		middleware.ErrorJSON(c, statusCode, err.Error())
 		return
 	}
 
@@ -243,9 +242,9 @@ func (h *Handler) handleRemovePermission(c *gin.Context) {
 	permissionID := c.Param("permissionId")
 	path := fmt.Sprintf("/aegis/users/%s/permissions/%s", userID, permissionID)
 
-	respBody, statusCode, err := h.proxyToAegis("DELETE", path, nil)
+	respBody, statusCode, err := h.proxyToAegis(c, "DELETE", path, nil)
 	if err != nil {
-		c.JSON(statusCode, gin.H{"error": err.Error()})
+		middleware.ErrorJSON(c, statusCode, err.Error())
 		return
 	}
 
@@ -262,13 +261,13 @@ func (h *Handler) handleChangePassword(c *gin.Context) {
 	roles, _ := c.Get("user_roles")
 	userRoles, ok := roles.([]string)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid roles format"})
+		middleware.ErrorJSON(c, http.StatusInternalServerError, "invalid roles format")
 		return
 	}
 
 	authUserIDStr, ok := authenticatedUserID.(string)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid user ID format"})
+		middleware.ErrorJSON(c, http.StatusInternalServerError, "invalid user ID format")
 		return
 	}
 
@@ -283,8 +282,8 @@ func (h *Handler) handleChangePassword(c *gin.Context) {
 		}
 
 		if !isAdmin {
-			log.Printf("User %s attempted to change password for user %s", authUserIDStr, userID)
-			c.JSON(http.StatusForbidden, gin.H{"error": "can only change your own password"})
+			core.Logf(c, "User %s attempted to change password for user %s", authUserIDStr, userID)
+			middleware.ErrorJSON(c, http.StatusForbidden, "can only change your own password")
 			return
 		}
 	}
@@ -292,14 +291,14 @@ func (h *Handler) handleChangePassword(c *gin.Context) {
 	// Read and forward password change request
 	body, err := readRequestBody(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request"})
+		middleware.ErrorJSON(c, http.StatusBadRequest, "failed to read request")
 		return
 	}
 
 	path := fmt.Sprintf("/aegis/users/%s/password", userID)
-	respBody, statusCode, err := h.proxyToAegis("POST", path, body)
+	respBody, statusCode, err := h.proxyToAegis(c, "POST", path, body)
 	if err != nil {
-		c.JSON(statusCode, gin.H{"error": err.Error()})
+		middleware.ErrorJSON(c, statusCode, err.Error())
 		return
 	}
 
@@ -318,9 +317,10 @@ func readRequestBody(c *gin.Context) ([]byte, error) {
 
 // proxyToAegis forwards HTTP requests to the Aegis service.
 // It handles request creation, execution, and response reading.
-func (h *Handler) proxyToAegis(method, path string, body []byte) ([]byte, int, error) {
+// The request ID of the incoming request is forwarded to Aegis.
+func (h *Handler) proxyToAegis(c *gin.Context, method, path string, body []byte) ([]byte, int, error) {
 	targetURL := h.aegisURL + path
-	log.Printf("Proxying %s request to Aegis: %s", method, targetURL)
+	core.Logf(c, "Proxying %s request to Aegis: %s", method, targetURL)
 
 	var bodyReader io.Reader
 	if body != nil {
@@ -329,22 +329,23 @@ func (h *Handler) proxyToAegis(method, path string, body []byte) ([]byte, int, e
 
 	req, err := http.NewRequest(method, targetURL, bodyReader)
 	if err != nil {
-		log.Printf("Failed to create HTTP request: %v", err)
+		core.Logf(c, "Failed to create HTTP request: %v", err)
 		return nil, http.StatusInternalServerError, errors.New("failed to create request")
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	core.InjectRequestID(c.Request.Context(), req.Header)
 
 	resp, err := h.httpClient.Do(req)
 	if err != nil {
-		log.Printf("Aegis request failed: %v", err)
+		core.Logf(c, "Aegis request failed: %v", err)
 		return nil, http.StatusBadGateway, errors.New("authentication service unavailable")
 	}
 	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		log.Printf("Failed to read Aegis response: %v", err)
+		core.Logf(c, "Failed to read Aegis response: %v", err)
 		return nil, http.StatusInternalServerError, errors.New("failed to read response")
 	}
 
@@ -15,7 +15,12 @@ import (
 	"github.com/gin-gonic/gin"
 	"nfcunha/hermes/hermes-server/core"
 	"nfcunha/hermes/hermes-server/core/bootstrap"
+	"nfcunha/hermes/hermes-server/core/domain/accesslog"
+	"nfcunha/hermes/hermes-server/core/domain/apikey"
 	"nfcunha/hermes/hermes-server/core/domain/healthlog"
+	"nfcunha/hermes/hermes-server/core/domain/limit"
+	"nfcunha/hermes/hermes-server/core/domain/policy"
+	"nfcunha/hermes/hermes-server/core/domain/regtoken"
 	"nfcunha/hermes/hermes-server/database"
 	"nfcunha/hermes/hermes-server/handler"
 	"nfcunha/hermes/hermes-server/utils/config"
@@ -50,6 +55,17 @@ func main() {
 	}
 	log.Println("Aegis connection successful")
 
+	// Verify Aegis JWTs locally and cache the results of Aegis calls
+	if cfg.Auth.JWKSURL != "none" {
+		jwks := core.NewJWKS(cfg.Auth.JWKSURL, cfg.Auth.JWKSRefreshInterval, cfg.Auth.AegisTimeout)
+		aegisClient.SetJWKS(jwks, cfg.Auth.JWTIssuer, cfg.Auth.JWTAudience)
+	}
+	aegisClient.SetTokenCache(core.NewTokenCache(core.TokenCacheConfig{
+		TTL:         cfg.Auth.TokenCacheTTL,
+		NegativeTTL: cfg.Auth.TokenCacheNegativeTTL,
+		MaxEntries:  cfg.Auth.TokenCacheSize,
+	}))
+
 	// Bootstrap admin user
 	bootstrapper := bootstrap.NewAdminBootstrapper(
 		cfg.Auth.AegisURL,
@@ -73,6 +89,28 @@ func main() {
 	engine := gin.New()
 	engine.Use(gin.Recovery())
 
+	// Client IPs come from X-Forwarded-For only when set by a trusted proxy
+	if err := engine.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid trusted proxies %v: %v", cfg.Server.TrustedProxies, err)
+	}
+
+	// Assign every request a correlation ID, forwarded to backends and echoed in responses
+	engine.Use(handler.RequestIDMiddleware(cfg.Server.RequestIDHeader))
+
+	// Trace requests when an OTLP collector is configured
+	var tracer *core.Tracer
+	if cfg.Tracing.Endpoint != "" {
+		tracer = core.NewTracer(core.TracingConfig{
+			Endpoint:      cfg.Tracing.Endpoint,
+			ServiceName:   cfg.Tracing.ServiceName,
+			BatchSize:     cfg.Tracing.BatchSize,
+			FlushInterval: cfg.Tracing.FlushInterval,
+		})
+		go tracer.Start()
+		defer tracer.Stop()
+	}
+	engine.Use(handler.TracingMiddleware(tracer))
+
 	if config.IsDebugMode() {
 		engine.Use(gin.Logger())
 	}
@@ -80,18 +118,125 @@ func main() {
 	// Add CORS middleware to allow requests from React frontend
 	engine.Use(handler.CORSMiddleware())
 
+	// Collect Prometheus metrics from routing, health checks and Aegis calls
+	metrics := core.NewMetrics()
+	aegisClient.SetMetrics(metrics)
+
 	// Create services
-	prx := core.NewProxyService()
+	prx := core.NewProxyService(cfg.Proxy.ResponseHeaderTimeout, cfg.Proxy.FlushInterval)
 	reg := core.NewServiceRegistry(database.GetDB())
-
-	// Create health log repository and health checker
+	inflight := core.NewInFlightTracker()
+	breaker := core.NewCircuitBreaker(core.BreakerConfig{
+		FailureThreshold: cfg.Breaker.FailureThreshold,
+		OpenDuration:     cfg.Breaker.OpenDuration,
+		HalfOpenRequests: cfg.Breaker.HalfOpenRequests,
+	})
+	reg.OnDeregister(breaker.Forget)
 	healthLogRepo := healthlog.NewRepository(database.GetDB())
-	checker := core.NewHealthChecker(reg, healthLogRepo)
+	outliers := core.NewOutlierDetector(core.OutlierConfig{
+		Window:         cfg.Outlier.Window,
+		MinRequests:    cfg.Outlier.MinRequests,
+		FailurePercent: cfg.Outlier.FailurePercent,
+		BaseEjection:   cfg.Outlier.BaseEjection,
+		MaxEjection:    cfg.Outlier.MaxEjection,
+	}, healthLogRepo)
+	reg.OnDeregister(outliers.Forget)
+	reg.OnDeregister(inflight.Forget)
+	concurrency := core.NewConcurrencyLimiter(core.ConcurrencyConfig{
+		MaxRequests:         cfg.Concurrency.MaxRequests,
+		MaxInstanceRequests: cfg.Concurrency.MaxInstanceRequests,
+		QueueSize:           cfg.Concurrency.QueueSize,
+		QueueTimeout:        cfg.Concurrency.QueueTimeout,
+	}, metrics)
+	retryOn, err := core.ParseRetryOn(cfg.Retry.RetryOn)
+	if err != nil {
+		log.Fatalf("Invalid HERMES_RETRY_ON: %v", err)
+	}
+	// Requests may select instances by metadata through the subset header
+	subsets := core.SubsetConfig{Header: cfg.Subset.Header, Fallback: core.SubsetFallback(cfg.Subset.Fallback)}
+	if subsets.Header == "none" {
+		subsets.Header = ""
+	}
+
+	// Weighted traffic splits of services for canary releases
+	splitter := core.NewTrafficSplitter(database.GetDB(), metrics)
+
+	// Copies of requests sent to other services, e.g. to validate a rewrite
+	mirrors := core.NewTrafficMirror(database.GetDB(), reg, cfg.Mirror.Timeout, cfg.Mirror.MaxInFlight, metrics)
+
+	routingService := core.NewRoutingService(reg, prx, inflight, breaker, outliers, concurrency, splitter, mirrors, metrics, core.RetryPolicy{
+		Attempts:      cfg.Retry.Attempts,
+		PerTryTimeout: cfg.Retry.PerTryTimeout,
+		Backoff:       cfg.Retry.Backoff,
+		RetryOn:       retryOn,
+	}, subsets)
+
+	// Create health checker
+	checker := core.NewHealthChecker(reg, healthLogRepo, metrics)
 	go checker.Start()
 	defer checker.Stop()
 
+	// Deregister draining instances once their in-flight requests finish
+	drainer := core.NewDrainManager(reg, inflight, cfg.Drain.CheckInterval, cfg.Drain.DefaultTimeout)
+	go drainer.Start()
+	defer drainer.Stop()
+
+	// Expire self-registered services whose lease was not renewed
+	reaper := core.NewLeaseReaper(reg, drainer, cfg.Lease.ReapInterval, cfg.Lease.DrainPeriod)
+	go reaper.Start()
+	defer reaper.Stop()
+
+	// Write the access log of routed traffic in the background
+	accessLogger := newAccessLogger(cfg.AccessLog)
+	go accessLogger.Start()
+	defer accessLogger.Stop()
+
+	// Access policies of routed services
+	policies := core.NewRoutePolicyStore(database.GetDB(), policy.Access(cfg.Auth.RouteDefaultAccess))
+
+	// API keys of machine clients
+	apiKeys := core.NewAPIKeys(apikey.NewRepository(database.GetDB()), cfg.Auth.APIKeyHeader)
+
+	// Rate limits of routed services
+	limiter := core.NewRateLimiter(database.GetDB(), limit.RateLimit{
+		RequestsPerSecond: cfg.RateLimit.RequestsPerSecond,
+		Burst:             cfg.RateLimit.Burst,
+		Key:               limit.KeyType(cfg.RateLimit.Key),
+	})
+
+	// Rules routing requests at the gateway root
+	table := core.NewRouteTable(database.GetDB())
+
+	// Static services, route rules, route policies and rate limits from the route config file
+	if cfg.Routes.File != "" {
+		loader := core.NewRouteConfigLoader(cfg.Routes.File, cfg.Routes.WatchInterval, reg, drainer, policies, limiter, table, metrics)
+		if err := loader.Load(); err != nil {
+			log.Fatalf("Failed to load route config: %v", err)
+		}
+		if cfg.Routes.WatchInterval > 0 {
+			go loader.Start()
+			defer loader.Stop()
+		}
+
+		// Reload on SIGHUP
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				log.Println("SIGHUP received, reloading route config")
+				loader.Load()
+			}
+		}()
+	}
+
+	// Tokens authorizing self-registration
+	tokens := core.NewRegistrationTokens(regtoken.NewRepository(database.GetDB()), cfg.Auth.RegistrationTokenRequired)
+	if !cfg.Auth.RegistrationTokenRequired {
+		log.Println("Warning: self-registration without a registration token is allowed (HERMES_REGISTRATION_TOKEN_REQUIRED=false)")
+	}
+
 	// Register routes
-	handler.RegisterRoutes(engine, prx, reg, aegisClient, cfg.Auth.AegisURL)
+	handler.RegisterRoutes(engine, routingService, reg, drainer, breaker, concurrency, aegisClient, cfg.Auth.AegisURL, metrics, accessLogger, policies, tokens, apiKeys, limiter, table, splitter, mirrors)
 
 	// Create HTTP server
 	addr := cfg.Server.Host + ":" + strconv.Itoa(cfg.Server.Port)
@@ -130,3 +275,29 @@ func main() {
 
 	log.Println("Gateway stopped gracefully")
 }
+
+// newAccessLogger creates the access logger for the configured sink, or nil
+// if access logging is disabled.
+func newAccessLogger(cfg config.AccessLogConfig) *core.AccessLogger {
+	var sink core.AccessLogSink
+	switch cfg.Sink {
+	case "stdout":
+		sink = core.NewWriterSink(os.Stdout)
+	case "file":
+		fileSink, err := core.NewFileSink(cfg.File, int64(cfg.MaxSizeMB)*1024*1024, cfg.MaxBackups)
+		if err != nil {
+			log.Fatalf("Failed to open access log: %v", err)
+		}
+		sink = fileSink
+	case "sqlite":
+		sink = core.NewRepositorySink(accesslog.NewRepository(database.GetDB()), cfg.MaxRows)
+	default:
+		return nil
+	}
+
+	log.Printf("Access log: sink=%s, sample rate=%v", cfg.Sink, cfg.SampleRate)
+	return core.NewAccessLogger(sink, core.AccessLogConfig{
+		SampleRate:      cfg.SampleRate,
+		AlwaysLogErrors: cfg.AlwaysLogErrors,
+	})
+}
@@ -4,32 +4,59 @@ package config
 import (
 	"errors"
 	"log"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // Config represents the complete Hermes configuration loaded from environment variables.
 type Config struct {
-	Server    ServerConfig
-	Auth      AuthConfig
-	Bootstrap BootstrapConfig
+	Server      ServerConfig
+	Auth        AuthConfig
+	Bootstrap   BootstrapConfig
+	Lease       LeaseConfig
+	Drain       DrainConfig
+	Proxy       ProxyConfig
+	Breaker     BreakerConfig
+	Retry       RetryConfig
+	Subset      SubsetConfig
+	Mirror      MirrorConfig
+	Outlier     OutlierConfig
+	Concurrency ConcurrencyConfig
+	Tracing     TracingConfig
+	AccessLog   AccessLogConfig
+	RateLimit   RateLimitConfig
+	Routes      RoutesConfig
 }
 
 // ServerConfig contains HTTP server settings.
 type ServerConfig struct {
-	Host           string
-	Port           int
-	ReadTimeout    time.Duration
-	WriteTimeout   time.Duration
-	IdleTimeout    time.Duration
-	MaxHeaderBytes int
+	Host            string
+	Port            int
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	MaxHeaderBytes  int
+	RequestIDHeader string   // Header carrying the correlation ID of a request
+	TrustedProxies  []string // Proxies whose X-Forwarded-For is trusted for client IPs
 }
 
 // AuthConfig contains authentication settings.
 type AuthConfig struct {
-	AegisURL     string
-	AegisTimeout time.Duration
+	AegisURL                  string
+	AegisTimeout              time.Duration
+	JWKSURL                   string        // Keys for local JWT validation, "none" disables it
+	JWKSRefreshInterval       time.Duration // How often the keys are refetched
+	JWTIssuer                 string        // Required iss claim, empty to skip the check
+	JWTAudience               string        // Required aud claim, empty to skip the check
+	TokenCacheTTL             time.Duration // Maximum time a valid Aegis result is reused, 0 disables
+	TokenCacheNegativeTTL     time.Duration // Time an invalid Aegis result is reused, 0 disables
+	TokenCacheSize            int           // Aegis results kept in the cache
+	RouteDefaultAccess        string        // Access to services without a route policy
+	RegistrationTokenRequired bool          // Reject self-registration without a registration token
+	APIKeyHeader              string        // Header carrying API keys
 }
 
 // BootstrapConfig contains initial admin user settings.
@@ -38,33 +65,267 @@ type BootstrapConfig struct {
 	AdminPassword string
 }
 
+// LeaseConfig contains settings for self-registration leases.
+type LeaseConfig struct {
+	ReapInterval time.Duration // How often expired leases are looked for
+	DrainPeriod  time.Duration // How long an expired instance drains before removal
+}
+
+// DrainConfig contains settings for graceful instance draining.
+type DrainConfig struct {
+	CheckInterval  time.Duration // How often draining instances are checked
+	DefaultTimeout time.Duration // Deadline for drains started without an explicit timeout
+}
+
+// ProxyConfig contains settings for forwarding requests to backends.
+type ProxyConfig struct {
+	ResponseHeaderTimeout time.Duration // How long to wait for backend response headers
+	FlushInterval         time.Duration // How often streamed responses are flushed (negative: every write)
+}
+
+// BreakerConfig contains default per-instance circuit breaker thresholds.
+type BreakerConfig struct {
+	FailureThreshold int           // Consecutive failures that open the breaker
+	OpenDuration     time.Duration // Time spent open before trial requests are allowed
+	HalfOpenRequests int           // Concurrent trial requests allowed while half-open
+}
+
+// RetryConfig contains the default policy for retrying failed requests on another instance.
+type RetryConfig struct {
+	Attempts      int           // Maximum attempts per request, including the first (1: no retries)
+	PerTryTimeout time.Duration // Time each attempt may wait for response headers (0: proxy default)
+	Backoff       time.Duration // Base delay between attempts, doubled after each retry
+	RetryOn       string        // Comma-separated status codes that trigger a retry
+}
+
+// SubsetConfig contains settings for routing requests to a subset of a
+// service's instances selected by metadata.
+type SubsetConfig struct {
+	Header   string // Request header carrying a selector such as "region=eu,version=beta" ("none": disabled)
+	Fallback string // When no instance matches: "none" rejects the request, "all" uses every instance
+}
+
+// MirrorConfig contains settings for sending mirrored copies of requests.
+type MirrorConfig struct {
+	Timeout     time.Duration // Time a mirrored copy may take before it is given up
+	MaxInFlight int           // Mirrored copies pending at once; further copies are dropped
+}
+
+// OutlierConfig contains settings for passive outlier detection on proxied traffic.
+type OutlierConfig struct {
+	Window         time.Duration // Sliding window over which failure rates are computed
+	MinRequests    int           // Requests needed in the window before an instance can be ejected
+	FailurePercent int           // Failure rate (0-100) that ejects an instance (0: disabled)
+	BaseEjection   time.Duration // Ejection period for the first ejection, doubled on each repeat
+	MaxEjection    time.Duration // Upper bound for the ejection period
+}
+
+// ConcurrencyConfig contains default limits on requests in flight to routed services.
+type ConcurrencyConfig struct {
+	MaxRequests         int           // Requests in flight to a service (0: unlimited)
+	MaxInstanceRequests int           // Requests in flight to one instance (0: unlimited)
+	QueueSize           int           // Requests that may wait for a free slot (0: shed at once)
+	QueueTimeout        time.Duration // Time a request may wait for a free slot
+}
+
+// TracingConfig contains settings for exporting trace spans over OTLP/HTTP.
+type TracingConfig struct {
+	Endpoint      string        // Collector base URL, e.g. http://otel-collector:4318 (empty: tracing disabled)
+	ServiceName   string        // service.name reported with every span
+	BatchSize     int           // Spans sent per export request
+	FlushInterval time.Duration // Maximum time a finished span waits before export
+}
+
+// AccessLogConfig contains settings for the structured access log of routed traffic.
+type AccessLogConfig struct {
+	Sink            string  // "stdout", "file", "sqlite", or "none"
+	File            string  // Path of the log file for the file sink
+	MaxSizeMB       int     // Size at which the log file is rotated
+	MaxBackups      int     // Rotated files kept
+	MaxRows         int     // Rows kept by the sqlite sink (0: unlimited)
+	SampleRate      float64 // Fraction of requests logged (0-1)
+	AlwaysLogErrors bool    // Log failed requests regardless of sampling
+}
+
+// RateLimitConfig contains the default rate limit of routed services.
+type RateLimitConfig struct {
+	RequestsPerSecond float64 // Token refill rate (0: services are not limited by default)
+	Burst             int     // Bucket capacity (0: the rate rounded up)
+	Key               string  // What requests are counted by: "ip", "user", "api_key" or "service"
+}
+
+// RoutesConfig contains settings for the declarative route config file.
+type RoutesConfig struct {
+	File          string        // Path of the YAML route config file (empty: disabled)
+	WatchInterval time.Duration // How often the file is checked for changes (0: reload on SIGHUP only)
+}
+
 // Load reads configuration from environment variables with sensible defaults.
 // All environment variables use the HERMES_ prefix:
 //   - HERMES_SERVER_HOST (default: "0.0.0.0")
 //   - HERMES_SERVER_PORT (default: 8080)
+//   - HERMES_REQUEST_ID_HEADER (default: "X-Request-ID")
+//   - HERMES_TRUSTED_PROXIES (default: "127.0.0.1,::1")
 //   - HERMES_AEGIS_URL (default: "http://localhost:3100/api")
+//   - HERMES_JWKS_URL (default: HERMES_AEGIS_URL + "/aegis/api/auth/jwks", "none" disables)
+//   - HERMES_JWKS_REFRESH_INTERVAL (default: 10m)
+//   - HERMES_JWT_ISSUER (default: "", not checked)
+//   - HERMES_JWT_AUDIENCE (default: "", not checked)
+//   - HERMES_TOKEN_CACHE_TTL (default: 1m)
+//   - HERMES_TOKEN_CACHE_NEGATIVE_TTL (default: 10s)
+//   - HERMES_TOKEN_CACHE_SIZE (default: 10000)
+//   - HERMES_ROUTE_DEFAULT_ACCESS (default: "public"; "authenticated")
+//   - HERMES_REGISTRATION_TOKEN_REQUIRED (default: true; false lets services self-register without a token)
+//   - HERMES_API_KEY_HEADER (default: "X-API-Key")
 //   - HERMES_ADMIN_USER (default: "hermes")
 //   - HERMES_ADMIN_PASSWORD (default: "hermes123")
+//   - HERMES_LEASE_REAP_INTERVAL (default: 5s)
+//   - HERMES_LEASE_DRAIN_PERIOD (default: 10s)
+//   - HERMES_DRAIN_CHECK_INTERVAL (default: 1s)
+//   - HERMES_DRAIN_TIMEOUT (default: 30s)
+//   - HERMES_PROXY_RESPONSE_HEADER_TIMEOUT (default: 30s)
+//   - HERMES_PROXY_FLUSH_INTERVAL (default: 100ms)
+//   - HERMES_BREAKER_FAILURE_THRESHOLD (default: 5)
+//   - HERMES_BREAKER_OPEN_DURATION (default: 30s)
+//   - HERMES_BREAKER_HALF_OPEN_REQUESTS (default: 1)
+//   - HERMES_RETRY_ATTEMPTS (default: 1)
+//   - HERMES_RETRY_PER_TRY_TIMEOUT (default: 0, proxy default)
+//   - HERMES_RETRY_BACKOFF (default: 50ms)
+//   - HERMES_RETRY_ON (default: "502,503,504")
+//   - HERMES_SUBSET_HEADER (default: "X-Hermes-Subset", "none" disables)
+//   - HERMES_SUBSET_FALLBACK (default: "none"; "all")
+//   - HERMES_MIRROR_TIMEOUT (default: 5s)
+//   - HERMES_MIRROR_MAX_IN_FLIGHT (default: 100)
+//   - HERMES_OUTLIER_WINDOW (default: 30s)
+//   - HERMES_OUTLIER_MIN_REQUESTS (default: 10)
+//   - HERMES_OUTLIER_FAILURE_PERCENT (default: 50, 0 disables)
+//   - HERMES_OUTLIER_BASE_EJECTION (default: 30s)
+//   - HERMES_OUTLIER_MAX_EJECTION (default: 5m)
+//   - HERMES_CONCURRENCY_MAX_REQUESTS (default: 0, unlimited)
+//   - HERMES_CONCURRENCY_MAX_INSTANCE_REQUESTS (default: 0, unlimited)
+//   - HERMES_CONCURRENCY_QUEUE_SIZE (default: 100)
+//   - HERMES_CONCURRENCY_QUEUE_TIMEOUT (default: 1s)
+//   - HERMES_TRACING_ENDPOINT (default: "", tracing disabled)
+//   - HERMES_TRACING_SERVICE_NAME (default: "hermes")
+//   - HERMES_TRACING_BATCH_SIZE (default: 512)
+//   - HERMES_TRACING_FLUSH_INTERVAL (default: 5s)
+//   - HERMES_ACCESS_LOG_SINK (default: "stdout"; "file", "sqlite", "none")
+//   - HERMES_ACCESS_LOG_FILE (default: "/app/data/access.log")
+//   - HERMES_ACCESS_LOG_MAX_SIZE_MB (default: 100)
+//   - HERMES_ACCESS_LOG_MAX_BACKUPS (default: 5)
+//   - HERMES_ACCESS_LOG_MAX_ROWS (default: 1000000; 0 keeps every row)
+//   - HERMES_ACCESS_LOG_SAMPLE_RATE (default: 1.0)
+//   - HERMES_ACCESS_LOG_ALWAYS_LOG_ERRORS (default: true)
+//   - HERMES_RATE_LIMIT_RPS (default: 0, not limited)
+//   - HERMES_RATE_LIMIT_BURST (default: 0, the rate rounded up)
+//   - HERMES_RATE_LIMIT_KEY (default: "ip"; "user", "api_key", "service")
+//   - HERMES_ROUTE_CONFIG_FILE (default: "", disabled)
+//   - HERMES_ROUTE_CONFIG_WATCH_INTERVAL (default: 5s, 0 disables watching)
 //
 // Returns an error if validation fails (e.g., invalid port number).
 func Load() (*Config, error) {
 	cfg := &Config{
 		Server: ServerConfig{
-			Host:           getEnv("HERMES_SERVER_HOST", "0.0.0.0"),
-			Port:           getEnvInt("HERMES_SERVER_PORT", 8080),
-			ReadTimeout:    getEnvDuration("HERMES_SERVER_READ_TIMEOUT", 30*time.Second),
-			WriteTimeout:   getEnvDuration("HERMES_SERVER_WRITE_TIMEOUT", 30*time.Second),
-			IdleTimeout:    getEnvDuration("HERMES_SERVER_IDLE_TIMEOUT", 60*time.Second),
-			MaxHeaderBytes: getEnvInt("HERMES_SERVER_MAX_HEADER_BYTES", 1048576), // 1MB
+			Host:            getEnv("HERMES_SERVER_HOST", "0.0.0.0"),
+			Port:            getEnvInt("HERMES_SERVER_PORT", 8080),
+			ReadTimeout:     getEnvDuration("HERMES_SERVER_READ_TIMEOUT", 30*time.Second),
+			WriteTimeout:    getEnvDuration("HERMES_SERVER_WRITE_TIMEOUT", 30*time.Second),
+			IdleTimeout:     getEnvDuration("HERMES_SERVER_IDLE_TIMEOUT", 60*time.Second),
+			MaxHeaderBytes:  getEnvInt("HERMES_SERVER_MAX_HEADER_BYTES", 1048576), // 1MB
+			RequestIDHeader: getEnv("HERMES_REQUEST_ID_HEADER", "X-Request-ID"),
+			TrustedProxies:  getEnvList("HERMES_TRUSTED_PROXIES", "127.0.0.1,::1"),
 		},
 		Auth: AuthConfig{
-			AegisURL:     getEnv("HERMES_AEGIS_URL", "http://localhost:3100/api"),
-			AegisTimeout: getEnvDuration("HERMES_AEGIS_TIMEOUT", 5*time.Second),
+			AegisURL:                  getEnv("HERMES_AEGIS_URL", "http://localhost:3100/api"),
+			AegisTimeout:              getEnvDuration("HERMES_AEGIS_TIMEOUT", 5*time.Second),
+			JWKSURL:                   getEnv("HERMES_JWKS_URL", ""),
+			JWKSRefreshInterval:       getEnvDuration("HERMES_JWKS_REFRESH_INTERVAL", 10*time.Minute),
+			JWTIssuer:                 getEnv("HERMES_JWT_ISSUER", ""),
+			JWTAudience:               getEnv("HERMES_JWT_AUDIENCE", ""),
+			TokenCacheTTL:             getEnvDuration("HERMES_TOKEN_CACHE_TTL", time.Minute),
+			TokenCacheNegativeTTL:     getEnvDuration("HERMES_TOKEN_CACHE_NEGATIVE_TTL", 10*time.Second),
+			TokenCacheSize:            getEnvInt("HERMES_TOKEN_CACHE_SIZE", 10000),
+			RouteDefaultAccess:        getEnv("HERMES_ROUTE_DEFAULT_ACCESS", "public"),
+			RegistrationTokenRequired: getEnvBool("HERMES_REGISTRATION_TOKEN_REQUIRED", true),
+			APIKeyHeader:              getEnv("HERMES_API_KEY_HEADER", "X-API-Key"),
 		},
 		Bootstrap: BootstrapConfig{
 			AdminUser:     getEnv("HERMES_ADMIN_USER", "hermes"),
 			AdminPassword: getEnv("HERMES_ADMIN_PASSWORD", "hermes123"),
 		},
+		Lease: LeaseConfig{
+			ReapInterval: getEnvDuration("HERMES_LEASE_REAP_INTERVAL", 5*time.Second),
+			DrainPeriod:  getEnvDuration("HERMES_LEASE_DRAIN_PERIOD", 10*time.Second),
+		},
+		Drain: DrainConfig{
+			CheckInterval:  getEnvDuration("HERMES_DRAIN_CHECK_INTERVAL", time.Second),
+			DefaultTimeout: getEnvDuration("HERMES_DRAIN_TIMEOUT", 30*time.Second),
+		},
+		Proxy: ProxyConfig{
+			ResponseHeaderTimeout: getEnvDuration("HERMES_PROXY_RESPONSE_HEADER_TIMEOUT", 30*time.Second),
+			FlushInterval:         getEnvDuration("HERMES_PROXY_FLUSH_INTERVAL", 100*time.Millisecond),
+		},
+		Breaker: BreakerConfig{
+			FailureThreshold: getEnvInt("HERMES_BREAKER_FAILURE_THRESHOLD", 5),
+			OpenDuration:     getEnvDuration("HERMES_BREAKER_OPEN_DURATION", 30*time.Second),
+			HalfOpenRequests: getEnvInt("HERMES_BREAKER_HALF_OPEN_REQUESTS", 1),
+		},
+		Retry: RetryConfig{
+			Attempts:      getEnvInt("HERMES_RETRY_ATTEMPTS", 1),
+			PerTryTimeout: getEnvDuration("HERMES_RETRY_PER_TRY_TIMEOUT", 0),
+			Backoff:       getEnvDuration("HERMES_RETRY_BACKOFF", 50*time.Millisecond),
+			RetryOn:       getEnv("HERMES_RETRY_ON", "502,503,504"),
+		},
+		Subset: SubsetConfig{
+			Header:   getEnv("HERMES_SUBSET_HEADER", "X-Hermes-Subset"),
+			Fallback: getEnv("HERMES_SUBSET_FALLBACK", "none"),
+		},
+		Mirror: MirrorConfig{
+			Timeout:     getEnvDuration("HERMES_MIRROR_TIMEOUT", 5*time.Second),
+			MaxInFlight: getEnvInt("HERMES_MIRROR_MAX_IN_FLIGHT", 100),
+		},
+		Outlier: OutlierConfig{
+			Window:         getEnvDuration("HERMES_OUTLIER_WINDOW", 30*time.Second),
+			MinRequests:    getEnvInt("HERMES_OUTLIER_MIN_REQUESTS", 10),
+			FailurePercent: getEnvInt("HERMES_OUTLIER_FAILURE_PERCENT", 50),
+			BaseEjection:   getEnvDuration("HERMES_OUTLIER_BASE_EJECTION", 30*time.Second),
+			MaxEjection:    getEnvDuration("HERMES_OUTLIER_MAX_EJECTION", 5*time.Minute),
+		},
+		Concurrency: ConcurrencyConfig{
+			MaxRequests:         getEnvInt("HERMES_CONCURRENCY_MAX_REQUESTS", 0),
+			MaxInstanceRequests: getEnvInt("HERMES_CONCURRENCY_MAX_INSTANCE_REQUESTS", 0),
+			QueueSize:           getEnvInt("HERMES_CONCURRENCY_QUEUE_SIZE", 100),
+			QueueTimeout:        getEnvDuration("HERMES_CONCURRENCY_QUEUE_TIMEOUT", time.Second),
+		},
+		Tracing: TracingConfig{
+			Endpoint:      getEnv("HERMES_TRACING_ENDPOINT", ""),
+			ServiceName:   getEnv("HERMES_TRACING_SERVICE_NAME", "hermes"),
+			BatchSize:     getEnvInt("HERMES_TRACING_BATCH_SIZE", 512),
+			FlushInterval: getEnvDuration("HERMES_TRACING_FLUSH_INTERVAL", 5*time.Second),
+		},
+		AccessLog: AccessLogConfig{
+			Sink:            getEnv("HERMES_ACCESS_LOG_SINK", "stdout"),
+			File:            getEnv("HERMES_ACCESS_LOG_FILE", "/app/data/access.log"),
+			MaxSizeMB:       getEnvInt("HERMES_ACCESS_LOG_MAX_SIZE_MB", 100),
+			MaxBackups:      getEnvInt("HERMES_ACCESS_LOG_MAX_BACKUPS", 5),
+			MaxRows:         getEnvInt("HERMES_ACCESS_LOG_MAX_ROWS", 1000000),
+			SampleRate:      getEnvFloat("HERMES_ACCESS_LOG_SAMPLE_RATE", 1.0),
+			AlwaysLogErrors: getEnvBool("HERMES_ACCESS_LOG_ALWAYS_LOG_ERRORS", true),
+		},
+		RateLimit: RateLimitConfig{
+			RequestsPerSecond: getEnvFloat("HERMES_RATE_LIMIT_RPS", 0),
+			Burst:             getEnvInt("HERMES_RATE_LIMIT_BURST", 0),
+			Key:               getEnv("HERMES_RATE_LIMIT_KEY", "ip"),
+		},
+		Routes: RoutesConfig{
+			File:          getEnv("HERMES_ROUTE_CONFIG_FILE", ""),
+			WatchInterval: getEnvDuration("HERMES_ROUTE_CONFIG_WATCH_INTERVAL", 5*time.Second),
+		},
+	}
+
+	// The JWKS is served by Aegis unless configured otherwise
+	if cfg.Auth.JWKSURL == "" {
+		cfg.Auth.JWKSURL = cfg.Auth.AegisURL + "/aegis/api/auth/jwks"
 	}
 
 	// Validate configuration
@@ -99,6 +360,118 @@ func validate(cfg *Config) error {
 		log.Printf("Invalid write timeout: %v (must be positive)", cfg.Server.WriteTimeout)
 		return errors.New("invalid write timeout")
 	}
+	if cfg.Lease.ReapInterval <= 0 {
+		log.Printf("Invalid lease reap interval: %v (must be positive)", cfg.Lease.ReapInterval)
+		return errors.New("invalid lease reap interval")
+	}
+	if cfg.Drain.CheckInterval <= 0 {
+		log.Printf("Invalid drain check interval: %v (must be positive)", cfg.Drain.CheckInterval)
+		return errors.New("invalid drain check interval")
+	}
+	if cfg.Breaker.FailureThreshold < 1 || cfg.Breaker.HalfOpenRequests < 1 {
+		log.Printf("Invalid circuit breaker thresholds: failures=%d, half-open requests=%d (must be at least 1)",
+			cfg.Breaker.FailureThreshold, cfg.Breaker.HalfOpenRequests)
+		return errors.New("invalid circuit breaker thresholds")
+	}
+	if cfg.Retry.Attempts < 1 {
+		log.Printf("Invalid retry attempts: %d (must be at least 1)", cfg.Retry.Attempts)
+		return errors.New("invalid retry attempts")
+	}
+	if cfg.Retry.PerTryTimeout < 0 || cfg.Retry.Backoff < 0 {
+		log.Printf("Invalid retry timing: per-try timeout=%v, backoff=%v (must not be negative)",
+			cfg.Retry.PerTryTimeout, cfg.Retry.Backoff)
+		return errors.New("invalid retry timing")
+	}
+	if cfg.Subset.Fallback != "none" && cfg.Subset.Fallback != "all" {
+		log.Printf("Invalid subset fallback: %q (must be none or all)", cfg.Subset.Fallback)
+		return errors.New("invalid subset fallback")
+	}
+	if cfg.Mirror.Timeout <= 0 || cfg.Mirror.MaxInFlight < 1 {
+		log.Printf("Invalid mirror settings: timeout=%v, max in flight=%d (must be positive)",
+			cfg.Mirror.Timeout, cfg.Mirror.MaxInFlight)
+		return errors.New("invalid mirror settings")
+	}
+	if cfg.Outlier.FailurePercent < 0 || cfg.Outlier.FailurePercent > 100 {
+		log.Printf("Invalid outlier failure percent: %d (must be 0-100)", cfg.Outlier.FailurePercent)
+		return errors.New("invalid outlier failure percent")
+	}
+	if cfg.Outlier.Window <= 0 || cfg.Outlier.BaseEjection <= 0 || cfg.Outlier.MaxEjection < cfg.Outlier.BaseEjection {
+		log.Printf("Invalid outlier timing: window=%v, base ejection=%v, max ejection=%v (must be positive, max >= base)",
+			cfg.Outlier.Window, cfg.Outlier.BaseEjection, cfg.Outlier.MaxEjection)
+		return errors.New("invalid outlier timing")
+	}
+	if cfg.Concurrency.MaxRequests < 0 || cfg.Concurrency.MaxInstanceRequests < 0 || cfg.Concurrency.QueueSize < 0 || cfg.Concurrency.QueueTimeout < 0 {
+		log.Printf("Invalid concurrency limits: max requests=%d, max instance requests=%d, queue size=%d, queue timeout=%v (must not be negative)",
+			cfg.Concurrency.MaxRequests, cfg.Concurrency.MaxInstanceRequests, cfg.Concurrency.QueueSize, cfg.Concurrency.QueueTimeout)
+		return errors.New("invalid concurrency limits")
+	}
+	if cfg.Tracing.Endpoint != "" {
+		if u, err := url.Parse(cfg.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			log.Printf("Invalid tracing endpoint: %q (must be an http or https URL)", cfg.Tracing.Endpoint)
+			return errors.New("invalid tracing endpoint")
+		}
+		if cfg.Tracing.BatchSize < 1 || cfg.Tracing.FlushInterval <= 0 {
+			log.Printf("Invalid tracing export settings: batch size=%d, flush interval=%v (must be positive)",
+				cfg.Tracing.BatchSize, cfg.Tracing.FlushInterval)
+			return errors.New("invalid tracing export settings")
+		}
+	}
+	if cfg.Auth.JWKSURL != "none" {
+		if u, err := url.Parse(cfg.Auth.JWKSURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			log.Printf("Invalid JWKS URL: %q (must be an http or https URL, or none)", cfg.Auth.JWKSURL)
+			return errors.New("invalid JWKS URL")
+		}
+		if cfg.Auth.JWKSRefreshInterval <= 0 {
+			log.Printf("Invalid JWKS refresh interval: %v (must be positive)", cfg.Auth.JWKSRefreshInterval)
+			return errors.New("invalid JWKS refresh interval")
+		}
+	}
+	if cfg.Auth.TokenCacheTTL < 0 || cfg.Auth.TokenCacheNegativeTTL < 0 || cfg.Auth.TokenCacheSize < 1 {
+		log.Printf("Invalid token cache settings: ttl=%v, negative ttl=%v, size=%d (TTLs must not be negative, size must be at least 1)",
+			cfg.Auth.TokenCacheTTL, cfg.Auth.TokenCacheNegativeTTL, cfg.Auth.TokenCacheSize)
+		return errors.New("invalid token cache settings")
+	}
+	if cfg.Auth.RouteDefaultAccess != "public" && cfg.Auth.RouteDefaultAccess != "authenticated" {
+		log.Printf("Invalid default route access: %q (must be public or authenticated)", cfg.Auth.RouteDefaultAccess)
+		return errors.New("invalid default route access")
+	}
+	switch cfg.AccessLog.Sink {
+	case "stdout", "file", "sqlite", "none":
+	default:
+		log.Printf("Invalid access log sink: %q (must be stdout, file, sqlite or none)", cfg.AccessLog.Sink)
+		return errors.New("invalid access log sink")
+	}
+	if cfg.AccessLog.SampleRate < 0 || cfg.AccessLog.SampleRate > 1 {
+		log.Printf("Invalid access log sample rate: %v (must be 0-1)", cfg.AccessLog.SampleRate)
+		return errors.New("invalid access log sample rate")
+	}
+	if cfg.AccessLog.Sink == "file" && (cfg.AccessLog.File == "" || cfg.AccessLog.MaxSizeMB < 1 || cfg.AccessLog.MaxBackups < 0) {
+		log.Printf("Invalid access log file settings: file=%q, max size=%dMB, max backups=%d",
+			cfg.AccessLog.File, cfg.AccessLog.MaxSizeMB, cfg.AccessLog.MaxBackups)
+		return errors.New("invalid access log file settings")
+	}
+	if cfg.AccessLog.MaxRows < 0 {
+		log.Printf("Invalid access log max rows: %d (must not be negative)", cfg.AccessLog.MaxRows)
+		return errors.New("invalid access log max rows")
+	}
+
+	// Validate default rate limit
+	if cfg.RateLimit.RequestsPerSecond < 0 || cfg.RateLimit.Burst < 0 {
+		log.Printf("Invalid rate limit: %v/s, burst %d (must not be negative)", cfg.RateLimit.RequestsPerSecond, cfg.RateLimit.Burst)
+		return errors.New("invalid rate limit")
+	}
+	switch cfg.RateLimit.Key {
+	case "ip", "user", "api_key", "service":
+	default:
+		log.Printf("Invalid rate limit key: %q (must be ip, user, api_key or service)", cfg.RateLimit.Key)
+		return errors.New("invalid rate limit key")
+	}
+
+	// Validate route config watching
+	if cfg.Routes.WatchInterval < 0 {
+		log.Printf("Invalid route config watch interval: %v (must not be negative)", cfg.Routes.WatchInterval)
+		return errors.New("invalid route config watch interval")
+	}
 
 	return nil
 }
@@ -111,6 +484,18 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvList retrieves a comma-separated environment variable or returns a
+// default value. Empty items are dropped.
+func getEnvList(key, defaultValue string) []string {
+	var items []string
+	for _, item := range strings.Split(getEnv(key, defaultValue), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // getEnvInt retrieves an integer environment variable or returns a default value.
 func getEnvInt(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
@@ -134,6 +519,29 @@ func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
 	return defaultValue
 }
 
+// getEnvFloat retrieves a floating point environment variable or returns a default value.
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatVal
+		}
+		log.Printf("Warning: invalid number value for %s: %s, using default: %v", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+// getEnvBool retrieves a boolean environment variable or returns a default value.
+// Accepts values like "true", "false", "1", "0"
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolVal, err := strconv.ParseBool(value); err == nil {
+			return boolVal
+		}
+		log.Printf("Warning: invalid boolean value for %s: %s, using default: %v", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
 // GetLogLevel returns the configured log level from HERMES_LOG_LEVEL.
 // Valid values: "debug", "info", "warn", "error"
 // Default: "info"